@@ -11,6 +11,9 @@ import (
 	fp "github.com/mundacity/flag-parser"
 	godoo "github.com/mundacity/go-doo"
 	"github.com/mundacity/go-doo/cli"
+	"github.com/mundacity/go-doo/offline"
+	"github.com/mundacity/go-doo/remote"
+	"github.com/mundacity/go-doo/sqlite"
 	"github.com/mundacity/go-doo/util"
 	lg "github.com/mundacity/quick-logger"
 	"github.com/spf13/viper"
@@ -18,15 +21,20 @@ import (
 
 // CliContext encapsulates user inputs and is passed around to execute desired operations
 type CliContext struct {
-	Config  godoo.ConfigVals
-	cmdName string
+	Config     godoo.ConfigVals
+	cmdName    string
+	subCmdName string // only used by commands like 'db' & 'srv' that group several tasks
 }
 
-func (ac *CliContext) SetupCliContext(args []string) {
+func (ac *CliContext) SetupCliContext(args []string) error {
 
 	ac.Config = godoo.ConfigVals{}
 	ac.cmdName = args[0]
 	ac.Config.Args = args[1:]
+	if (ac.cmdName == "db" || ac.cmdName == "srv") && len(args) > 1 {
+		ac.subCmdName = args[1]
+		ac.Config.Args = args[2:]
+	}
 
 	SetConfigVals()
 	ac.Config.MaxLen = viper.GetInt("MAX_LENGTH")
@@ -35,6 +43,9 @@ func (ac *CliContext) SetupCliContext(args []string) {
 	ac.Config.Instance = godoo.InstanceType(viper.GetInt("INSTANCE_TYPE"))
 	ac.Config.DateLayout = viper.GetString("DATETIME_FORMAT")
 	ac.Config.NowString = util.StringFromDate(time.Now())
+	ac.Config.ConfirmThreshold = viper.GetInt("EDIT_CONFIRM_THRESHOLD")
+	ac.Config.Templates = getTemplates()
+	ac.Config.AuthToken = viper.GetString("AUTH_TOKEN")
 
 	startLogger("cli application started...")
 	ac.SetupFlagParser()
@@ -42,23 +53,58 @@ func (ac *CliContext) SetupCliContext(args []string) {
 	tolog := []any{ac.Config.MaxLen, ac.Config.IntDigits, ac.Config.TagDelim, ac.Config.Instance, ac.Config.DateLayout}
 	s := "[MaxLen: %v, IntDigits: %v, TagDelim: %v, InstanceType: %v, DateLayout: %v]"
 
-	if ac.Config.Instance != 0 {
-		ac.Config.Client = *http.DefaultClient
+	if ac.Config.Instance == godoo.Multiple {
+		srcs := viper.GetString("MULTIPLE_SOURCES")
+		rp, err := getMultiRepo(getDbKind(viper.GetString("DB_TYPE")), srcs, viper.GetString("PRIMARY_SOURCE"), ac.Config.DateLayout, ac.Config.AuthToken)
+		if err != nil {
+			return err
+		}
+		ac.Config.TodoRepo = rp
+
+		tolog = append(tolog, srcs)
+		s = s[:len(s)-1] + ", Sources: %v]"
+		lg.Logger.Logf(lg.Info, s, tolog...)
+		return nil
+	}
+
+	if ac.Config.Instance == godoo.Remote {
 		ac.Config.RemoteUrl = fmt.Sprintf("%v:%v", viper.GetString("BASE_URL"), viper.GetInt("SERVER_PORT"))
+		ac.Config.TodoRepo = getOfflineRepo(ac.Config.RemoteUrl, ac.Config.DateLayout, ac.Config.AuthToken)
 
 		tolog = append(tolog, ac.Config.RemoteUrl)
 		s = s[:len(s)-1] + ", RemoteUrl: %v]"
 		lg.Logger.Logf(lg.Info, s, tolog...)
-		return
+		return nil
 	}
 
 	// only runs in local mode
 	ac.Config.Conn = getConn()
-	ac.Config.TodoRepo = getRepo(getDbKind(viper.GetString("DB_TYPE")), ac.Config.Conn, ac.Config.DateLayout, 0)
+	migrate := ac.cmdName != "db" // db commands decide for themselves
+	rp, err := getRepo(getDbKind(viper.GetString("DB_TYPE")), ac.Config.Conn, ac.Config.DateLayout, 0, migrate)
+	if err != nil {
+		return err
+	}
+	ac.Config.TodoRepo = rp
 
 	tolog = append(tolog, ac.Config.Conn)
 	s += ac.Config.Conn
 	lg.Logger.Logf(lg.Info, s, tolog...)
+	return nil
+}
+
+// Returns the remote repo wrapped so that adds & edits are queued locally
+// while the server can't be reached. Without the local outbox, the plain
+// remote repo is used instead. token is sent if the server requires one.
+func getOfflineRepo(url, dateLayout, token string) godoo.IRepository {
+	rp := remote.NewRepo(url, &http.Client{Timeout: viper.GetDuration("REMOTE_TIMEOUT")}, remote.WithToken(token))
+
+	path := viper.GetString("OFFLINE_DB")
+	box, err := sqlite.OpenOutbox(path, dateLayout)
+	if err != nil {
+		lg.Logger.Logf(lg.Warning, "couldn't open offline db '%v'; changes won't be queued: %v", path, err)
+		return rp
+	}
+	return offline.NewRepo(rp, box)
 }
 
 func (ac *CliContext) GetCommand() (godoo.ICommand, error) {
@@ -73,6 +119,22 @@ func (ac *CliContext) GetCommand() (godoo.ICommand, error) {
 		cmd = cli.NewGetCommand(&ac.Config)
 	case "edit":
 		cmd = cli.NewEditCommand(&ac.Config)
+	case "delete":
+		cmd = cli.NewDeleteCommand(&ac.Config)
+	case "db":
+		cmd = cli.NewDbCommand(&ac.Config, ac.subCmdName)
+	case "history":
+		cmd = cli.NewHistoryCommand(&ac.Config)
+	case "undo":
+		cmd = cli.NewUndoCommand(&ac.Config)
+	case "export":
+		cmd = cli.NewExportCommand(&ac.Config)
+	case "import":
+		cmd = cli.NewImportCommand(&ac.Config)
+	case "sync":
+		cmd = cli.NewSyncCommand(&ac.Config)
+	case "srv":
+		cmd = cli.NewSrvCommand(&ac.Config, ac.subCmdName)
 	default:
 		return nil, errors.New("invalid command")
 	}
@@ -101,6 +163,16 @@ func (ac *CliContext) getValidFlags() []fp.FlagInfo {
 		return ac.getGetFlags()
 	case "edit":
 		return ac.getEditFlags()
+	case "delete":
+		return ac.getDeleteFlags()
+	case "db":
+		return ac.getDbFlags()
+	case "history":
+		return ac.getHistoryFlags()
+	case "export":
+		return ac.getExportFlags()
+	case "import":
+		return ac.getImportFlags()
 	default:
 		return nil
 	}
@@ -118,8 +190,11 @@ func (ac *CliContext) getAddFlags() []fp.FlagInfo {
 	f5 := fp.FlagInfo{FlagName: string(godoo.Child), FlagType: fp.Integer, MaxLen: maxIntDigits}
 	f6 := fp.FlagInfo{FlagName: string(godoo.Parent), FlagType: fp.Integer, MaxLen: maxIntDigits}
 	f7 := fp.FlagInfo{FlagName: string(godoo.Date), FlagType: fp.DateTime, MaxLen: 20}
+	f8 := fp.FlagInfo{FlagName: string(godoo.Recurrence), FlagType: fp.Str, MaxLen: 12}
+	f9 := fp.FlagInfo{FlagName: string(godoo.SharedItem), FlagType: fp.Boolean, Standalone: true}
+	f10 := fp.FlagInfo{FlagName: string(godoo.PrivateItem), FlagType: fp.Boolean, Standalone: true}
 
-	ret = append(ret, f2, f3, f4, f5, f6, f7)
+	ret = append(ret, f2, f3, f4, f5, f6, f7, f8, f9, f10)
 	return ret
 }
 
@@ -134,6 +209,7 @@ func (ac *CliContext) getGetFlags() []fp.FlagInfo {
 	f2 := fp.FlagInfo{FlagName: string(godoo.ItmId), FlagType: fp.Integer, MaxLen: maxIntDigits}
 	f3 := fp.FlagInfo{FlagName: string(godoo.Next), FlagType: fp.Boolean, Standalone: true}
 	f13 := fp.FlagInfo{FlagName: string(godoo.DateMode), FlagType: fp.Boolean, Standalone: true}
+	f14 := fp.FlagInfo{FlagName: string(godoo.Tree), FlagType: fp.Integer, MaxLen: maxIntDigits}
 	f4 := fp.FlagInfo{FlagName: string(godoo.Date), FlagType: fp.DateTime, MaxLen: 21, AllowDateRange: true}
 	f5 := fp.FlagInfo{FlagName: string(godoo.Tag), FlagType: fp.Str, MaxLen: lenMax}
 	f6 := fp.FlagInfo{FlagName: string(godoo.Child), FlagType: fp.Integer, MaxLen: maxIntDigits}
@@ -142,8 +218,20 @@ func (ac *CliContext) getGetFlags() []fp.FlagInfo {
 	f10 := fp.FlagInfo{FlagName: string(godoo.All), FlagType: fp.Boolean, Standalone: true}
 	f11 := fp.FlagInfo{FlagName: string(godoo.Finished), FlagType: fp.Boolean, Standalone: true}
 	f12 := fp.FlagInfo{FlagName: string(godoo.MarkComplete), FlagType: fp.Boolean, Standalone: true}
-
-	ret = append(ret, f8, f2, f3, f4, f5, f6, f7, f9, f10, f11, f12, f13)
+	f15 := fp.FlagInfo{FlagName: string(godoo.Search), FlagType: fp.Str, MaxLen: lenMax}
+	f16 := fp.FlagInfo{FlagName: string(godoo.CompletedBetween), FlagType: fp.DateTime, MaxLen: 21, AllowDateRange: true}
+	f17 := fp.FlagInfo{FlagName: string(godoo.Format), FlagType: fp.Str, MaxLen: 6}
+	f18 := fp.FlagInfo{FlagName: string(godoo.Template), FlagType: fp.Str, MaxLen: lenMax}
+	f19 := fp.FlagInfo{FlagName: string(godoo.Sort), FlagType: fp.Str, MaxLen: lenMax}
+	f20 := fp.FlagInfo{FlagName: string(godoo.Descending), FlagType: fp.Boolean, Standalone: true}
+	f21 := fp.FlagInfo{FlagName: string(godoo.Limit), FlagType: fp.Integer, MaxLen: maxIntDigits}
+	f22 := fp.FlagInfo{FlagName: string(godoo.Offset), FlagType: fp.Integer, MaxLen: maxIntDigits}
+	f23 := fp.FlagInfo{FlagName: string(godoo.Query), FlagType: fp.Str, MaxLen: lenMax}
+	f24 := fp.FlagInfo{FlagName: string(godoo.AnyTag), FlagType: fp.Boolean, Standalone: true}
+	// a cursor holds the body of the page's last item, base64 encoded
+	f25 := fp.FlagInfo{FlagName: string(godoo.Cursor), FlagType: fp.Str, MaxLen: lenMax*2 + 100}
+
+	ret = append(ret, f8, f2, f3, f4, f5, f6, f7, f9, f10, f11, f12, f13, f14, f15, f16, f17, f18, f19, f20, f21, f22, f23, f24, f25)
 	return ret
 }
 
@@ -163,6 +251,7 @@ func (ac *CliContext) getEditFlags() []fp.FlagInfo {
 
 	f7 := fp.FlagInfo{FlagName: string(godoo.AppendMode), FlagType: fp.Boolean, Standalone: true}
 	f8 := fp.FlagInfo{FlagName: string(godoo.ReplaceMode), FlagType: fp.Boolean, Standalone: true}
+	f16 := fp.FlagInfo{FlagName: string(godoo.RemoveMode), FlagType: fp.Boolean, Standalone: true}
 
 	f9 := fp.FlagInfo{FlagName: string(godoo.ChangeBody), FlagType: fp.Str, MaxLen: lenMax}
 	f10 := fp.FlagInfo{FlagName: string(godoo.ChangeTag), FlagType: fp.Str, MaxLen: lenMax}
@@ -170,7 +259,77 @@ func (ac *CliContext) getEditFlags() []fp.FlagInfo {
 	f12 := fp.FlagInfo{FlagName: string(godoo.ChangedDeadline), FlagType: fp.DateTime, MaxLen: 20}
 	f13 := fp.FlagInfo{FlagName: string(godoo.MarkComplete), FlagType: fp.Boolean, Standalone: true}
 	f15 := fp.FlagInfo{FlagName: string(godoo.ChangeMode), FlagType: fp.Str, MaxLen: 1}
+	f17 := fp.FlagInfo{FlagName: string(godoo.Done), FlagType: fp.Boolean, Standalone: true}
+	f18 := fp.FlagInfo{FlagName: string(godoo.Undone), FlagType: fp.Boolean, Standalone: true}
+	f19 := fp.FlagInfo{FlagName: string(godoo.DryRun), FlagType: fp.Boolean, Standalone: true}
+	f20 := fp.FlagInfo{FlagName: string(godoo.Yes), FlagType: fp.Boolean, Standalone: true}
+	f21 := fp.FlagInfo{FlagName: string(godoo.SharedItem), FlagType: fp.Boolean, Standalone: true}
+	f22 := fp.FlagInfo{FlagName: string(godoo.PrivateItem), FlagType: fp.Boolean, Standalone: true}
+	f23 := fp.FlagInfo{FlagName: string(godoo.FromSource), FlagType: fp.Str, MaxLen: lenMax}
+
+	ret = append(ret, f1, f2, f3, f4, f5, f6, f7, f8, f9, f10, f11, f12, f13, f14, f15, f16, f17, f18, f19, f20, f21, f22, f23)
+	return ret
+}
+
+func (ac *CliContext) getDeleteFlags() []fp.FlagInfo {
+	var ret []fp.FlagInfo
+
+	maxIntDigits := ac.Config.IntDigits
+	lenMax := ac.Config.MaxLen
+
+	f1 := fp.FlagInfo{FlagName: string(godoo.Body), FlagType: fp.Str, MaxLen: lenMax}
+	f2 := fp.FlagInfo{FlagName: string(godoo.ItmId), FlagType: fp.Integer, MaxLen: maxIntDigits}
+	f3 := fp.FlagInfo{FlagName: string(godoo.Date), FlagType: fp.DateTime, MaxLen: 21, AllowDateRange: true}
+	f4 := fp.FlagInfo{FlagName: string(godoo.Tag), FlagType: fp.Str, MaxLen: lenMax}
+	f5 := fp.FlagInfo{FlagName: string(godoo.Child), FlagType: fp.Integer, MaxLen: maxIntDigits}
+	f6 := fp.FlagInfo{FlagName: string(godoo.Creation), FlagType: fp.DateTime, MaxLen: 21, AllowDateRange: true}
+	f7 := fp.FlagInfo{FlagName: string(godoo.Finished), FlagType: fp.Boolean, Standalone: true}
+	f8 := fp.FlagInfo{FlagName: string(godoo.FromSource), FlagType: fp.Str, MaxLen: lenMax}
+
+	ret = append(ret, f1, f2, f3, f4, f5, f6, f7, f8)
+	return ret
+}
+
+func (ac *CliContext) getDbFlags() []fp.FlagInfo {
+	var ret []fp.FlagInfo
+
+	// first so that 'godoo db backup <path>' works without the flag
+	f1 := fp.FlagInfo{FlagName: string(godoo.File), FlagType: fp.Str, MaxLen: ac.Config.MaxLen}
+	f2 := fp.FlagInfo{FlagName: string(godoo.Status), FlagType: fp.Boolean, Standalone: true}
+	f3 := fp.FlagInfo{FlagName: string(godoo.Keep), FlagType: fp.Integer, MaxLen: ac.Config.IntDigits}
+	f4 := fp.FlagInfo{FlagName: string(godoo.Yes), FlagType: fp.Boolean, Standalone: true}
+
+	ret = append(ret, f1, f2, f3, f4)
+	return ret
+}
+
+func (ac *CliContext) getHistoryFlags() []fp.FlagInfo {
+	var ret []fp.FlagInfo
+
+	f1 := fp.FlagInfo{FlagName: string(godoo.ItmId), FlagType: fp.Integer, MaxLen: ac.Config.IntDigits}
+	f2 := fp.FlagInfo{FlagName: string(godoo.FromSource), FlagType: fp.Str, MaxLen: ac.Config.MaxLen}
+
+	ret = append(ret, f1, f2)
+	return ret
+}
+
+func (ac *CliContext) getExportFlags() []fp.FlagInfo {
+	var ret []fp.FlagInfo
+
+	f1 := fp.FlagInfo{FlagName: string(godoo.Format), FlagType: fp.Str, MaxLen: 7}
+
+	ret = append(ret, f1)
+	return ret
+}
+
+func (ac *CliContext) getImportFlags() []fp.FlagInfo {
+	var ret []fp.FlagInfo
+
+	// first so that 'godoo import items.json' works without the flag
+	f1 := fp.FlagInfo{FlagName: string(godoo.File), FlagType: fp.Str, MaxLen: ac.Config.MaxLen}
+	f2 := fp.FlagInfo{FlagName: string(godoo.Format), FlagType: fp.Str, MaxLen: 7}
+	f3 := fp.FlagInfo{FlagName: string(godoo.Dedupe), FlagType: fp.Boolean, Standalone: true}
 
-	ret = append(ret, f1, f2, f3, f4, f5, f6, f7, f8, f9, f10, f11, f12, f13, f14, f15)
+	ret = append(ret, f1, f2, f3)
 	return ret
 }
@@ -3,9 +3,14 @@ package app
 import (
 	"fmt"
 	"io"
+	"net/http"
+	"runtime"
+	"strings"
 
 	godoo "github.com/mundacity/go-doo"
 	"github.com/mundacity/go-doo/cli"
+	"github.com/mundacity/go-doo/multi"
+	"github.com/mundacity/go-doo/remote"
 	"github.com/mundacity/go-doo/sqlite"
 	lg "github.com/mundacity/quick-logger"
 	"github.com/spf13/viper"
@@ -45,13 +50,11 @@ func RunCliApp(args []string, w io.Writer) int {
 func SetupCli(osArgs []string) error {
 
 	cli.CliContext = &CliContext{}
-	cli.CliContext.SetupCliContext(osArgs)
-
-	return nil
+	return cli.CliContext.SetupCliContext(osArgs)
 }
 
 // Sets up server context & logger in a similar way to SetupCli()
-func GetSrvConfig() godoo.ServerConfigVals {
+func GetSrvConfig() (godoo.ServerConfigVals, error) {
 
 	SetConfigVals()
 	cf := godoo.ServerConfigVals{}
@@ -66,15 +69,24 @@ func GetSrvConfig() godoo.ServerConfigVals {
 
 	startLogger("srv application started")
 
+	cf.BackupDir = viper.GetString("BACKUP_DIR")
+	cf.BackupInterval = viper.GetDuration("BACKUP_INTERVAL")
+	cf.BackupKeep = viper.GetInt("BACKUP_KEEP")
+	cf.AuthRequired = viper.GetBool("AUTH_REQUIRED")
+
 	pl := viper.GetBool("MAINTAIN_PRIORITY_LIST")
 	if pl {
 		cf.RunPriorityList = true
 		cf.PriorityList = godoo.NewPriorityList()
 	}
-	cf.Repo = getRepo(getDbKind(viper.GetString("DB_TYPE")), cn, dl, port)
+	rp, err := getRepo(getDbKind(viper.GetString("DB_TYPE")), cn, dl, port, true)
+	if err != nil {
+		return cf, err
+	}
+	cf.Repo = rp
 
-	lg.Logger.Logf(lg.Info, "Conn: %v\n\tDateLayout: %v\n\tPriorityList: %v\n", cn, dl, pl)
-	return cf
+	lg.Logger.Logf(lg.Info, "Conn: %v\n\tDateLayout: %v\n\tPriorityList: %v\n\tBackups: '%v' every %v\n\tAuthRequired: %v\n", cn, dl, pl, cf.BackupDir, cf.BackupInterval, cf.AuthRequired)
+	return cf, nil
 }
 
 // Set default configuration values and read from env file
@@ -89,6 +101,10 @@ func SetConfigVals() {
 	viper.SetDefault("BASE_URL", "http://localhost")
 	viper.SetDefault("LOG_FILE_PATH", "godoo-logs")
 	viper.SetDefault("MAINTAIN_PRIORITY_LIST", true)
+	viper.SetDefault("EDIT_CONFIRM_THRESHOLD", 10)
+	viper.SetDefault("BACKUP_KEEP", 7)
+	viper.SetDefault("OFFLINE_DB", "godoo-offline.db")
+	viper.SetDefault("REMOTE_TIMEOUT", "10s")
 
 	viper.SetConfigName("env-cli")
 	viper.SetConfigType("env")
@@ -107,6 +123,18 @@ func getConn() string {
 	}
 }
 
+// Returns the named output templates from the config. TEMPLATE_SHORT
+// is available to 'get --template' as 'short'.
+func getTemplates() map[string]string {
+	ret := make(map[string]string)
+	for _, k := range viper.AllKeys() {
+		if name := strings.TrimPrefix(k, "template_"); name != k && name != "" {
+			ret[name] = viper.GetString(k)
+		}
+	}
+	return ret
+}
+
 // Starts a quick logger that can be used throughout the system
 func startLogger(msg string) {
 	enable := viper.GetBool("ENABLE_LOGGING")
@@ -135,15 +163,78 @@ func getDbKind(k string) godoo.DbType {
 	}
 }
 
-// Returns instantiated repo interface that
-// is used when communicating with the database
-func getRepo(dbKind godoo.DbType, connStr, dateLayout string, port int) godoo.IRepository {
+// Returns instantiated repo interface that is used when communicating
+// with the database. Pending schema migrations are applied if migrate is true.
+func getRepo(dbKind godoo.DbType, connStr, dateLayout string, port int, migrate bool) (godoo.IRepository, error) {
 	lg.Logger.Logf(lg.Info, "Port: %v", port)
 	switch dbKind {
 	case godoo.Sqlite:
-		return sqlite.SetupRepo(connStr, dbKind, dateLayout, port)
+		var r *sqlite.Repo
+		var err error
+		if migrate {
+			r, err = sqlite.SetupRepo(connStr, dbKind, dateLayout, port)
+		} else {
+			r, err = sqlite.OpenRepo(connStr, dbKind, dateLayout, port)
+		}
+
+		if err != nil {
+			lg.Logger.LogWithCallerInfo(lg.Error, fmt.Sprintf("repo set up failed: %v", err), runtime.Caller)
+			return nil, &StartupError{Err: err}
+		}
+		return r, nil
 	}
 
 	lg.Logger.Log(lg.Warning, "repo wasn't set up properly")
-	return nil
+	return nil, &StartupError{Err: fmt.Errorf("unsupported db type: %v", dbKind)}
+}
+
+// Returns a repo that fans out to every source listed in srcs.
+// Sources are comma separated name=location pairs, where a
+// location starting with http(s):// is a remote server and
+// anything else is a path to a local db, e.g.
+// "personal=/path/to/go-doo.db,lan=http://192.168.0.123:8080".
+// token is sent to every remote server.
+func getMultiRepo(dbKind godoo.DbType, srcs, primary, dateLayout, token string) (godoo.IRepository, error) {
+	var sources []multi.Source
+
+	for _, src := range strings.Split(srcs, ",") {
+		name, loc, found := strings.Cut(strings.TrimSpace(src), "=")
+		if !found || name == "" || loc == "" {
+			lg.Logger.Logf(lg.Warning, "ignoring malformed source: '%v'", src)
+			continue
+		}
+
+		var rp godoo.IRepository
+		if strings.HasPrefix(loc, "http://") || strings.HasPrefix(loc, "https://") {
+			rp = remote.NewRepo(loc, &http.Client{Timeout: viper.GetDuration("REMOTE_TIMEOUT")}, remote.WithToken(token))
+		} else {
+			var err error
+			rp, err = getRepo(dbKind, loc, dateLayout, 0, true)
+			if err != nil {
+				return nil, err
+			}
+		}
+		sources = append(sources, multi.Source{Name: name, Repo: rp})
+	}
+
+	rp, err := multi.NewRepo(primary, sources...)
+	if err != nil {
+		lg.Logger.Logf(lg.Error, "multiple sources set up failed: %v", err)
+		return nil, &StartupError{Err: err}
+	}
+	return rp, nil
+}
+
+// Returned when the app can't get going, e.g. because
+// the db in the connection string can't be opened
+type StartupError struct {
+	Err error
+}
+
+func (s *StartupError) Error() string {
+	return fmt.Sprintf("startup failed: %v", s.Err)
+}
+
+func (s *StartupError) Unwrap() error {
+	return s.Err
 }
@@ -0,0 +1,71 @@
+package godoo
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+// An auth token for the server, as listed by 'godoo srv token'.
+// The token itself is only known when it's created.
+type Token struct {
+	Id        int       `json:"id"`
+	Owner     string    `json:"owner"`
+	CreatedAt time.Time `json:"createdAt"`
+	RevokedAt time.Time `json:"revokedAt"` // zero unless revoked
+}
+
+// Implemented by repositories that keep the server's auth tokens
+type ITokenStore interface {
+	// Returns the new token, which can't be read back later
+	CreateToken(owner string) (Token, string, error)
+	RevokeToken(id int) error
+	Tokens() ([]Token, error)
+	// Returns the owner of token, or an *InvalidTokenError if it
+	// doesn't exist or has been revoked
+	TokenOwner(token string) (string, error)
+}
+
+// Header remote clients send their token in, as 'Bearer <token>'
+const AuthHeader = "Authorization"
+
+// Returns the value of the auth header for token
+func BearerToken(token string) string {
+	return "Bearer " + token
+}
+
+// Reads the token out of the value of an auth header,
+// returning an empty string if there isn't one
+func ParseBearerToken(hdr string) string {
+	scheme, token, found := strings.Cut(strings.TrimSpace(hdr), " ")
+	if !found || !strings.EqualFold(scheme, "Bearer") {
+		return ""
+	}
+	return strings.TrimSpace(token)
+}
+
+// Returned when a request to a server requiring auth tokens
+// doesn't have a valid one
+type InvalidTokenError struct{}
+
+func (e *InvalidTokenError) Error() string {
+	return "missing, unknown or revoked auth token"
+}
+
+// Returned when revoking a token that doesn't exist
+type TokenNotFoundError struct {
+	Id int
+}
+
+func (e *TokenNotFoundError) Error() string {
+	return fmt.Sprintf("no token with id %v", e.Id)
+}
+
+// Returned when an owner name can't be used for a token
+type InvalidOwnerError struct {
+	Owner string
+}
+
+func (e *InvalidOwnerError) Error() string {
+	return fmt.Sprintf("invalid owner '%v'; use letters, numbers, '.', '_', '-' or '@'", e.Owner)
+}
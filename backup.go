@@ -0,0 +1,74 @@
+package godoo
+
+import (
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Snapshots are named after the time they were taken, e.g.
+// go-doo-20220601-153000.db, so they sort oldest first
+const (
+	snapshotPrefix = "go-doo-"
+	snapshotExt    = ".db"
+	snapshotLayout = "20060102-150405"
+)
+
+// Returns the file name of a snapshot taken at t
+func SnapshotName(t time.Time) string {
+	return snapshotPrefix + t.UTC().Format(snapshotLayout) + snapshotExt
+}
+
+// Backs up to a new snapshot in dir, then removes all but the newest keep
+// snapshots there. keep <= 0 keeps every snapshot. Returns the path of the
+// new snapshot & those of any that were removed.
+func TakeSnapshot(b IBackuper, dir string, keep int, t time.Time) (string, []string, error) {
+	path := filepath.Join(dir, SnapshotName(t))
+	if err := b.Backup(path); err != nil {
+		return "", nil, err
+	}
+
+	removed, err := PruneSnapshots(dir, keep)
+	return path, removed, err
+}
+
+// Removes all but the newest keep snapshots in dir. Other files are left alone.
+func PruneSnapshots(dir string, keep int) ([]string, error) {
+	if keep <= 0 {
+		return nil, nil
+	}
+
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	var snaps []string
+	for _, e := range entries {
+		if !e.IsDir() && isSnapshot(e.Name()) {
+			snaps = append(snaps, e.Name())
+		}
+	}
+	sort.Strings(snaps)
+
+	var removed []string
+	for len(snaps) > keep {
+		path := filepath.Join(dir, snaps[0])
+		if err = os.Remove(path); err != nil {
+			return removed, err
+		}
+		removed = append(removed, path)
+		snaps = snaps[1:]
+	}
+	return removed, nil
+}
+
+func isSnapshot(name string) bool {
+	if !strings.HasPrefix(name, snapshotPrefix) || !strings.HasSuffix(name, snapshotExt) {
+		return false
+	}
+	_, err := time.Parse(snapshotLayout, strings.TrimSuffix(strings.TrimPrefix(name, snapshotPrefix), snapshotExt))
+	return err == nil
+}
@@ -0,0 +1,31 @@
+package godoo
+
+// Adds itms in order & returns their new ids. parents[i] is the position
+// in itms of item i's parent, which has to come before it, or -1 to keep
+// the item's own ParentId. Repos that can't add items in one go have them
+// added one at a time, so a failure part way leaves the earlier ones added.
+func AddAll(rp IRepository, itms []TodoItem, parents []int) ([]int64, error) {
+	if b, ok := rp.(IBatchAdder); ok {
+		return b.AddAll(itms, parents)
+	}
+
+	var ids []int64
+	for i := range itms {
+		itm := SetBatchParent(itms[i], parents[i], ids)
+		id, err := rp.Add(&itm)
+		if err != nil {
+			return ids, err
+		}
+		ids = append(ids, id)
+	}
+	return ids, nil
+}
+
+// Returns itm with its parent set to the item at position parent in the
+// batch, using the ids of those added so far
+func SetBatchParent(itm TodoItem, parent int, ids []int64) TodoItem {
+	if parent >= 0 {
+		itm.ParentId, itm.IsChild = int(ids[parent]), true
+	}
+	return itm
+}
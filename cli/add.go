@@ -1,12 +1,10 @@
 package cli
 
 import (
-	"bytes"
-	"encoding/json"
+	"errors"
 	"flag"
 	"fmt"
 	"io"
-	"net/http"
 	"runtime"
 	"strings"
 	"time"
@@ -26,6 +24,9 @@ type AddCommand struct {
 	childOf      int    //child of the int argument
 	parentOf     int    //parent of the int argument
 	deadlineDate string
+	recurrence   string //repeat rule, e.g. '1w'
+	shared       bool   //who can see the item on servers requiring auth tokens
+	private      bool
 }
 
 // Returns a new AddCommand, but also sets up the flagset and parser
@@ -51,6 +52,9 @@ func (aCmd *AddCommand) setupFlagSet() {
 	aCmd.fs.IntVar(&aCmd.childOf, strings.Trim(string(godoo.Child), "-"), 0, "make item a child of another item")
 	aCmd.fs.IntVar(&aCmd.parentOf, strings.Trim(string(godoo.Parent), "-"), 0, "make item a parent of another item")
 	aCmd.fs.StringVar(&aCmd.deadlineDate, strings.Trim(string(godoo.Date), "-"), "", "when item needs to be completed by")
+	aCmd.fs.StringVar(&aCmd.recurrence, strings.Trim(string(godoo.Recurrence), "-"), "", "how often the item repeats once completed, e.g. 1d, 1w, 1m")
+	aCmd.fs.BoolVar(&aCmd.shared, strings.Trim(string(godoo.SharedItem), "-"), false, "let everyone using the server see the item")
+	aCmd.fs.BoolVar(&aCmd.private, strings.Trim(string(godoo.PrivateItem), "-"), false, "only let you see the item (the server's default)")
 }
 
 // ParseInput implements method from ICommand interface
@@ -70,20 +74,26 @@ func (aCmd *AddCommand) ParseInput() error {
 // Run implements method from ICommand interface
 func (aCmd *AddCommand) Run(w io.Writer) error {
 
-	td, _ := aCmd.BuildItemFromInput()
-
-	if aCmd.conf.Instance == godoo.Remote {
-		return aCmd.remoteAdd(w, td)
+	td, err := aCmd.BuildItemFromInput()
+	if err != nil {
+		lg.Logger.LogWithCallerInfo(lg.Error, fmt.Sprintf("error while interpreting user input: %v", err), runtime.Caller)
+		return err
 	}
 
 	id, err := aCmd.conf.TodoRepo.Add(&td)
+	var q *godoo.QueuedError
+	if errors.As(err, &q) {
+		printQueuedMessage(w)
+		lg.Logger.Logf(lg.Warning, "item queued: %v", err)
+		return nil
+	}
 	if err != nil {
 		lg.Logger.LogWithCallerInfo(lg.Error, fmt.Sprintf("failed to add item: %v", err), runtime.Caller)
 		return err
 	}
 
 	printAddMessage(int(id), w)
-	lg.Logger.Log(lg.Info, "local item successfully added")
+	lg.Logger.Log(lg.Info, "item successfully added")
 
 	return nil
 }
@@ -113,51 +123,27 @@ func (aCmd *AddCommand) BuildItemFromInput() (godoo.TodoItem, error) {
 		return td, &InvalidArgumentError{}
 	}
 
-	td.Body = aCmd.body
-	td.CreationDate, _ = time.Parse(aCmd.conf.DateLayout, aCmd.conf.DateLayout)
-	td.ParentId = aCmd.childOf
-
-	parseTagInput(&td, aCmd.tagInput, aCmd.conf.TagDelim)
-	return td, nil
-}
-
-func (aCmd *AddCommand) remoteAdd(w io.Writer, td godoo.TodoItem) error {
-
-	// --> very happy path; need to test
-	baseUrl := aCmd.conf.RemoteUrl + "/add"
-
-	body, err := json.Marshal(td)
-	if err != nil {
-		lg.Logger.LogWithCallerInfo(lg.Error, fmt.Sprintf("json marshalling error: %v", err), runtime.Caller)
-		return err
+	if aCmd.shared && aCmd.private {
+		return td, &InvalidArgumentError{}
 	}
-
-	rq, err := http.NewRequest("POST", baseUrl, bytes.NewBuffer(body))
-	if err != nil {
-		lg.Logger.LogWithCallerInfo(lg.Error, fmt.Sprintf("request generation error: %v", err), runtime.Caller)
-		return err
+	if aCmd.shared {
+		td.Visibility = godoo.Shared
 	}
-	rq.Header.Set("content-type", "application/json")
-
-	resp, err := aCmd.conf.Client.Do(rq)
-	if err != nil {
-		lg.Logger.LogWithCallerInfo(lg.Error, fmt.Sprintf("error receiving response: %v", err), runtime.Caller)
-		return err
+	if aCmd.private {
+		td.Visibility = godoo.Private
 	}
-	defer resp.Body.Close()
-
-	var i int64
 
-	d := json.NewDecoder(resp.Body)
-	d.DisallowUnknownFields()
-	if err = d.Decode(&i); err != nil {
-		lg.Logger.LogWithCallerInfo(lg.Error, fmt.Sprintf("json decoding error: %v", err), runtime.Caller)
+	td.Body = aCmd.body
+	td.CreationDate, _ = time.Parse(aCmd.conf.DateLayout, aCmd.conf.DateLayout)
+	if err := td.SetParent(aCmd.childOf); err != nil {
+		return td, err
+	}
+	if err := td.SetRecurrence(aCmd.recurrence); err != nil {
+		return td, err
 	}
 
-	printAddMessage(int(i), w)
-	lg.Logger.Log(lg.Info, "remote item successfully added")
-
-	return nil
+	parseTagInput(&td, aCmd.tagInput, aCmd.conf.TagDelim)
+	return td, nil
 }
 
 // helper to parse delimited tag input;
@@ -66,6 +66,24 @@ func _getTestCases() []add_test_case {
 		err:      &InvalidArgumentError{},
 		name:     "invalid priority arg",
 		envVal:   0,
+	}, {
+		args:     []string{"add", "-b", "weekly report", "-t", "work", "-r", "1w"},
+		expected: godoo.TodoItem{Body: "weekly report", Priority: godoo.None, Tags: _getTagMap("work", "*"), Recurrence: "1w"},
+		err:      nil,
+		name:     "recurring item",
+		envVal:   0,
+	}, {
+		args:     []string{"add", "-b", "team offsite", "--shared"},
+		expected: godoo.TodoItem{Body: "team offsite", Priority: godoo.None, Visibility: godoo.Shared},
+		err:      nil,
+		name:     "shared item",
+		envVal:   0,
+	}, {
+		args:     []string{"add", "-b", "team offsite", "--shared", "--private"},
+		expected: godoo.TodoItem{Body: "team offsite", Priority: godoo.None},
+		err:      &InvalidArgumentError{},
+		name:     "shared & private",
+		envVal:   0,
 	}}
 }
 
@@ -140,6 +158,12 @@ func compareTestResults(expected, got godoo.TodoItem) (bool, string) {
 	if expected.Id != got.Id {
 		return false, fmt.Sprintf("id doesn't match. Expected '%v', got '%v'", expected.Id, got.Id)
 	}
+	if expected.Recurrence != got.Recurrence {
+		return false, fmt.Sprintf("recurrence doesn't match. Expected '%v', got '%v'", expected.Recurrence, got.Recurrence)
+	}
+	if expected.Visibility != got.Visibility {
+		return false, fmt.Sprintf("visibility doesn't match. Expected '%v', got '%v'", expected.Visibility, got.Visibility)
+	}
 
 	for s := range expected.Tags {
 
@@ -1,5 +1,10 @@
 package cli
 
+import (
+	"fmt"
+	"strings"
+)
+
 type InstanceTypeNotRecognised struct{}
 
 type UnableToDetermineQueryTypeError struct{}
@@ -14,8 +19,55 @@ func (n *NoEditInstructionsError) Error() string {
 	return "no edit instructions/uppercase flags provided "
 }
 
+type NoSearchInstructionsError struct{}
+
+func (n *NoSearchInstructionsError) Error() string {
+	return "no search instructions/lowercase flags provided"
+}
+
 type InvalidArgumentError struct{}
 
 func (i *InvalidArgumentError) Error() string {
 	return "argument not allowed"
 }
+
+type LocalOnlyError struct{}
+
+func (l *LocalOnlyError) Error() string {
+	return "command only available when using local storage"
+}
+
+type UnknownFormatError struct {
+	Format  string
+	Allowed []outputFormat
+}
+
+func (u *UnknownFormatError) Error() string {
+	var fs []string
+	for _, f := range u.Allowed {
+		fs = append(fs, string(f))
+	}
+	return fmt.Sprintf("unknown format '%v'; use %v", u.Format, strings.Join(fs, ", "))
+}
+
+type HistoryUnavailableError struct{}
+
+func (h *HistoryUnavailableError) Error() string {
+	return "change history not available for this storage option"
+}
+
+// Returned when an item in an import file can't be read
+type ImportReadError struct {
+	Item int // 1-based position in the file
+	Err  error
+}
+
+func (i *ImportReadError) Error() string {
+	return fmt.Sprintf("can't read item %v: %v", i.Item, i.Err)
+}
+
+type RemoteOnlyError struct{}
+
+func (r *RemoteOnlyError) Error() string {
+	return "command only available when using remote storage"
+}
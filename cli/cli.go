@@ -21,6 +21,32 @@ const (
 	high     priorityMode = "h"
 )
 
+// Machine-readable alternatives to the default coloured output of 'get'
+type outputFormat string
+
+const (
+	jsonFormat    outputFormat = "json"
+	ndjsonFormat  outputFormat = "ndjson" // one object per line
+	csvFormat     outputFormat = "csv"
+	tsvFormat     outputFormat = "tsv"
+	todoTxtFormat outputFormat = "todotxt" // export & import only
+)
+
+// Formats 'get' can write
+var itemFormats = []outputFormat{jsonFormat, ndjsonFormat, csvFormat, tsvFormat}
+
+// Formats 'export' can write & 'import' can read
+var transferFormats = []outputFormat{jsonFormat, ndjsonFormat, csvFormat, tsvFormat, todoTxtFormat}
+
+func isFormatIn(f outputFormat, fs []outputFormat) bool {
+	for _, x := range fs {
+		if f == x {
+			return true
+		}
+	}
+	return false
+}
+
 // if user is using a date range, get the upper bound of that range
 func getUpperDateBound(dateText string, dateLayout string) time.Time {
 	splt := splitDates(dateText)
@@ -36,3 +62,13 @@ func getUpperDateBound(dateText string, dateLayout string) time.Time {
 func splitDates(s string) []string {
 	return strings.Split(s, ":")
 }
+
+// Narrows rp down to the source called name, when rp is made up of
+// several & one was asked for
+func pickSource(rp godoo.IRepository, name string) (godoo.IRepository, error) {
+	p, ok := rp.(godoo.ISourcePicker)
+	if !ok || name == "" {
+		return rp, nil
+	}
+	return p.Source(name)
+}
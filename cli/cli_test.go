@@ -2,7 +2,6 @@ package cli
 
 import (
 	"errors"
-	"net/http"
 	"time"
 
 	godoo "github.com/mundacity/go-doo"
@@ -20,7 +19,7 @@ type FakeAppContext struct {
 type FakeParser struct {
 }
 
-func (a *FakeAppContext) SetupCliContext(args []string) {
+func (a *FakeAppContext) SetupCliContext(args []string) error {
 	a.Config = godoo.ConfigVals{}
 	a.cmdName = args[0]
 	a.Config.Args = args[1:]
@@ -39,9 +38,9 @@ func (a *FakeAppContext) SetupCliContext(args []string) {
 	a.SetupFlagParser()
 	lg.Logger = lg.NewDummyLogger()
 
-	a.Config.Client = *http.DefaultClient
 	a.Config.RemoteUrl = ""
 	a.Config.Conn = ""
+	return nil
 }
 
 func (a *FakeAppContext) GetCommand() (godoo.ICommand, error) {
@@ -55,6 +54,18 @@ func (a *FakeAppContext) GetCommand() (godoo.ICommand, error) {
 		cmd = NewGetCommand(&a.Config)
 	case "edit":
 		cmd = NewEditCommand(&a.Config)
+	case "delete":
+		cmd = NewDeleteCommand(&a.Config)
+	case "history":
+		cmd = NewHistoryCommand(&a.Config)
+	case "undo":
+		cmd = NewUndoCommand(&a.Config)
+	case "export":
+		cmd = NewExportCommand(&a.Config)
+	case "import":
+		cmd = NewImportCommand(&a.Config)
+	case "sync":
+		cmd = NewSyncCommand(&a.Config)
 	default:
 		return nil, errors.New("invalid command")
 	}
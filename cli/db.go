@@ -0,0 +1,207 @@
+package cli
+
+import (
+	"bufio"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"runtime"
+	"strings"
+	"time"
+
+	godoo "github.com/mundacity/go-doo"
+	lg "github.com/mundacity/quick-logger"
+)
+
+// DbCommand implements the ICommand interface and groups together
+// maintenance tasks that work directly on the database, e.g. 'db migrate'
+type DbCommand struct {
+	conf   *godoo.ConfigVals
+	fs     *flag.FlagSet
+	subCmd string
+	status bool
+	file   string    // backup to write or restore from
+	keep   int       // snapshots kept when backing up to a directory
+	yes    bool      // skip confirmation
+	input  io.Reader // where confirmation is read from; stdin if nil
+}
+
+// Returns a new DbCommand for the subcommand passed, after setting up the flagset
+func NewDbCommand(conf *godoo.ConfigVals, subCmd string) *DbCommand {
+	dbCmd := DbCommand{}
+	dbCmd.conf = conf
+	dbCmd.subCmd = subCmd
+	lg.Logger.Logf(lg.Info, "db command created (%v)", subCmd)
+
+	dbCmd.setupFlagSet()
+
+	return &dbCmd
+}
+
+// Describes the flags and argument types associated with the command
+func (dbCmd *DbCommand) setupFlagSet() {
+	dbCmd.fs = flag.NewFlagSet("db", flag.ContinueOnError)
+	dbCmd.fs.BoolVar(&dbCmd.status, strings.Trim(string(godoo.Status), "-"), false, "show applied & pending migrations without applying anything")
+	dbCmd.fs.StringVar(&dbCmd.file, strings.Trim(string(godoo.File), "-"), "", "backup file, or a directory to add a snapshot to")
+	dbCmd.fs.IntVar(&dbCmd.keep, strings.Trim(string(godoo.Keep), "-"), 0, "snapshots to keep in the backup directory; 0 keeps them all")
+	dbCmd.fs.BoolVar(&dbCmd.yes, strings.Trim(string(godoo.Yes), "-"), false, "don't ask before restoring")
+}
+
+// ParseInput implements method from ICommand interface. Backup
+// & restore take the file without --file, e.g. 'db backup <path>'.
+func (dbCmd *DbCommand) ParseInput() error {
+	newArgs, err := dbCmd.conf.Parser.ParseUserInput()
+
+	if err != nil {
+		lg.Logger.LogWithCallerInfo(lg.Error, fmt.Sprintf("user input parsing error: %v", err), runtime.Caller)
+		return err
+	}
+
+	dbCmd.conf.Args = newArgs
+	lg.Logger.Log(lg.Info, "successfully parsed user input")
+	if err = dbCmd.fs.Parse(dbCmd.conf.Args); err != nil {
+		return err
+	}
+
+	if dbCmd.file == "" && dbCmd.fs.NArg() > 0 {
+		dbCmd.file = dbCmd.fs.Arg(0)
+		return dbCmd.fs.Parse(dbCmd.fs.Args()[1:])
+	}
+	return nil
+}
+
+// Implements ICommand Run() method
+func (dbCmd *DbCommand) Run(w io.Writer) error {
+	switch dbCmd.subCmd {
+	case "migrate":
+		return dbCmd.runMigrate(w)
+	case "backup":
+		return dbCmd.runBackup(w)
+	case "restore":
+		return dbCmd.runRestore(w)
+	default:
+		lg.Logger.Logf(lg.Error, "unknown db subcommand: '%v'", dbCmd.subCmd)
+		return &InvalidArgumentError{}
+	}
+}
+
+// Not used by db subcommands; implemented to satisfy ICommand
+func (dbCmd *DbCommand) BuildItemFromInput() (godoo.TodoItem, error) {
+	return *godoo.NewTodoItem(godoo.WithPriorityLevel(godoo.None)), nil
+}
+
+// Applies pending migrations, or just lists them if --status passed
+func (dbCmd *DbCommand) runMigrate(w io.Writer) error {
+	mg, ok := dbCmd.conf.TodoRepo.(godoo.IMigrator)
+	if !ok {
+		lg.Logger.LogWithCallerInfo(lg.Error, "repo doesn't support migrations", runtime.Caller)
+		return &LocalOnlyError{}
+	}
+
+	if !dbCmd.status {
+		n, err := mg.Migrate()
+		if err != nil {
+			lg.Logger.LogWithCallerInfo(lg.Error, fmt.Sprintf("migration failed: %v", err), runtime.Caller)
+			return err
+		}
+		lg.Logger.Logf(lg.Info, "%v migration/s applied", n)
+		printMigrateMessage(n, w)
+	}
+
+	infos, err := mg.MigrationStatus()
+	if err != nil {
+		lg.Logger.LogWithCallerInfo(lg.Error, fmt.Sprintf("couldn't get migration status: %v", err), runtime.Caller)
+		return err
+	}
+
+	w.Write([]byte(buildMigrationOutput(infos)))
+	return nil
+}
+
+// Returns the repo as a backuper, after checking a single file was given
+func (dbCmd *DbCommand) getBackuper() (godoo.IBackuper, error) {
+	if dbCmd.file == "" || dbCmd.fs.NArg() > 0 {
+		lg.Logger.LogWithCallerInfo(lg.Error, fmt.Sprintf("expected a single file, got '%v' & %v", dbCmd.file, dbCmd.fs.Args()), runtime.Caller)
+		return nil, &InvalidArgumentError{}
+	}
+
+	b, ok := dbCmd.conf.TodoRepo.(godoo.IBackuper)
+	if !ok {
+		lg.Logger.LogWithCallerInfo(lg.Error, "repo doesn't support backups", runtime.Caller)
+		return nil, &LocalOnlyError{}
+	}
+	return b, nil
+}
+
+// Copies the db to a file, or to a new snapshot if the path is a
+// directory, in which case only the newest --keep snapshots are kept
+func (dbCmd *DbCommand) runBackup(w io.Writer) error {
+	b, err := dbCmd.getBackuper()
+	if err != nil {
+		return err
+	}
+
+	path := dbCmd.file
+	var removed []string
+	if fi, statErr := os.Stat(path); statErr == nil && fi.IsDir() {
+		path, removed, err = godoo.TakeSnapshot(b, path, dbCmd.keep, time.Now())
+	} else {
+		err = b.Backup(path)
+	}
+
+	if err != nil {
+		lg.Logger.LogWithCallerInfo(lg.Error, fmt.Sprintf("backup failed: %v", err), runtime.Caller)
+		return err
+	}
+
+	lg.Logger.Logf(lg.Info, "backed up to %v; removed %v old snapshot/s", path, len(removed))
+	printBackupMessage(path, len(removed), w)
+	return nil
+}
+
+// Replaces the db with a backup, once the user has confirmed
+func (dbCmd *DbCommand) runRestore(w io.Writer) error {
+	b, err := dbCmd.getBackuper()
+	if err != nil {
+		return err
+	}
+
+	if !dbCmd.yes {
+		if err = dbCmd.confirm(w); err != nil {
+			return err
+		}
+	}
+
+	if err = b.Restore(dbCmd.file); err != nil {
+		lg.Logger.LogWithCallerInfo(lg.Error, fmt.Sprintf("restore failed: %v", err), runtime.Caller)
+		return err
+	}
+
+	lg.Logger.Logf(lg.Info, "restored from %v", dbCmd.file)
+	printRestoreMessage(dbCmd.file, w)
+	return nil
+}
+
+// Warns the user that restoring replaces everything & waits for a yes
+func (dbCmd *DbCommand) confirm(w io.Writer) error {
+	w.Write([]byte(fmt.Sprintf("Replace every item with those in '%v'? (y/N)\n", dbCmd.file)))
+
+	lg.Logger.Log(lg.Info, "user asked to confirm restore")
+
+	in := dbCmd.input
+	if in == nil {
+		in = os.Stdin
+	}
+	choice, _, err := bufio.NewReader(in).ReadRune()
+	if err != nil {
+		lg.Logger.LogWithCallerInfo(lg.Error, fmt.Sprintf("error receiving confirmation: %v", err), runtime.Caller)
+	}
+
+	if choice != 'y' && choice != 'Y' {
+		lg.Logger.Logf(lg.Warning, "restore not confirmed: %v", choice)
+		return errors.New("cancelling operation")
+	}
+	return nil
+}
@@ -0,0 +1,138 @@
+package cli
+
+import (
+	"bytes"
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	godoo "github.com/mundacity/go-doo"
+	lg "github.com/mundacity/quick-logger"
+)
+
+// writes an empty file for each backup & remembers what was restored
+type backupRepo struct {
+	godoo.IRepository
+	restored *string
+}
+
+func (b backupRepo) Backup(path string) error {
+	return os.WriteFile(path, nil, 0644)
+}
+
+func (b backupRepo) Restore(path string) error {
+	*b.restored = path
+	return nil
+}
+
+type db_backup_test_case struct {
+	subCmd      string
+	args        []string // '{dir}' is replaced with a temporary directory
+	input       string   // answer to the confirmation prompt
+	repo        godoo.IRepository
+	expOut      []string
+	expFiles    int // files in the directory afterwards
+	expRestored bool
+	expErr      error
+	name        string
+}
+
+func getDbBackupTestCases() []db_backup_test_case {
+	old := godoo.SnapshotName(time.Date(2022, 6, 1, 9, 0, 0, 0, time.UTC))
+	return []db_backup_test_case{{
+		subCmd:   "backup",
+		args:     []string{"{dir}/copy.db"},
+		expOut:   []string{"Backed up to", "copy.db"},
+		expFiles: 2,
+		name:     "backup to a file",
+	}, {
+		subCmd:   "backup",
+		args:     []string{"{dir}", "--keep", "1"},
+		expOut:   []string{"Backed up to", "removed 1 old snapshot"},
+		expFiles: 1,
+		name:     "backup to a directory keeps the newest snapshots",
+	}, {
+		subCmd:      "restore",
+		args:        []string{"{dir}/" + old},
+		input:       "y",
+		expOut:      []string{"Replace every item", "Restored from"},
+		expRestored: true,
+		name:        "restore once confirmed",
+	}, {
+		subCmd: "restore",
+		args:   []string{"{dir}/" + old},
+		input:  "n",
+		expErr: errors.New("cancelling operation"),
+		name:   "restore not confirmed",
+	}, {
+		subCmd:      "restore",
+		args:        []string{"--yes", "{dir}/" + old},
+		expRestored: true,
+		name:        "restore without asking",
+	}, {
+		subCmd: "backup",
+		expErr: &InvalidArgumentError{},
+		name:   "no file",
+	}, {
+		subCmd: "backup",
+		args:   []string{"{dir}/copy.db"},
+		repo:   historyRepo{},
+		expErr: &LocalOnlyError{},
+		name:   "repo without backups",
+	}}
+}
+
+func TestDbBackupCommands(t *testing.T) {
+	lg.Logger = lg.NewDummyLogger()
+	tcs := getDbBackupTestCases()
+	for _, tc := range tcs {
+		t.Run(tc.name, func(t *testing.T) {
+			runDbBackupTest(t, tc)
+		})
+	}
+}
+
+func runDbBackupTest(t *testing.T, tc db_backup_test_case) {
+	dir := t.TempDir()
+	old := godoo.SnapshotName(time.Date(2022, 6, 1, 9, 0, 0, 0, time.UTC))
+	os.WriteFile(filepath.Join(dir, old), nil, 0644)
+
+	fakeArgs = nil
+	for _, a := range tc.args {
+		fakeArgs = append(fakeArgs, strings.ReplaceAll(a, "{dir}", dir))
+	}
+
+	var restored string
+	if tc.repo == nil {
+		tc.repo = backupRepo{restored: &restored}
+	}
+	conf := godoo.ConfigVals{TodoRepo: tc.repo, Parser: &FakeParser{}}
+	dbCmd := NewDbCommand(&conf, tc.subCmd)
+	dbCmd.input = strings.NewReader(tc.input)
+
+	var b bytes.Buffer
+	err := dbCmd.ParseInput()
+	if err == nil {
+		err = dbCmd.Run(&b)
+	}
+
+	if (err == nil) != (tc.expErr == nil) || (err != nil && reflect.TypeOf(err) != reflect.TypeOf(tc.expErr)) {
+		t.Errorf(">>>>FAILED (err): expected '%v', got '%v'", tc.expErr, err)
+	}
+	for _, o := range tc.expOut {
+		if !strings.Contains(b.String(), o) {
+			t.Errorf(">>>>FAILED: expected output to contain '%v', got '%v'", o, b.String())
+		}
+	}
+	if (restored != "") != tc.expRestored {
+		t.Errorf(">>>>FAILED: expected restore: %v, got '%v'", tc.expRestored, restored)
+	}
+
+	if entries, _ := os.ReadDir(dir); tc.expFiles != 0 && len(entries) != tc.expFiles {
+		t.Errorf(">>>>FAILED: expected %v files, got %v", tc.expFiles, len(entries))
+	}
+}
@@ -0,0 +1,170 @@
+package cli
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"runtime"
+	"strings"
+	"time"
+
+	godoo "github.com/mundacity/go-doo"
+	lg "github.com/mundacity/quick-logger"
+)
+
+// DeleteCommand implements the ICommand interface and lets the user remove
+// items from storage. Searching works in the same way as the edit command.
+type DeleteCommand struct {
+	conf         *godoo.ConfigVals
+	fs           *flag.FlagSet
+	id           int
+	body         string
+	childOf      int
+	deadline     string
+	creationDate string
+	tagInput     string
+	complete     bool
+	source       string
+}
+
+// Sets up flag info & parser before returning a new delete command
+func NewDeleteCommand(conf *godoo.ConfigVals) *DeleteCommand {
+	dCmd := DeleteCommand{}
+	dCmd.conf = conf
+	lg.Logger.Log(lg.Info, "delete command created")
+
+	dCmd.setupFlagSet()
+
+	return &dCmd
+}
+
+// Describes the flags and argument types associated with the command
+func (dCmd *DeleteCommand) setupFlagSet() {
+
+	dCmd.fs = flag.NewFlagSet("delete", flag.ContinueOnError)
+
+	dCmd.fs.IntVar(&dCmd.id, strings.Trim(string(godoo.ItmId), "-"), 0, "delete item by id")
+	dCmd.fs.IntVar(&dCmd.childOf, strings.Trim(string(godoo.Child), "-"), 0, "delete items by parentId - i.e. child of id passed")
+	dCmd.fs.StringVar(&dCmd.deadline, strings.Trim(string(godoo.Date), "-"), "", "delete items by deadline")
+	dCmd.fs.StringVar(&dCmd.creationDate, strings.Trim(string(godoo.Creation), "-"), "", "delete items by creation date")
+	dCmd.fs.StringVar(&dCmd.body, strings.Trim(string(godoo.Body), "-"), "", "delete items by body keyword")
+	dCmd.fs.StringVar(&dCmd.tagInput, strings.Trim(string(godoo.Tag), "-"), "", "delete items by tag")
+	dCmd.fs.BoolVar(&dCmd.complete, strings.Trim(string(godoo.Finished), "-"), false, "delete completed items")
+	dCmd.fs.StringVar(&dCmd.source, strings.Trim(string(godoo.FromSource), "-"), "", "only delete items from this source")
+}
+
+// ParseInput implements method from ICommand interface
+func (dCmd *DeleteCommand) ParseInput() error {
+	newArgs, err := dCmd.conf.Parser.ParseUserInput()
+
+	if err != nil {
+		lg.Logger.LogWithCallerInfo(lg.Error, fmt.Sprintf("user input parsing error: %v", err), runtime.Caller)
+		return err
+	}
+
+	dCmd.conf.Args = newArgs
+	lg.Logger.Log(lg.Info, "successfully parsed user input")
+	return dCmd.fs.Parse(dCmd.conf.Args)
+}
+
+// Implements ICommand Run() method
+func (dCmd *DeleteCommand) Run(w io.Writer) error {
+
+	srchQryLst, err := dCmd.DetermineQueryType(godoo.Delete)
+	if err != nil {
+		return err
+	}
+
+	toDelete, err := dCmd.BuildItemFromInput()
+	if err != nil {
+		lg.Logger.LogWithCallerInfo(lg.Error, fmt.Sprintf("error while interpreting user input: %v", err), runtime.Caller)
+		return err
+	}
+
+	srchFq := godoo.FullUserQuery{QueryOptions: srchQryLst, QueryData: toDelete}
+
+	ids, err := dCmd.conf.TodoRepo.DeleteWhere(srchFq)
+	if err != nil {
+		lg.Logger.LogWithCallerInfo(lg.Error, fmt.Sprintf("failed to delete item: %v", err), runtime.Caller)
+		return err
+	}
+
+	printDeleteMessage(len(ids), w)
+	lg.Logger.Logf(lg.Info, "items successfully deleted: %v", ids)
+	return nil
+}
+
+// Populates a godoo.TodoItem with user-supplied data to
+// pass to database for querying
+func (dCmd *DeleteCommand) BuildItemFromInput() (godoo.TodoItem, error) {
+	ret := godoo.NewTodoItem(godoo.WithPriorityLevel(godoo.None))
+
+	ret.Id = dCmd.id
+	if dCmd.childOf != 0 {
+		ret.ParentId = dCmd.childOf
+		ret.IsChild = true
+	}
+	if dCmd.creationDate != "" {
+		splt := strings.Split(dCmd.creationDate, ":")
+		ret.CreationDate, _ = time.Parse(dCmd.conf.DateLayout, splt[0])
+	}
+	if dCmd.deadline != "" {
+		splt := strings.Split(dCmd.deadline, ":")
+		ret.Deadline, _ = time.Parse(dCmd.conf.DateLayout, splt[0])
+	}
+	if dCmd.body != "" {
+		ret.Body = dCmd.body
+	}
+	if dCmd.tagInput != "" {
+		parseTagInput(ret, dCmd.tagInput, dCmd.conf.TagDelim)
+	}
+
+	ret.IsComplete = dCmd.complete
+	ret.Source = dCmd.source
+
+	return *ret, nil
+}
+
+// Interprets user input to determine which items to delete.
+// If no search options provided, returns error rather than
+// deleting everything.
+func (dCmd *DeleteCommand) DetermineQueryType(qType godoo.QueryType) ([]godoo.UserQueryOption, error) {
+	var ret []godoo.UserQueryOption
+
+	// by id numbers
+	if dCmd.id != 0 {
+		ret = append(ret, godoo.UserQueryOption{Elem: godoo.ById})
+	}
+	if dCmd.childOf != 0 {
+		ret = append(ret, godoo.UserQueryOption{Elem: godoo.ByParentId})
+	}
+
+	// by string
+	if dCmd.tagInput != "" {
+		ret = append(ret, godoo.UserQueryOption{Elem: godoo.ByTag})
+	}
+	if dCmd.body != "" {
+		ret = append(ret, godoo.UserQueryOption{Elem: godoo.ByBody})
+	}
+
+	// by times
+	if dCmd.deadline != "" {
+		d := getUpperDateBound(dCmd.deadline, dCmd.conf.DateLayout)
+		ret = append(ret, godoo.UserQueryOption{Elem: godoo.ByDeadline, UpperBoundDate: d})
+	}
+	if dCmd.creationDate != "" {
+		d := getUpperDateBound(dCmd.creationDate, dCmd.conf.DateLayout)
+		ret = append(ret, godoo.UserQueryOption{Elem: godoo.ByCreationDate, UpperBoundDate: d})
+	}
+	if dCmd.complete {
+		ret = append(ret, godoo.UserQueryOption{Elem: godoo.ByCompletion})
+	}
+
+	if len(ret) == 0 {
+		lg.Logger.LogWithCallerInfo(lg.Error, "no search options provided", runtime.Caller)
+		return ret, &NoSearchInstructionsError{}
+	}
+
+	lg.Logger.QuickFmtLog(lg.Info, "query options (deleting): ", ", ", ret)
+	return ret, nil
+}
@@ -0,0 +1,83 @@
+package cli
+
+import (
+	"testing"
+
+	godoo "github.com/mundacity/go-doo"
+	lg "github.com/mundacity/quick-logger"
+)
+
+type delete_query_build_test_case struct {
+	input      DeleteCommand
+	name       string
+	expSrchLst []godoo.UserQueryElement
+	expSrchItm godoo.TodoItem
+	expErr     error
+}
+
+func getDeleteQueryBuildTestCases() []delete_query_build_test_case {
+	return []delete_query_build_test_case{{
+		input:      DeleteCommand{id: 7},
+		name:       "id",
+		expSrchLst: []godoo.UserQueryElement{godoo.ById},
+		expSrchItm: *getTodoItm([]any{7, nil, nil, nil, nil, false}),
+	}, {
+		input:      DeleteCommand{conf: &godoo.ConfigVals{TagDelim: "*"}, body: "junk", tagInput: "scratch", childOf: 3},
+		name:       "body, tag, child",
+		expSrchLst: []godoo.UserQueryElement{godoo.ByBody, godoo.ByTag, godoo.ByParentId},
+		expSrchItm: *getTodoItm([]any{nil, 3, "junk", "scratch", nil, false}),
+	}, {
+		input:      DeleteCommand{conf: &godoo.ConfigVals{TagDelim: "*"}, tagInput: "scratch*draft"},
+		name:       "several tags",
+		expSrchLst: []godoo.UserQueryElement{godoo.ByTag},
+		expSrchItm: func() godoo.TodoItem {
+			itm := getTodoItm([]any{nil, nil, nil, "scratch", nil, false})
+			itm.Tags["draft"] = struct{}{}
+			return *itm
+		}(),
+	}, {
+		input:      DeleteCommand{complete: true},
+		name:       "completed items",
+		expSrchLst: []godoo.UserQueryElement{godoo.ByCompletion},
+		expSrchItm: *getTodoItm([]any{nil, nil, nil, nil, nil, true}),
+	}, {
+		input:      DeleteCommand{},
+		name:       "no search flags",
+		expSrchLst: []godoo.UserQueryElement{},
+		expSrchItm: *getTodoItm([]any{nil, nil, nil, nil, nil, false}),
+		expErr:     &NoSearchInstructionsError{},
+	}}
+}
+
+func TestDeleteQueryBuilding(t *testing.T) {
+	lg.Logger = lg.NewDummyLogger()
+	tcs := getDeleteQueryBuildTestCases()
+	for _, tc := range tcs {
+		t.Run(tc.name, func(t *testing.T) {
+			runDeleteQueryBuildTests(t, tc)
+		})
+	}
+}
+
+func runDeleteQueryBuildTests(t *testing.T, tc delete_query_build_test_case) {
+	gotSrchLst, err := tc.input.DetermineQueryType(godoo.Delete)
+	gotSrchItm, _ := tc.input.BuildItemFromInput()
+
+	if (err == nil) != (tc.expErr == nil) {
+		t.Errorf(">>>>FAIL (err): expected '%v', got '%v'", tc.expErr, err)
+	}
+
+	same, msg := compareTdoItms(tc.expSrchItm, gotSrchItm)
+	if same {
+		t.Logf(">>>>PASS (srchItm): expected & got are equal")
+	} else {
+		t.Errorf(">>>>FAIL (srchItm): expected & got are not equal --> '%v'", msg)
+	}
+
+	same, msg = compareQueryElemsLists(tc.expSrchLst, gotSrchLst)
+	if same {
+		t.Logf(">>>>PASS (srchLst): expected & got are equal")
+	} else {
+		t.Errorf(">>>>FAIL (srchLst): expected & got are not equal --> '%v'", msg)
+	}
+}
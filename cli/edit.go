@@ -2,13 +2,10 @@ package cli
 
 import (
 	"bufio"
-	"bytes"
-	"encoding/json"
 	"errors"
 	"flag"
 	"fmt"
 	"io"
-	"net/http"
 	"os"
 	"runtime"
 	"strings"
@@ -30,13 +27,22 @@ type EditCommand struct {
 	tagInput          string //add new, edit/delete existing
 	appending         bool
 	replacing         bool
+	removing          bool // tags only
 	complete          bool
+	source            string
 	newTag            string
 	newBody           string
 	newDeadline       string
 	newParent         int
 	newToggleComplete bool
+	newDone           bool // absolute, unlike the toggle
+	newUndone         bool
+	newShared         bool
+	newPrivate        bool
 	newPriority       priorityMode
+	dryRun            bool
+	yes               bool      // skip confirmation
+	input             io.Reader // answers to prompts; stdin if nil
 }
 
 // Sets up flag info & parser before returning a new edit comman
@@ -63,18 +69,28 @@ func (eCmd *EditCommand) setupFlagSet() {
 	eCmd.fs.StringVar(&eCmd.body, strings.Trim(string(godoo.Body), "-"), "", "edit items by body keyword")
 	eCmd.fs.StringVar(&eCmd.tagInput, strings.Trim(string(godoo.Tag), "-"), "", "edit items by tag")
 	eCmd.fs.BoolVar(&eCmd.complete, strings.Trim(string(godoo.Finished), "-"), false, "edit by completed items")
+	eCmd.fs.StringVar(&eCmd.source, strings.Trim(string(godoo.FromSource), "-"), "", "only edit items from this source")
 
 	// edit mode
 	eCmd.fs.BoolVar(&eCmd.appending, strings.Trim(string(godoo.AppendMode), "-"), false, "append new input to end of existing body/tag")
 	eCmd.fs.BoolVar(&eCmd.replacing, strings.Trim(string(godoo.ReplaceMode), "-"), false, "replace existing body/tag with new input")
+	eCmd.fs.BoolVar(&eCmd.removing, strings.Trim(string(godoo.RemoveMode), "-"), false, "remove tag from existing item/s")
 
 	// elements of item/s to edit
 	eCmd.fs.BoolVar(&eCmd.newToggleComplete, strings.Trim(string(godoo.MarkComplete), "-"), false, "toggle item completion")
+	eCmd.fs.BoolVar(&eCmd.newDone, strings.Trim(string(godoo.Done), "-"), false, "mark item/s complete")
+	eCmd.fs.BoolVar(&eCmd.newUndone, strings.Trim(string(godoo.Undone), "-"), false, "mark item/s incomplete")
+	eCmd.fs.BoolVar(&eCmd.newShared, strings.Trim(string(godoo.SharedItem), "-"), false, "let everyone using the server see item/s")
+	eCmd.fs.BoolVar(&eCmd.newPrivate, strings.Trim(string(godoo.PrivateItem), "-"), false, "only let the owner see item/s")
 	eCmd.fs.StringVar(&eCmd.newTag, strings.Trim(string(godoo.ChangeTag), "-"), "", "change item/s tag")
 	eCmd.fs.StringVar(&eCmd.newDeadline, strings.Trim(string(godoo.ChangedDeadline), "-"), "", "change item/s deadline")
 	eCmd.fs.StringVar(&eCmd.newBody, strings.Trim(string(godoo.ChangeBody), "-"), "", "change item/s body")
 	eCmd.fs.IntVar(&eCmd.newParent, strings.Trim(string(godoo.ChangeParent), "-"), 0, "change item/s parent id")
 	eCmd.fs.StringVar((*string)(&eCmd.newPriority), strings.Trim(string(godoo.ChangeMode), "-"), "", "change item/s priority mode - low/medium/high")
+
+	// confirmation
+	eCmd.fs.BoolVar(&eCmd.dryRun, strings.Trim(string(godoo.DryRun), "-"), false, "show what would change without changing anything")
+	eCmd.fs.BoolVar(&eCmd.yes, strings.Trim(string(godoo.Yes), "-"), false, "don't ask before editing many items")
 }
 
 // ParseInput implements method from ICommand interface
@@ -94,7 +110,9 @@ func (eCmd *EditCommand) ParseInput() error {
 // Implements ICommand Run() method
 func (eCmd *EditCommand) Run(w io.Writer) error {
 
-	eCmd.getAdditionalInput()
+	if err := eCmd.getAdditionalInput(); err != nil {
+		return err
+	}
 	srchQryLst, err := eCmd.DetermineQueryType(godoo.Get)
 	if err != nil {
 		return err
@@ -121,27 +139,86 @@ func (eCmd *EditCommand) Run(w io.Writer) error {
 	srchFq := godoo.FullUserQuery{QueryOptions: srchQryLst, QueryData: toEdit}
 	edtFq := godoo.FullUserQuery{QueryOptions: edtQryLst, QueryData: newVals}
 
-	if eCmd.conf.Instance == godoo.Remote {
-		return eCmd.remoteEdit(w, srchFq, edtFq)
+	// read before anything's shown, so the edit can't overwrite
+	// changes someone else makes while the user is looking
+	versions, err := eCmd.readVersions(srchFq)
+	if err != nil {
+		lg.Logger.LogWithCallerInfo(lg.Error, fmt.Sprintf("failed to read items to edit: %v", err), runtime.Caller)
+		return err
+	}
+
+	// working out every change is only worth it if they're going to be shown
+	if eCmd.dryRun || !eCmd.yes {
+		n, err := eCmd.count(srchFq, versions)
+		if err != nil {
+			lg.Logger.LogWithCallerInfo(lg.Error, fmt.Sprintf("failed to count items to edit: %v", err), runtime.Caller)
+			return err
+		}
+
+		if eCmd.dryRun || n > eCmd.conf.ConfirmThreshold {
+			p, err := eCmd.preview(srchFq, edtFq)
+			if err != nil {
+				lg.Logger.LogWithCallerInfo(lg.Error, fmt.Sprintf("failed to preview edit: %v", err), runtime.Caller)
+				return err
+			}
+
+			if eCmd.dryRun {
+				w.Write([]byte(buildPreviewOutput(p)))
+				lg.Logger.Logf(lg.Info, "dry run; %v item/s matched", p.Matched)
+				return nil
+			}
+			if err = eCmd.confirm(p, w); err != nil {
+				return err
+			}
+		}
 	}
 
-	num, err := eCmd.conf.TodoRepo.UpdateWhere(srchFq, edtFq)
+	num, err := eCmd.update(srchFq, edtFq, versions)
+	var q *godoo.QueuedError
+	if errors.As(err, &q) {
+		printQueuedMessage(w)
+		lg.Logger.Logf(lg.Warning, "edit to %v cached item/s queued: %v", num, err)
+		return nil
+	}
+	var ce *godoo.VersionConflictError
+	if errors.As(err, &ce) {
+		w.Write([]byte(buildConflictOutput(ce.Conflicts)))
+		lg.Logger.LogWithCallerInfo(lg.Error, fmt.Sprintf("edit refused: %v", err), runtime.Caller)
+		return err
+	}
 	if err != nil {
 		lg.Logger.LogWithCallerInfo(lg.Error, fmt.Sprintf("failed to edit item: %v", err), runtime.Caller)
 		return err
 	}
 
 	printEditMessage(num, w)
-	lg.Logger.Log(lg.Info, "local item successfully edited")
+	lg.Logger.Logf(lg.Info, "%v item/s successfully edited", num)
 	return nil
 }
 
-// Checks whether user replacing or appending to existing item bodies
+// Checks whether user replacing, appending to or removing existing item bodies/tags
 func (eCmd *EditCommand) getAdditionalInput() error {
+	if eCmd.removing && len(eCmd.newBody) > 0 {
+		lg.Logger.LogWithCallerInfo(lg.Error, "remove mode used with body", runtime.Caller)
+		return &InvalidArgumentError{}
+	}
+	if countTrue(eCmd.newToggleComplete, eCmd.newDone, eCmd.newUndone) > 1 {
+		lg.Logger.LogWithCallerInfo(lg.Error, "more than one of toggle/done/undone used", runtime.Caller)
+		return &InvalidArgumentError{}
+	}
+	if eCmd.newShared && eCmd.newPrivate {
+		lg.Logger.LogWithCallerInfo(lg.Error, "both shared & private used", runtime.Caller)
+		return &InvalidArgumentError{}
+	}
+
 	if len(eCmd.newBody) > 0 || len(eCmd.newTag) > 0 {
-		if !eCmd.appending && !eCmd.replacing {
+		if !eCmd.appending && !eCmd.replacing && !eCmd.removing {
 			// get user input to figure what they want
-			fmt.Print("\nNo edit mode specified. Choose append (a), replace (r). Any other key to cancel...\n")
+			prompt := "\nNo edit mode specified. Choose append (a), replace (r). Any other key to cancel...\n"
+			if len(eCmd.newBody) == 0 {
+				prompt = "\nNo edit mode specified. Choose append (a), replace (r), remove (x). Any other key to cancel...\n"
+			}
+			fmt.Print(prompt)
 
 			lg.Logger.Log(lg.Info, "user asked for additional input")
 
@@ -156,6 +233,8 @@ func (eCmd *EditCommand) getAdditionalInput() error {
 				eCmd.replacing = true
 			} else if choice == 'a' {
 				eCmd.appending = true
+			} else if choice == 'x' && len(eCmd.newBody) == 0 {
+				eCmd.removing = true
 			} else {
 				lg.Logger.Logf(lg.Warning, "invalid additional user input: %v", choice)
 				return errors.New("cancelling operation")
@@ -166,6 +245,75 @@ func (eCmd *EditCommand) getAdditionalInput() error {
 	return nil
 }
 
+// Returns the versions of the items srch matches, or nil if
+// the repo can't make an edit conditional on them
+func (eCmd *EditCommand) readVersions(srch godoo.FullUserQuery) (map[int]int, error) {
+	if _, ok := eCmd.conf.TodoRepo.(godoo.IConditionalUpdater); !ok {
+		return nil, nil
+	}
+	itms, err := eCmd.conf.TodoRepo.GetWhere(srch)
+	if err != nil {
+		return nil, err
+	}
+	return godoo.GetVersions(itms), nil
+}
+
+// Edits the items unless they've changed since they were read at versions
+func (eCmd *EditCommand) update(srch, edt godoo.FullUserQuery, versions map[int]int) (int, error) {
+	if c, ok := eCmd.conf.TodoRepo.(godoo.IConditionalUpdater); ok && versions != nil {
+		return c.UpdateIfUnchanged(srch, edt, versions)
+	}
+	return eCmd.conf.TodoRepo.UpdateWhere(srch, edt)
+}
+
+// Counts the items the edit would touch. Items already read for
+// their versions don't need reading again.
+func (eCmd *EditCommand) count(srch godoo.FullUserQuery, versions map[int]int) (int, error) {
+	if c, ok := eCmd.conf.TodoRepo.(godoo.ICounter); ok {
+		return c.CountWhere(srch)
+	}
+	if versions != nil {
+		return len(versions), nil
+	}
+
+	itms, err := eCmd.conf.TodoRepo.GetWhere(srch)
+	return len(itms), err
+}
+
+// Works out what the edit would do. Repos that can't preview
+// an edit only report how many items it would touch.
+func (eCmd *EditCommand) preview(srch, edt godoo.FullUserQuery) (godoo.EditPreview, error) {
+	if p, ok := eCmd.conf.TodoRepo.(godoo.IPreviewer); ok {
+		return p.PreviewUpdate(srch, edt)
+	}
+
+	itms, err := eCmd.conf.TodoRepo.GetWhere(srch)
+	return godoo.EditPreview{Matched: len(itms)}, err
+}
+
+// Shows the user what's about to change & waits for a yes
+func (eCmd *EditCommand) confirm(p godoo.EditPreview, w io.Writer) error {
+	w.Write([]byte(buildPreviewOutput(p)))
+	w.Write([]byte("\nApply these changes? (y/N)\n"))
+
+	lg.Logger.Log(lg.Info, "user asked to confirm edit")
+
+	in := eCmd.input
+	if in == nil {
+		in = os.Stdin
+	}
+	choice, _, err := bufio.NewReader(in).ReadRune()
+	if err != nil {
+		lg.Logger.LogWithCallerInfo(lg.Error, fmt.Sprintf("error receiving confirmation: %v", err), runtime.Caller)
+	}
+
+	if choice != 'y' && choice != 'Y' {
+		lg.Logger.Logf(lg.Warning, "edit not confirmed: %v", choice)
+		return errors.New("cancelling operation")
+	}
+	return nil
+}
+
 // Populates a godoo.TodoItem with user-supplied data to pass
 // to database for querying/editing
 func (eCmd *EditCommand) BuildItemFromInput() (godoo.TodoItem, error) {
@@ -193,11 +341,14 @@ func (eCmd *EditCommand) BuildItemFromInput() (godoo.TodoItem, error) {
 		}
 
 		ret.IsComplete = eCmd.complete
+		ret.Source = eCmd.source
 
 	} else {
 		if eCmd.newParent != 0 {
-			ret.ParentId = eCmd.newParent
-			ret.IsChild = true
+			if err := ret.SetParent(eCmd.newParent); err != nil {
+				lg.Logger.LogWithCallerInfo(lg.Error, fmt.Sprintf("invalid parent id: %v", err), runtime.Caller)
+				return *ret, err
+			}
 		}
 		if eCmd.newDeadline != "" {
 			ret.Deadline, _ = time.Parse(eCmd.conf.DateLayout, eCmd.newDeadline)
@@ -209,11 +360,17 @@ func (eCmd *EditCommand) BuildItemFromInput() (godoo.TodoItem, error) {
 			ret.Body = eCmd.newBody
 		}
 		if eCmd.newTag != "" {
-			ret.Tags[eCmd.newTag] = struct{}{}
+			parseTagInput(ret, eCmd.newTag, eCmd.conf.TagDelim)
 		}
-		if eCmd.newToggleComplete {
+		if eCmd.newToggleComplete || eCmd.newDone {
 			ret.IsComplete = true
 		}
+		if eCmd.newShared {
+			ret.Visibility = godoo.Shared
+		}
+		if eCmd.newPrivate {
+			ret.Visibility = godoo.Private
+		}
 		if len(string(eCmd.newPriority)) > 0 {
 			p, err := convertPriority(string(eCmd.newPriority))
 			if err != nil {
@@ -228,6 +385,16 @@ func (eCmd *EditCommand) BuildItemFromInput() (godoo.TodoItem, error) {
 	return *ret, nil
 }
 
+func countTrue(bs ...bool) int {
+	n := 0
+	for _, b := range bs {
+		if b {
+			n++
+		}
+	}
+	return n
+}
+
 func convertPriority(s string) (godoo.PriorityLevel, error) {
 	sl := strings.ToLower(s)
 	switch sl {
@@ -244,47 +411,6 @@ func convertPriority(s string) (godoo.PriorityLevel, error) {
 	}
 }
 
-// In remote mode, coordinates request & response to/from remote server.
-func (eCmd *EditCommand) remoteEdit(w io.Writer, srchFq, edtFq godoo.FullUserQuery) error {
-	// --> very happy path; need to test
-	baseUrl := eCmd.conf.RemoteUrl + "/edit"
-
-	s := []godoo.FullUserQuery{srchFq, edtFq}
-
-	body, err := json.Marshal(s)
-	if err != nil {
-		lg.Logger.LogWithCallerInfo(lg.Error, fmt.Sprintf("json marshalling error: %v", err), runtime.Caller)
-		return err
-	}
-
-	rq, err := http.NewRequest("PUT", baseUrl, bytes.NewBuffer(body))
-	if err != nil {
-		lg.Logger.LogWithCallerInfo(lg.Error, fmt.Sprintf("request generation error: %v", err), runtime.Caller)
-		return err
-	}
-	rq.Header.Set("content-type", "application/json")
-
-	resp, err := eCmd.conf.Client.Do(rq)
-	if err != nil {
-		lg.Logger.LogWithCallerInfo(lg.Error, fmt.Sprintf("error receiving response: %v", err), runtime.Caller)
-		return err
-	}
-	defer resp.Body.Close()
-
-	var i int
-
-	d := json.NewDecoder(resp.Body)
-
-	if err = d.Decode(&i); err != nil {
-		lg.Logger.LogWithCallerInfo(lg.Error, fmt.Sprintf("json decoding error: %v", err), runtime.Caller)
-	}
-
-	printEditMessage(i, w)
-	lg.Logger.Logf(lg.Info, "%v remote item/s successfully edited", i)
-
-	return nil
-}
-
 // Interprets user input to determine intentions in both the search and edit
 // portions of input. If no edit options provided, returns error.
 func (eCmd *EditCommand) DetermineQueryType(qType godoo.QueryType) ([]godoo.UserQueryOption, error) {
@@ -346,9 +472,18 @@ func (eCmd *EditCommand) DetermineQueryType(qType godoo.QueryType) ([]godoo.User
 		if eCmd.replacing {
 			ret = append(ret, godoo.UserQueryOption{Elem: godoo.ByReplacement})
 		}
+		if eCmd.removing {
+			ret = append(ret, godoo.UserQueryOption{Elem: godoo.ByRemoval})
+		}
 		if eCmd.newToggleComplete {
+			ret = append(ret, godoo.UserQueryOption{Elem: godoo.ByCompletion}, godoo.UserQueryOption{Elem: godoo.ByToggle})
+		}
+		if eCmd.newDone || eCmd.newUndone {
 			ret = append(ret, godoo.UserQueryOption{Elem: godoo.ByCompletion})
 		}
+		if eCmd.newShared || eCmd.newPrivate {
+			ret = append(ret, godoo.UserQueryOption{Elem: godoo.ByVisibility})
+		}
 		if len(string(eCmd.newPriority)) > 0 {
 			//ret.Priority = converPriority(string(eCmd.newPriority))
 			ret = append(ret, godoo.UserQueryOption{Elem: godoo.ByNextPriority})
@@ -1,13 +1,17 @@
 package cli
 
 import (
+	"bytes"
+	"errors"
 	"fmt"
 	"sort"
+	"strings"
 	"testing"
 	"time"
 
 	godoo "github.com/mundacity/go-doo"
 	"github.com/mundacity/go-doo/util"
+	lg "github.com/mundacity/quick-logger"
 )
 
 type edit_item_generation_test_case struct {
@@ -53,11 +57,41 @@ func _getTestCasesForEditing() []edit_item_generation_test_case {
 		expected: EditCommand{id: 15, newBody: "cleaned out by edit command", replacing: true},
 		err:      nil,
 		name:     "find by id edit body with replace directive",
+	}, {
+		args:     []string{"edit", "-i", "9", "-T", "stale", "--remove"},
+		expected: EditCommand{id: 9, newTag: "stale", removing: true},
+		err:      nil,
+		name:     "find by id remove tag",
 	}, {
 		args:     []string{"edit", "-b", "multiple", "-B", "appended to end of body by edit command", "--append"},
 		expected: EditCommand{body: "multiple", newBody: "appended to end of body by edit command", appending: true},
 		err:      nil,
 		name:     "find by body edit body with append directive",
+	}, {
+		args:     []string{"edit", "-t", "sprint", "--done"},
+		expected: EditCommand{tagInput: "sprint", newDone: true},
+		err:      nil,
+		name:     "find by tag set complete",
+	}, {
+		args:     []string{"edit", "-t", "sprint", "--undone"},
+		expected: EditCommand{tagInput: "sprint", newUndone: true},
+		err:      nil,
+		name:     "find by tag set incomplete",
+	}, {
+		args:     []string{"edit", "-t", "sprint", "--done", "--dry-run"},
+		expected: EditCommand{tagInput: "sprint", newDone: true, dryRun: true},
+		err:      nil,
+		name:     "dry run",
+	}, {
+		args:     []string{"edit", "-t", "sprint", "--done", "--yes"},
+		expected: EditCommand{tagInput: "sprint", newDone: true, yes: true},
+		err:      nil,
+		name:     "skip confirmation",
+	}, {
+		args:     []string{"edit", "-i", "8", "--private"},
+		expected: EditCommand{id: 8, newPrivate: true},
+		err:      nil,
+		name:     "make private",
 	}}
 }
 
@@ -80,7 +114,7 @@ func getEditQueryBuildTestCases() []edit_query_build_test_case {
 		input:      EditCommand{body: "edit command", newToggleComplete: true},
 		name:       "body and complete",
 		expSrchLst: []godoo.UserQueryElement{godoo.ByBody},
-		expEdtLst:  []godoo.UserQueryElement{godoo.ByCompletion},
+		expEdtLst:  []godoo.UserQueryElement{godoo.ByCompletion, godoo.ByToggle},
 		expSrchItm: godoo.TodoItem{Body: "edit command"},
 		expEdtItm:  godoo.TodoItem{IsComplete: true},
 	}, {
@@ -101,9 +135,44 @@ func getEditQueryBuildTestCases() []edit_query_build_test_case {
 		input:      EditCommand{body: "multiple", tagInput: "dev", childOf: 4, appending: true, newBody: "cleaned out by edit command", newToggleComplete: true},
 		name:       "body, tag, child - new body appended marked complete",
 		expSrchLst: []godoo.UserQueryElement{godoo.ByBody, godoo.ByTag, godoo.ByParentId},
-		expEdtLst:  []godoo.UserQueryElement{godoo.ByBody, godoo.ByAppending, godoo.ByCompletion},
+		expEdtLst:  []godoo.UserQueryElement{godoo.ByBody, godoo.ByAppending, godoo.ByCompletion, godoo.ByToggle},
 		expSrchItm: *getTodoItm([]any{nil, 4, "multiple", "dev", nil, false}),
 		expEdtItm:  *getTodoItm([]any{nil, nil, "cleaned out by edit command", nil, nil, true}),
+	}, {
+		input:      EditCommand{conf: &godoo.ConfigVals{TagDelim: "*"}, id: 6, removing: true, newTag: "stale"},
+		name:       "id - tag removed",
+		expSrchLst: []godoo.UserQueryElement{godoo.ById},
+		expEdtLst:  []godoo.UserQueryElement{godoo.ByTag, godoo.ByRemoval},
+		expSrchItm: godoo.TodoItem{Id: 6},
+		expEdtItm:  *getTodoItm([]any{nil, nil, nil, "stale", nil, false}),
+	}, {
+		input:      EditCommand{conf: &godoo.ConfigVals{TagDelim: "*"}, tagInput: "sprint", replacing: true, newTag: "backlog*later"},
+		name:       "tag - multiple tags replaced",
+		expSrchLst: []godoo.UserQueryElement{godoo.ByTag},
+		expEdtLst:  []godoo.UserQueryElement{godoo.ByTag, godoo.ByReplacement},
+		expSrchItm: *getTodoItm([]any{nil, nil, nil, "sprint", nil, false}),
+		expEdtItm:  godoo.TodoItem{Tags: map[string]struct{}{"backlog": {}, "later": {}}},
+	}, {
+		input:      EditCommand{tagInput: "sprint", newDone: true},
+		name:       "tag - set complete",
+		expSrchLst: []godoo.UserQueryElement{godoo.ByTag},
+		expEdtLst:  []godoo.UserQueryElement{godoo.ByCompletion},
+		expSrchItm: *getTodoItm([]any{nil, nil, nil, "sprint", nil, false}),
+		expEdtItm:  godoo.TodoItem{IsComplete: true},
+	}, {
+		input:      EditCommand{tagInput: "sprint", complete: true, newUndone: true},
+		name:       "tag & complete - set incomplete",
+		expSrchLst: []godoo.UserQueryElement{godoo.ByTag, godoo.ByCompletion},
+		expEdtLst:  []godoo.UserQueryElement{godoo.ByCompletion},
+		expSrchItm: *getTodoItm([]any{nil, nil, nil, "sprint", nil, true}),
+		expEdtItm:  godoo.TodoItem{IsComplete: false},
+	}, {
+		input:      EditCommand{id: 8, newShared: true},
+		name:       "id - shared",
+		expSrchLst: []godoo.UserQueryElement{godoo.ById},
+		expEdtLst:  []godoo.UserQueryElement{godoo.ByVisibility},
+		expSrchItm: godoo.TodoItem{Id: 8},
+		expEdtItm:  godoo.TodoItem{Visibility: godoo.Shared},
 	}}
 }
 
@@ -261,6 +330,9 @@ func compareTdoItms(itm1, itm2 godoo.TodoItem) (bool, string) {
 	if itm1.IsComplete != itm2.IsComplete {
 		return false, "no isComplete match"
 	}
+	if itm1.Visibility != itm2.Visibility {
+		return false, "no visibility match"
+	}
 	if len(itm1.ChildItems) != len(itm2.ChildItems) {
 		return false, "no match on length of childItems"
 	}
@@ -281,7 +353,7 @@ func compareTdoItms(itm1, itm2 godoo.TodoItem) (bool, string) {
 	sort.Strings(itm2Tags)
 
 	for i, t := range itm1Tags {
-		if t != itm1Tags[i] {
+		if t != itm2Tags[i] {
 			return false, "tag mismatch"
 		}
 	}
@@ -292,6 +364,9 @@ func compare(exp, got EditCommand) (bool, string) {
 	if exp.appending != got.appending {
 		return false, fmt.Sprintf("No match on appending mode. Expected '%v', got '%v'", exp.appending, got.appending)
 	}
+	if exp.removing != got.removing {
+		return false, fmt.Sprintf("No match on removing mode. Expected '%v', got '%v'", exp.removing, got.removing)
+	}
 	if exp.replacing != got.replacing {
 		return false, fmt.Sprintf("No match on replacing mode. Expected '%v', got '%v'", exp.replacing, got.replacing)
 	}
@@ -328,5 +403,173 @@ func compare(exp, got EditCommand) (bool, string) {
 	if exp.newToggleComplete != got.newToggleComplete {
 		return false, fmt.Sprintf("No match on newlyComplete. Expected '%v', got '%v'", exp.newToggleComplete, got.newToggleComplete)
 	}
+	if exp.newDone != got.newDone {
+		return false, fmt.Sprintf("No match on newDone. Expected '%v', got '%v'", exp.newDone, got.newDone)
+	}
+	if exp.newUndone != got.newUndone {
+		return false, fmt.Sprintf("No match on newUndone. Expected '%v', got '%v'", exp.newUndone, got.newUndone)
+	}
+	if exp.dryRun != got.dryRun {
+		return false, fmt.Sprintf("No match on dryRun. Expected '%v', got '%v'", exp.dryRun, got.dryRun)
+	}
+	if exp.yes != got.yes {
+		return false, fmt.Sprintf("No match on yes. Expected '%v', got '%v'", exp.yes, got.yes)
+	}
+	if exp.newShared != got.newShared || exp.newPrivate != got.newPrivate {
+		return false, fmt.Sprintf("No match on visibility. Expected '%v/%v', got '%v/%v'", exp.newShared, exp.newPrivate, got.newShared, got.newPrivate)
+	}
 	return true, "all field values equal"
 }
+
+// counts real edits & previews so tests can tell whether they ran.
+// Matches 3 items, or 1 if few.
+type previewRepo struct {
+	godoo.IRepository
+	edits    *int
+	previews *int
+	few      bool
+}
+
+func (p previewRepo) CountWhere(srchQry godoo.FullUserQuery) (int, error) {
+	if p.few {
+		return 1, nil
+	}
+	return 3, nil
+}
+
+func (p previewRepo) PreviewUpdate(srchQry, edtQry godoo.FullUserQuery) (godoo.EditPreview, error) {
+	*p.previews++
+	return godoo.EditPreview{Matched: 3, Changes: []godoo.HistoryEntry{
+		{ItemId: 4, Action: godoo.Updated, Before: &godoo.TodoItem{Id: 4}, After: &godoo.TodoItem{Id: 4, IsComplete: true}},
+		{ItemId: 5, Action: godoo.Updated, Before: &godoo.TodoItem{Id: 5}, After: &godoo.TodoItem{Id: 5, IsComplete: true}},
+	}}, nil
+}
+
+func (p previewRepo) UpdateWhere(srchQry, edtQry godoo.FullUserQuery) (int, error) {
+	*p.edits++
+	return 3, nil
+}
+
+// previewRepo that keeps item versions. If changedSince, item 5 is
+// changed by someone else after it's read.
+type versionedRepo struct {
+	previewRepo
+	changedSince bool
+}
+
+func (v versionedRepo) GetWhere(qry godoo.FullUserQuery) ([]godoo.TodoItem, error) {
+	return []godoo.TodoItem{{Id: 4, Version: 1}, {Id: 5, Version: 2}, {Id: 6, Version: 1}}, nil
+}
+
+func (v versionedRepo) UpdateIfUnchanged(srchQry, edtQry godoo.FullUserQuery, versions map[int]int) (int, error) {
+	if versions[5] != 2 {
+		return 0, errors.New("versions not read before editing")
+	}
+	if v.changedSince {
+		return 0, &godoo.VersionConflictError{Conflicts: []godoo.VersionConflict{{ItemId: 5, Expected: 2, Current: 3}}}
+	}
+	return v.previewRepo.UpdateWhere(srchQry, edtQry)
+}
+
+type edit_confirm_test_case struct {
+	cmd          EditCommand
+	versioned    bool // the repo can make edits conditional
+	changedSince bool
+	few          bool // fewer matches than the confirmation threshold
+	input        string
+	expEdits     int
+	expPreviews  int
+	expOut       []string
+	expErr       bool
+	name         string
+}
+
+func getEditConfirmTestCases() []edit_confirm_test_case {
+	return []edit_confirm_test_case{{
+		cmd:         EditCommand{tagInput: "sprint", newDone: true, dryRun: true},
+		expOut:      []string{"-- Id: 4", "complete: 'false' -> 'true'", "3 items matched; 2 changes would be made"},
+		expPreviews: 1,
+		name:        "dry run changes nothing",
+	}, {
+		cmd:         EditCommand{tagInput: "sprint", newDone: true},
+		input:       "y\n",
+		expEdits:    1,
+		expPreviews: 1,
+		expOut:      []string{"Apply these changes?", "Edited 3 items"},
+		name:        "confirmed",
+	}, {
+		cmd:         EditCommand{tagInput: "sprint", newDone: true},
+		input:       "n\n",
+		expOut:      []string{"Apply these changes?"},
+		expPreviews: 1,
+		expErr:      true,
+		name:        "declined",
+	}, {
+		cmd:      EditCommand{tagInput: "sprint", newDone: true, yes: true},
+		expEdits: 1,
+		name:     "confirmation skipped",
+	}, {
+		cmd:      EditCommand{tagInput: "sprint", newDone: true},
+		few:      true,
+		expEdits: 1,
+		expOut:   []string{"Edited 3 items"},
+		name:     "below threshold - not previewed",
+	}, {
+		cmd:         EditCommand{tagInput: "sprint", newDone: true},
+		versioned:   true,
+		input:       "y\n",
+		expEdits:    1,
+		expPreviews: 1,
+		expOut:      []string{"Edited 3 items"},
+		name:        "unchanged since read",
+	}, {
+		cmd:          EditCommand{tagInput: "sprint", newDone: true},
+		versioned:    true,
+		changedSince: true,
+		input:        "y\n",
+		expPreviews:  1,
+		expOut:       []string{"-- Id: 5", "now version 3; read at version 2", "Nothing edited; 1 item changed"},
+		expErr:       true,
+		name:         "changed while confirming",
+	}}
+}
+
+func TestEditConfirmation(t *testing.T) {
+	lg.Logger = lg.NewDummyLogger()
+	tcs := getEditConfirmTestCases()
+	for _, tc := range tcs {
+		t.Run(tc.name, func(t *testing.T) {
+			runEditConfirmTest(t, tc)
+		})
+	}
+}
+
+func runEditConfirmTest(t *testing.T, tc edit_confirm_test_case) {
+	edits, previews := 0, 0
+	rp := previewRepo{edits: &edits, previews: &previews, few: tc.few}
+	conf := godoo.ConfigVals{TodoRepo: rp, ConfirmThreshold: 2}
+	if tc.versioned {
+		conf.TodoRepo = versionedRepo{previewRepo: rp, changedSince: tc.changedSince}
+	}
+	eCmd := tc.cmd
+	eCmd.conf = &conf
+	eCmd.input = strings.NewReader(tc.input)
+
+	var b bytes.Buffer
+	err := eCmd.Run(&b)
+
+	if (err != nil) != tc.expErr {
+		t.Errorf(">>>>FAILED (err): expected error: %v, got '%v'", tc.expErr, err)
+	}
+	if edits != tc.expEdits {
+		t.Errorf(">>>>FAILED: expected %v edits, got %v", tc.expEdits, edits)
+	}
+	if previews != tc.expPreviews {
+		t.Errorf(">>>>FAILED: expected %v previews, got %v", tc.expPreviews, previews)
+	}
+	for _, o := range tc.expOut {
+		if !strings.Contains(b.String(), o) {
+			t.Errorf(">>>>FAILED: expected output to contain '%v', got '%v'", o, b.String())
+		}
+	}
+}
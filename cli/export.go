@@ -0,0 +1,80 @@
+package cli
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"runtime"
+	"sort"
+	"strings"
+
+	godoo "github.com/mundacity/go-doo"
+	lg "github.com/mundacity/quick-logger"
+)
+
+// ExportCommand implements the ICommand interface and writes every
+// item in a portable format that the import command can read back
+type ExportCommand struct {
+	conf   *godoo.ConfigVals
+	fs     *flag.FlagSet
+	format outputFormat
+}
+
+// Returns a new ExportCommand after setting up the flagset
+func NewExportCommand(conf *godoo.ConfigVals) *ExportCommand {
+	xCmd := ExportCommand{}
+	xCmd.conf = conf
+	lg.Logger.Log(lg.Info, "export command created")
+
+	xCmd.setupFlagSet()
+
+	return &xCmd
+}
+
+// Describes the flags and argument types associated with the command
+func (xCmd *ExportCommand) setupFlagSet() {
+	xCmd.fs = flag.NewFlagSet("export", flag.ContinueOnError)
+	xCmd.fs.StringVar((*string)(&xCmd.format), strings.Trim(string(godoo.Format), "-"), string(jsonFormat), "json, ndjson, csv, tsv or todotxt")
+}
+
+// ParseInput implements method from ICommand interface
+func (xCmd *ExportCommand) ParseInput() error {
+	newArgs, err := xCmd.conf.Parser.ParseUserInput()
+
+	if err != nil {
+		lg.Logger.LogWithCallerInfo(lg.Error, fmt.Sprintf("user input parsing error: %v", err), runtime.Caller)
+		return err
+	}
+
+	xCmd.conf.Args = newArgs
+	lg.Logger.Log(lg.Info, "successfully parsed user input")
+	return xCmd.fs.Parse(xCmd.conf.Args)
+}
+
+// Implements ICommand Run() method
+func (xCmd *ExportCommand) Run(w io.Writer) error {
+	if !isFormatIn(xCmd.format, transferFormats) {
+		lg.Logger.LogWithCallerInfo(lg.Error, fmt.Sprintf("unknown export format: %v", xCmd.format), runtime.Caller)
+		return &UnknownFormatError{Format: string(xCmd.format), Allowed: transferFormats}
+	}
+
+	itms, err := xCmd.conf.TodoRepo.GetAll()
+	if err != nil {
+		lg.Logger.LogWithCallerInfo(lg.Error, fmt.Sprintf("failed to get items: %v", err), runtime.Caller)
+		return err
+	}
+	sort.Slice(itms, func(i, j int) bool { return itms[i].Id < itms[j].Id })
+
+	if xCmd.format == todoTxtFormat {
+		w.Write([]byte(buildTodoTxtOutput(itms)))
+	} else {
+		w.Write([]byte(getFormattedOutputFunc(itms, xCmd.format, xCmd.conf.TagDelim, xCmd.conf.DateLayout)()))
+	}
+	lg.Logger.Logf(lg.Info, "exported %v item/s as %v", len(itms), xCmd.format)
+	return nil
+}
+
+// Not used by the export command; implemented to satisfy ICommand
+func (xCmd *ExportCommand) BuildItemFromInput() (godoo.TodoItem, error) {
+	return *godoo.NewTodoItem(godoo.WithPriorityLevel(godoo.None)), nil
+}
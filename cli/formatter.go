@@ -3,10 +3,15 @@ package cli
 // Don't want a dependency just for colours/formatting.
 // Colours & init func taken from https://twin.sh/articles/35/how-to-add-colors-to-your-console-terminal-output-in-go
 import (
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
 	"fmt"
 	"io"
 	"runtime"
+	"sort"
 	"strings"
+	"time"
 
 	godoo "github.com/mundacity/go-doo"
 	"github.com/mundacity/go-doo/util"
@@ -52,6 +57,279 @@ func printEditMessage(n int, w io.Writer) {
 	w.Write([]byte(msg))
 }
 
+// Runs after successfully deleting n items
+func printDeleteMessage(n int, w io.Writer) {
+	s := ""
+	if n == 0 || n > 1 {
+		s = "s"
+	}
+	msg := fmt.Sprintf("--> Deleted %v item%v\n", n, s)
+	w.Write([]byte(msg))
+}
+
+// Runs after applying n migrations
+func printMigrateMessage(n int, w io.Writer) {
+	s := ""
+	if n == 0 || n > 1 {
+		s = "s"
+	}
+	msg := fmt.Sprintf("--> Applied %v migration%v\n", n, s)
+	w.Write([]byte(msg))
+}
+
+// Runs after backing up to path, having removed n old snapshots
+func printBackupMessage(path string, n int, w io.Writer) {
+	msg := fmt.Sprintf("--> Backed up to %v", path)
+	if n > 0 {
+		s := ""
+		if n > 1 {
+			s = "s"
+		}
+		msg += fmt.Sprintf("; removed %v old snapshot%v", n, s)
+	}
+	w.Write([]byte(msg + "\n"))
+}
+
+// Runs after restoring from the backup at path
+func printRestoreMessage(path string, w io.Writer) {
+	msg := fmt.Sprintf("--> Restored from %v\n", path)
+	w.Write([]byte(msg))
+}
+
+// Runs after importing items from a file
+func printImportMessage(added, skipped int, w io.Writer) {
+	s := ""
+	if added == 0 || added > 1 {
+		s = "s"
+	}
+	msg := fmt.Sprintf("--> Imported %v item%v", added, s)
+	if skipped > 0 {
+		msg += fmt.Sprintf("; skipped %v already there", skipped)
+	}
+	w.Write([]byte(msg + "\n"))
+}
+
+// Lists each migration along with when it was applied, or that it's still pending
+func buildMigrationOutput(infos []godoo.MigrationInfo) string {
+	var str string
+	pending := 0
+	for _, m := range infos {
+		state := Yellow + "pending" + Reset
+		if m.Applied {
+			state = Green + "applied" + Reset + " " + m.AppliedAt
+		} else {
+			pending++
+		}
+		str += fmt.Sprintf("-- [%v] %v\n\t%v\n", m.Version, m.Description, state)
+	}
+	str += fmt.Sprintf("--> %v pending\n", pending)
+	return str
+}
+
+// Lists each change along with who made it & which fields it touched
+func buildHistoryOutput(entries []godoo.HistoryEntry) string {
+	var str string
+	for _, e := range entries {
+		action := string(e.Action)
+		if e.Undoes != 0 {
+			action += " (undo)"
+		}
+		str += fmt.Sprintf(Yellow+"-- [%v]"+Reset+" %v "+Cyan+"%v"+Reset+" by %v\n", e.Id, e.OccurredAt.Local().Format("2006-01-02 15:04:05"), action, e.Client)
+		for _, c := range getHistoryChanges(e.Before, e.After) {
+			str += "\t- " + c + "\n"
+		}
+	}
+
+	c := len(entries)
+	s := ""
+	if c == 0 || c > 1 {
+		s = "s"
+	}
+	str += fmt.Sprintf("--> Returned %v change%v\n", c, s)
+	return str
+}
+
+// Lists each reverted change, showing the item going back to how it was
+func buildUndoOutput(entries []godoo.HistoryEntry) string {
+	var str string
+	for _, e := range entries {
+		str += fmt.Sprintf(Yellow+"-- Id: %v"+Reset+" "+Cyan+"%v"+Reset+" reverted\n", e.ItemId, e.Action)
+		for _, c := range getHistoryChanges(e.After, e.Before) {
+			str += "\t- " + c + "\n"
+		}
+	}
+
+	c := len(entries)
+	s := ""
+	if c == 0 || c > 1 {
+		s = "s"
+	}
+	str += fmt.Sprintf("--> Undid %v change%v\n", c, s)
+	return str
+}
+
+// Runs after creating a token; the only time it's shown
+func printTokenCreatedMessage(tkn godoo.Token, raw string, w io.Writer) {
+	msg := fmt.Sprintf("--> Created token %v for %v:\n\t%v\n", tkn.Id, tkn.Owner, raw)
+	msg += Yellow + "--> Copy it now; it can't be shown again" + Reset + "\n"
+	w.Write([]byte(msg))
+}
+
+func printTokenRevokedMessage(id int, w io.Writer) {
+	msg := fmt.Sprintf("--> Revoked token %v\n", id)
+	w.Write([]byte(msg))
+}
+
+// Lists each token's owner & whether it's still usable
+func buildTokenOutput(tkns []godoo.Token) string {
+	var str string
+	active := 0
+	for _, t := range tkns {
+		state := Green + "active" + Reset
+		if !t.RevokedAt.IsZero() {
+			state = Red + "revoked" + Reset + " " + t.RevokedAt.Local().Format("2006-01-02 15:04:05")
+		} else {
+			active++
+		}
+		str += fmt.Sprintf(Yellow+"-- [%v]"+Reset+" %v, created %v\n\t%v\n", t.Id, t.Owner, t.CreatedAt.Local().Format("2006-01-02 15:04:05"), state)
+	}
+	str += fmt.Sprintf("--> %v active\n", active)
+	return str
+}
+
+// Runs when an add or edit couldn't reach the server & was queued instead
+func printQueuedMessage(w io.Writer) {
+	msg := Yellow + "--> Server unreachable; change saved for 'godoo sync'" + Reset + "\n"
+	w.Write([]byte(msg))
+}
+
+// Lists each item a queued edit wasn't applied to, then what was sent
+func buildSyncOutput(rep godoo.SyncReport) string {
+	var str string
+	for _, c := range rep.Conflicts {
+		id := "-"
+		if c.ItemId != 0 {
+			id = fmt.Sprint(c.ItemId)
+		}
+		str += fmt.Sprintf(Red+"-- Id: %v"+Reset+" "+Cyan+"%v"+Reset+" (queued %v) not applied: %v\n", id, c.Entry.Action, c.Entry.QueuedAt.Local().Format("2006-01-02 15:04:05"), c.Reason)
+	}
+
+	s := ""
+	if rep.Sent != 1 {
+		s = "s"
+	}
+	str += fmt.Sprintf("--> Sent %v queued change%v", rep.Sent, s)
+	if len(rep.Conflicts) > 0 {
+		s = ""
+		if len(rep.Conflicts) != 1 {
+			s = "s"
+		}
+		str += fmt.Sprintf("; %v conflict%v", len(rep.Conflicts), s)
+	}
+	if rep.Pending > 0 {
+		str += fmt.Sprintf("; %v still queued", rep.Pending)
+	} else {
+		str += fmt.Sprintf("; %v items cached", rep.Cached)
+	}
+	return str + "\n"
+}
+
+// Lists the items that stopped an edit going ahead
+func buildConflictOutput(conflicts []godoo.VersionConflict) string {
+	var str string
+	for _, c := range conflicts {
+		str += fmt.Sprintf(Red+"-- Id: %v"+Reset+" %v\n", c.ItemId, c.Reason())
+	}
+
+	s := ""
+	if len(conflicts) != 1 {
+		s = "s"
+	}
+	str += fmt.Sprintf("--> Nothing edited; %v item%v changed by someone else. Check them & try again.\n", len(conflicts), s)
+	return str
+}
+
+func buildPreviewOutput(p godoo.EditPreview) string {
+	var str string
+	for _, e := range p.Changes {
+		str += fmt.Sprintf(Yellow+"-- Id: %v"+Reset+" "+Cyan+"%v"+Reset+"\n", e.ItemId, e.Action)
+		for _, c := range getHistoryChanges(e.Before, e.After) {
+			str += "\t- " + c + "\n"
+		}
+	}
+
+	s := ""
+	if p.Matched != 1 {
+		s = "s"
+	}
+	str += fmt.Sprintf("--> %v item%v matched", p.Matched, s)
+	if p.Changes != nil { // nil if the repo can't say
+		s = ""
+		if len(p.Changes) != 1 {
+			s = "s"
+		}
+		str += fmt.Sprintf("; %v change%v would be made", len(p.Changes), s)
+	}
+	return str + "\n"
+}
+
+// Describes the fields that differ between before & after. Items that
+// were added or deleted only have their body shown.
+func getHistoryChanges(before, after *godoo.TodoItem) []string {
+	if before == nil && after == nil {
+		return nil
+	}
+	if before == nil {
+		return []string{fmt.Sprintf("body: '%v'", after.Body)}
+	}
+	if after == nil {
+		return []string{fmt.Sprintf("body: '%v'", before.Body)}
+	}
+
+	var ret []string
+	add := func(field string, b, a any) {
+		if b != a {
+			ret = append(ret, fmt.Sprintf("%v: '%v' -> '%v'", field, b, a))
+		}
+	}
+	add("body", before.Body, after.Body)
+	add("deadline", getDateOutput(before.Deadline), getDateOutput(after.Deadline))
+	add("priority", before.Priority, after.Priority)
+	add("parentId", before.ParentId, after.ParentId)
+	add("complete", before.IsComplete, after.IsComplete)
+	add("tags", getSortedTagOutput(before.Tags), getSortedTagOutput(after.Tags))
+	add("recurrence", before.Recurrence, after.Recurrence)
+	add("visibility", getVisibilityOutput(before.Visibility), getVisibilityOutput(after.Visibility))
+	return ret
+}
+
+// Items from before visibility was kept are shared
+func getVisibilityOutput(v godoo.Visibility) godoo.Visibility {
+	if v == "" {
+		return godoo.Shared
+	}
+	return v
+}
+
+func getDateOutput(d time.Time) string {
+	if d.IsZero() {
+		return "n/a"
+	}
+	return util.StringFromDate(d)
+}
+
+// Like getTagOutput, but always in the same order so that tag sets can be compared
+func getSortedTagOutput(mp map[string]struct{}) string {
+	var tgs []string
+	for t := range mp {
+		if len(t) > 0 {
+			tgs = append(tgs, t)
+		}
+	}
+	sort.Strings(tgs)
+	return strings.Join(tgs, "; ")
+}
+
 // Runs after successfully retrieving item/s. Returns a func that returns a formatted string
 func getOutputGenerationFunc(itms []godoo.TodoItem) func() string {
 	f := func() string {
@@ -70,6 +348,166 @@ func getOutputGenerationFunc(itms []godoo.TodoItem) func() string {
 	return f
 }
 
+// An item as written by the machine-readable formats. Field names match
+// TodoItem's json tags; dates are yyyy-mm-dd, completedAt is RFC3339 & any
+// unset date is empty.
+type itemRecord struct {
+	Id           int      `json:"itemId"`
+	ParentId     int      `json:"parentId"`
+	IsChild      bool     `json:"isChild"`
+	CreationDate string   `json:"creationDate"`
+	Deadline     string   `json:"deadlineDate"`
+	Priority     int      `json:"priority"`
+	Body         string   `json:"itemText"`
+	IsComplete   bool     `json:"isComplete"`
+	CompletedAt  string   `json:"completedAt"`
+	ChildItems   []int    `json:"children"`
+	Tags         []string `json:"tags"`
+	Recurrence   string   `json:"recurrence"`
+	Version      int      `json:"version"`
+	Owner        string   `json:"owner"`
+	Visibility   string   `json:"visibility"`
+	Source       string   `json:"source"`
+	Rank         float64  `json:"rank"`
+	Snippet      string   `json:"snippet"`
+}
+
+// Column headers for csv & tsv, in the same order as getItemRow
+var itemColumns = []string{"itemId", "parentId", "isChild", "creationDate", "deadlineDate", "priority", "itemText", "isComplete", "completedAt", "children", "tags", "recurrence", "version", "owner", "visibility", "source", "rank", "snippet"}
+
+// Dates are written with dl, the DATETIME_FORMAT layout
+func toItemRecord(itm godoo.TodoItem, dl string) itemRecord {
+	rec := itemRecord{Id: itm.Id, ParentId: itm.ParentId, IsChild: itm.IsChild, Priority: int(itm.Priority), Body: itm.Body,
+		IsComplete: itm.IsComplete, Recurrence: itm.Recurrence, Version: itm.Version, Owner: itm.Owner, Visibility: string(itm.Visibility),
+		Source: itm.Source, Rank: itm.Rank, Snippet: itm.Snippet}
+
+	if !itm.CreationDate.IsZero() {
+		rec.CreationDate = itm.CreationDate.Format(dl)
+	}
+	if !itm.Deadline.IsZero() {
+		rec.Deadline = itm.Deadline.Format(dl)
+	}
+	if !itm.CompletedAt.IsZero() {
+		rec.CompletedAt = itm.CompletedAt.Format(time.RFC3339)
+	}
+
+	rec.ChildItems = []int{}
+	for id := range itm.ChildItems {
+		rec.ChildItems = append(rec.ChildItems, id)
+	}
+	sort.Ints(rec.ChildItems)
+
+	rec.Tags = []string{}
+	for t := range itm.Tags {
+		if len(t) > 0 {
+			rec.Tags = append(rec.Tags, t)
+		}
+	}
+	sort.Strings(rec.Tags)
+	return rec
+}
+
+// Lists & maps are joined with delim, the same delimiter used for tag input
+func getItemRow(rec itemRecord, delim string) []string {
+	var children []string
+	for _, id := range rec.ChildItems {
+		children = append(children, fmt.Sprint(id))
+	}
+	return []string{fmt.Sprint(rec.Id), fmt.Sprint(rec.ParentId), fmt.Sprint(rec.IsChild), rec.CreationDate, rec.Deadline, fmt.Sprint(rec.Priority), rec.Body,
+		fmt.Sprint(rec.IsComplete), rec.CompletedAt, strings.Join(children, delim), strings.Join(rec.Tags, delim), rec.Recurrence, fmt.Sprint(rec.Version), rec.Owner, rec.Visibility, rec.Source, fmt.Sprint(rec.Rank), rec.Snippet}
+}
+
+// Runs after successfully retrieving item/s when a machine-readable format
+// has been asked for. No colours, & no summary line after the items.
+func getFormattedOutputFunc(itms []godoo.TodoItem, f outputFormat, delim, dl string) func() string {
+	return func() string {
+		recs := []itemRecord{}
+		for _, itm := range itms {
+			recs = append(recs, toItemRecord(itm, dl))
+		}
+
+		var b bytes.Buffer
+		switch f {
+		case jsonFormat:
+			enc := json.NewEncoder(&b)
+			enc.SetEscapeHTML(false)
+			enc.SetIndent("", "  ")
+			enc.Encode(recs)
+		case ndjsonFormat:
+			enc := json.NewEncoder(&b)
+			enc.SetEscapeHTML(false)
+			for _, rec := range recs {
+				enc.Encode(rec)
+			}
+		case csvFormat, tsvFormat:
+			cw := csv.NewWriter(&b)
+			if f == tsvFormat {
+				cw.Comma = '\t'
+			}
+			cw.Write(itemColumns)
+			for _, rec := range recs {
+				cw.Write(getItemRow(rec, delim))
+			}
+			cw.Flush()
+		}
+		return b.String()
+	}
+}
+
+// Runs after successfully retrieving a subtree. Returns a func that returns
+// the items as an indented tree, with rootId at the top
+func getTreeOutputGenerationFunc(itms []godoo.TodoItem, rootId int) func() string {
+	f := func() string {
+		mp := make(map[int]godoo.TodoItem)
+		for _, itm := range itms {
+			mp[itm.Id] = itm
+		}
+
+		var str string
+		if root, exists := mp[rootId]; exists {
+			visited := make(map[int]struct{})
+			str = buildTreeOutput(root, mp, visited, 0)
+		}
+
+		c := len(itms)
+		s := ""
+		if c == 0 || c > 1 {
+			s = "s"
+		}
+		str += fmt.Sprintf("--> Returned %v item%v\n", c, s)
+		return str
+	}
+	return f
+}
+
+// Writes a single line for itm, then recursively does the same
+// for its children, one tab further in
+func buildTreeOutput(itm godoo.TodoItem, mp map[int]godoo.TodoItem, visited map[int]struct{}, depth int) string {
+	if _, seen := visited[itm.Id]; seen {
+		return ""
+	}
+	visited[itm.Id] = struct{}{}
+
+	done := Red + "[ ]" + Reset
+	if itm.IsComplete {
+		done = Green + "[x]" + Reset
+	}
+	retStr := fmt.Sprintf("%v%v "+Yellow+"%v"+Reset+" %v\n", strings.Repeat("\t", depth), done, itm.Id, itm.Body)
+
+	var children []int
+	for id := range itm.ChildItems {
+		children = append(children, id)
+	}
+	sort.Ints(children)
+
+	for _, id := range children {
+		if child, exists := mp[id]; exists {
+			retStr += buildTreeOutput(child, mp, visited, depth+1)
+		}
+	}
+	return retStr
+}
+
 func buildOutput(itm godoo.TodoItem) string {
 	var retStr string
 	tagOut := getTagOutput(itm.Tags)
@@ -80,11 +518,32 @@ func buildOutput(itm godoo.TodoItem) string {
 	done := Red + "Not done" + Reset
 	if itm.IsComplete {
 		done = Green + "Done" + Reset
+		if !itm.CompletedAt.IsZero() {
+			done = Green + "Done " + util.StringFromDate(itm.CompletedAt) + Reset
+		}
+	}
+	if itm.Source != "" {
+		done += "][" + Purple + itm.Source + Reset
+	}
+	if itm.Recurrence != "" {
+		done += "][" + Blue + "repeats " + itm.Recurrence + Reset
+	}
+	if itm.Owner != "" {
+		done += "][" + Gray + fmt.Sprintf("%v, %v", itm.Owner, getVisibilityOutput(itm.Visibility)) + Reset
 	}
 	retStr += fmt.Sprintf(Yellow+"-- Id:"+Reset+" [%v][%v]\n\t"+Cyan+"- Created:"+Reset+"  %v     "+Cyan+"ParentId:"+Reset+" %v     "+Cyan+"Priority:"+Reset+" %v\n\t"+Cyan+"- Deadline:"+Reset+" %v\n\t"+Cyan+"- Tags:"+Reset+"     %v\n\t"+Cyan+"- Body:"+Reset+"     %v\n", itm.Id, done, util.StringFromDate(itm.CreationDate), itm.ParentId, itm.Priority, deadline, tagOut, itm.Body)
+	if itm.Snippet != "" {
+		retStr += fmt.Sprintf("\t"+Cyan+"- Match:"+Reset+"    %v\n", highlight(itm.Snippet))
+	}
 	return retStr
 }
 
+// Swaps the snippet's match markers for colours
+func highlight(snippet string) string {
+	r := strings.NewReplacer(godoo.HighlightStart, Yellow, godoo.HighlightEnd, Reset)
+	return r.Replace(snippet)
+}
+
 func getTagOutput(mp map[string]struct{}) string {
 	var ret string
 	sep := "; "
@@ -1,14 +1,12 @@
 package cli
 
 import (
-	"bytes"
-	"encoding/json"
 	"flag"
 	"fmt"
 	"io"
-	"net/http"
 	"runtime"
 	"strings"
+	"text/template"
 	"time"
 
 	godoo "github.com/mundacity/go-doo"
@@ -21,15 +19,27 @@ type GetCommand struct {
 	id             int
 	next           bool   // default to priority, but can be changed by nextByDate flag
 	tagInput       string // tags with delimeter set by environment variable
+	anyTag         bool   // match items with any of the tags rather than all
 	bodyPhrase     string // key phrase within body
 	childOf        int    // child of the int argument
 	parentOf       int    // parent of the int argument
 	deadlineDate   string
 	creationDate   string
+	completedOn    string // date or date range during which items were completed
 	getAll         bool
 	complete       bool
 	toggleComplete bool
 	nextByDate     bool
+	treeRoot       int    // id of item at the top of a subtree
+	searchExpr     string // full-text search expression
+	query          string // boolean query, e.g. 'tag:work or not done'
+	format         outputFormat
+	template       string // text/template source, or the name of one from the config
+	sortKeys       string // comma separated, e.g. 'deadline,priority'
+	descending     bool
+	limit          int
+	offset         int
+	cursor         string // from the previous page's hint
 }
 
 // Returns new get command after setting up flag info and flag-parser
@@ -51,14 +61,26 @@ func (getCmd *GetCommand) setupFlagSet() {
 	getCmd.fs.BoolVar(&getCmd.nextByDate, strings.Trim(string(godoo.DateMode), "-"), false, "get next item by date priority")
 	getCmd.fs.StringVar(&getCmd.deadlineDate, strings.Trim(string(godoo.Date), "-"), "", "date of existing item; if empty, modifies -n to return based on date instead of defaulting to priority")
 	getCmd.fs.StringVar(&getCmd.creationDate, strings.Trim(string(godoo.Creation), "-"), "", "creation date of existing item")
-	getCmd.fs.StringVar(&getCmd.tagInput, strings.Trim(string(godoo.Tag), "-"), "", "search by item tag")
+	getCmd.fs.StringVar(&getCmd.completedOn, strings.Trim(string(godoo.CompletedBetween), "-"), "", "date (range) during which items were completed")
+	getCmd.fs.StringVar(&getCmd.tagInput, strings.Trim(string(godoo.Tag), "-"), "", "search by item tag; separate several with the tag delimiter to find items with all of them")
+	getCmd.fs.BoolVar(&getCmd.anyTag, strings.Trim(string(godoo.AnyTag), "-"), false, "with several tags, find items with any of them")
 	getCmd.fs.StringVar(&getCmd.bodyPhrase, strings.Trim(string(godoo.Body), "-"), "", "search by known phrase within body")
+	getCmd.fs.StringVar(&getCmd.searchExpr, strings.Trim(string(godoo.Search), "-"), "", "full-text search of bodies & tags; supports AND/OR/NOT & prefix* terms")
+	getCmd.fs.StringVar(&getCmd.query, strings.Trim(string(godoo.Query), "-"), "", "boolean query combining conditions with and, or, not & brackets, e.g. 'tag:work or not done'")
 
 	getCmd.fs.IntVar(&getCmd.childOf, strings.Trim(string(godoo.Child), "-"), 0, "search based on parent Id; requested item is child of provided parent id")
 	getCmd.fs.IntVar(&getCmd.parentOf, strings.Trim(string(godoo.Parent), "-"), 0, "search based on child Id; requested item is parent of provided child id")
 	getCmd.fs.BoolVar(&getCmd.getAll, strings.Trim(string(godoo.All), "-"), false, "get all items")
 	getCmd.fs.BoolVar(&getCmd.complete, strings.Trim(string(godoo.Finished), "-"), false, "search for completed items")
 	getCmd.fs.BoolVar(&getCmd.toggleComplete, strings.Trim(string(godoo.MarkComplete), "-"), false, "search for unfinished items")
+	getCmd.fs.IntVar(&getCmd.treeRoot, strings.Trim(string(godoo.Tree), "-"), 0, "get item and all of its descendants, displayed as a tree")
+	getCmd.fs.StringVar((*string)(&getCmd.format), strings.Trim(string(godoo.Format), "-"), "", "machine-readable output - json, ndjson, csv or tsv")
+	getCmd.fs.StringVar(&getCmd.template, strings.Trim(string(godoo.Template), "-"), "", "output each item with a text/template, or a named template from the config")
+	getCmd.fs.StringVar(&getCmd.sortKeys, strings.Trim(string(godoo.Sort), "-"), "", "order by id, deadline, creation, priority and/or body; comma separated")
+	getCmd.fs.BoolVar(&getCmd.descending, strings.Trim(string(godoo.Descending), "-"), false, "reverse the order")
+	getCmd.fs.IntVar(&getCmd.limit, strings.Trim(string(godoo.Limit), "-"), 0, "return at most this many items")
+	getCmd.fs.IntVar(&getCmd.offset, strings.Trim(string(godoo.Offset), "-"), 0, "skip this many items first")
+	getCmd.fs.StringVar(&getCmd.cursor, strings.Trim(string(godoo.Cursor), "-"), "", "start after the previous page; used instead of the offset")
 
 }
 
@@ -79,6 +101,25 @@ func (g *GetCommand) ParseInput() error {
 // Implements Run() method from ICommand interface
 func (gCmd *GetCommand) Run(w io.Writer) error {
 
+	if gCmd.format != "" && !isFormatIn(gCmd.format, itemFormats) {
+		lg.Logger.LogWithCallerInfo(lg.Error, fmt.Sprintf("unknown output format: %v", gCmd.format), runtime.Caller)
+		return &UnknownFormatError{Format: string(gCmd.format), Allowed: itemFormats}
+	}
+	if gCmd.format != "" && gCmd.template != "" {
+		lg.Logger.LogWithCallerInfo(lg.Error, "format & template both used", runtime.Caller)
+		return &InvalidArgumentError{}
+	}
+
+	var tmpl *template.Template
+	if gCmd.template != "" {
+		t, err := parseItemTemplate(gCmd.template, gCmd.conf)
+		if err != nil {
+			lg.Logger.LogWithCallerInfo(lg.Error, fmt.Sprintf("invalid template: %v", err), runtime.Caller)
+			return err
+		}
+		tmpl = t
+	}
+
 	input, _ := gCmd.BuildItemFromInput()
 
 	var itms []godoo.TodoItem
@@ -89,30 +130,72 @@ func (gCmd *GetCommand) Run(w io.Writer) error {
 		return err
 	}
 
-	fullQry := godoo.FullUserQuery{QueryOptions: qList, QueryData: input}
+	fullQry := godoo.FullUserQuery{QueryOptions: qList, QueryData: input, SearchText: gCmd.searchExpr,
+		Sort: gCmd.getSortKeys(), Descending: gCmd.descending, Limit: gCmd.limit, Offset: gCmd.offset, Cursor: gCmd.cursor}
 
-	if gCmd.conf.Instance == godoo.Remote {
-		return gCmd.remoteGet(w, fullQry)
+	if err = godoo.ValidateSortKeys(fullQry.Sort); err != nil {
+		lg.Logger.LogWithCallerInfo(lg.Error, fmt.Sprintf("invalid sort key: %v", err), runtime.Caller)
+		return err
+	}
+	if gCmd.limit < 0 || gCmd.offset < 0 {
+		lg.Logger.LogWithCallerInfo(lg.Error, "negative limit or offset", runtime.Caller)
+		return &InvalidArgumentError{}
+	}
+	if gCmd.query != "" {
+		e, err := godoo.ParseQueryExpr(gCmd.query, gCmd.conf.DateLayout)
+		if err != nil {
+			lg.Logger.LogWithCallerInfo(lg.Error, fmt.Sprintf("invalid query: %v", err), runtime.Caller)
+			return err
+		}
+		fullQry.Expr = &e
 	}
 
-	itms, err = gCmd.conf.TodoRepo.GetWhere(fullQry)
+	itms, next, err := godoo.GetPage(gCmd.conf.TodoRepo, fullQry)
 	if err != nil {
 		lg.Logger.LogWithCallerInfo(lg.Error, fmt.Sprintf("failed to get item: %v", err), runtime.Caller)
 		return err
 	}
 
 	msg := getOutputGenerationFunc(itms)
+	if gCmd.format != "" {
+		msg = getFormattedOutputFunc(itms, gCmd.format, gCmd.conf.TagDelim, gCmd.conf.DateLayout)
+	} else if tmpl != nil {
+		out, err := buildTemplateOutput(itms, tmpl)
+		if err != nil {
+			lg.Logger.LogWithCallerInfo(lg.Error, fmt.Sprintf("failed to apply template: %v", err), runtime.Caller)
+			return err
+		}
+		msg = func() string { return out }
+	} else if gCmd.treeRoot != 0 {
+		msg = getTreeOutputGenerationFunc(itms, gCmd.treeRoot)
+	}
 	w.Write([]byte(msg()))
-	lg.Logger.Log(lg.Info, "local item successfully retrieved")
+	if next != "" && gCmd.format == "" && tmpl == nil {
+		w.Write([]byte(fmt.Sprintf("--> More with %v %v\n", godoo.Cursor, next)))
+	}
+	lg.Logger.Logf(lg.Info, "successfully retrieved %v item/s", len(itms))
 
 	return nil
 }
 
+func (gCmd *GetCommand) getSortKeys() []godoo.SortKey {
+	var ret []godoo.SortKey
+	for _, k := range strings.Split(gCmd.sortKeys, ",") {
+		if k = strings.ToLower(strings.TrimSpace(k)); k != "" {
+			ret = append(ret, godoo.SortKey(k))
+		}
+	}
+	return ret
+}
+
 // Populates a godoo.TodoItem with user-supplied data to query database
 func (gCmd *GetCommand) BuildItemFromInput() (godoo.TodoItem, error) {
 	ret := godoo.NewTodoItem(godoo.WithPriorityLevel(godoo.None))
 
 	ret.Id = gCmd.id
+	if gCmd.treeRoot != 0 {
+		ret.Id = gCmd.treeRoot
+	}
 	if gCmd.childOf != 0 {
 		ret.ParentId = gCmd.childOf
 		ret.IsChild = true
@@ -130,12 +213,14 @@ func (gCmd *GetCommand) BuildItemFromInput() (godoo.TodoItem, error) {
 		splt := strings.Split(gCmd.deadlineDate, ":")
 		ret.Deadline, _ = time.Parse(gCmd.conf.DateLayout, splt[0])
 	}
+	if gCmd.completedOn != "" {
+		splt := strings.Split(gCmd.completedOn, ":")
+		ret.CompletedAt, _ = time.Parse(gCmd.conf.DateLayout, splt[0])
+	}
 	if gCmd.bodyPhrase != "" {
 		ret.Body = gCmd.bodyPhrase
 	}
-	if gCmd.tagInput != "" {
-		ret.Tags[gCmd.tagInput] = struct{}{}
-	}
+	parseTagInput(ret, gCmd.tagInput, gCmd.conf.TagDelim)
 	if gCmd.complete {
 		ret.IsComplete = true
 	} else if gCmd.toggleComplete {
@@ -153,6 +238,11 @@ func (gCmd *GetCommand) DetermineQueryType(qType godoo.QueryType) ([]godoo.UserQ
 		return ret, nil // no further params needed/allowed
 	}
 
+	if gCmd.treeRoot != 0 {
+		ret = append(ret, godoo.UserQueryOption{Elem: godoo.BySubtree})
+		return ret, nil // whole subtree; other params not allowed
+	}
+
 	// by id numbers
 	if gCmd.id != 0 {
 		ret = append(ret, godoo.UserQueryOption{Elem: godoo.ById})
@@ -169,10 +259,16 @@ func (gCmd *GetCommand) DetermineQueryType(qType godoo.QueryType) ([]godoo.UserQ
 	// by string
 	if gCmd.tagInput != "" {
 		ret = append(ret, godoo.UserQueryOption{Elem: godoo.ByTag})
+		if gCmd.anyTag {
+			ret = append(ret, godoo.UserQueryOption{Elem: godoo.ByAnyTag})
+		}
 	}
 	if gCmd.bodyPhrase != "" {
 		ret = append(ret, godoo.UserQueryOption{Elem: godoo.ByBody})
 	}
+	if gCmd.searchExpr != "" {
+		ret = append(ret, godoo.UserQueryOption{Elem: godoo.ByFullText})
+	}
 
 	// by times
 	if len(gCmd.deadlineDate) > 0 {
@@ -184,6 +280,10 @@ func (gCmd *GetCommand) DetermineQueryType(qType godoo.QueryType) ([]godoo.UserQ
 		d := getUpperDateBound(gCmd.creationDate, gCmd.conf.DateLayout)
 		ret = append(ret, godoo.UserQueryOption{Elem: godoo.ByCreationDate, UpperBoundDate: d})
 	}
+	if gCmd.completedOn != "" {
+		d := getUpperDateBound(gCmd.completedOn, gCmd.conf.DateLayout)
+		ret = append(ret, godoo.UserQueryOption{Elem: godoo.ByCompletionDate, UpperBoundDate: d})
+	}
 	if gCmd.complete || gCmd.toggleComplete {
 		ret = append(ret, godoo.UserQueryOption{Elem: godoo.ByCompletion})
 	}
@@ -191,48 +291,3 @@ func (gCmd *GetCommand) DetermineQueryType(qType godoo.QueryType) ([]godoo.UserQ
 	lg.Logger.QuickFmtLog(lg.Info, "query options (getting): ", ", ", ret)
 	return ret, nil
 }
-
-// Coordinates request/response in remote mode
-func (gCmd *GetCommand) remoteGet(w io.Writer, fq godoo.FullUserQuery) error {
-
-	// --> very happy path; need to test
-	baseUrl := gCmd.conf.RemoteUrl + "/get"
-
-	// building request
-	body, err := json.Marshal(fq)
-	if err != nil {
-		lg.Logger.LogWithCallerInfo(lg.Error, fmt.Sprintf("json marshalling error: %v", err), runtime.Caller)
-		return err
-	}
-
-	rq, err := http.NewRequest("GET", baseUrl, bytes.NewBuffer(body))
-	if err != nil {
-		lg.Logger.LogWithCallerInfo(lg.Error, fmt.Sprintf("request generation error: %v", err), runtime.Caller)
-		return err
-	}
-	rq.Header.Set("content-type", "application/json")
-
-	// getting response
-	resp, err := gCmd.conf.Client.Do(rq)
-	if err != nil {
-		lg.Logger.LogWithCallerInfo(lg.Error, fmt.Sprintf("error receiving response: %v", err), runtime.Caller)
-		return err
-	}
-	defer resp.Body.Close()
-
-	var itms []godoo.TodoItem
-	d := json.NewDecoder(resp.Body)
-	var err2 error
-
-	if err2 = d.Decode(&itms); err2 != nil {
-		lg.Logger.LogWithCallerInfo(lg.Error, fmt.Sprintf("json decoding error: %v", err2), runtime.Caller)
-	}
-
-	// printing to console
-	msg := getOutputGenerationFunc(itms)
-	w.Write([]byte(msg()))
-
-	lg.Logger.Logf(lg.Info, "successfully retrieved %v item/s", len(itms))
-
-	return nil
-}
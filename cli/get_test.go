@@ -1,10 +1,16 @@
 package cli
 
 import (
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
 	"fmt"
+	"strings"
 	"testing"
+	"time"
 
 	godoo "github.com/mundacity/go-doo"
+	lg "github.com/mundacity/quick-logger"
 )
 
 type get_test_case struct {
@@ -42,6 +48,31 @@ func _getTestCasesForGetting() []get_test_case {
 		expected: GetCommand{complete: false, deadlineDate: "2022-06-01:2022-06-18"},
 		err:      nil,
 		name:     "get incomplete with literal deadline range (maxLen be at least 21)",
+	}, {
+		args:     []string{"get", "-a", "--format", "csv"},
+		expected: GetCommand{getAll: true, format: csvFormat},
+		err:      nil,
+		name:     "get all as csv",
+	}, {
+		args:     []string{"get", "-t", "work", "--sort", "deadline,priority", "--desc", "--limit", "20", "--offset", "40"},
+		expected: GetCommand{tagInput: "work", sortKeys: "deadline,priority", descending: true, limit: 20, offset: 40},
+		err:      nil,
+		name:     "sorted & paged",
+	}, {
+		args:     []string{"get", "-a", "--limit", "20", "--cursor", "eyJpIjo0fQ"},
+		expected: GetCommand{getAll: true, limit: 20, cursor: "eyJpIjo0fQ"},
+		err:      nil,
+		name:     "next page by cursor",
+	}, {
+		args:     []string{"get", "-t", "work*urgent", "--any-tag"},
+		expected: GetCommand{tagInput: "work*urgent", anyTag: true},
+		err:      nil,
+		name:     "any of several tags",
+	}, {
+		args:     []string{"get", "-q", "(tag:work or tag:urgent) and not done"},
+		expected: GetCommand{query: "(tag:work or tag:urgent) and not done"},
+		err:      nil,
+		name:     "boolean query",
 	}}
 }
 
@@ -76,11 +107,36 @@ func getGetQueryBuildTestCases() []get_query_build_test_case {
 		name:       "body complete child",
 		expSrchLst: []godoo.UserQueryElement{godoo.ByBody, godoo.ByCompletion, godoo.ByParentId},
 		expSrchItm: *getTodoItm([]any{nil, 8, "multiple", nil, nil, true}),
+	}, {
+		input:      GetCommand{parentOf: 12},
+		name:       "parent of child",
+		expSrchLst: []godoo.UserQueryElement{godoo.ByChildId},
+		expSrchItm: godoo.TodoItem{ChildItems: map[int]struct{}{12: {}}},
+	}, {
+		input:      GetCommand{treeRoot: 4, bodyPhrase: "ignored"},
+		name:       "subtree",
+		expSrchLst: []godoo.UserQueryElement{godoo.BySubtree},
+		expSrchItm: *getTodoItm([]any{4, nil, "ignored", nil, nil, false}),
 	}, {
 		input:      GetCommand{complete: true},
 		name:       "completion",
 		expSrchLst: []godoo.UserQueryElement{godoo.ByCompletion},
 		expSrchItm: *getTodoItm([]any{nil, nil, nil, nil, nil, true}),
+	}, {
+		input:      GetCommand{searchExpr: "deploy AND staging", tagInput: "work"},
+		name:       "full-text search with tag",
+		expSrchLst: []godoo.UserQueryElement{godoo.ByTag, godoo.ByFullText},
+		expSrchItm: *getTodoItm([]any{nil, nil, nil, "work", nil, false}),
+	}, {
+		input:      GetCommand{tagInput: "work*urgent"},
+		name:       "all of several tags",
+		expSrchLst: []godoo.UserQueryElement{godoo.ByTag},
+		expSrchItm: godoo.TodoItem{Tags: map[string]struct{}{"work": {}, "urgent": {}}},
+	}, {
+		input:      GetCommand{tagInput: "work*urgent", anyTag: true},
+		name:       "any of several tags",
+		expSrchLst: []godoo.UserQueryElement{godoo.ByTag, godoo.ByAnyTag},
+		expSrchItm: godoo.TodoItem{Tags: map[string]struct{}{"work": {}, "urgent": {}}},
 	}}
 }
 
@@ -120,6 +176,7 @@ func TestGetQueryBuilding(t *testing.T) {
 }
 
 func runGetQueryBuildTests(t *testing.T, tc get_query_build_test_case) {
+	tc.input.conf = &godoo.ConfigVals{TagDelim: "*"}
 	gotSrchLst, _ := tc.input.DetermineQueryType(godoo.Get)
 	gotSrchItm, _ := tc.input.BuildItemFromInput()
 
@@ -169,5 +226,337 @@ func compareResults(exp, got GetCommand) (bool, string) {
 	if exp.complete != got.complete {
 		return false, fmt.Sprintf("No match on complete. Expected '%v', got '%v'", exp.complete, got.complete)
 	}
+	if exp.sortKeys != got.sortKeys || exp.descending != got.descending {
+		return false, fmt.Sprintf("No match on sorting. Expected '%v %v', got '%v %v'", exp.sortKeys, exp.descending, got.sortKeys, got.descending)
+	}
+	if exp.limit != got.limit || exp.offset != got.offset || exp.cursor != got.cursor {
+		return false, fmt.Sprintf("No match on paging. Expected '%v/%v/%v', got '%v/%v/%v'", exp.limit, exp.offset, exp.cursor, got.limit, got.offset, got.cursor)
+	}
+	if exp.anyTag != got.anyTag {
+		return false, fmt.Sprintf("No match on anyTag. Expected '%v', got '%v'", exp.anyTag, got.anyTag)
+	}
+	if exp.query != got.query {
+		return false, fmt.Sprintf("No match on query. Expected '%v', got '%v'", exp.query, got.query)
+	}
+	if exp.format != got.format {
+		return false, fmt.Sprintf("No match on format. Expected '%v', got '%v'", exp.format, got.format)
+	}
 	return true, "all field values matching"
 }
+
+// only GetWhere is needed; the rest satisfies IRepository
+type itemsRepo struct{ godoo.IRepository }
+
+func (i itemsRepo) GetWhere(fq godoo.FullUserQuery) ([]godoo.TodoItem, error) {
+	return []godoo.TodoItem{{
+		Id:           1,
+		CreationDate: time.Date(2022, 6, 1, 0, 0, 0, 0, time.UTC),
+		Body:         "write report, \"final\" draft",
+		Priority:     godoo.High,
+		ChildItems:   map[int]struct{}{3: {}, 2: {}},
+		Tags:         map[string]struct{}{"work": {}, "dev": {}},
+	}, {
+		Id:           2,
+		ParentId:     1,
+		IsChild:      true,
+		CreationDate: time.Date(2022, 6, 2, 0, 0, 0, 0, time.UTC),
+		Deadline:     time.Date(2022, 6, 9, 0, 0, 0, 0, time.UTC),
+		Body:         "proofread",
+		IsComplete:   true,
+		CompletedAt:  time.Date(2022, 6, 3, 9, 30, 0, 0, time.UTC),
+	}}, nil
+}
+
+type get_format_test_case struct {
+	format outputFormat
+	check  func(out string) error
+	expErr error
+	name   string
+}
+
+func getGetFormatTestCases() []get_format_test_case {
+	return []get_format_test_case{{
+		format: jsonFormat,
+		check: func(out string) error {
+			var recs []map[string]any
+			if err := json.Unmarshal([]byte(out), &recs); err != nil {
+				return err
+			}
+			if len(recs) != 2 || recs[0]["itemText"] != "write report, \"final\" draft" || recs[1]["completedAt"] != "2022-06-03T09:30:00Z" {
+				return fmt.Errorf("unexpected records: %v", recs)
+			}
+			if fmt.Sprint(recs[0]["tags"]) != "[dev work]" || fmt.Sprint(recs[0]["children"]) != "[2 3]" || recs[0]["deadlineDate"] != "" {
+				return fmt.Errorf("unexpected record: %v", recs[0])
+			}
+			return nil
+		},
+		name: "json",
+	}, {
+		format: ndjsonFormat,
+		check: func(out string) error {
+			lines := strings.Split(strings.TrimSpace(out), "\n")
+			if len(lines) != 2 {
+				return fmt.Errorf("expected 2 lines, got %v", len(lines))
+			}
+			var rec map[string]any
+			if err := json.Unmarshal([]byte(lines[1]), &rec); err != nil {
+				return err
+			}
+			if rec["itemId"] != 2.0 || rec["isComplete"] != true {
+				return fmt.Errorf("unexpected record: %v", rec)
+			}
+			return nil
+		},
+		name: "ndjson",
+	}, {
+		format: csvFormat,
+		check: func(out string) error {
+			rows, err := csv.NewReader(strings.NewReader(out)).ReadAll()
+			if err != nil {
+				return err
+			}
+			if len(rows) != 3 || strings.Join(rows[0], ",") != strings.Join(itemColumns, ",") {
+				return fmt.Errorf("unexpected header: %v", rows)
+			}
+			if rows[1][6] != "write report, \"final\" draft" || rows[1][10] != "dev*work" || rows[2][4] != "2022-06-09" {
+				return fmt.Errorf("unexpected rows: %v", rows[1:])
+			}
+			return nil
+		},
+		name: "csv",
+	}, {
+		format: tsvFormat,
+		check: func(out string) error {
+			r := csv.NewReader(strings.NewReader(out))
+			r.Comma = '\t'
+			rows, err := r.ReadAll()
+			if err != nil || len(rows) != 3 || len(rows[0]) != len(itemColumns) {
+				return fmt.Errorf("unexpected rows: %v (err: %v)", rows, err)
+			}
+			return nil
+		},
+		name: "tsv",
+	}, {
+		format: "xml",
+		expErr: &UnknownFormatError{},
+		name:   "unknown format",
+	}}
+}
+
+func TestGetFormats(t *testing.T) {
+	lg.Logger = lg.NewDummyLogger()
+	tcs := getGetFormatTestCases()
+	for _, tc := range tcs {
+		t.Run(tc.name, func(t *testing.T) {
+			runGetFormatTest(t, tc)
+		})
+	}
+}
+
+func runGetFormatTest(t *testing.T, tc get_format_test_case) {
+	conf := godoo.ConfigVals{TodoRepo: itemsRepo{}, TagDelim: "*", DateLayout: "2006-01-02"}
+	gCmd := GetCommand{conf: &conf, getAll: true, format: tc.format}
+
+	var b bytes.Buffer
+	err := gCmd.Run(&b)
+	if (err == nil) != (tc.expErr == nil) {
+		t.Fatalf(">>>>FAILED (err): expected '%v', got '%v'", tc.expErr, err)
+	}
+	if tc.check == nil {
+		return
+	}
+
+	if strings.Contains(b.String(), "\033[") || strings.Contains(b.String(), "Returned") {
+		t.Errorf(">>>>FAILED: output shouldn't contain colours or a summary, got '%v'", b.String())
+	}
+	if err = tc.check(b.String()); err != nil {
+		t.Errorf(">>>>FAILED: %v", err)
+	}
+}
+
+// keeps the query it was given
+type queryRepo struct {
+	itemsRepo
+	qry *godoo.FullUserQuery
+}
+
+func (q queryRepo) GetWhere(fq godoo.FullUserQuery) ([]godoo.TodoItem, error) {
+	*q.qry = fq
+	itms, _ := q.itemsRepo.GetWhere(fq)
+	return godoo.PageItems(itms, fq.Offset, fq.Limit), nil
+}
+
+type get_paging_test_case struct {
+	cmd     GetCommand
+	expSort []godoo.SortKey
+	expMore bool
+	expErr  bool
+	name    string
+}
+
+func getGetPagingTestCases() []get_paging_test_case {
+	return []get_paging_test_case{{
+		cmd:     GetCommand{sortKeys: "Deadline, priority", limit: 1},
+		expSort: []godoo.SortKey{godoo.SortByDeadline, godoo.SortByPriority},
+		expMore: true,
+		name:    "more to come",
+	}, {
+		cmd:  GetCommand{limit: 2},
+		name: "last page exactly full",
+	}, {
+		cmd:  GetCommand{limit: 5},
+		name: "last page",
+	}, {
+		cmd:    GetCommand{sortKeys: "colour"},
+		expErr: true,
+		name:   "unknown sort key",
+	}, {
+		cmd:    GetCommand{offset: -1},
+		expErr: true,
+		name:   "negative offset",
+	}}
+}
+
+func TestGetPaging(t *testing.T) {
+	lg.Logger = lg.NewDummyLogger()
+	tcs := getGetPagingTestCases()
+	for _, tc := range tcs {
+		t.Run(tc.name, func(t *testing.T) {
+			runGetPagingTest(t, tc)
+		})
+	}
+}
+
+func runGetPagingTest(t *testing.T, tc get_paging_test_case) {
+	var qry godoo.FullUserQuery
+	gCmd := tc.cmd
+	gCmd.getAll = true
+	gCmd.conf = &godoo.ConfigVals{TodoRepo: queryRepo{qry: &qry}}
+
+	var b bytes.Buffer
+	err := gCmd.Run(&b)
+	if (err != nil) != tc.expErr {
+		t.Fatalf(">>>>FAILED (err): expected error: %v, got '%v'", tc.expErr, err)
+	}
+	if err != nil {
+		return
+	}
+
+	// an extra item is asked for to tell whether there's another page
+	if fmt.Sprint(qry.Sort) != fmt.Sprint(tc.expSort) || qry.Limit != tc.cmd.limit+1 {
+		t.Errorf(">>>>FAILED: unexpected query sort %v, limit %v", qry.Sort, qry.Limit)
+	}
+	hint := "More with --cursor " + godoo.NewCursor(godoo.TodoItem{Id: 1, CreationDate: time.Date(2022, 6, 1, 0, 0, 0, 0, time.UTC), Body: "write report, \"final\" draft", Priority: godoo.High})
+	if more := strings.Contains(b.String(), hint); more != tc.expMore {
+		t.Errorf(">>>>FAILED: expected next page hint: %v, got '%v'", tc.expMore, b.String())
+	}
+}
+
+// returns matches in the order it's asked for, as a real repo would
+type rankedRepo struct{ godoo.IRepository }
+
+func (r rankedRepo) GetWhere(fq godoo.FullUserQuery) ([]godoo.TodoItem, error) {
+	itms := []godoo.TodoItem{{Id: 1, Body: "deploy to staging", Rank: -3}, {Id: 2, Body: "check deployment logs", Rank: -1}}
+	if fq.Descending {
+		itms[0], itms[1] = itms[1], itms[0]
+	}
+	return itms, nil
+}
+
+func TestGetKeepsSearchOrder(t *testing.T) {
+	lg.Logger = lg.NewDummyLogger()
+	for _, desc := range []bool{false, true} {
+		gCmd := GetCommand{searchExpr: "deploy*", descending: desc, format: jsonFormat}
+		gCmd.conf = &godoo.ConfigVals{TodoRepo: rankedRepo{}}
+
+		var b bytes.Buffer
+		if err := gCmd.Run(&b); err != nil {
+			t.Fatalf(">>>>FAILED: %v", err)
+		}
+		var recs []itemRecord
+		json.Unmarshal(b.Bytes(), &recs)
+
+		exp := "[1 2]"
+		if desc {
+			exp = "[2 1]"
+		}
+		var got []int
+		for _, rec := range recs {
+			got = append(got, rec.Id)
+		}
+		if fmt.Sprint(got) != exp {
+			t.Errorf(">>>>FAILED: descending %v - expected %v, got %v", desc, exp, got)
+		}
+	}
+}
+
+type get_query_expr_test_case struct {
+	query   string
+	expExpr string // as written back out by QueryExpr.String()
+	expErr  bool
+	name    string
+}
+
+func getGetQueryExprTestCases() []get_query_expr_test_case {
+	return []get_query_expr_test_case{{
+		query:   "tag:work or tag:urgent and not done",
+		expExpr: "(tag:work or (tag:urgent and not done:true))",
+		name:    "precedence",
+	}, {
+		query:   "(tag:work OR tag:urgent) report",
+		expExpr: "((tag:work or tag:urgent) and body:report)",
+		name:    "grouping; bare words search the body",
+	}, {
+		query:   `body:"weekly report" priority:h deadline:2022-06-01:2022-06-30`,
+		expExpr: `(body:"weekly report" and priority:high and deadline:2022-06-01:2022-06-30)`,
+		name:    "quoted values, priority initials & date ranges",
+	}, {
+		query:  "tag:work and",
+		expErr: true,
+		name:   "missing condition",
+	}, {
+		query:  "(tag:work or done",
+		expErr: true,
+		name:   "missing bracket",
+	}, {
+		query:  "deadline:tomorrow",
+		expErr: true,
+		name:   "bad date",
+	}, {
+		query:  "colour:red",
+		expErr: true,
+		name:   "unknown field",
+	}}
+}
+
+func TestGetQueryExpr(t *testing.T) {
+	lg.Logger = lg.NewDummyLogger()
+	tcs := getGetQueryExprTestCases()
+	for _, tc := range tcs {
+		t.Run(tc.name, func(t *testing.T) {
+			runGetQueryExprTest(t, tc)
+		})
+	}
+}
+
+func runGetQueryExprTest(t *testing.T, tc get_query_expr_test_case) {
+	var qry godoo.FullUserQuery
+	gCmd := GetCommand{query: tc.query}
+	gCmd.conf = &godoo.ConfigVals{TodoRepo: queryRepo{qry: &qry}, DateLayout: "2006-01-02"}
+
+	var b bytes.Buffer
+	err := gCmd.Run(&b)
+	if (err != nil) != tc.expErr {
+		t.Fatalf(">>>>FAILED (err): expected error: %v, got '%v'", tc.expErr, err)
+	}
+	if err != nil {
+		if _, ok := err.(*godoo.QuerySyntaxError); !ok {
+			t.Errorf(">>>>FAILED: expected a syntax error, got '%v'", err)
+		}
+		return
+	}
+
+	if qry.Expr == nil || qry.Expr.String() != tc.expExpr {
+		t.Errorf(">>>>FAILED: expected '%v', got '%v'", tc.expExpr, qry.Expr)
+	}
+}
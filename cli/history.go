@@ -0,0 +1,88 @@
+package cli
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"runtime"
+	"strings"
+
+	godoo "github.com/mundacity/go-doo"
+	lg "github.com/mundacity/quick-logger"
+)
+
+// HistoryCommand implements the ICommand interface and lists
+// every recorded change to a single item, oldest first
+type HistoryCommand struct {
+	conf   *godoo.ConfigVals
+	fs     *flag.FlagSet
+	id     int
+	source string
+}
+
+// Returns a new HistoryCommand after setting up the flagset
+func NewHistoryCommand(conf *godoo.ConfigVals) *HistoryCommand {
+	hCmd := HistoryCommand{}
+	hCmd.conf = conf
+	lg.Logger.Log(lg.Info, "history command created")
+
+	hCmd.setupFlagSet()
+
+	return &hCmd
+}
+
+// Describes the flags and argument types associated with the command
+func (hCmd *HistoryCommand) setupFlagSet() {
+	hCmd.fs = flag.NewFlagSet("history", flag.ContinueOnError)
+	hCmd.fs.IntVar(&hCmd.id, strings.Trim(string(godoo.ItmId), "-"), 0, "show changes to the item with this id")
+	hCmd.fs.StringVar(&hCmd.source, strings.Trim(string(godoo.FromSource), "-"), "", "source the item is from")
+}
+
+// ParseInput implements method from ICommand interface
+func (hCmd *HistoryCommand) ParseInput() error {
+	newArgs, err := hCmd.conf.Parser.ParseUserInput()
+
+	if err != nil {
+		lg.Logger.LogWithCallerInfo(lg.Error, fmt.Sprintf("user input parsing error: %v", err), runtime.Caller)
+		return err
+	}
+
+	hCmd.conf.Args = newArgs
+	lg.Logger.Log(lg.Info, "successfully parsed user input")
+	return hCmd.fs.Parse(hCmd.conf.Args)
+}
+
+// Implements ICommand Run() method
+func (hCmd *HistoryCommand) Run(w io.Writer) error {
+	if hCmd.id < 1 {
+		lg.Logger.LogWithCallerInfo(lg.Error, "no item id provided", runtime.Caller)
+		return &NoSearchInstructionsError{}
+	}
+
+	rp, err := pickSource(hCmd.conf.TodoRepo, hCmd.source)
+	if err != nil {
+		lg.Logger.LogWithCallerInfo(lg.Error, fmt.Sprintf("couldn't pick source: %v", err), runtime.Caller)
+		return err
+	}
+
+	hs, ok := rp.(godoo.IHistorian)
+	if !ok {
+		lg.Logger.LogWithCallerInfo(lg.Error, "repo doesn't keep history", runtime.Caller)
+		return &HistoryUnavailableError{}
+	}
+
+	entries, err := hs.History(hCmd.id)
+	if err != nil {
+		lg.Logger.LogWithCallerInfo(lg.Error, fmt.Sprintf("couldn't get history: %v", err), runtime.Caller)
+		return err
+	}
+
+	w.Write([]byte(buildHistoryOutput(entries)))
+	lg.Logger.Logf(lg.Info, "history for item %v returned (%v changes)", hCmd.id, len(entries))
+	return nil
+}
+
+// Not used by the history command; implemented to satisfy ICommand
+func (hCmd *HistoryCommand) BuildItemFromInput() (godoo.TodoItem, error) {
+	return *godoo.NewTodoItem(godoo.WithPriorityLevel(godoo.None)), nil
+}
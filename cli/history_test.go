@@ -0,0 +1,79 @@
+package cli
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	godoo "github.com/mundacity/go-doo"
+	lg "github.com/mundacity/quick-logger"
+)
+
+// only History is needed; the rest satisfies IRepository
+type historyRepo struct{ godoo.IRepository }
+
+func (h historyRepo) History(itemId int) ([]godoo.HistoryEntry, error) {
+	return []godoo.HistoryEntry{{Id: 1, ItemId: itemId, Action: godoo.Added, After: &godoo.TodoItem{Body: "new item"}}}, nil
+}
+
+type history_changes_test_case struct {
+	before *godoo.TodoItem
+	after  *godoo.TodoItem
+	exp    []string
+	name   string
+}
+
+func getHistoryChangesTestCases() []history_changes_test_case {
+	return []history_changes_test_case{{
+		after: &godoo.TodoItem{Body: "new item"},
+		exp:   []string{"body: 'new item'"},
+		name:  "added",
+	}, {
+		before: &godoo.TodoItem{Body: "old item"},
+		exp:    []string{"body: 'old item'"},
+		name:   "deleted",
+	}, {
+		before: &godoo.TodoItem{Body: "write report", Tags: map[string]struct{}{"work": {}}},
+		after:  &godoo.TodoItem{Body: "write report", Tags: map[string]struct{}{"work": {}, "urgent": {}}, IsComplete: true},
+		exp:    []string{"complete: 'false' -> 'true'", "tags: 'work' -> 'urgent; work'"},
+		name:   "completed & tagged",
+	}, {
+		before: &godoo.TodoItem{Body: "write report", ParentId: 2},
+		after:  &godoo.TodoItem{Body: "write the report", ParentId: 3},
+		exp:    []string{"body: 'write report' -> 'write the report'", "parentId: '2' -> '3'"},
+		name:   "body & parent",
+	}}
+}
+
+func TestHistoryChanges(t *testing.T) {
+	tcs := getHistoryChangesTestCases()
+	for _, tc := range tcs {
+		t.Run(tc.name, func(t *testing.T) {
+			got := getHistoryChanges(tc.before, tc.after)
+			if strings.Join(got, "\n") != strings.Join(tc.exp, "\n") {
+				t.Errorf(">>>>FAILED: expected %v, got %v", tc.exp, got)
+			} else {
+				t.Logf(">>>>PASSED: %v", got)
+			}
+		})
+	}
+}
+
+func TestHistoryCommand(t *testing.T) {
+	lg.Logger = lg.NewDummyLogger()
+	conf := godoo.ConfigVals{TodoRepo: historyRepo{}}
+
+	var b bytes.Buffer
+	hCmd := HistoryCommand{conf: &conf, id: 4}
+	if err := hCmd.Run(&b); err != nil {
+		t.Fatalf(">>>>FAILED: %v", err)
+	}
+	if !strings.Contains(b.String(), "body: 'new item'") || !strings.Contains(b.String(), "Returned 1 change\n") {
+		t.Errorf(">>>>FAILED: unexpected output '%v'", b.String())
+	}
+
+	hCmd.id = 0
+	if _, ok := hCmd.Run(&b).(*NoSearchInstructionsError); !ok {
+		t.Errorf(">>>>FAILED: expected NoSearchInstructionsError without an id")
+	}
+}
@@ -0,0 +1,422 @@
+package cli
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strconv"
+	"strings"
+	"time"
+
+	godoo "github.com/mundacity/go-doo"
+	"github.com/mundacity/go-doo/util"
+	lg "github.com/mundacity/quick-logger"
+)
+
+// ImportCommand implements the ICommand interface and adds the items
+// in a file written by the export command, or by a todo.txt tool
+type ImportCommand struct {
+	conf   *godoo.ConfigVals
+	fs     *flag.FlagSet
+	file   string
+	format outputFormat // worked out from the file extension if not set
+	dedupe bool
+}
+
+// Returns a new ImportCommand after setting up the flagset
+func NewImportCommand(conf *godoo.ConfigVals) *ImportCommand {
+	iCmd := ImportCommand{}
+	iCmd.conf = conf
+	lg.Logger.Log(lg.Info, "import command created")
+
+	iCmd.setupFlagSet()
+
+	return &iCmd
+}
+
+// Describes the flags and argument types associated with the command
+func (iCmd *ImportCommand) setupFlagSet() {
+	iCmd.fs = flag.NewFlagSet("import", flag.ContinueOnError)
+	iCmd.fs.StringVar(&iCmd.file, strings.Trim(string(godoo.File), "-"), "", "file to import")
+	iCmd.fs.StringVar((*string)(&iCmd.format), strings.Trim(string(godoo.Format), "-"), "", "json, ndjson, csv, tsv or todotxt; defaults to the file extension")
+	iCmd.fs.BoolVar(&iCmd.dedupe, strings.Trim(string(godoo.Dedupe), "-"), false, "skip items whose body & creation date already exist")
+}
+
+// ParseInput implements method from ICommand interface. The file can
+// be passed without --file, before or after any other flags.
+func (iCmd *ImportCommand) ParseInput() error {
+	newArgs, err := iCmd.conf.Parser.ParseUserInput()
+
+	if err != nil {
+		lg.Logger.LogWithCallerInfo(lg.Error, fmt.Sprintf("user input parsing error: %v", err), runtime.Caller)
+		return err
+	}
+
+	iCmd.conf.Args = newArgs
+	lg.Logger.Log(lg.Info, "successfully parsed user input")
+	if err = iCmd.fs.Parse(iCmd.conf.Args); err != nil {
+		return err
+	}
+
+	if iCmd.file == "" && iCmd.fs.NArg() > 0 {
+		iCmd.file = iCmd.fs.Arg(0)
+		return iCmd.fs.Parse(iCmd.fs.Args()[1:])
+	}
+	return nil
+}
+
+// Implements ICommand Run() method
+func (iCmd *ImportCommand) Run(w io.Writer) error {
+	if iCmd.file == "" || iCmd.fs.NArg() > 0 {
+		lg.Logger.LogWithCallerInfo(lg.Error, fmt.Sprintf("expected a single file, got '%v' & %v", iCmd.file, iCmd.fs.Args()), runtime.Caller)
+		return &InvalidArgumentError{}
+	}
+
+	f := iCmd.format
+	if f == "" {
+		f = getImportFormat(iCmd.file)
+	}
+	if !isFormatIn(f, transferFormats) {
+		lg.Logger.LogWithCallerInfo(lg.Error, fmt.Sprintf("unknown import format: '%v'", f), runtime.Caller)
+		return &UnknownFormatError{Format: string(f), Allowed: transferFormats}
+	}
+
+	file, err := os.Open(iCmd.file)
+	if err != nil {
+		lg.Logger.LogWithCallerInfo(lg.Error, fmt.Sprintf("couldn't open file: %v", err), runtime.Caller)
+		return err
+	}
+	defer file.Close()
+
+	itms, err := readItems(file, f, iCmd.conf.TagDelim, iCmd.conf.DateLayout)
+	if err != nil {
+		lg.Logger.LogWithCallerInfo(lg.Error, fmt.Sprintf("couldn't read file: %v", err), runtime.Caller)
+		return err
+	}
+
+	now, _ := time.Parse(iCmd.conf.DateLayout, iCmd.conf.NowString)
+	imp := newItemImporter(iCmd.conf.TodoRepo, itms, now)
+	if iCmd.dedupe {
+		if err = imp.loadExisting(); err != nil {
+			lg.Logger.LogWithCallerInfo(lg.Error, fmt.Sprintf("failed to get existing items: %v", err), runtime.Caller)
+			return err
+		}
+	}
+
+	if err = imp.run(); err != nil {
+		lg.Logger.LogWithCallerInfo(lg.Error, fmt.Sprintf("import stopped after %v item/s: %v", imp.added, err), runtime.Caller)
+		if imp.added > 0 {
+			printImportMessage(imp.added, imp.skipped, w)
+		}
+		return err
+	}
+
+	printImportMessage(imp.added, imp.skipped, w)
+	lg.Logger.Logf(lg.Info, "imported %v item/s, skipped %v", imp.added, imp.skipped)
+	return nil
+}
+
+// Not used by the import command; implemented to satisfy ICommand
+func (iCmd *ImportCommand) BuildItemFromInput() (godoo.TodoItem, error) {
+	return *godoo.NewTodoItem(godoo.WithPriorityLevel(godoo.None)), nil
+}
+
+func getImportFormat(file string) outputFormat {
+	switch ext := strings.ToLower(filepath.Ext(file)); ext {
+	case ".json":
+		return jsonFormat
+	case ".ndjson", ".jsonl":
+		return ndjsonFormat
+	case ".csv":
+		return csvFormat
+	case ".tsv":
+		return tsvFormat
+	case ".txt":
+		return todoTxtFormat
+	default:
+		return outputFormat(strings.TrimPrefix(ext, "."))
+	}
+}
+
+// Reads items in any of the formats the export command writes. Dates
+// are read with dl, the DATETIME_FORMAT layout, other than in todo.txt.
+func readItems(r io.Reader, f outputFormat, delim, dl string) ([]godoo.TodoItem, error) {
+	if f == todoTxtFormat {
+		return readTodoTxt(r)
+	}
+	recs, err := readItemRecords(r, f, delim)
+	if err != nil {
+		return nil, err
+	}
+
+	var ret []godoo.TodoItem
+	for i, rec := range recs {
+		itm, err := fromItemRecord(rec, dl)
+		if err != nil {
+			return nil, &ImportReadError{Item: i + 1, Err: err}
+		}
+		ret = append(ret, itm)
+	}
+	return ret, nil
+}
+
+func readItemRecords(r io.Reader, f outputFormat, delim string) ([]itemRecord, error) {
+	var recs []itemRecord
+
+	switch f {
+	case jsonFormat:
+		if err := json.NewDecoder(r).Decode(&recs); err != nil {
+			return nil, err
+		}
+	case ndjsonFormat:
+		d := json.NewDecoder(r)
+		for {
+			var rec itemRecord
+			if err := d.Decode(&rec); errors.Is(err, io.EOF) {
+				break
+			} else if err != nil {
+				return nil, &ImportReadError{Item: len(recs) + 1, Err: err}
+			}
+			recs = append(recs, rec)
+		}
+	case csvFormat, tsvFormat:
+		return readItemRows(r, f == tsvFormat, delim)
+	}
+	return recs, nil
+}
+
+// Columns are matched by name, so they can be in any order & any
+// that are missing are left empty
+func readItemRows(r io.Reader, tabs bool, delim string) ([]itemRecord, error) {
+	cr := csv.NewReader(r)
+	if tabs {
+		cr.Comma = '\t'
+	}
+
+	header, err := cr.Read()
+	if err != nil {
+		return nil, err
+	}
+	cols := make(map[string]int)
+	for i, c := range header {
+		cols[c] = i
+	}
+
+	var ret []itemRecord
+	for {
+		row, err := cr.Read()
+		if errors.Is(err, io.EOF) {
+			return ret, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		rec, err := readItemRow(row, cols, delim)
+		if err != nil {
+			return nil, &ImportReadError{Item: len(ret) + 1, Err: err}
+		}
+		ret = append(ret, rec)
+	}
+}
+
+func readItemRow(row []string, cols map[string]int, delim string) (itemRecord, error) {
+	get := func(col string) string {
+		if i, ok := cols[col]; ok && i < len(row) {
+			return row[i]
+		}
+		return ""
+	}
+	atoi := func(col string) (int, error) {
+		if get(col) == "" {
+			return 0, nil
+		}
+		return strconv.Atoi(get(col))
+	}
+
+	rec := itemRecord{CreationDate: get("creationDate"), Deadline: get("deadlineDate"), Body: get("itemText"),
+		CompletedAt: get("completedAt"), Recurrence: get("recurrence"), Owner: get("owner"), Visibility: get("visibility")}
+
+	var err error
+	if rec.Id, err = atoi("itemId"); err != nil {
+		return rec, err
+	}
+	if rec.ParentId, err = atoi("parentId"); err != nil {
+		return rec, err
+	}
+	if rec.Priority, err = atoi("priority"); err != nil {
+		return rec, err
+	}
+	if rec.Version, err = atoi("version"); err != nil {
+		return rec, err
+	}
+	if s := get("isComplete"); s != "" {
+		if rec.IsComplete, err = strconv.ParseBool(s); err != nil {
+			return rec, err
+		}
+	}
+	if get("tags") != "" {
+		rec.Tags = strings.Split(get("tags"), delim)
+	}
+	return rec, nil
+}
+
+// Children aren't read; they're rebuilt from each item's parent. Versions
+// aren't kept either, as the repo numbers them from the import on.
+func fromItemRecord(rec itemRecord, dl string) (godoo.TodoItem, error) {
+	itm := godoo.NewTodoItem(godoo.WithPriorityLevel(godoo.PriorityLevel(rec.Priority)))
+	itm.Id, itm.ParentId, itm.IsChild = rec.Id, rec.ParentId, rec.ParentId != 0
+	itm.Body, itm.IsComplete = rec.Body, rec.IsComplete
+	itm.Owner, itm.Visibility = rec.Owner, godoo.Visibility(rec.Visibility)
+
+	if err := itm.SetRecurrence(rec.Recurrence); err != nil {
+		return *itm, err
+	}
+	switch itm.Visibility {
+	case "", godoo.Private, godoo.Shared:
+	default:
+		return *itm, fmt.Errorf("unknown visibility '%v'", rec.Visibility)
+	}
+
+	if rec.Priority < int(godoo.None) || rec.Priority > int(godoo.DateBased) {
+		return *itm, fmt.Errorf("unknown priority %v", rec.Priority)
+	}
+
+	var err error
+	if rec.CreationDate != "" {
+		if itm.CreationDate, err = time.Parse(dl, rec.CreationDate); err != nil {
+			return *itm, err
+		}
+	}
+	if rec.Deadline != "" {
+		if itm.Deadline, err = time.Parse(dl, rec.Deadline); err != nil {
+			return *itm, err
+		}
+	}
+	if rec.CompletedAt != "" {
+		if itm.CompletedAt, err = time.Parse(time.RFC3339, rec.CompletedAt); err != nil {
+			return *itm, err
+		}
+	}
+	for _, t := range rec.Tags {
+		if t != "" {
+			itm.Tags[t] = struct{}{}
+		}
+	}
+	return *itm, nil
+}
+
+// Adds items to a repo, parents before their children. Ids in the file
+// are only used to link items to their parents; each item gets a new id.
+// Everything is worked out before anything is added, and the items are
+// then added in one go where the repo allows it.
+type item_importer struct {
+	repo     godoo.IRepository
+	itms     []godoo.TodoItem
+	now      time.Time           // creation date for items without one
+	indexes  map[int]int         // file id -> position in itms
+	newIds   map[int]item_ref    // file id -> where the item ends up
+	done     map[int]bool        // position -> finished; false while still in progress
+	existing map[string]item_ref // only set when deduping
+	toAdd    []godoo.TodoItem
+	parents  []int // position in toAdd of each one's parent; -1 for none
+	added    int
+	skipped  int
+}
+
+// An item either already in the repo or waiting to be added
+type item_ref struct {
+	id    int // in the repo; 0 if not there yet
+	toAdd int // position in toAdd; -1 if already in the repo
+}
+
+func newItemImporter(repo godoo.IRepository, itms []godoo.TodoItem, now time.Time) *item_importer {
+	imp := item_importer{repo: repo, itms: itms, now: now, indexes: make(map[int]int), newIds: make(map[int]item_ref), done: make(map[int]bool)}
+	for i, itm := range itms {
+		if itm.Id != 0 {
+			imp.indexes[itm.Id] = i
+		}
+	}
+	return &imp
+}
+
+// Remembers items already in the repo so they're not added again
+func (imp *item_importer) loadExisting() error {
+	itms, err := imp.repo.GetAll()
+	if err != nil {
+		return err
+	}
+
+	imp.existing = make(map[string]item_ref)
+	for _, itm := range itms {
+		imp.existing[getDedupeKey(itm)] = item_ref{id: itm.Id, toAdd: -1}
+	}
+	return nil
+}
+
+func getDedupeKey(itm godoo.TodoItem) string {
+	return util.StringFromDate(itm.CreationDate) + " " + itm.Body
+}
+
+func (imp *item_importer) run() error {
+	for i := range imp.itms {
+		imp.plan(i)
+	}
+
+	ids, err := godoo.AddAll(imp.repo, imp.toAdd, imp.parents)
+	imp.added = len(ids)
+	return err
+}
+
+// Works out where the item at position i goes, after its parent. A parent
+// that isn't in the file, or whose link would form a cycle, is dropped.
+func (imp *item_importer) plan(i int) {
+	if _, seen := imp.done[i]; seen {
+		return
+	}
+	imp.done[i] = false
+
+	itm := imp.itms[i]
+	parent := item_ref{toAdd: -1}
+	if p, ok := imp.indexes[itm.ParentId]; ok && itm.ParentId != 0 {
+		if finished, seen := imp.done[p]; !seen || finished {
+			imp.plan(p)
+			parent = imp.newIds[itm.ParentId]
+		}
+	}
+	imp.done[i] = true
+
+	oldId := itm.Id
+	itm.Id, itm.ParentId, itm.IsChild = 0, parent.id, parent.id != 0
+	itm.ChildItems = make(map[int]struct{})
+	if itm.CreationDate.IsZero() {
+		itm.CreationDate = imp.now
+	}
+
+	key := getDedupeKey(itm)
+	if ref, ok := imp.existing[key]; ok {
+		imp.setNewId(oldId, ref)
+		imp.skipped++
+		return
+	}
+
+	ref := item_ref{toAdd: len(imp.toAdd)}
+	imp.toAdd = append(imp.toAdd, itm)
+	imp.parents = append(imp.parents, parent.toAdd)
+	imp.setNewId(oldId, ref)
+	if imp.existing != nil {
+		imp.existing[key] = ref // duplicates within the file too
+	}
+}
+
+func (imp *item_importer) setNewId(oldId int, ref item_ref) {
+	if oldId != 0 {
+		imp.newIds[oldId] = ref
+	}
+}
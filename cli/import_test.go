@@ -0,0 +1,428 @@
+package cli
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	godoo "github.com/mundacity/go-doo"
+	lg "github.com/mundacity/quick-logger"
+)
+
+// keeps added items in memory; only Add & GetAll are needed
+type memRepo struct {
+	godoo.IRepository
+	itms *[]godoo.TodoItem
+}
+
+func newMemRepo(itms ...godoo.TodoItem) memRepo {
+	return memRepo{itms: &itms}
+}
+
+func (m memRepo) Add(itm *godoo.TodoItem) (int64, error) {
+	if itm.ParentId != 0 && itm.ParentId > len(*m.itms) {
+		return 0, &godoo.ParentNotFoundError{ParentId: itm.ParentId}
+	}
+	n := *itm
+	n.Id = len(*m.itms) + 1
+	*m.itms = append(*m.itms, n)
+	return int64(n.Id), nil
+}
+
+func (m memRepo) GetAll() ([]godoo.TodoItem, error) {
+	return append([]godoo.TodoItem{}, *m.itms...), nil
+}
+
+func parseDate(s string) time.Time {
+	d, _ := time.Parse("2006-01-02", s)
+	return d
+}
+
+func getExportItems() []godoo.TodoItem {
+	completed, _ := time.Parse(time.RFC3339, "2022-06-05T17:30:00Z")
+	return []godoo.TodoItem{
+		{Id: 3, CreationDate: parseDate("2022-06-01"), Deadline: parseDate("2022-07-01"), Priority: godoo.High, Body: "plan sprint", Recurrence: "2w", Version: 4, Owner: "ann", Visibility: godoo.Shared, Tags: map[string]struct{}{"work": {}, "dev": {}}},
+		{Id: 5, ParentId: 8, IsChild: true, CreationDate: parseDate("2022-06-03"), Priority: godoo.Low, Body: "write \"release\" notes, then email", Version: 1, Owner: "ann", Visibility: godoo.Private, Tags: map[string]struct{}{}},
+		{Id: 8, ParentId: 3, IsChild: true, CreationDate: parseDate("2022-06-02"), Priority: godoo.Medium, Body: "draft backlog", IsComplete: true, CompletedAt: completed, Tags: map[string]struct{}{"work": {}}},
+		{Id: 9, CreationDate: parseDate("2022-06-04"), Body: "water plants", Tags: map[string]struct{}{}},
+		{Id: 11, CreationDate: parseDate("2022-06-05"), Deadline: parseDate("2022-06-12"), Priority: godoo.DateBased, Body: "ask +bob about @home due:friday, then x", Tags: map[string]struct{}{"admin": {}}},
+	}
+}
+
+type round_trip_test_case struct {
+	format outputFormat
+	ext    string
+	layout string // DATETIME_FORMAT
+	name   string
+}
+
+func getRoundTripTestCases() []round_trip_test_case {
+	return []round_trip_test_case{
+		{format: jsonFormat, ext: ".json", layout: "2006-01-02", name: "json"},
+		{format: ndjsonFormat, ext: ".ndjson", layout: "2006-01-02", name: "ndjson"},
+		{format: csvFormat, ext: ".csv", layout: "2006-01-02", name: "csv"},
+		{format: tsvFormat, ext: ".tsv", layout: "2006-01-02", name: "tsv"},
+		{format: todoTxtFormat, ext: ".txt", layout: "2006-01-02", name: "todo.txt"},
+		{format: jsonFormat, ext: ".json", layout: "02/01/2006", name: "json with another date format"},
+		{format: csvFormat, ext: ".csv", layout: "Jan 2 2006", name: "csv with another date format"},
+		{format: todoTxtFormat, ext: ".txt", layout: "02/01/2006", name: "todo.txt keeps its own date format"},
+	}
+}
+
+func TestExportImportRoundTrip(t *testing.T) {
+	lg.Logger = lg.NewDummyLogger()
+	tcs := getRoundTripTestCases()
+	for _, tc := range tcs {
+		t.Run(tc.name, func(t *testing.T) {
+			runRoundTripTest(t, tc)
+		})
+	}
+}
+
+func runRoundTripTest(t *testing.T, tc round_trip_test_case) {
+	src := getExportItems()
+	file := exportToFile(t, newMemRepo(src...), tc.format, tc.ext, tc.layout)
+
+	dest := newMemRepo()
+	out, err := importFile(dest, file, false, tc.layout)
+	if err != nil {
+		t.Fatalf(">>>>FAILED: %v", err)
+	}
+	if !strings.Contains(out, "Imported 5 items") {
+		t.Errorf(">>>>FAILED: unexpected output '%v'", out)
+	}
+
+	// new ids depend on the order items were added, so match them up by body
+	bodies := make(map[int]string)
+	byBody := make(map[string]godoo.TodoItem)
+	for _, itm := range *dest.itms {
+		bodies[itm.Id] = itm.Body
+		byBody[itm.Body] = itm
+	}
+	for _, exp := range src {
+		got := byBody[exp.Body]
+		if tc.format == todoTxtFormat {
+			// todo.txt only records the day an item was completed
+			exp.CompletedAt = exp.CompletedAt.Truncate(24 * time.Hour)
+		}
+		if msg := compareImported(exp, got, getExportItems(), bodies); msg != "" {
+			t.Errorf(">>>>FAILED: '%v' - %v", exp.Body, msg)
+		}
+	}
+}
+
+// versions aren't kept on import, so they're checked on the exported records
+func TestExportedRecords(t *testing.T) {
+	lg.Logger = lg.NewDummyLogger()
+	tcs := getRoundTripTestCases()
+	for _, tc := range tcs {
+		if tc.format == todoTxtFormat {
+			continue
+		}
+		t.Run(tc.name, func(t *testing.T) {
+			runExportedRecordsTest(t, tc)
+		})
+	}
+}
+
+func runExportedRecordsTest(t *testing.T, tc round_trip_test_case) {
+	src := getExportItems()
+	file := exportToFile(t, newMemRepo(src...), tc.format, tc.ext, tc.layout)
+
+	f, err := os.Open(file)
+	if err != nil {
+		t.Fatalf(">>>>FAILED: %v", err)
+	}
+	defer f.Close()
+
+	recs, err := readItemRecords(f, tc.format, "*")
+	if err != nil || len(recs) != len(src) {
+		t.Fatalf(">>>>FAILED: got %v records (err: %v)", len(recs), err)
+	}
+	for i, rec := range recs {
+		exp := toItemRecord(src[i], tc.layout)
+		if rec.Version != exp.Version || rec.Owner != exp.Owner || rec.Visibility != exp.Visibility {
+			t.Errorf(">>>>FAILED: expected %v/%v/%v, got %v/%v/%v", exp.Version, exp.Owner, exp.Visibility, rec.Version, rec.Owner, rec.Visibility)
+		}
+	}
+}
+
+func compareImported(exp, got godoo.TodoItem, src []godoo.TodoItem, bodies map[int]string) string {
+	expParent := ""
+	for _, s := range src {
+		if s.Id == exp.ParentId {
+			expParent = s.Body
+		}
+	}
+
+	switch {
+	case got.Body != exp.Body:
+		return fmt.Sprintf("body '%v'", got.Body)
+	case bodies[got.ParentId] != expParent || got.IsChild != exp.IsChild:
+		return fmt.Sprintf("parent '%v'", bodies[got.ParentId])
+	case !got.CreationDate.Equal(exp.CreationDate) || !got.Deadline.Equal(exp.Deadline):
+		return fmt.Sprintf("dates %v & %v", got.CreationDate, got.Deadline)
+	case got.Priority != exp.Priority:
+		return fmt.Sprintf("priority %v", got.Priority)
+	case got.IsComplete != exp.IsComplete || !got.CompletedAt.Equal(exp.CompletedAt):
+		return fmt.Sprintf("completion %v at %v", got.IsComplete, got.CompletedAt)
+	case got.Recurrence != exp.Recurrence:
+		return fmt.Sprintf("recurrence '%v'", got.Recurrence)
+	case got.Owner != exp.Owner || got.Visibility != exp.Visibility:
+		return fmt.Sprintf("owner '%v', visibility '%v'", got.Owner, got.Visibility)
+	case getSortedTagOutput(got.Tags) != getSortedTagOutput(exp.Tags):
+		return fmt.Sprintf("tags %v", got.Tags)
+	}
+	return ""
+}
+
+func exportToFile(t *testing.T, repo godoo.IRepository, f outputFormat, ext, dl string) string {
+	conf := godoo.ConfigVals{TodoRepo: repo, TagDelim: "*", DateLayout: dl}
+	xCmd := NewExportCommand(&conf)
+	xCmd.format = f
+
+	var b bytes.Buffer
+	if err := xCmd.Run(&b); err != nil {
+		t.Fatalf(">>>>FAILED (export): %v", err)
+	}
+	return writeTempFile(t, "items"+ext, b.String())
+}
+
+func writeTempFile(t *testing.T, name, content string) string {
+	file := filepath.Join(t.TempDir(), name)
+	if err := os.WriteFile(file, []byte(content), 0644); err != nil {
+		t.Fatalf("couldn't write %v: %v", name, err)
+	}
+	return file
+}
+
+func importFile(repo godoo.IRepository, file string, dedupe bool, dl string) (string, error) {
+	conf := godoo.ConfigVals{TodoRepo: repo, TagDelim: "*", DateLayout: dl, NowString: time.Date(2022, 6, 30, 0, 0, 0, 0, time.UTC).Format(dl)}
+	iCmd := NewImportCommand(&conf)
+	iCmd.file, iCmd.dedupe = file, dedupe
+
+	var b bytes.Buffer
+	err := iCmd.Run(&b)
+	return b.String(), err
+}
+
+// adds items in one go, counting how often it's asked to
+type batchRepo struct {
+	memRepo
+	calls *int
+}
+
+func (b batchRepo) AddAll(itms []godoo.TodoItem, parents []int) ([]int64, error) {
+	*b.calls++
+	return godoo.AddAll(b.memRepo, itms, parents)
+}
+
+func TestImportInOneGo(t *testing.T) {
+	lg.Logger = lg.NewDummyLogger()
+	src := getExportItems()
+	file := exportToFile(t, newMemRepo(src...), jsonFormat, ".json", "2006-01-02")
+
+	dest := batchRepo{memRepo: newMemRepo(), calls: new(int)}
+	if _, err := importFile(dest, file, false, "2006-01-02"); err != nil {
+		t.Fatalf(">>>>FAILED: %v", err)
+	}
+	if *dest.calls != 1 || len(*dest.itms) != len(src) {
+		t.Errorf(">>>>FAILED: expected %v items added in 1 call, got %v in %v", len(src), len(*dest.itms), *dest.calls)
+	}
+}
+
+type import_test_case struct {
+	file      string // name decides the format
+	content   string
+	existing  []godoo.TodoItem
+	dedupe    bool
+	expBodies []string          // in the order added
+	expParent map[string]string // body -> parent body
+	expErr    error
+	name      string
+}
+
+func getImportTestCases() []import_test_case {
+	return []import_test_case{{
+		file:      "items.txt",
+		content:   "draft backlog id:8 parent:3\n\n(A) 2022-06-01 plan sprint +work id:3\ncall the bank parent:40\n",
+		expBodies: []string{"plan sprint", "draft backlog", "call the bank"},
+		expParent: map[string]string{"draft backlog": "plan sprint", "call the bank": ""},
+		name:      "parents first; links outside the file dropped",
+	}, {
+		file:      "items.txt",
+		content:   "a id:1 parent:2\nb id:2 parent:1\n",
+		expBodies: []string{"b", "a"},
+		expParent: map[string]string{"a": "b", "b": ""},
+		name:      "cycles are broken",
+	}, {
+		file:      "items.txt",
+		content:   "2022-06-01 plan sprint id:3\n2022-06-02 draft backlog id:4 parent:3\n2022-06-02 draft backlog\n",
+		existing:  []godoo.TodoItem{{CreationDate: parseDate("2022-06-01"), Body: "plan sprint"}},
+		dedupe:    true,
+		expBodies: []string{"draft backlog"},
+		expParent: map[string]string{"draft backlog": "plan sprint"},
+		name:      "dedupe skips existing items & repeats, and links to them",
+	}, {
+		file:      "items.txt",
+		content:   "2022-06-01 plan sprint\n",
+		existing:  []godoo.TodoItem{{CreationDate: parseDate("2022-06-01"), Body: "plan sprint"}},
+		expBodies: []string{"plan sprint"},
+		name:      "duplicates added without dedupe",
+	}, {
+		file:      "items.csv",
+		content:   "itemText,tags,creationDate\nwater plants,home*garden,\n",
+		expBodies: []string{"water plants"},
+		name:      "csv columns by name; missing dates default to today",
+	}, {
+		file:    "items.csv",
+		content: "itemText,deadlineDate\nwater plants,tomorrow\n",
+		expErr:  &ImportReadError{},
+		name:    "bad date",
+	}, {
+		file:    "items.txt",
+		content: "plan sprint\nreview due:soon\n",
+		expErr:  &ImportReadError{},
+		name:    "bad todo.txt value",
+	}, {
+		file:    "items.txt",
+		content: "plan sprint\nreview rec:often\n",
+		expErr:  &ImportReadError{},
+		name:    "nothing added when a later item is bad",
+	}, {
+		file:    "items.xml",
+		content: "<items/>",
+		expErr:  &UnknownFormatError{},
+		name:    "unknown format",
+	}}
+}
+
+func TestImport(t *testing.T) {
+	lg.Logger = lg.NewDummyLogger()
+	tcs := getImportTestCases()
+	for _, tc := range tcs {
+		t.Run(tc.name, func(t *testing.T) {
+			runImportTest(t, tc)
+		})
+	}
+}
+
+func runImportTest(t *testing.T, tc import_test_case) {
+	repo := newMemRepo()
+	for i := range tc.existing {
+		repo.Add(&tc.existing[i])
+	}
+
+	_, err := importFile(repo, writeTempFile(t, tc.file, tc.content), tc.dedupe, "2006-01-02")
+	if (err == nil) != (tc.expErr == nil) || fmt.Sprintf("%T", err) != fmt.Sprintf("%T", tc.expErr) && tc.expErr != nil {
+		t.Fatalf(">>>>FAILED (err): expected '%T', got '%v'", tc.expErr, err)
+	}
+	if err != nil {
+		if len(*repo.itms) != len(tc.existing) {
+			t.Errorf(">>>>FAILED: expected nothing added, got %v", (*repo.itms)[len(tc.existing):])
+		}
+		return
+	}
+
+	added := (*repo.itms)[len(tc.existing):]
+	bodies := make(map[int]string)
+	var got []string
+	for _, itm := range *repo.itms {
+		bodies[itm.Id] = itm.Body
+	}
+	for _, itm := range added {
+		got = append(got, itm.Body)
+		if p, ok := tc.expParent[itm.Body]; ok && bodies[itm.ParentId] != p {
+			t.Errorf(">>>>FAILED: expected '%v' to have parent '%v', got '%v'", itm.Body, p, bodies[itm.ParentId])
+		}
+		if itm.CreationDate.IsZero() {
+			t.Errorf(">>>>FAILED: '%v' has no creation date", itm.Body)
+		}
+	}
+	if fmt.Sprint(got) != fmt.Sprint(tc.expBodies) {
+		t.Errorf(">>>>FAILED: expected %v, got %v", tc.expBodies, got)
+	}
+}
+
+type todo_txt_test_case struct {
+	line   string
+	exp    godoo.TodoItem
+	expTag []string
+	name   string
+}
+
+func getTodoTxtTestCases() []todo_txt_test_case {
+	return []todo_txt_test_case{{
+		line:   "(B) 2022-06-01 call mum +family @phone due:2022-06-03",
+		exp:    godoo.TodoItem{Priority: godoo.Medium, CreationDate: parseDate("2022-06-01"), Body: "call mum", Deadline: parseDate("2022-06-03")},
+		expTag: []string{"family", "phone"},
+		name:   "priority, dates & contexts",
+	}, {
+		line: "x 2022-06-05 2022-06-01 file taxes pri:A",
+		exp:  godoo.TodoItem{IsComplete: true, CompletedAt: parseDate("2022-06-05"), CreationDate: parseDate("2022-06-01"), Body: "file taxes", Priority: godoo.High},
+		name: "completed",
+	}, {
+		line: "(D) read chapter 3 at 9:30 id",
+		exp:  godoo.TodoItem{Priority: godoo.Low, Body: "read chapter 3 at 9:30 id"},
+		name: "lower priorities are low; unknown pairs stay in the body",
+	}, {
+		line:   "2022-06-01 ask +bob about @home due:friday, then x +admin pri:date",
+		exp:    godoo.TodoItem{Priority: godoo.DateBased, CreationDate: parseDate("2022-06-01"), Body: "ask +bob about @home due:friday, then x"},
+		expTag: []string{"admin"},
+		name:   "tags & pairs only read from the end; date-based priority",
+	}, {
+		line: "x 2022-06-01 file taxes",
+		exp:  godoo.TodoItem{IsComplete: true, CreationDate: parseDate("2022-06-01"), Body: "file taxes"},
+		name: "a single date after x is the creation date",
+	}}
+}
+
+func TestReadTodoTxt(t *testing.T) {
+	tcs := getTodoTxtTestCases()
+	for _, tc := range tcs {
+		t.Run(tc.name, func(t *testing.T) {
+			got, err := readTodoTxtLine(tc.line)
+			if err != nil {
+				t.Fatalf(">>>>FAILED: %v", err)
+			}
+			tc.exp.Tags = make(map[string]struct{})
+			for _, tg := range tc.expTag {
+				tc.exp.Tags[tg] = struct{}{}
+			}
+
+			if msg := compareImported(tc.exp, got, nil, nil); msg != "" {
+				t.Errorf(">>>>FAILED: %v", msg)
+			}
+		})
+	}
+}
+
+func TestExportFormats(t *testing.T) {
+	lg.Logger = lg.NewDummyLogger()
+	conf := godoo.ConfigVals{TodoRepo: newMemRepo(getExportItems()...), TagDelim: "*", DateLayout: "2006-01-02"}
+	xCmd := NewExportCommand(&conf)
+
+	var b bytes.Buffer
+	xCmd.format = "todotxt"
+	if err := xCmd.Run(&b); err != nil {
+		t.Fatalf(">>>>FAILED: %v", err)
+	}
+	for _, exp := range []string{
+		"x 2022-06-05 2022-06-02 draft backlog +work id:8 parent:3 pri:B",
+		"(A) 2022-06-01 plan sprint +dev +work due:2022-07-01 id:3 rec:2w owner:ann vis:shared",
+		"2022-06-05 ask +bob about @home due:friday, then x +admin due:2022-06-12 id:11 pri:date",
+	} {
+		if !strings.Contains(b.String(), exp+"\n") {
+			t.Errorf(">>>>FAILED: expected '%v' in\n%v", exp, b.String())
+		}
+	}
+
+	xCmd.format = "xml"
+	if err := xCmd.Run(&b); err == nil {
+		t.Errorf(">>>>FAILED: expected an error for an unknown format")
+	}
+}
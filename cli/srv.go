@@ -0,0 +1,109 @@
+package cli
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"runtime"
+	"strconv"
+
+	godoo "github.com/mundacity/go-doo"
+	lg "github.com/mundacity/quick-logger"
+)
+
+// SrvCommand implements the ICommand interface and groups together
+// tasks for running the server, e.g. 'srv token create alice'. They
+// work on the local db, so are run on the machine the server is on.
+type SrvCommand struct {
+	conf   *godoo.ConfigVals
+	fs     *flag.FlagSet
+	subCmd string
+}
+
+// Returns a new SrvCommand for the subcommand passed, after setting up the flagset
+func NewSrvCommand(conf *godoo.ConfigVals, subCmd string) *SrvCommand {
+	sCmd := SrvCommand{}
+	sCmd.conf = conf
+	sCmd.subCmd = subCmd
+	lg.Logger.Logf(lg.Info, "srv command created (%v)", subCmd)
+
+	sCmd.fs = flag.NewFlagSet("srv", flag.ContinueOnError)
+
+	return &sCmd
+}
+
+// ParseInput implements method from ICommand interface. Srv subcommands
+// only take positional args, so there's nothing for the parser to do.
+func (sCmd *SrvCommand) ParseInput() error {
+	return sCmd.fs.Parse(sCmd.conf.Args)
+}
+
+// Implements ICommand Run() method
+func (sCmd *SrvCommand) Run(w io.Writer) error {
+	switch sCmd.subCmd {
+	case "token":
+		return sCmd.runToken(w)
+	default:
+		lg.Logger.Logf(lg.Error, "unknown srv subcommand: '%v'", sCmd.subCmd)
+		return &InvalidArgumentError{}
+	}
+}
+
+// Not used by srv subcommands; implemented to satisfy ICommand
+func (sCmd *SrvCommand) BuildItemFromInput() (godoo.TodoItem, error) {
+	return *godoo.NewTodoItem(godoo.WithPriorityLevel(godoo.None)), nil
+}
+
+// Creates, revokes or lists the tokens the server accepts, i.e.
+// 'token create <owner>', 'token revoke <id>' or 'token list'
+func (sCmd *SrvCommand) runToken(w io.Writer) error {
+	ts, ok := sCmd.conf.TodoRepo.(godoo.ITokenStore)
+	if !ok {
+		lg.Logger.LogWithCallerInfo(lg.Error, "repo doesn't keep auth tokens", runtime.Caller)
+		return &LocalOnlyError{}
+	}
+
+	args := sCmd.fs.Args()
+	if len(args) == 0 {
+		lg.Logger.LogWithCallerInfo(lg.Error, "no token action given", runtime.Caller)
+		return &InvalidArgumentError{}
+	}
+
+	switch {
+	case args[0] == "create" && len(args) == 2:
+		tkn, raw, err := ts.CreateToken(args[1])
+		if err != nil {
+			lg.Logger.LogWithCallerInfo(lg.Error, fmt.Sprintf("couldn't create token: %v", err), runtime.Caller)
+			return err
+		}
+		lg.Logger.Logf(lg.Info, "token %v created for '%v'", tkn.Id, tkn.Owner)
+		printTokenCreatedMessage(tkn, raw, w)
+		return nil
+
+	case args[0] == "revoke" && len(args) == 2:
+		id, err := strconv.Atoi(args[1])
+		if err != nil || id < 1 {
+			lg.Logger.LogWithCallerInfo(lg.Error, fmt.Sprintf("invalid token id '%v'", args[1]), runtime.Caller)
+			return &InvalidArgumentError{}
+		}
+		if err = ts.RevokeToken(id); err != nil {
+			lg.Logger.LogWithCallerInfo(lg.Error, fmt.Sprintf("couldn't revoke token: %v", err), runtime.Caller)
+			return err
+		}
+		lg.Logger.Logf(lg.Info, "token %v revoked", id)
+		printTokenRevokedMessage(id, w)
+		return nil
+
+	case args[0] == "list" && len(args) == 1:
+		tkns, err := ts.Tokens()
+		if err != nil {
+			lg.Logger.LogWithCallerInfo(lg.Error, fmt.Sprintf("couldn't list tokens: %v", err), runtime.Caller)
+			return err
+		}
+		w.Write([]byte(buildTokenOutput(tkns)))
+		return nil
+	}
+
+	lg.Logger.LogWithCallerInfo(lg.Error, fmt.Sprintf("invalid token arguments: %v", args), runtime.Caller)
+	return &InvalidArgumentError{}
+}
@@ -0,0 +1,141 @@
+package cli
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+	"time"
+
+	godoo "github.com/mundacity/go-doo"
+	lg "github.com/mundacity/quick-logger"
+)
+
+// keeps tokens in memory; the rest satisfies IRepository
+type tokenRepo struct {
+	godoo.IRepository
+	tokens *[]godoo.Token
+}
+
+func (t tokenRepo) CreateToken(owner string) (godoo.Token, string, error) {
+	if strings.Contains(owner, " ") {
+		return godoo.Token{}, "", &godoo.InvalidOwnerError{Owner: owner}
+	}
+	tkn := godoo.Token{Id: len(*t.tokens) + 1, Owner: owner, CreatedAt: time.Now()}
+	*t.tokens = append(*t.tokens, tkn)
+	return tkn, "gd_secret", nil
+}
+
+func (t tokenRepo) RevokeToken(id int) error {
+	if id > len(*t.tokens) {
+		return &godoo.TokenNotFoundError{Id: id}
+	}
+	(*t.tokens)[id-1].RevokedAt = time.Now()
+	return nil
+}
+
+func (t tokenRepo) Tokens() ([]godoo.Token, error) {
+	return *t.tokens, nil
+}
+
+func (t tokenRepo) TokenOwner(token string) (string, error) {
+	return "", &godoo.InvalidTokenError{}
+}
+
+type srv_test_case struct {
+	subCmd  string
+	args    []string
+	noStore bool // the repo doesn't keep tokens
+	expOut  []string
+	expErr  error
+	name    string
+}
+
+func getSrvTestCases() []srv_test_case {
+	return []srv_test_case{{
+		subCmd: "token",
+		args:   []string{"create", "carol"},
+		expOut: []string{"Created token 3 for carol", "gd_secret", "can't be shown again"},
+		name:   "create",
+	}, {
+		subCmd: "token",
+		args:   []string{"revoke", "1"},
+		expOut: []string{"Revoked token 1"},
+		name:   "revoke",
+	}, {
+		subCmd: "token",
+		args:   []string{"list"},
+		expOut: []string{"alice, created", "bob, created", "--> 2 active"},
+		name:   "list",
+	}, {
+		subCmd: "token",
+		args:   []string{"create", "carol smith"},
+		expErr: &godoo.InvalidOwnerError{},
+		name:   "invalid owner",
+	}, {
+		subCmd: "token",
+		args:   []string{"revoke", "9"},
+		expErr: &godoo.TokenNotFoundError{},
+		name:   "unknown token",
+	}, {
+		subCmd: "token",
+		args:   []string{"revoke", "one"},
+		expErr: &InvalidArgumentError{},
+		name:   "id not a number",
+	}, {
+		subCmd: "token",
+		args:   []string{"create"},
+		expErr: &InvalidArgumentError{},
+		name:   "no owner",
+	}, {
+		subCmd: "token",
+		args:   []string{"rotate", "1"},
+		expErr: &InvalidArgumentError{},
+		name:   "unknown action",
+	}, {
+		subCmd: "start",
+		expErr: &InvalidArgumentError{},
+		name:   "unknown subcommand",
+	}, {
+		subCmd:  "token",
+		args:    []string{"list"},
+		noStore: true,
+		expErr:  &LocalOnlyError{},
+		name:    "repo without tokens",
+	}}
+}
+
+func TestSrvCommand(t *testing.T) {
+	lg.Logger = lg.NewDummyLogger()
+	tcs := getSrvTestCases()
+	for _, tc := range tcs {
+		t.Run(tc.name, func(t *testing.T) {
+			runSrvTest(t, tc)
+		})
+	}
+}
+
+func runSrvTest(t *testing.T, tc srv_test_case) {
+	tokens := []godoo.Token{{Id: 1, Owner: "alice"}, {Id: 2, Owner: "bob"}}
+	var repo godoo.IRepository = tokenRepo{tokens: &tokens}
+	if tc.noStore {
+		repo = undoRepo{}
+	}
+
+	conf := godoo.ConfigVals{Args: tc.args, TodoRepo: repo}
+	sCmd := NewSrvCommand(&conf, tc.subCmd)
+
+	var b bytes.Buffer
+	err := sCmd.ParseInput()
+	if err == nil {
+		err = sCmd.Run(&b)
+	}
+
+	if (err == nil) != (tc.expErr == nil) {
+		t.Errorf(">>>>FAILED (err): expected '%v', got '%v'", tc.expErr, err)
+	}
+	for _, o := range tc.expOut {
+		if !strings.Contains(b.String(), o) {
+			t.Errorf(">>>>FAILED: expected output to contain '%v', got '%v'", o, b.String())
+		}
+	}
+}
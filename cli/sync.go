@@ -0,0 +1,65 @@
+package cli
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"runtime"
+
+	godoo "github.com/mundacity/go-doo"
+	lg "github.com/mundacity/quick-logger"
+)
+
+// SyncCommand implements the ICommand interface and sends the adds
+// & edits queued while the server couldn't be reached
+type SyncCommand struct {
+	conf *godoo.ConfigVals
+	fs   *flag.FlagSet
+}
+
+// Returns a new SyncCommand after setting up the flagset
+func NewSyncCommand(conf *godoo.ConfigVals) *SyncCommand {
+	sCmd := SyncCommand{}
+	sCmd.conf = conf
+	lg.Logger.Log(lg.Info, "sync command created")
+
+	sCmd.fs = flag.NewFlagSet("sync", flag.ContinueOnError)
+
+	return &sCmd
+}
+
+// ParseInput implements method from ICommand interface. Sync
+// doesn't take any flags, so there's nothing for the parser to do.
+func (sCmd *SyncCommand) ParseInput() error {
+	return sCmd.fs.Parse(sCmd.conf.Args)
+}
+
+// Implements ICommand Run() method. Whatever was sent is reported
+// even if the server goes away again part way through.
+func (sCmd *SyncCommand) Run(w io.Writer) error {
+	if sCmd.fs.NArg() > 0 {
+		lg.Logger.LogWithCallerInfo(lg.Error, fmt.Sprintf("unexpected arguments: %v", sCmd.fs.Args()), runtime.Caller)
+		return &InvalidArgumentError{}
+	}
+
+	s, ok := sCmd.conf.TodoRepo.(godoo.ISyncer)
+	if !ok {
+		lg.Logger.LogWithCallerInfo(lg.Error, "repo doesn't queue changes", runtime.Caller)
+		return &RemoteOnlyError{}
+	}
+
+	rep, err := s.Sync()
+	w.Write([]byte(buildSyncOutput(rep)))
+	if err != nil {
+		lg.Logger.LogWithCallerInfo(lg.Error, fmt.Sprintf("sync failed: %v", err), runtime.Caller)
+		return err
+	}
+
+	lg.Logger.Logf(lg.Info, "synced %v changes; %v conflicts", rep.Sent, len(rep.Conflicts))
+	return nil
+}
+
+// Not used by the sync command; implemented to satisfy ICommand
+func (sCmd *SyncCommand) BuildItemFromInput() (godoo.TodoItem, error) {
+	return *godoo.NewTodoItem(godoo.WithPriorityLevel(godoo.None)), nil
+}
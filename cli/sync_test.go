@@ -0,0 +1,106 @@
+package cli
+
+import (
+	"bytes"
+	"errors"
+	"net/url"
+	"strings"
+	"testing"
+
+	godoo "github.com/mundacity/go-doo"
+	lg "github.com/mundacity/quick-logger"
+)
+
+// returns rep from Sync, along with err; adds & edits are always queued
+type syncRepo struct {
+	godoo.IRepository
+	rep godoo.SyncReport
+	err error
+}
+
+func (s syncRepo) Sync() (godoo.SyncReport, error) {
+	return s.rep, s.err
+}
+
+func (s syncRepo) Add(itm *godoo.TodoItem) (int64, error) {
+	return 0, &godoo.QueuedError{Err: &url.Error{Op: "Post", URL: "http://192.168.0.123:8080/add", Err: errors.New("connection refused")}}
+}
+
+type sync_test_case struct {
+	args   []string
+	repo   godoo.IRepository
+	expOut []string
+	expErr error
+	name   string
+}
+
+func getSyncTestCases() []sync_test_case {
+	e := godoo.OutboxEntry{Action: godoo.Updated}
+	return []sync_test_case{{
+		repo: syncRepo{rep: godoo.SyncReport{Sent: 2, Cached: 14, Conflicts: []godoo.SyncConflict{
+			{Entry: e, ItemId: 4, Reason: "changed on the server"},
+		}}},
+		expOut: []string{"Id: 4", "not applied: changed on the server", "Sent 2 queued changes; 1 conflict; 14 items cached"},
+		name:   "conflicts are listed",
+	}, {
+		repo:   syncRepo{rep: godoo.SyncReport{Sent: 1, Pending: 3}, err: errors.New("connection refused")},
+		expOut: []string{"Sent 1 queued change; 3 still queued"},
+		expErr: errors.New("connection refused"),
+		name:   "server goes away part way through",
+	}, {
+		args:   []string{"now"},
+		repo:   syncRepo{},
+		expErr: &InvalidArgumentError{},
+		name:   "arguments aren't accepted",
+	}, {
+		repo:   historyRepo{},
+		expErr: &RemoteOnlyError{},
+		name:   "repo that doesn't queue changes",
+	}}
+}
+
+func TestSyncCommand(t *testing.T) {
+	lg.Logger = lg.NewDummyLogger()
+	tcs := getSyncTestCases()
+	for _, tc := range tcs {
+		t.Run(tc.name, func(t *testing.T) {
+			runSyncTest(t, tc)
+		})
+	}
+}
+
+func runSyncTest(t *testing.T, tc sync_test_case) {
+	conf := godoo.ConfigVals{Args: tc.args, TodoRepo: tc.repo}
+	sCmd := NewSyncCommand(&conf)
+
+	var b bytes.Buffer
+	err := sCmd.ParseInput()
+	if err == nil {
+		err = sCmd.Run(&b)
+	}
+
+	if (err == nil) != (tc.expErr == nil) {
+		t.Errorf(">>>>FAILED (err): expected '%v', got '%v'", tc.expErr, err)
+	}
+	for _, o := range tc.expOut {
+		if !strings.Contains(b.String(), o) {
+			t.Errorf(">>>>FAILED: expected output to contain '%v', got '%v'", o, b.String())
+		}
+	}
+}
+
+func TestQueuedAdd(t *testing.T) {
+	lg.Logger = lg.NewDummyLogger()
+	fakeArgs = []string{"-b", "call the bank"}
+	conf := godoo.ConfigVals{TodoRepo: syncRepo{}, Parser: &FakeParser{}, MaxLen: 2000, TagDelim: "*", DateLayout: "2006-01-02"}
+	aCmd := NewAddCommand(&conf)
+
+	var b bytes.Buffer
+	err := aCmd.ParseInput()
+	if err == nil {
+		err = aCmd.Run(&b)
+	}
+	if err != nil || !strings.Contains(b.String(), "saved for 'godoo sync'") {
+		t.Errorf(">>>>FAILED: expected the item to be queued, got '%v' (err: %v)", b.String(), err)
+	}
+}
@@ -0,0 +1,126 @@
+package cli
+
+import (
+	"bytes"
+	"fmt"
+	"sort"
+	"strings"
+	"text/template"
+	"time"
+
+	godoo "github.com/mundacity/go-doo"
+)
+
+// Parses the template passed to 'get --template'. If src is the name of a
+// template from the config, that template is used instead.
+func parseItemTemplate(src string, conf *godoo.ConfigVals) (*template.Template, error) {
+	if named, exists := conf.Templates[strings.ToLower(src)]; exists {
+		src = named
+	}
+	if !strings.HasSuffix(src, "\n") {
+		src += "\n" // one item per line
+	}
+
+	now, err := time.Parse("2006-01-02", conf.NowString)
+	if err != nil {
+		now = time.Now()
+	}
+	return template.New("item").Funcs(getTemplateFuncs(conf.DateLayout, now)).Parse(src)
+}
+
+// Helpers available to templates alongside the TodoItem fields:
+//   - join: tags or child ids, sorted & separated, e.g. {{join .Tags ","}}
+//   - date: a date in the configured layout; empty if unset
+//   - due: a deadline relative to today, e.g. 'in 3d', 'today', '2d ago'
+//   - priority: the priority level's name, e.g. 'high'
+func getTemplateFuncs(layout string, now time.Time) template.FuncMap {
+	return template.FuncMap{
+		"join": joinForTemplate,
+		"date": func(t time.Time) string {
+			if t.IsZero() {
+				return ""
+			}
+			return t.Format(layout)
+		},
+		"due": func(t time.Time) string {
+			return getRelativeDate(t, now)
+		},
+		"priority": getPriorityName,
+	}
+}
+
+func joinForTemplate(v any, sep string) (string, error) {
+	var vals []string
+	switch c := v.(type) {
+	case map[string]struct{}:
+		for k := range c {
+			if len(k) > 0 {
+				vals = append(vals, k)
+			}
+		}
+		sort.Strings(vals)
+	case map[int]struct{}:
+		var ids []int
+		for id := range c {
+			ids = append(ids, id)
+		}
+		sort.Ints(ids)
+		for _, id := range ids {
+			vals = append(vals, fmt.Sprint(id))
+		}
+	case []string:
+		vals = c
+	default:
+		return "", fmt.Errorf("join: can't join %T", v)
+	}
+	return strings.Join(vals, sep), nil
+}
+
+// Whole days between now & t
+func getRelativeDate(t, now time.Time) string {
+	if t.IsZero() {
+		return ""
+	}
+	day := func(d time.Time) time.Time { return time.Date(d.Year(), d.Month(), d.Day(), 0, 0, 0, 0, time.UTC) }
+	n := int(day(t).Sub(day(now)).Hours() / 24)
+
+	switch {
+	case n == 0:
+		return "today"
+	case n == 1:
+		return "tomorrow"
+	case n == -1:
+		return "yesterday"
+	case n > 1:
+		return fmt.Sprintf("in %vd", n)
+	default:
+		return fmt.Sprintf("%vd ago", -n)
+	}
+}
+
+func getPriorityName(p godoo.PriorityLevel) string {
+	switch p {
+	case godoo.Low:
+		return "low"
+	case godoo.Medium:
+		return "medium"
+	case godoo.High:
+		return "high"
+	case godoo.DateBased:
+		return "date"
+	default:
+		return "none"
+	}
+}
+
+// Runs after successfully retrieving item/s when a template has been
+// given. Each item is rendered in turn; there's no summary line.
+func buildTemplateOutput(itms []godoo.TodoItem, t *template.Template) (string, error) {
+	var b bytes.Buffer
+	for _, itm := range itms {
+		if err := t.Execute(&b, itm); err != nil {
+			return "", err
+		}
+	}
+	return b.String(), nil
+}
@@ -0,0 +1,92 @@
+package cli
+
+import (
+	"bytes"
+	"testing"
+	"time"
+
+	godoo "github.com/mundacity/go-doo"
+	lg "github.com/mundacity/quick-logger"
+)
+
+type template_test_case struct {
+	template string
+	format   outputFormat
+	expOut   string
+	expErr   bool
+	name     string
+}
+
+func getTemplateTestCases() []template_test_case {
+	return []template_test_case{{
+		template: `{{.Id}} {{.Body}} [{{join .Tags ","}}]`,
+		expOut:   "1 write report, \"final\" draft [dev,work]\n2 proofread []\n",
+		name:     "inline template",
+	}, {
+		template: "short",
+		expOut:   "1 high  (children: 2;3)\n2 none in 3d (children: )\n",
+		name:     "named template",
+	}, {
+		template: "SHORT",
+		expOut:   "1 high  (children: 2;3)\n2 none in 3d (children: )\n",
+		name:     "template names aren't case sensitive",
+	}, {
+		template: `{{if .IsComplete}}x{{else}}-{{end}} {{date .CompletedAt}}|{{date .Deadline}}`,
+		expOut:   "- |\nx 2022-06-03|2022-06-09\n",
+		name:     "dates",
+	}, {
+		template: `{{.Id`,
+		expErr:   true,
+		name:     "template doesn't parse",
+	}, {
+		template: `{{.Assignee}}`,
+		expErr:   true,
+		name:     "no such field",
+	}, {
+		template: `{{.Id}}`,
+		format:   jsonFormat,
+		expErr:   true,
+		name:     "template & format together",
+	}}
+}
+
+func TestGetTemplates(t *testing.T) {
+	lg.Logger = lg.NewDummyLogger()
+	tcs := getTemplateTestCases()
+	for _, tc := range tcs {
+		t.Run(tc.name, func(t *testing.T) {
+			runTemplateTest(t, tc)
+		})
+	}
+}
+
+func runTemplateTest(t *testing.T, tc template_test_case) {
+	conf := godoo.ConfigVals{
+		TodoRepo:   itemsRepo{},
+		DateLayout: "2006-01-02",
+		NowString:  "2022-06-06",
+		Templates:  map[string]string{"short": `{{.Id}} {{priority .Priority}} {{due .Deadline}} (children: {{join .ChildItems ";"}})`},
+	}
+	gCmd := GetCommand{conf: &conf, getAll: true, template: tc.template, format: tc.format}
+
+	var b bytes.Buffer
+	err := gCmd.Run(&b)
+	if (err != nil) != tc.expErr {
+		t.Fatalf(">>>>FAILED (err): expected error: %v, got '%v'", tc.expErr, err)
+	}
+	if b.String() != tc.expOut {
+		t.Errorf(">>>>FAILED: expected '%q', got '%q'", tc.expOut, b.String())
+	}
+}
+
+func TestRelativeDates(t *testing.T) {
+	parse := func(s string) time.Time { d, _ := time.Parse("2006-01-02", s); return d }
+	now := parse("2022-06-06")
+	tcs := map[string]string{"2022-06-06": "today", "2022-06-07": "tomorrow", "2022-06-05": "yesterday", "2022-07-06": "in 30d", "2022-05-30": "7d ago"}
+
+	for d, exp := range tcs {
+		if got := getRelativeDate(parse(d), now); got != exp {
+			t.Errorf(">>>>FAILED: %v - expected '%v', got '%v'", d, exp, got)
+		}
+	}
+}
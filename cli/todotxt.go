@@ -0,0 +1,214 @@
+package cli
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	godoo "github.com/mundacity/go-doo"
+)
+
+// todo.txt (http://todotxt.org) has no ids, parents or repeat rules,
+// so they're written as key:value pairs. Tags are written as +projects.
+const (
+	todoTxtId         = "id"
+	todoTxtParent     = "parent"
+	todoTxtDue        = "due"
+	todoTxtRepeat     = "rec"
+	todoTxtPriority   = "pri" // priority of a completed or date-based item
+	todoTxtOwner      = "owner"
+	todoTxtVisibility = "vis"
+)
+
+// todo.txt dates are always yyyy-mm-dd, whatever DATETIME_FORMAT is
+const todoTxtDateLayout = "2006-01-02"
+
+// Date-based priority has no letter
+const todoTxtDateBased = "date"
+
+var todoTxtPriorities = map[godoo.PriorityLevel]string{godoo.High: "A", godoo.Medium: "B", godoo.Low: "C"}
+
+var todoTxtPriorityPattern = regexp.MustCompile(`^\([A-Z]\)$`)
+
+// Writes one line per item, e.g.
+// 'x 2022-06-05 2022-06-01 write report +work due:2022-06-10 id:3 pri:A'
+func buildTodoTxtOutput(itms []godoo.TodoItem) string {
+	var b strings.Builder
+	for _, itm := range itms {
+		rec := toItemRecord(itm, todoTxtDateLayout)
+
+		var parts []string
+		pri := todoTxtPriorities[itm.Priority]
+		if itm.Priority == godoo.DateBased {
+			pri = todoTxtDateBased
+		}
+		if itm.IsComplete {
+			// completed items keep their priority as a pri: pair
+			parts = append(parts, "x")
+			if !itm.CompletedAt.IsZero() {
+				parts = append(parts, itm.CompletedAt.Format(todoTxtDateLayout))
+			}
+		} else if pri != "" && pri != todoTxtDateBased {
+			parts = append(parts, "("+pri+")")
+		}
+		if rec.CreationDate != "" {
+			parts = append(parts, rec.CreationDate)
+		}
+		parts = append(parts, itm.Body)
+
+		for _, t := range rec.Tags {
+			parts = append(parts, "+"+t)
+		}
+		if rec.Deadline != "" {
+			parts = append(parts, todoTxtDue+":"+rec.Deadline)
+		}
+		if itm.Id != 0 {
+			parts = append(parts, fmt.Sprintf("%v:%v", todoTxtId, itm.Id))
+		}
+		if itm.ParentId != 0 {
+			parts = append(parts, fmt.Sprintf("%v:%v", todoTxtParent, itm.ParentId))
+		}
+		if itm.Recurrence != "" {
+			parts = append(parts, todoTxtRepeat+":"+itm.Recurrence)
+		}
+		if pri != "" && (itm.IsComplete || pri == todoTxtDateBased) {
+			parts = append(parts, todoTxtPriority+":"+pri)
+		}
+		if itm.Owner != "" {
+			parts = append(parts, todoTxtOwner+":"+itm.Owner)
+		}
+		if itm.Visibility != "" {
+			parts = append(parts, todoTxtVisibility+":"+string(itm.Visibility))
+		}
+		b.WriteString(strings.Join(parts, " ") + "\n")
+	}
+	return b.String()
+}
+
+// Reads items written by buildTodoTxtOutput, or by any other todo.txt
+// tool. +projects & @contexts are read as tags, and key:value pairs as
+// the fields above, but only from the end of a line; those earlier on
+// are left in the body. Blank lines are skipped.
+func readTodoTxt(r io.Reader) ([]godoo.TodoItem, error) {
+	var ret []godoo.TodoItem
+	sc := bufio.NewScanner(r)
+	for n := 1; sc.Scan(); n++ {
+		if strings.TrimSpace(sc.Text()) == "" {
+			continue
+		}
+		itm, err := readTodoTxtLine(sc.Text())
+		if err != nil {
+			return nil, &ImportReadError{Item: n, Err: err}
+		}
+		ret = append(ret, itm)
+	}
+	return ret, sc.Err()
+}
+
+func readTodoTxtLine(line string) (godoo.TodoItem, error) {
+	itm := godoo.NewTodoItem(godoo.WithPriorityLevel(godoo.None))
+	words := strings.Fields(line)
+
+	if len(words) > 0 && words[0] == "x" {
+		itm.IsComplete = true
+		words = words[1:]
+		// a completion date is only written along with a creation date
+		if d, ok := readTodoTxtDate(words); ok && len(words) > 1 {
+			if _, ok = readTodoTxtDate(words[1:]); ok {
+				itm.CompletedAt = d
+				words = words[1:]
+			}
+		}
+	}
+	if len(words) > 0 && todoTxtPriorityPattern.MatchString(words[0]) {
+		itm.Priority = getTodoTxtPriority(words[0][1:2])
+		words = words[1:]
+	}
+	if d, ok := readTodoTxtDate(words); ok {
+		itm.CreationDate = d
+		words = words[1:]
+	}
+
+	end := len(words)
+	for ; end > 0; end-- {
+		ok, err := readTodoTxtField(itm, words[end-1])
+		if err != nil {
+			return *itm, err
+		}
+		if !ok {
+			break
+		}
+	}
+	itm.Body = strings.Join(words[:end], " ")
+
+	if err := itm.SetRecurrence(itm.Recurrence); err != nil {
+		return *itm, err
+	}
+	return *itm, nil
+}
+
+// Sets the field w holds, if it's a tag or a known key:value pair
+func readTodoTxtField(itm *godoo.TodoItem, w string) (bool, error) {
+	if len(w) > 1 && (w[0] == '+' || w[0] == '@') {
+		itm.Tags[w[1:]] = struct{}{}
+		return true, nil
+	}
+
+	k, v, found := strings.Cut(w, ":")
+	if !found {
+		return false, nil
+	}
+
+	var err error
+	switch k {
+	case todoTxtId:
+		itm.Id, err = strconv.Atoi(v)
+	case todoTxtParent:
+		itm.ParentId, err = strconv.Atoi(v)
+		itm.IsChild = itm.ParentId != 0
+	case todoTxtDue:
+		itm.Deadline, err = time.Parse(todoTxtDateLayout, v)
+	case todoTxtRepeat:
+		itm.Recurrence = v
+	case todoTxtPriority:
+		itm.Priority = getTodoTxtPriority(v)
+	case todoTxtOwner:
+		itm.Owner = v
+	case todoTxtVisibility:
+		itm.Visibility = godoo.Visibility(v)
+		if itm.Visibility != godoo.Private && itm.Visibility != godoo.Shared {
+			err = fmt.Errorf("unknown visibility")
+		}
+	default:
+		return false, nil
+	}
+	if err != nil {
+		return false, fmt.Errorf("bad value in '%v'", w)
+	}
+	return true, nil
+}
+
+func readTodoTxtDate(words []string) (time.Time, bool) {
+	if len(words) == 0 {
+		return time.Time{}, false
+	}
+	d, err := time.Parse(todoTxtDateLayout, words[0])
+	return d, err == nil
+}
+
+// A is high, B medium & anything else low
+func getTodoTxtPriority(letter string) godoo.PriorityLevel {
+	if letter == todoTxtDateBased {
+		return godoo.DateBased
+	}
+	for p, l := range todoTxtPriorities {
+		if l == letter && p != godoo.Low {
+			return p
+		}
+	}
+	return godoo.Low
+}
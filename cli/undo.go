@@ -0,0 +1,73 @@
+package cli
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"runtime"
+	"strings"
+
+	godoo "github.com/mundacity/go-doo"
+	lg "github.com/mundacity/quick-logger"
+)
+
+// UndoCommand implements the ICommand interface and reverts
+// the most recent add, edit or delete made from this machine
+type UndoCommand struct {
+	conf   *godoo.ConfigVals
+	fs     *flag.FlagSet
+	source string
+}
+
+// Returns a new UndoCommand after setting up the flagset
+func NewUndoCommand(conf *godoo.ConfigVals) *UndoCommand {
+	uCmd := UndoCommand{}
+	uCmd.conf = conf
+	lg.Logger.Log(lg.Info, "undo command created")
+
+	uCmd.fs = flag.NewFlagSet("undo", flag.ContinueOnError)
+	uCmd.fs.StringVar(&uCmd.source, strings.Trim(string(godoo.FromSource), "-"), "", "source to undo the last change in")
+
+	return &uCmd
+}
+
+// ParseInput implements method from ICommand interface. Undo's
+// only flag is --source, so there's nothing for the parser to do.
+func (uCmd *UndoCommand) ParseInput() error {
+	return uCmd.fs.Parse(uCmd.conf.Args)
+}
+
+// Implements ICommand Run() method
+func (uCmd *UndoCommand) Run(w io.Writer) error {
+	if uCmd.fs.NArg() > 0 {
+		lg.Logger.LogWithCallerInfo(lg.Error, fmt.Sprintf("unexpected arguments: %v", uCmd.fs.Args()), runtime.Caller)
+		return &InvalidArgumentError{}
+	}
+
+	rp, err := pickSource(uCmd.conf.TodoRepo, uCmd.source)
+	if err != nil {
+		lg.Logger.LogWithCallerInfo(lg.Error, fmt.Sprintf("couldn't pick source: %v", err), runtime.Caller)
+		return err
+	}
+
+	u, ok := rp.(godoo.IUndoer)
+	if !ok {
+		lg.Logger.LogWithCallerInfo(lg.Error, "repo doesn't support undo", runtime.Caller)
+		return &HistoryUnavailableError{}
+	}
+
+	entries, err := u.Undo()
+	if err != nil {
+		lg.Logger.LogWithCallerInfo(lg.Error, fmt.Sprintf("undo failed: %v", err), runtime.Caller)
+		return err
+	}
+
+	w.Write([]byte(buildUndoOutput(entries)))
+	lg.Logger.Logf(lg.Info, "undid %v changes", len(entries))
+	return nil
+}
+
+// Not used by the undo command; implemented to satisfy ICommand
+func (uCmd *UndoCommand) BuildItemFromInput() (godoo.TodoItem, error) {
+	return *godoo.NewTodoItem(godoo.WithPriorityLevel(godoo.None)), nil
+}
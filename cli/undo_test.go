@@ -0,0 +1,75 @@
+package cli
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	godoo "github.com/mundacity/go-doo"
+	lg "github.com/mundacity/quick-logger"
+)
+
+// only Undo is needed; the rest satisfies IRepository
+type undoRepo struct{ godoo.IRepository }
+
+func (u undoRepo) Undo() ([]godoo.HistoryEntry, error) {
+	return []godoo.HistoryEntry{
+		{Id: 9, ItemId: 4, Action: godoo.Updated, Before: &godoo.TodoItem{Body: "meeting agenda"}, After: &godoo.TodoItem{Body: "notes"}},
+		{Id: 8, ItemId: 5, Action: godoo.Added, After: &godoo.TodoItem{Body: "typo"}},
+	}, nil
+}
+
+type undo_test_case struct {
+	args   []string
+	repo   godoo.IRepository
+	expOut []string
+	expErr error
+	name   string
+}
+
+func getUndoTestCases() []undo_test_case {
+	return []undo_test_case{{
+		repo:   undoRepo{},
+		expOut: []string{"body: 'notes' -> 'meeting agenda'", "body: 'typo'", "Undid 2 changes"},
+		name:   "reverted changes are listed",
+	}, {
+		args:   []string{"-i", "4"},
+		repo:   undoRepo{},
+		expErr: &InvalidArgumentError{},
+		name:   "flags aren't accepted",
+	}, {
+		repo:   historyRepo{},
+		expErr: &HistoryUnavailableError{},
+		name:   "repo without undo support",
+	}}
+}
+
+func TestUndoCommand(t *testing.T) {
+	lg.Logger = lg.NewDummyLogger()
+	tcs := getUndoTestCases()
+	for _, tc := range tcs {
+		t.Run(tc.name, func(t *testing.T) {
+			runUndoTest(t, tc)
+		})
+	}
+}
+
+func runUndoTest(t *testing.T, tc undo_test_case) {
+	conf := godoo.ConfigVals{Args: tc.args, TodoRepo: tc.repo}
+	uCmd := NewUndoCommand(&conf)
+
+	var b bytes.Buffer
+	err := uCmd.ParseInput()
+	if err == nil {
+		err = uCmd.Run(&b)
+	}
+
+	if (err == nil) != (tc.expErr == nil) {
+		t.Errorf(">>>>FAILED (err): expected '%v', got '%v'", tc.expErr, err)
+	}
+	for _, o := range tc.expOut {
+		if !strings.Contains(b.String(), o) {
+			t.Errorf(">>>>FAILED: expected output to contain '%v', got '%v'", o, b.String())
+		}
+	}
+}
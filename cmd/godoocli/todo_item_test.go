@@ -3,6 +3,7 @@ package main_test
 import (
 	"fmt"
 	"testing"
+	"time"
 
 	godoo "github.com/mundacity/go-doo"
 )
@@ -167,3 +168,84 @@ func TestRemoveChildItem(t *testing.T) {
 	}
 
 }
+
+type recurrence_test_case struct {
+	rule     string
+	deadline time.Time
+	expNext  time.Time
+	validity bool
+	testName string
+}
+
+func getRecurrenceTestCases() []recurrence_test_case {
+	now := time.Date(2022, 6, 15, 0, 0, 0, 0, time.UTC)
+	return []recurrence_test_case{{
+		rule:     "1w",
+		deadline: time.Date(2022, 6, 14, 0, 0, 0, 0, time.UTC),
+		expNext:  time.Date(2022, 6, 21, 0, 0, 0, 0, time.UTC),
+		validity: true,
+		testName: "weekly",
+	}, {
+		rule:     "1d",
+		deadline: time.Date(2022, 6, 10, 0, 0, 0, 0, time.UTC),
+		expNext:  time.Date(2022, 6, 16, 0, 0, 0, 0, time.UTC),
+		validity: true,
+		testName: "daily, completed late - skips to the future",
+	}, {
+		rule:     "1m15d",
+		deadline: time.Date(2022, 6, 20, 0, 0, 0, 0, time.UTC),
+		expNext:  time.Date(2022, 8, 4, 0, 0, 0, 0, time.UTC),
+		validity: true,
+		testName: "combined units",
+	}, {
+		rule:     "1y",
+		expNext:  now.AddDate(1, 0, 0),
+		validity: true,
+		testName: "no deadline - repeats from now",
+	}, {
+		rule:     "w",
+		testName: "missing number",
+	}, {
+		rule:     "2x",
+		testName: "unknown unit",
+	}, {
+		rule:     "0d",
+		testName: "zero interval",
+	}, {
+		rule:     "3",
+		testName: "missing unit",
+	}}
+}
+
+func TestRecurrence(t *testing.T) {
+	now := time.Date(2022, 6, 15, 0, 0, 0, 0, time.UTC)
+	for _, tc := range getRecurrenceTestCases() {
+		t.Run(tc.testName, func(t *testing.T) {
+			itm := godoo.NewTodoItem(godoo.WithPriorityLevel(godoo.High))
+			itm.Body = "standup"
+			itm.Deadline = tc.deadline
+			itm.Tags["work"] = struct{}{}
+			itm.SetParent(4)
+
+			err := itm.SetRecurrence(tc.rule)
+			if !tc.validity {
+				if _, ok := err.(*godoo.InvalidRecurrenceError); !ok {
+					t.Errorf("\n\t>>>>FAILED: error is '%v', expected InvalidRecurrenceError", err)
+				}
+				return
+			}
+
+			next, err := itm.NextOccurrence(now)
+			if err != nil {
+				t.Fatalf("\n\t>>>>FAILED: error is '%v', expected nil", err)
+			}
+			if !next.Deadline.Equal(tc.expNext) {
+				t.Errorf("\n\t>>>>FAILED: next deadline is %v, expected %v", next.Deadline, tc.expNext)
+			}
+			_, tagged := next.Tags["work"]
+			if next.Body != itm.Body || next.Priority != godoo.High || next.ParentId != 4 || !tagged || next.Recurrence != tc.rule {
+				t.Errorf("\n\t>>>>FAILED: next occurrence didn't copy the original: %+v", next)
+			}
+		})
+	}
+}
@@ -1,13 +1,21 @@
 package main
 
 import (
+	"fmt"
+	"os"
+
 	"github.com/mundacity/go-doo/app"
 	"github.com/mundacity/go-doo/srv"
 )
 
 func main() {
 
-	cf := app.GetSrvConfig()
+	cf, err := app.GetSrvConfig()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "error: '%v'\n", err)
+		os.Exit(2)
+	}
+
 	ct := srv.NewSrvContext()
 	ct.SetupServerContext(cf)
 
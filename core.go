@@ -1,8 +1,8 @@
 package godoo
 
 import (
+	"fmt"
 	"io"
-	"net/http"
 	"time"
 )
 
@@ -19,7 +19,7 @@ const (
 
 // passed to different commands to run cli
 type ICliContext interface {
-	SetupCliContext(args []string)
+	SetupCliContext(args []string) error
 	SetupFlagParser()
 	GetCommand() (ICommand, error)
 }
@@ -46,8 +46,7 @@ type IFlagParser interface {
 
 type ConfigVals struct {
 	Args       []string
-	Client     http.Client
-	TodoRepo   IRepository
+	TodoRepo   IRepository // local, remote or multiple - commands don't need to know which
 	Instance   InstanceType
 	RemoteUrl  string
 	DateLayout string
@@ -57,6 +56,12 @@ type ConfigVals struct {
 	IntDigits  int
 	TagDelim   string
 	Parser     IFlagParser
+	// Edits matching more items than this ask for confirmation first
+	ConfirmThreshold int
+	// Named output templates for 'get', keyed by lower case name
+	Templates map[string]string
+	// Sent to servers that require auth tokens
+	AuthToken string
 }
 
 type ServerConfigVals struct {
@@ -66,6 +71,13 @@ type ServerConfigVals struct {
 	PriorityList    *PriorityList
 	RunPriorityList bool
 	Port            int
+	// Scheduled backups; off unless both BackupDir & BackupInterval are set
+	BackupDir      string
+	BackupInterval time.Duration
+	BackupKeep     int // snapshots kept in BackupDir; 0 keeps them all
+	// Requests need a token from 'godoo srv token create', & only see
+	// their owner's items along with shared ones
+	AuthRequired bool
 }
 
 // Flags used throughout the system
@@ -82,6 +94,9 @@ const (
 	Mode            CMD_FLAG = "-m"
 	Next            CMD_FLAG = "-n"
 	Parent          CMD_FLAG = "-p"
+	Query           CMD_FLAG = "-q" // boolean query, e.g. 'tag:work or not done'
+	Recurrence      CMD_FLAG = "-r" // repeat rule, e.g. 1w
+	Search          CMD_FLAG = "-s" // full-text search
 	Tag             CMD_FLAG = "-t"
 	ChangeBody      CMD_FLAG = "-B" //append or replace
 	ChangeParent    CMD_FLAG = "-C"
@@ -91,9 +106,45 @@ const (
 	ChangeTag       CMD_FLAG = "-T" //append, replace, or remove
 	AppendMode      CMD_FLAG = "--append"
 	ReplaceMode     CMD_FLAG = "--replace"
+	RemoveMode      CMD_FLAG = "--remove" // tags only
+	Done            CMD_FLAG = "--done"   // set complete, however many times it's run
+	Undone          CMD_FLAG = "--undone" // set incomplete
 	// Modifies the behaviour of the -n flag (next) in get command.
 	// Instead of next by priority, it's next by date.
 	DateMode CMD_FLAG = "--date"
+	// Returns the item with the id passed & all of its descendants
+	Tree CMD_FLAG = "--tree"
+	// Date (range) during which items were completed
+	CompletedBetween CMD_FLAG = "--completed-between"
+	// Show state rather than change it - e.g. 'db migrate --status'
+	Status CMD_FLAG = "--status"
+	// Show what an edit would change without changing anything
+	DryRun CMD_FLAG = "--dry-run"
+	// Skip confirmation prompts
+	Yes CMD_FLAG = "--yes"
+	// Machine-readable output - json, ndjson, csv or tsv
+	Format CMD_FLAG = "--format"
+	// Output via a text/template, or the name of one from the config
+	Template CMD_FLAG = "--template"
+	// Order, size & position of a page of results
+	Sort       CMD_FLAG = "--sort"
+	Descending CMD_FLAG = "--desc"
+	Limit      CMD_FLAG = "--limit"
+	Offset     CMD_FLAG = "--offset"
+	Cursor     CMD_FLAG = "--cursor"
+	// Items with any of the tags passed to -t, rather than all of them
+	AnyTag CMD_FLAG = "--any-tag"
+	// File to read items from; implied by 'godoo import <file>'
+	File CMD_FLAG = "--file"
+	// Skip imported items whose body & creation date already exist
+	Dedupe CMD_FLAG = "--dedupe"
+	// Number of backup snapshots to keep
+	Keep CMD_FLAG = "--keep"
+	// Who can see items on a server requiring auth tokens
+	SharedItem  CMD_FLAG = "--shared"
+	PrivateItem CMD_FLAG = "--private"
+	// Source an edit or delete applies to in multiple storage mode
+	FromSource CMD_FLAG = "--source"
 )
 
 // Differnt kinds of supported RDBMS
@@ -131,6 +182,15 @@ const (
 	ByReplacement
 	ByAppending
 	ByCompletion
+	ByRemoval        // modifier; only applies to tags
+	BySubtree        // item & all of its descendants
+	ByFullText       // match against FullUserQuery.SearchText
+	ByCompletionDate // when an item was marked complete
+	ByToggle         // modifier; flips completion instead of setting it
+	ByAnyTag         // modifier; ByTag matches any of the tags rather than all
+	ByVisibility     // edits only; private or shared
+	ByOwner          // items owned by QueryData.Owner
+	ByVisibleTo      // items owned by QueryData.Owner, or shared
 )
 
 // Wrapper for a single UserQueryElement and
@@ -148,15 +208,197 @@ type UserQueryOption struct {
 type FullUserQuery struct {
 	QueryOptions []UserQueryOption `json:"qryOpts"`
 	QueryData    TodoItem          `json:"qryData"`
+	SearchText   string            `json:"searchText,omitempty"` // full-text expression, e.g. "deploy AND stag*"
+	Expr         *QueryExpr        `json:"expr,omitempty"`       // and-ed with the query options
+	Sort         []SortKey         `json:"sort,omitempty"`       // ties are always broken by id
+	Descending   bool              `json:"descending,omitempty"`
+	Limit        int               `json:"limit,omitempty"` // 0 for no limit
+	Offset       int               `json:"offset,omitempty"`
+	Cursor       string            `json:"cursor,omitempty"` // from a previous page; used instead of Offset
 }
 
+// Fields that results can be ordered by
+type SortKey string
+
+const (
+	SortById       SortKey = "id"
+	SortByDeadline SortKey = "deadline" // items without a deadline go after those with one
+	SortByCreation SortKey = "creation"
+	SortByPriority SortKey = "priority"
+	SortByBody     SortKey = "body" // not case sensitive
+)
+
 // Defines methods used to interact with data storage
 type IRepository interface {
 	GetAll() ([]TodoItem, error)
 	GetWhere(query FullUserQuery) ([]TodoItem, error)
 	Add(itm *TodoItem) (int64, error)
 	UpdateWhere(srchQry, edtQry FullUserQuery) (int, error)
-	// Delete(items ...int) error
+	DeleteWhere(srchQry FullUserQuery) ([]int, error)
+}
+
+// Implemented by repositories that manage their own schema
+type IMigrator interface {
+	Migrate() (int, error)
+	MigrationStatus() ([]MigrationInfo, error)
+}
+
+// Implemented by repositories that keep a record of every change made to items
+type IHistorian interface {
+	History(itemId int) ([]HistoryEntry, error)
+}
+
+// Implemented by repositories that can revert the most recent add, edit
+// or delete made by a client. Returns the entries that were reverted.
+type IUndoer interface {
+	Undo() ([]HistoryEntry, error)
+}
+
+// Implemented by repositories that can show what an edit would do without doing it
+type IPreviewer interface {
+	PreviewUpdate(srchQry, edtQry FullUserQuery) (EditPreview, error)
+}
+
+// Implemented by repositories that can count the items a search
+// matches without reading them
+type ICounter interface {
+	CountWhere(srchQry FullUserQuery) (int, error)
+}
+
+// Implemented by repositories that can add several items at once, so
+// either all of them are added or none are; see AddAll
+type IBatchAdder interface {
+	AddAll(itms []TodoItem, parents []int) ([]int64, error)
+}
+
+// Implemented by repositories that are told where the next page
+// starts rather than working it out; see GetPage
+type IPager interface {
+	GetPage(qry FullUserQuery) (itms []TodoItem, nextCursor string, err error)
+}
+
+// Implemented by repositories made up of several sources, so commands
+// that don't take a search, like history & undo, can name one of them
+type ISourcePicker interface {
+	Source(name string) (IRepository, error)
+}
+
+// Implemented by repositories that can copy their db while it's in use.
+// Restore replaces everything in the db with the contents of the backup.
+type IBackuper interface {
+	Backup(path string) error
+	Restore(path string) error
+}
+
+// The number of items an edit matches & how each would change
+type EditPreview struct {
+	Matched int            `json:"matched"`
+	Changes []HistoryEntry `json:"changes"`
+}
+
+// Implemented by repositories that can attribute changes to whoever asked for
+// them. Changes made through the repo returned are recorded against client.
+type IAttributer interface {
+	ForClient(client string) IRepository
+}
+
+// Header remote clients use to identify themselves, e.g. 'alice@laptop'
+const ClientHeader = "X-Godoo-Client"
+
+// Header the server uses to hand out the cursor for the next page of
+// results; it's left out on the last page
+const NextCursorHeader = "X-Godoo-Next-Cursor"
+
+// The kind of change recorded in an item's history
+type HistoryAction string
+
+const (
+	Added   HistoryAction = "add"
+	Updated HistoryAction = "update"
+	Deleted HistoryAction = "delete"
+)
+
+// A single change to an item. Before is nil for added items & After
+// is nil for deleted ones. Entries written by the same add, edit or
+// delete share an Operation; Undoes is set if that was an undo.
+type HistoryEntry struct {
+	Id         int           `json:"id"`
+	ItemId     int           `json:"itemId"`
+	Action     HistoryAction `json:"action"`
+	Before     *TodoItem     `json:"before,omitempty"`
+	After      *TodoItem     `json:"after,omitempty"`
+	Client     string        `json:"client"`
+	OccurredAt time.Time     `json:"occurredAt"`
+	Operation  int           `json:"operation"`
+	Undoes     int           `json:"undoes,omitempty"`
+}
+
+// Describes a single schema migration and whether it's been applied
+type MigrationInfo struct {
+	Version     int    `json:"version"`
+	Description string `json:"description"`
+	Applied     bool   `json:"applied"`
+	AppliedAt   string `json:"appliedAt"`
+}
+
+// Returned when a destructive operation is attempted
+// without any search criteria to narrow it down
+type NoQueryOptionsError struct{}
+
+func (e *NoQueryOptionsError) Error() string {
+	return "no query options provided"
+}
+
+// Returned when full-text search is requested
+// but the storage option doesn't support it
+type FullTextUnavailableError struct{}
+
+func (e *FullTextUnavailableError) Error() string {
+	return "full-text search not available (sqlite needs to be built with the 'sqlite_fts5' tag)"
+}
+
+// Returned when a full-text search expression can't be parsed
+type SearchSyntaxError struct {
+	Expr string
+}
+
+func (e *SearchSyntaxError) Error() string {
+	return fmt.Sprintf("invalid search expression: '%v'", e.Expr)
+}
+
+// Returned when the client has no changes left to undo
+type NothingToUndoError struct{}
+
+func (e *NothingToUndoError) Error() string {
+	return "nothing to undo"
+}
+
+// Returned when an item has been changed since the operation being
+// undone, so restoring it would overwrite someone else's work
+type UndoConflictError struct {
+	ItemId int
+}
+
+func (e *UndoConflictError) Error() string {
+	return fmt.Sprintf("can't undo: item %v has changed since", e.ItemId)
+}
+
+// Returned when results are to be sorted by something other than a SortKey
+type InvalidSortKeyError struct {
+	Key SortKey
+}
+
+func (e *InvalidSortKeyError) Error() string {
+	return fmt.Sprintf("can't sort by '%v'; use id, deadline, creation, priority or body", e.Key)
+}
+
+// Returned when a page cursor wasn't one handed out by NewCursor
+type InvalidCursorError struct {
+	Cursor string
+}
+
+func (e *InvalidCursorError) Error() string {
+	return fmt.Sprintf("invalid cursor: '%v'", e.Cursor)
 }
 
 // Defines common behaviour of different collection types
@@ -2,7 +2,6 @@ package fake
 
 import (
 	"errors"
-	"net/http"
 
 	godoo "github.com/mundacity/go-doo"
 	"github.com/mundacity/go-doo/cli"
@@ -14,7 +13,7 @@ type App_Context struct {
 	cmdName string
 }
 
-func (a *App_Context) SetupCliContext(args []string) {
+func (a *App_Context) SetupCliContext(args []string) error {
 	a.Config = godoo.ConfigVals{}
 	a.cmdName = args[0]
 	a.Config.Args = args[1:]
@@ -26,11 +25,10 @@ func (a *App_Context) SetupCliContext(args []string) {
 
 	lg.Logger = lg.NewDummyLogger()
 
-	a.Config.Client = *http.DefaultClient
 	a.Config.RemoteUrl = ""
 	a.Config.Conn = ""
 	a.Config.TodoRepo = RepoDud{}
-
+	return nil
 }
 
 func (a *App_Context) GetCommand() (godoo.ICommand, error) {
@@ -44,6 +42,18 @@ func (a *App_Context) GetCommand() (godoo.ICommand, error) {
 		cmd = cli.NewGetCommand(&a.Config)
 	case "edit":
 		cmd = cli.NewEditCommand(&a.Config)
+	case "delete":
+		cmd = cli.NewDeleteCommand(&a.Config)
+	case "history":
+		cmd = cli.NewHistoryCommand(&a.Config)
+	case "undo":
+		cmd = cli.NewUndoCommand(&a.Config)
+	case "export":
+		cmd = cli.NewExportCommand(&a.Config)
+	case "import":
+		cmd = cli.NewImportCommand(&a.Config)
+	case "sync":
+		cmd = cli.NewSyncCommand(&a.Config)
 	default:
 		return nil, errors.New("invalid command")
 	}
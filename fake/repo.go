@@ -26,6 +26,28 @@ func (m RepoDud) UpdateWhere(srchQry, edtQry godoo.FullUserQuery) (int, error) {
 	return 3, nil
 }
 
+func (m RepoDud) DeleteWhere(srchQry godoo.FullUserQuery) ([]int, error) {
+	return []int{1, 2}, nil
+}
+
+func (m RepoDud) History(itemId int) ([]godoo.HistoryEntry, error) {
+	return []godoo.HistoryEntry{
+		{Id: 1, ItemId: itemId, Action: godoo.Added, After: &godoo.TodoItem{Id: itemId}, Client: "dud"},
+	}, nil
+}
+
+func (m RepoDud) Undo() ([]godoo.HistoryEntry, error) {
+	return []godoo.HistoryEntry{
+		{Id: 2, ItemId: 1, Action: godoo.Updated, Before: &godoo.TodoItem{Id: 1}, After: &godoo.TodoItem{Id: 1}, Client: "dud"},
+	}, nil
+}
+
+func (m RepoDud) PreviewUpdate(srchQry, edtQry godoo.FullUserQuery) (godoo.EditPreview, error) {
+	return godoo.EditPreview{Matched: 3, Changes: []godoo.HistoryEntry{
+		{ItemId: 1, Action: godoo.Updated, Before: &godoo.TodoItem{Id: 1}, After: &godoo.TodoItem{Id: 1, IsComplete: true}},
+	}}, nil
+}
+
 func (m RepoDud) GetAll() ([]godoo.TodoItem, error) {
 	var itms []godoo.TodoItem
 	return itms, nil
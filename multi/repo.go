@@ -0,0 +1,419 @@
+package multi
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+
+	godoo "github.com/mundacity/go-doo"
+	lg "github.com/mundacity/quick-logger"
+)
+
+// Source pairs a repository with the label used to
+// identify where returned items came from
+type Source struct {
+	Name string
+	Repo godoo.IRepository
+}
+
+// Repo implements IRepository by fanning each call out to several
+// underlying repositories - local, remote or a mix - concurrently.
+// New items are only ever added to the primary source.
+type Repo struct {
+	sources []Source
+	primary int
+}
+
+// Returns a new Repo; primary is the name of the source that new items are added to.
+// If primary is empty, the first source is used.
+func NewRepo(primary string, sources ...Source) (*Repo, error) {
+	if len(sources) == 0 {
+		return nil, &NoSourcesError{}
+	}
+
+	r := &Repo{sources: sources}
+	if primary == "" {
+		return r, nil
+	}
+
+	for i, s := range sources {
+		if s.Name == primary {
+			r.primary = i
+			return r, nil
+		}
+	}
+	return nil, &UnknownPrimaryError{Name: primary}
+}
+
+// result of a single source's part of a fanned-out operation
+type source_result struct {
+	name string
+	itms []godoo.TodoItem
+	ids  []int
+	n    int
+	err  error
+}
+
+// Runs f against each of srcs in its own goroutine and collects the results
+func fanOut(srcs []Source, f func(rp godoo.IRepository) source_result) []source_result {
+	ch := make(chan source_result, len(srcs))
+	var wg sync.WaitGroup
+
+	for _, s := range srcs {
+		wg.Add(1)
+		go func(s Source) {
+			defer wg.Done()
+			res := f(s.Repo)
+			res.name = s.Name
+			ch <- res
+		}(s)
+	}
+
+	wg.Wait()
+	close(ch)
+
+	var ret []source_result
+	for res := range ch {
+		ret = append(ret, res)
+	}
+	return ret
+}
+
+func (r *Repo) GetAll() ([]godoo.TodoItem, error) {
+	res := fanOut(r.sources, func(rp godoo.IRepository) source_result {
+		itms, err := rp.GetAll()
+		return source_result{itms: itms, err: err}
+	})
+	return mergeItems(res)
+}
+
+// Results from every source are merged into the order asked for before
+// the page is cut out, so each source is asked for everything up to the
+// end of the page. A cursor holds sort values rather than a position,
+// so it's passed on as it is & each source starts after the same place.
+func (r *Repo) GetWhere(qry godoo.FullUserQuery) ([]godoo.TodoItem, error) {
+	if err := godoo.ValidateSortKeys(qry.Sort); err != nil {
+		return nil, err
+	}
+	start, err := qry.PageStart()
+	if err != nil {
+		return nil, err
+	}
+	if _, err = qry.PageAfter(); err != nil {
+		return nil, err
+	}
+
+	srcs, err := r.named(qry.QueryData.Source)
+	if err != nil {
+		return nil, err
+	}
+
+	srcQry := qry
+	srcQry.Offset = 0
+	srcQry.QueryData.Source = ""
+	if qry.Limit > 0 {
+		srcQry.Limit = start + qry.Limit
+	}
+
+	res := fanOut(srcs, func(rp godoo.IRepository) source_result {
+		itms, err := rp.GetWhere(srcQry)
+		return source_result{itms: itms, err: err}
+	})
+	ret, err := mergeItems(res)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(qry.Sort) == 0 && qry.SearchText != "" {
+		// by relevance, the same way each source orders its matches
+		sort.SliceStable(ret, func(i, j int) bool {
+			a, b := ret[i], ret[j]
+			if qry.Descending {
+				a, b = b, a
+			}
+			if a.Rank == b.Rank {
+				return a.Id < b.Id
+			}
+			return a.Rank < b.Rank
+		})
+	} else {
+		godoo.SortItems(ret, qry.Sort, qry.Descending)
+	}
+
+	if qry.IsPaged() {
+		ret = godoo.PageItems(ret, start, qry.Limit)
+	}
+	return ret, nil
+}
+
+func (r *Repo) Add(itm *godoo.TodoItem) (int64, error) {
+	return r.sources[r.primary].Repo.Add(itm)
+}
+
+// All or nothing only if the primary source can add items in one go
+func (r *Repo) AddAll(itms []godoo.TodoItem, parents []int) ([]int64, error) {
+	return godoo.AddAll(r.sources[r.primary].Repo, itms, parents)
+}
+
+// Ids are only unique within a source, so edits that search by id
+// or set a new parent have to name the source they're meant for.
+func (r *Repo) UpdateWhere(srchQry, edtQry godoo.FullUserQuery) (int, error) {
+	srcs, err := r.targets(srchQry, edtQry)
+	if err != nil {
+		return 0, err
+	}
+	srchQry.QueryData.Source = ""
+
+	res := fanOut(srcs, func(rp godoo.IRepository) source_result {
+		n, err := rp.UpdateWhere(srchQry, edtQry)
+		return source_result{n: n, err: err}
+	})
+
+	var total int
+	for _, s := range res {
+		total += s.n
+	}
+	return total, collectErrors(res)
+}
+
+func (r *Repo) DeleteWhere(srchQry godoo.FullUserQuery) ([]int, error) {
+	srcs, err := r.targets(srchQry)
+	if err != nil {
+		return nil, err
+	}
+	srchQry.QueryData.Source = ""
+
+	res := fanOut(srcs, func(rp godoo.IRepository) source_result {
+		ids, err := rp.DeleteWhere(srchQry)
+		return source_result{ids: ids, err: err}
+	})
+
+	var ids []int
+	for _, s := range res {
+		ids = append(ids, s.ids...)
+	}
+	return ids, collectErrors(res)
+}
+
+// Counts matches in the named source, or all of them
+func (r *Repo) CountWhere(srchQry godoo.FullUserQuery) (int, error) {
+	srcs, err := r.named(srchQry.QueryData.Source)
+	if err != nil {
+		return 0, err
+	}
+	srchQry.QueryData.Source = ""
+
+	res := fanOut(srcs, func(rp godoo.IRepository) source_result {
+		if c, ok := rp.(godoo.ICounter); ok {
+			n, err := c.CountWhere(srchQry)
+			return source_result{n: n, err: err}
+		}
+		itms, err := rp.GetWhere(srchQry)
+		return source_result{n: len(itms), err: err}
+	})
+
+	var total int
+	for _, s := range res {
+		total += s.n
+	}
+	return total, collectErrors(res)
+}
+
+// Previews in the source the edit is for, if it can. Otherwise,
+// e.g. when the edit spans sources, only the number of items
+// it matches is known.
+func (r *Repo) PreviewUpdate(srchQry, edtQry godoo.FullUserQuery) (godoo.EditPreview, error) {
+	srcs, err := r.targets(srchQry, edtQry)
+	if err != nil {
+		return godoo.EditPreview{}, err
+	}
+
+	if p, ok := srcs[0].Repo.(godoo.IPreviewer); ok && len(srcs) == 1 {
+		srchQry.QueryData.Source = ""
+		return p.PreviewUpdate(srchQry, edtQry)
+	}
+	n, err := r.CountWhere(srchQry)
+	return godoo.EditPreview{Matched: n}, err
+}
+
+// Versions can only be checked in a single source, as item ids, & so the
+// keys of versions, repeat across sources. Edits spanning sources are made
+// without checking them.
+func (r *Repo) UpdateIfUnchanged(srchQry, edtQry godoo.FullUserQuery, versions map[int]int) (int, error) {
+	srcs, err := r.targets(srchQry, edtQry)
+	if err != nil {
+		return 0, err
+	}
+
+	if c, ok := srcs[0].Repo.(godoo.IConditionalUpdater); ok && len(srcs) == 1 {
+		srchQry.QueryData.Source = ""
+		return c.UpdateIfUnchanged(srchQry, edtQry, versions)
+	}
+	return r.UpdateWhere(srchQry, edtQry)
+}
+
+// History & undo don't take a search to name a source with, so they only
+// work without picking one when there's a single source to begin with
+func (r *Repo) History(itemId int) ([]godoo.HistoryEntry, error) {
+	if len(r.sources) > 1 {
+		return nil, &NoSourceNamedError{Op: "history"}
+	}
+	h, ok := r.sources[0].Repo.(godoo.IHistorian)
+	if !ok {
+		return nil, &UnsupportedError{Source: r.sources[0].Name, Op: "history"}
+	}
+	return h.History(itemId)
+}
+
+func (r *Repo) Undo() ([]godoo.HistoryEntry, error) {
+	if len(r.sources) > 1 {
+		return nil, &NoSourceNamedError{Op: "undo"}
+	}
+	u, ok := r.sources[0].Repo.(godoo.IUndoer)
+	if !ok {
+		return nil, &UnsupportedError{Source: r.sources[0].Name, Op: "undo"}
+	}
+	return u.Undo()
+}
+
+// Returns the repository behind the source called name
+func (r *Repo) Source(name string) (godoo.IRepository, error) {
+	srcs, err := r.named(name)
+	if err != nil {
+		return nil, err
+	}
+	return srcs[0].Repo, nil
+}
+
+// Returns the sources an edit or delete should run against - the one
+// named in the search, if any, or else all of them. Without a name,
+// queries involving ids are refused as they'd hit a different item
+// in each source.
+func (r *Repo) targets(srchQry godoo.FullUserQuery, others ...godoo.FullUserQuery) ([]Source, error) {
+	if srchQry.QueryData.Source != "" {
+		return r.named(srchQry.QueryData.Source)
+	}
+
+	if len(r.sources) == 1 {
+		return r.sources, nil
+	}
+	for _, qry := range append([]godoo.FullUserQuery{srchQry}, others...) {
+		for _, o := range qry.QueryOptions {
+			switch o.Elem {
+			case godoo.ById, godoo.ByChildId, godoo.ByParentId, godoo.BySubtree:
+				return nil, &AmbiguousIdError{}
+			}
+		}
+	}
+	return r.sources, nil
+}
+
+// Returns every source, or just the one called name if it's set
+func (r *Repo) named(name string) ([]Source, error) {
+	if name == "" {
+		return r.sources, nil
+	}
+	for _, s := range r.sources {
+		if s.Name == name {
+			return []Source{s}, nil
+		}
+	}
+	return nil, &UnknownSourceError{Name: name}
+}
+
+// Labels each item with its source and combines them. A source that
+// can't be read from (e.g. the LAN server being down) shouldn't
+// hide everything else, so an error is only returned if every
+// source failed.
+func mergeItems(res []source_result) ([]godoo.TodoItem, error) {
+	var ret []godoo.TodoItem
+	failed := 0
+
+	for _, s := range res {
+		if s.err != nil {
+			failed++
+			lg.Logger.Logf(lg.Warning, "source '%v' failed: %v", s.name, s.err)
+			continue
+		}
+		for _, itm := range s.itms {
+			itm.Source = s.name
+			ret = append(ret, itm)
+		}
+	}
+
+	if failed == len(res) {
+		return nil, collectErrors(res)
+	}
+	return ret, nil
+}
+
+func collectErrors(res []source_result) error {
+	var errs []string
+	for _, s := range res {
+		if s.err != nil {
+			errs = append(errs, fmt.Sprintf("%v: %v", s.name, s.err))
+		}
+	}
+	if len(errs) == 0 {
+		return nil
+	}
+	return &SourceError{Msgs: errs}
+}
+
+// Returned when one or more sources fail during a fanned-out operation
+type SourceError struct {
+	Msgs []string
+}
+
+func (s *SourceError) Error() string {
+	return "source error/s - " + strings.Join(s.Msgs, "; ")
+}
+
+type NoSourcesError struct{}
+
+func (n *NoSourcesError) Error() string {
+	return "no sources provided"
+}
+
+type UnknownPrimaryError struct {
+	Name string
+}
+
+func (u *UnknownPrimaryError) Error() string {
+	return fmt.Sprintf("primary source '%v' not found", u.Name)
+}
+
+type UnknownSourceError struct {
+	Name string
+}
+
+func (u *UnknownSourceError) Error() string {
+	return fmt.Sprintf("source '%v' not found", u.Name)
+}
+
+// Returned when an edit or delete uses ids without naming a source
+type AmbiguousIdError struct{}
+
+func (a *AmbiguousIdError) Error() string {
+	return "ids aren't unique across sources; use --source to pick one"
+}
+
+// Returned when an operation needs a single source, but none was named
+type NoSourceNamedError struct {
+	Op string
+}
+
+func (n *NoSourceNamedError) Error() string {
+	return fmt.Sprintf("%v needs a single source; use --source to pick one", n.Op)
+}
+
+// Returned when a source's storage option doesn't support an operation
+type UnsupportedError struct {
+	Source string
+	Op     string
+}
+
+func (u *UnsupportedError) Error() string {
+	return fmt.Sprintf("source '%v' doesn't support %v", u.Source, u.Op)
+}
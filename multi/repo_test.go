@@ -0,0 +1,454 @@
+package multi
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	godoo "github.com/mundacity/go-doo"
+	"github.com/mundacity/go-doo/fake"
+	lg "github.com/mundacity/quick-logger"
+)
+
+// always fails; stands in for an unreachable server
+type brokenRepo struct{}
+
+func (b brokenRepo) GetAll() ([]godoo.TodoItem, error) { return nil, errors.New("unreachable") }
+func (b brokenRepo) GetWhere(qry godoo.FullUserQuery) ([]godoo.TodoItem, error) {
+	return nil, errors.New("unreachable")
+}
+func (b brokenRepo) Add(itm *godoo.TodoItem) (int64, error) { return 0, errors.New("unreachable") }
+func (b brokenRepo) UpdateWhere(srchQry, edtQry godoo.FullUserQuery) (int, error) {
+	return 0, errors.New("unreachable")
+}
+func (b brokenRepo) DeleteWhere(srchQry godoo.FullUserQuery) ([]int, error) {
+	return nil, errors.New("unreachable")
+}
+
+type fan_out_test_case struct {
+	sources  []Source
+	primary  string
+	expItms  int
+	expEdits int
+	expAddId int64
+	getErr   bool
+	editErr  bool
+	addErr   bool
+	name     string
+}
+
+func getFanOutTestCases() []fan_out_test_case {
+	return []fan_out_test_case{{
+		sources:  []Source{{"personal", fake.RepoDud{}}, {"lan", fake.RepoDud{}}},
+		primary:  "lan",
+		expItms:  2,
+		expEdits: 6,
+		expAddId: 1,
+		name:     "two healthy sources",
+	}, {
+		sources:  []Source{{"personal", fake.RepoDud{}}, {"lan", brokenRepo{}}},
+		primary:  "personal",
+		expItms:  1,
+		expEdits: 3,
+		expAddId: 1,
+		editErr:  true,
+		name:     "one source down - reads still work",
+	}, {
+		sources: []Source{{"personal", brokenRepo{}}, {"lan", brokenRepo{}}},
+		expItms: 0,
+		getErr:  true,
+		editErr: true,
+		addErr:  true,
+		name:    "all sources down",
+	}}
+}
+
+func TestFanOut(t *testing.T) {
+	lg.Logger = lg.NewDummyLogger()
+	tcs := getFanOutTestCases()
+	for _, tc := range tcs {
+		t.Run(tc.name, func(t *testing.T) {
+			runFanOutTest(t, tc)
+		})
+	}
+}
+
+func runFanOutTest(t *testing.T, tc fan_out_test_case) {
+	r, err := NewRepo(tc.primary, tc.sources...)
+	if err != nil {
+		t.Fatalf(">>>>FAILED: %v", err)
+	}
+
+	itms, err := r.GetWhere(godoo.FullUserQuery{})
+	if (err != nil) != tc.getErr {
+		t.Errorf(">>>>FAILED (get): unexpected error state: %v", err)
+	}
+	if len(itms) != tc.expItms {
+		t.Errorf(">>>>FAILED (get): expected %v items, got %v", tc.expItms, len(itms))
+	}
+	for _, itm := range itms {
+		if itm.Source == "" {
+			t.Errorf(">>>>FAILED (get): item %v has no source label", itm.Id)
+		}
+	}
+
+	n, err := r.UpdateWhere(godoo.FullUserQuery{}, godoo.FullUserQuery{})
+	if (err != nil) != tc.editErr {
+		t.Errorf(">>>>FAILED (edit): unexpected error state: %v", err)
+	}
+	if n != tc.expEdits {
+		t.Errorf(">>>>FAILED (edit): expected %v edits, got %v", tc.expEdits, n)
+	}
+
+	id, err := r.Add(&godoo.TodoItem{})
+	if (err != nil) != tc.addErr {
+		t.Errorf(">>>>FAILED (add): unexpected error state: %v", err)
+	}
+	if id != tc.expAddId {
+		t.Errorf(">>>>FAILED (add): expected id %v, got %v", tc.expAddId, id)
+	}
+}
+
+// returns its items the way a real source would - sorted & paged
+type listRepo struct {
+	brokenRepo
+	itms []godoo.TodoItem
+}
+
+// cursors are only used here with items in id order
+func (l listRepo) GetWhere(qry godoo.FullUserQuery) ([]godoo.TodoItem, error) {
+	pos, err := qry.PageAfter()
+	if err != nil {
+		return nil, err
+	}
+
+	var ret []godoo.TodoItem
+	for _, itm := range l.itms {
+		if pos == nil || (!qry.Descending && itm.Id > pos.Id) || (qry.Descending && itm.Id < pos.Id) {
+			ret = append(ret, itm)
+		}
+	}
+	godoo.SortItems(ret, qry.Sort, qry.Descending)
+	return godoo.PageItems(ret, qry.Offset, qry.Limit), nil
+}
+
+type merge_test_case struct {
+	qry    godoo.FullUserQuery
+	expIds []int
+	name   string
+}
+
+func getMergeTestCases() []merge_test_case {
+	return []merge_test_case{{
+		expIds: []int{1, 1, 2, 3, 4},
+		name:   "merged by id",
+	}, {
+		qry:    godoo.FullUserQuery{Sort: []godoo.SortKey{godoo.SortByBody}},
+		expIds: []int{4, 2, 1, 3, 1},
+		name:   "merged by body",
+	}, {
+		qry:    godoo.FullUserQuery{Sort: []godoo.SortKey{godoo.SortByBody}, Limit: 2, Offset: 2},
+		expIds: []int{1, 3},
+		name:   "paged after merging",
+	}, {
+		qry:    godoo.FullUserQuery{Sort: []godoo.SortKey{godoo.SortByDeadline}, Descending: true},
+		expIds: []int{2, 3, 4, 1, 1},
+		name:   "by deadline descending, items without one last",
+	}, {
+		qry:    godoo.FullUserQuery{Limit: 2, Cursor: godoo.NewCursor(godoo.TodoItem{Id: 1})},
+		expIds: []int{2, 3},
+		name:   "each source starts after the cursor",
+	}, {
+		qry:    godoo.FullUserQuery{Descending: true, Limit: 2, Cursor: godoo.NewCursor(godoo.TodoItem{Id: 2})},
+		expIds: []int{1, 1},
+		name:   "last page",
+	}}
+}
+
+func TestMergeOrder(t *testing.T) {
+	lg.Logger = lg.NewDummyLogger()
+	personal := listRepo{itms: []godoo.TodoItem{{Id: 1, Body: "call mum"}, {Id: 2, Body: "Buy milk", Deadline: time.Date(2022, 7, 1, 0, 0, 0, 0, time.UTC)}, {Id: 4, Body: "bake"}}}
+	lan := listRepo{itms: []godoo.TodoItem{{Id: 1, Body: "fix printer"}, {Id: 3, Body: "deploy", Deadline: time.Date(2022, 6, 10, 0, 0, 0, 0, time.UTC)}}}
+	r, _ := NewRepo("", Source{"personal", personal}, Source{"lan", lan})
+
+	for _, tc := range getMergeTestCases() {
+		t.Run(tc.name, func(t *testing.T) {
+			itms, err := r.GetWhere(tc.qry)
+			if err != nil {
+				t.Fatalf(">>>>FAILED: %v", err)
+			}
+
+			var got []int
+			for _, itm := range itms {
+				got = append(got, itm.Id)
+			}
+			if fmt.Sprint(got) != fmt.Sprint(tc.expIds) {
+				t.Errorf(">>>>FAILED: expected %v, got %v", tc.expIds, got)
+			}
+		})
+	}
+}
+
+func TestMergeByRelevance(t *testing.T) {
+	lg.Logger = lg.NewDummyLogger()
+	personal := listRepo{itms: []godoo.TodoItem{{Id: 1, Rank: -2}, {Id: 2, Rank: -5}}}
+	lan := listRepo{itms: []godoo.TodoItem{{Id: 3, Rank: -4}}}
+	r, _ := NewRepo("", Source{"personal", personal}, Source{"lan", lan})
+
+	for desc, exp := range map[bool]string{false: "[2 3 1]", true: "[1 3 2]"} {
+		itms, err := r.GetWhere(godoo.FullUserQuery{SearchText: "deploy*", Descending: desc})
+		if err != nil {
+			t.Fatalf(">>>>FAILED: %v", err)
+		}
+
+		var got []int
+		for _, itm := range itms {
+			got = append(got, itm.Id)
+		}
+		if fmt.Sprint(got) != exp {
+			t.Errorf(">>>>FAILED: descending %v - expected %v, got %v", desc, exp, got)
+		}
+	}
+}
+
+func TestUnknownPrimary(t *testing.T) {
+	_, err := NewRepo("missing", Source{"personal", fake.RepoDud{}})
+	if _, ok := err.(*UnknownPrimaryError); !ok {
+		t.Errorf(">>>>FAILED: expected UnknownPrimaryError, got '%v'", err)
+	}
+
+	_, err = NewRepo("")
+	if _, ok := err.(*NoSourcesError); !ok {
+		t.Errorf(">>>>FAILED: expected NoSourcesError, got '%v'", err)
+	}
+}
+
+// holds a single item with id 1 & counts the edits & deletes that reach it
+type idRepo struct {
+	brokenRepo
+	hits *int
+}
+
+func (i idRepo) UpdateWhere(srchQry, edtQry godoo.FullUserQuery) (int, error) {
+	*i.hits++
+	return 1, nil
+}
+func (i idRepo) DeleteWhere(srchQry godoo.FullUserQuery) ([]int, error) {
+	*i.hits++
+	return []int{1}, nil
+}
+
+type same_id_test_case struct {
+	source    string
+	srchOpt   godoo.UserQueryElement
+	edtOpts   []godoo.UserQueryOption
+	expHits   map[string]int
+	expEdtErr error
+	expDelErr error
+	name      string
+}
+
+func getSameIdTestCases() []same_id_test_case {
+	return []same_id_test_case{{
+		srchOpt:   godoo.ById,
+		expHits:   map[string]int{"personal": 0, "work": 0},
+		expEdtErr: &AmbiguousIdError{},
+		expDelErr: &AmbiguousIdError{},
+		name:      "id without a source refused",
+	}, {
+		srchOpt:   godoo.ByParentId,
+		expHits:   map[string]int{"personal": 0, "work": 0},
+		expEdtErr: &AmbiguousIdError{},
+		expDelErr: &AmbiguousIdError{},
+		name:      "children without a source refused",
+	}, {
+		srchOpt:   godoo.ByTag,
+		edtOpts:   []godoo.UserQueryOption{{Elem: godoo.ByParentId}},
+		expHits:   map[string]int{"personal": 1, "work": 1},
+		expEdtErr: &AmbiguousIdError{},
+		name:      "new parent without a source refused",
+	}, {
+		source:  "work",
+		srchOpt: godoo.ById,
+		expHits: map[string]int{"personal": 0, "work": 2},
+		name:    "id in named source only",
+	}, {
+		source:    "missing",
+		srchOpt:   godoo.ById,
+		expHits:   map[string]int{"personal": 0, "work": 0},
+		expEdtErr: &UnknownSourceError{},
+		expDelErr: &UnknownSourceError{},
+		name:      "unknown source",
+	}, {
+		srchOpt: godoo.ByTag,
+		expHits: map[string]int{"personal": 2, "work": 2},
+		name:    "no ids - every source",
+	}}
+}
+
+func TestSameIdInTwoSources(t *testing.T) {
+	lg.Logger = lg.NewDummyLogger()
+	tcs := getSameIdTestCases()
+	for _, tc := range tcs {
+		t.Run(tc.name, func(t *testing.T) {
+			runSameIdTest(t, tc)
+		})
+	}
+}
+
+func runSameIdTest(t *testing.T, tc same_id_test_case) {
+	hits := map[string]*int{"personal": new(int), "work": new(int)}
+	r, _ := NewRepo("", Source{"personal", idRepo{hits: hits["personal"]}}, Source{"work", idRepo{hits: hits["work"]}})
+
+	srch := godoo.FullUserQuery{QueryOptions: []godoo.UserQueryOption{{Elem: tc.srchOpt}}}
+	srch.QueryData.Id = 1
+	srch.QueryData.Source = tc.source
+	edt := godoo.FullUserQuery{QueryOptions: tc.edtOpts}
+
+	_, err := r.UpdateWhere(srch, edt)
+	if fmt.Sprintf("%T", err) != fmt.Sprintf("%T", tc.expEdtErr) {
+		t.Errorf(">>>>FAILED (edit): expected %T, got '%v'", tc.expEdtErr, err)
+	}
+	_, err = r.DeleteWhere(srch)
+	if fmt.Sprintf("%T", err) != fmt.Sprintf("%T", tc.expDelErr) {
+		t.Errorf(">>>>FAILED (delete): expected %T, got '%v'", tc.expDelErr, err)
+	}
+
+	for name, exp := range tc.expHits {
+		if *hits[name] != exp {
+			t.Errorf(">>>>FAILED: expected %v calls to '%v', got %v", exp, name, *hits[name])
+		}
+	}
+}
+
+// idRepo that keeps history, can undo, preview & check versions
+type capableRepo struct {
+	idRepo
+}
+
+func (c capableRepo) History(itemId int) ([]godoo.HistoryEntry, error) {
+	*c.hits++
+	return []godoo.HistoryEntry{{ItemId: itemId}}, nil
+}
+func (c capableRepo) Undo() ([]godoo.HistoryEntry, error) {
+	*c.hits++
+	return []godoo.HistoryEntry{{ItemId: 1}}, nil
+}
+func (c capableRepo) PreviewUpdate(srchQry, edtQry godoo.FullUserQuery) (godoo.EditPreview, error) {
+	*c.hits++
+	return godoo.EditPreview{Matched: 1, Changes: []godoo.HistoryEntry{{ItemId: 1}}}, nil
+}
+func (c capableRepo) UpdateIfUnchanged(srchQry, edtQry godoo.FullUserQuery, versions map[int]int) (int, error) {
+	if versions[1] != 4 {
+		return 0, errors.New("versions not passed on")
+	}
+	return c.idRepo.UpdateWhere(srchQry, edtQry)
+}
+
+type single_source_test_case struct {
+	source  string
+	run     func(r *Repo, srch godoo.FullUserQuery) (int, error) // returns items affected
+	expN    int
+	expHits map[string]int
+	expErr  error
+	name    string
+}
+
+func getSingleSourceTestCases() []single_source_test_case {
+	history := func(r *Repo, srch godoo.FullUserQuery) (int, error) {
+		var h godoo.IHistorian = r
+		if srch.QueryData.Source != "" {
+			rp, err := r.Source(srch.QueryData.Source)
+			if err != nil {
+				return 0, err
+			}
+			h = rp.(godoo.IHistorian)
+		}
+		es, err := h.History(1)
+		return len(es), err
+	}
+	undo := func(r *Repo, srch godoo.FullUserQuery) (int, error) {
+		es, err := r.Undo()
+		return len(es), err
+	}
+	preview := func(r *Repo, srch godoo.FullUserQuery) (int, error) {
+		p, err := r.PreviewUpdate(srch, godoo.FullUserQuery{})
+		return len(p.Changes), err
+	}
+	conditional := func(r *Repo, srch godoo.FullUserQuery) (int, error) {
+		return r.UpdateIfUnchanged(srch, godoo.FullUserQuery{}, map[int]int{1: 4})
+	}
+
+	return []single_source_test_case{{
+		source:  "work",
+		run:     history,
+		expN:    1,
+		expHits: map[string]int{"personal": 0, "work": 1},
+		name:    "history in named source",
+	}, {
+		run:     history,
+		expHits: map[string]int{"personal": 0, "work": 0},
+		expErr:  &NoSourceNamedError{},
+		name:    "history without a source",
+	}, {
+		run:     undo,
+		expHits: map[string]int{"personal": 0, "work": 0},
+		expErr:  &NoSourceNamedError{},
+		name:    "undo without a source",
+	}, {
+		source:  "work",
+		run:     preview,
+		expN:    1,
+		expHits: map[string]int{"personal": 0, "work": 1},
+		name:    "preview in named source",
+	}, {
+		run:     preview,
+		expHits: map[string]int{"personal": 0, "work": 0},
+		expErr:  &AmbiguousIdError{},
+		name:    "preview by id without a source",
+	}, {
+		source:  "work",
+		run:     conditional,
+		expN:    1,
+		expHits: map[string]int{"personal": 0, "work": 1},
+		name:    "versions checked in named source",
+	}, {
+		run:     conditional,
+		expHits: map[string]int{"personal": 0, "work": 0},
+		expErr:  &AmbiguousIdError{},
+		name:    "versioned edit by id without a source",
+	}}
+}
+
+func TestSingleSourceOperations(t *testing.T) {
+	lg.Logger = lg.NewDummyLogger()
+	tcs := getSingleSourceTestCases()
+	for _, tc := range tcs {
+		t.Run(tc.name, func(t *testing.T) {
+			runSingleSourceTest(t, tc)
+		})
+	}
+}
+
+func runSingleSourceTest(t *testing.T, tc single_source_test_case) {
+	hits := map[string]*int{"personal": new(int), "work": new(int)}
+	r, _ := NewRepo("", Source{"personal", capableRepo{idRepo{hits: hits["personal"]}}}, Source{"work", capableRepo{idRepo{hits: hits["work"]}}})
+
+	srch := godoo.FullUserQuery{QueryOptions: []godoo.UserQueryOption{{Elem: godoo.ById}}}
+	srch.QueryData.Id = 1
+	srch.QueryData.Source = tc.source
+
+	n, err := tc.run(r, srch)
+	if fmt.Sprintf("%T", err) != fmt.Sprintf("%T", tc.expErr) {
+		t.Errorf(">>>>FAILED: expected %T, got '%v'", tc.expErr, err)
+	}
+	if n != tc.expN {
+		t.Errorf(">>>>FAILED: expected %v, got %v", tc.expN, n)
+	}
+	for name, exp := range tc.expHits {
+		if *hits[name] != exp {
+			t.Errorf(">>>>FAILED: expected %v calls to '%v', got %v", exp, name, *hits[name])
+		}
+	}
+}
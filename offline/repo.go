@@ -0,0 +1,353 @@
+package offline
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"net/url"
+	"sort"
+	"time"
+
+	godoo "github.com/mundacity/go-doo"
+	lg "github.com/mundacity/quick-logger"
+)
+
+// Repo implements IRepository on top of a remote repo, so remote mode keeps
+// working when the server can't be reached. Adds & edits are queued in the
+// outbox until Sync sends them, & reads fall back to the items cached from
+// the last successful pull. Deletes need the server.
+type Repo struct {
+	remote godoo.IRepository
+	box    godoo.IOutbox
+}
+
+// Returns a new Repo that sends everything to remote while it can be reached
+func NewRepo(remote godoo.IRepository, box godoo.IOutbox) *Repo {
+	return &Repo{remote: remote, box: box}
+}
+
+// Whether err means the server couldn't be reached at all, rather than
+// that it turned the request down. Good enough for falling back to the
+// cache, but not for queueing changes, as a request that timed out may
+// still have been made.
+func isUnreachable(err error) bool {
+	var ue *url.Error
+	return errors.As(err, &ue)
+}
+
+// Whether err means the request never got as far as the server, so
+// it's safe to send it again later without doing it twice
+func neverSent(err error) bool {
+	var oe *net.OpError
+	return isUnreachable(err) && errors.As(err, &oe) && oe.Op == "dial"
+}
+
+func (r *Repo) GetAll() ([]godoo.TodoItem, error) {
+	itms, err := r.remote.GetAll()
+	if isUnreachable(err) {
+		lg.Logger.Logf(lg.Warning, "server unreachable, reading from the cache: %v", err)
+		return r.box.GetAll()
+	}
+	if err == nil {
+		r.cache(itms, true)
+	}
+	return itms, err
+}
+
+func (r *Repo) GetWhere(qry godoo.FullUserQuery) ([]godoo.TodoItem, error) {
+	itms, err := r.remote.GetWhere(qry)
+	if isUnreachable(err) {
+		lg.Logger.Logf(lg.Warning, "server unreachable, reading from the cache: %v", err)
+		return r.box.GetWhere(qry)
+	}
+	if err == nil {
+		r.cache(itms, false)
+	}
+	return itms, err
+}
+
+// Keeps a copy of what was pulled. Failing to doesn't stop the items
+// being returned, as they're only needed when the server is down.
+func (r *Repo) cache(itms []godoo.TodoItem, replaceAll bool) {
+	if err := r.box.CacheItems(itms, replaceAll); err != nil {
+		lg.Logger.Logf(lg.Warning, "couldn't cache items: %v", err)
+	}
+}
+
+// Returns a *QueuedError if the item was queued rather than added. Only
+// items that never reached the server are queued; if the request timed
+// out, it may have been added, so the error's returned as it is.
+func (r *Repo) Add(itm *godoo.TodoItem) (int64, error) {
+	id, err := r.remote.Add(itm)
+	if !neverSent(err) {
+		return id, err
+	}
+
+	e := godoo.OutboxEntry{Action: godoo.Added, Item: itm, QueuedAt: time.Now()}
+	if _, qErr := r.box.Queue(e); qErr != nil {
+		return 0, fmt.Errorf("couldn't queue item: %v (%v)", qErr, err)
+	}
+	return 0, &godoo.QueuedError{Err: err}
+}
+
+// Returns a *QueuedError if the edit was queued rather than made. Queued
+// edits only apply to the cached items they match, & only if none of them
+// has changed on the server by the time they're sent.
+func (r *Repo) UpdateWhere(srchQry, edtQry godoo.FullUserQuery) (int, error) {
+	n, err := r.remote.UpdateWhere(srchQry, edtQry)
+	if !neverSent(err) {
+		return n, err
+	}
+
+	itms, cErr := r.box.GetWhere(srchQry)
+	if cErr != nil {
+		return 0, fmt.Errorf("couldn't read cached items: %v (%v)", cErr, err)
+	}
+	return r.queueEdit(srchQry, edtQry, godoo.GetVersions(itms), err)
+}
+
+// As UpdateWhere, but the edit is refused if any of the items has changed
+// since it was read at the versions passed, whether it's made now or queued
+func (r *Repo) UpdateIfUnchanged(srchQry, edtQry godoo.FullUserQuery, versions map[int]int) (int, error) {
+	c, ok := r.remote.(godoo.IConditionalUpdater)
+	if !ok {
+		return 0, &UnsupportedError{Op: "checking versions"}
+	}
+
+	n, err := c.UpdateIfUnchanged(srchQry, edtQry, versions)
+	if !neverSent(err) {
+		return n, err
+	}
+	return r.queueEdit(srchQry, edtQry, versions, err)
+}
+
+// Queues an edit to the items with the versions passed, returning a
+// *QueuedError that wraps err, the reason it couldn't be sent. An edit
+// matching nothing in the cache would do nothing when sent, so isn't queued.
+func (r *Repo) queueEdit(srchQry, edtQry godoo.FullUserQuery, versions map[int]int, err error) (int, error) {
+	if len(versions) == 0 {
+		return 0, &NothingCachedError{Err: err}
+	}
+
+	e := godoo.OutboxEntry{Action: godoo.Updated, Search: &srchQry, Edit: &edtQry, Versions: versions, QueuedAt: time.Now()}
+	if _, qErr := r.box.Queue(e); qErr != nil {
+		return 0, fmt.Errorf("couldn't queue edit: %v (%v)", qErr, err)
+	}
+	return len(versions), &godoo.QueuedError{Err: err}
+}
+
+func (r *Repo) DeleteWhere(srchQry godoo.FullUserQuery) ([]int, error) {
+	return r.remote.DeleteWhere(srchQry)
+}
+
+func (r *Repo) History(itemId int) ([]godoo.HistoryEntry, error) {
+	h, ok := r.remote.(godoo.IHistorian)
+	if !ok {
+		return nil, &UnsupportedError{Op: "history"}
+	}
+	return h.History(itemId)
+}
+
+func (r *Repo) Undo() ([]godoo.HistoryEntry, error) {
+	u, ok := r.remote.(godoo.IUndoer)
+	if !ok {
+		return nil, &UnsupportedError{Op: "undo"}
+	}
+	return u.Undo()
+}
+
+// Previews on the server if it can be reached. Otherwise only the
+// number of cached items the edit matches is known.
+func (r *Repo) PreviewUpdate(srchQry, edtQry godoo.FullUserQuery) (godoo.EditPreview, error) {
+	p, ok := r.remote.(godoo.IPreviewer)
+	if ok {
+		ret, err := p.PreviewUpdate(srchQry, edtQry)
+		if !isUnreachable(err) {
+			return ret, err
+		}
+	}
+
+	itms, err := r.box.GetWhere(srchQry)
+	return godoo.EditPreview{Matched: len(itms)}, err
+}
+
+// Sends queued changes to the server, oldest first, then refreshes the
+// cache. An edit isn't applied to any item that's been changed or deleted
+// on the server since the edit was made; those are reported as conflicts.
+// Edits need a remote repo that can check item versions.
+// Each change is taken off the queue just before it's sent & only put
+// back if it never reached the server, so a change is never sent twice.
+// If the server goes away part way through, what's left stays queued.
+func (r *Repo) Sync() (godoo.SyncReport, error) {
+	var ret godoo.SyncReport
+
+	entries, err := r.box.Queued()
+	if err != nil {
+		return ret, err
+	}
+
+	for i, e := range entries {
+		var conflicts []godoo.SyncConflict
+		switch e.Action {
+		case godoo.Added:
+			conflicts, err = r.replayAdd(e)
+		case godoo.Updated:
+			conflicts, err = r.replayEdit(entries, i)
+		default:
+			err = fmt.Errorf("unknown action '%v'", e.Action)
+		}
+
+		if neverSent(err) {
+			ret.Pending = len(entries) - i
+			return ret, err
+		}
+		if err != nil {
+			// e.g. turned down by the server; sending it again won't help
+			conflicts = append(conflicts, godoo.SyncConflict{Entry: e, Reason: err.Error()})
+		}
+
+		if err = r.box.Remove(e.Id); err != nil {
+			ret.Pending = len(entries) - i
+			return ret, err
+		}
+		ret.Sent++
+		ret.Conflicts = append(ret.Conflicts, conflicts...)
+	}
+
+	itms, err := r.remote.GetAll()
+	if err != nil {
+		return ret, err
+	}
+	r.cache(itms, true)
+	ret.Cached = len(itms)
+	return ret, nil
+}
+
+// Sends the queued add e, taking it off the queue first & putting it back
+// only if it never reached the server. An add that was sent but got no
+// reply may or may not have been made, so it's reported as a conflict to
+// be checked rather than sent again.
+func (r *Repo) replayAdd(e godoo.OutboxEntry) ([]godoo.SyncConflict, error) {
+	if err := r.box.Remove(e.Id); err != nil {
+		return nil, err
+	}
+
+	_, err := r.remote.Add(e.Item)
+	if neverSent(err) {
+		if _, qErr := r.box.Queue(e); qErr != nil {
+			return nil, fmt.Errorf("couldn't put the item back in the queue: %v (%v)", qErr, err)
+		}
+		return nil, err
+	}
+	if isUnreachable(err) {
+		return []godoo.SyncConflict{{Entry: e, Reason: fmt.Sprintf("may not have been added, check before adding it again: %v", err)}}, nil
+	}
+	return nil, err
+}
+
+// Applies the queued edit entries[i] to each of the items it matched offline,
+// one at a time, as long as the item's version on the server shows it hasn't
+// changed. Each item is saved as done just before it's sent, & only put back
+// if the edit never reached the server, so a sync that's cut short doesn't
+// send it again. Later queued edits to the same item expect the version this
+// one left it at rather than the cached one.
+func (r *Repo) replayEdit(entries []godoo.OutboxEntry, i int) ([]godoo.SyncConflict, error) {
+	c, ok := r.remote.(godoo.IConditionalUpdater)
+	if !ok {
+		return nil, &UnsupportedError{Op: "syncing edits"}
+	}
+
+	e := entries[i]
+	var ids []int
+	left := make(map[int]int)
+	for id, v := range e.Versions {
+		ids = append(ids, id)
+		left[id] = v
+	}
+	sort.Ints(ids)
+
+	var ret []godoo.SyncConflict
+	for _, id := range ids {
+		byId := godoo.FullUserQuery{QueryOptions: []godoo.UserQueryOption{{Elem: godoo.ById}}, QueryData: godoo.TodoItem{Id: id}}
+
+		delete(left, id)
+		if err := r.saveLeft(e, left); err != nil {
+			return ret, err
+		}
+
+		_, err := c.UpdateIfUnchanged(byId, *e.Edit, map[int]int{id: e.Versions[id]})
+		var ce *godoo.VersionConflictError
+		if errors.As(err, &ce) {
+			for _, vc := range ce.Conflicts {
+				ret = append(ret, godoo.SyncConflict{Entry: e, ItemId: vc.ItemId, Reason: vc.Reason()})
+			}
+		} else if neverSent(err) {
+			left[id] = e.Versions[id]
+			if sErr := r.saveLeft(e, left); sErr != nil {
+				return ret, fmt.Errorf("couldn't put the edit back in the queue: %v (%v)", sErr, err)
+			}
+			return ret, err
+		} else if isUnreachable(err) {
+			ret = append(ret, godoo.SyncConflict{Entry: e, ItemId: id, Reason: fmt.Sprintf("may not have been edited, check before editing it again: %v", err)})
+		} else if err != nil {
+			return ret, err
+		} else if err = r.passOnVersion(entries[i+1:], byId); err != nil {
+			return ret, err
+		}
+	}
+	return ret, nil
+}
+
+// Saves the queued edit e with only the items in left still to be sent
+func (r *Repo) saveLeft(e godoo.OutboxEntry, left map[int]int) error {
+	vs := make(map[int]int)
+	for id, v := range left {
+		vs[id] = v
+	}
+	e.Versions = vs
+	return r.box.Update(e)
+}
+
+// Sets the version later queued edits expect the item byId finds at to
+// its version on the server, now that one of our own edits has changed it
+func (r *Repo) passOnVersion(later []godoo.OutboxEntry, byId godoo.FullUserQuery) error {
+	cur, err := r.remote.GetWhere(byId)
+	if err != nil || len(cur) == 0 {
+		return err
+	}
+
+	id := byId.QueryData.Id
+	for _, e := range later {
+		if _, ok := e.Versions[id]; !ok {
+			continue
+		}
+		e.Versions[id] = cur[0].Version
+		if err = r.box.Update(e); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Returned when the remote repo doesn't support an operation
+type UnsupportedError struct {
+	Op string
+}
+
+func (u *UnsupportedError) Error() string {
+	return fmt.Sprintf("%v isn't supported by this storage option", u.Op)
+}
+
+// Returned when the server can't be reached & none of the cached
+// items match an edit, so there's nothing to queue it against
+type NothingCachedError struct {
+	Err error
+}
+
+func (n *NothingCachedError) Error() string {
+	return fmt.Sprintf("server unreachable & no cached items match, so the edit wasn't saved: %v", n.Err)
+}
+
+func (n *NothingCachedError) Unwrap() error {
+	return n.Err
+}
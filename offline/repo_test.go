@@ -0,0 +1,364 @@
+package offline
+
+import (
+	"errors"
+	"net"
+	"net/url"
+	"path/filepath"
+	"testing"
+	"time"
+
+	godoo "github.com/mundacity/go-doo"
+	"github.com/mundacity/go-doo/sqlite"
+	lg "github.com/mundacity/quick-logger"
+)
+
+// stands in for the remote repo; fails as if the server
+// can't be reached whenever down is true
+type flakyRepo struct {
+	godoo.IRepository
+	down *bool
+}
+
+func (f flakyRepo) err() error {
+	if *f.down {
+		return &url.Error{Op: "Get", URL: "http://192.168.0.123:8080/get", Err: &net.OpError{Op: "dial", Net: "tcp", Err: errors.New("connection refused")}}
+	}
+	return nil
+}
+
+func (f flakyRepo) GetAll() ([]godoo.TodoItem, error) {
+	if err := f.err(); err != nil {
+		return nil, err
+	}
+	return f.IRepository.GetAll()
+}
+
+func (f flakyRepo) GetWhere(qry godoo.FullUserQuery) ([]godoo.TodoItem, error) {
+	if err := f.err(); err != nil {
+		return nil, err
+	}
+	return f.IRepository.GetWhere(qry)
+}
+
+func (f flakyRepo) Add(itm *godoo.TodoItem) (int64, error) {
+	if err := f.err(); err != nil {
+		return 0, err
+	}
+	return f.IRepository.Add(itm)
+}
+
+func (f flakyRepo) UpdateWhere(srchQry, edtQry godoo.FullUserQuery) (int, error) {
+	if err := f.err(); err != nil {
+		return 0, err
+	}
+	return f.IRepository.UpdateWhere(srchQry, edtQry)
+}
+
+func (f flakyRepo) UpdateIfUnchanged(srchQry, edtQry godoo.FullUserQuery, versions map[int]int) (int, error) {
+	if err := f.err(); err != nil {
+		return 0, err
+	}
+	return f.IRepository.(godoo.IConditionalUpdater).UpdateIfUnchanged(srchQry, edtQry, versions)
+}
+
+func byId(id int) godoo.FullUserQuery {
+	return godoo.FullUserQuery{QueryOptions: []godoo.UserQueryOption{{Elem: godoo.ById}}, QueryData: godoo.TodoItem{Id: id}}
+}
+
+func replaceBody(body string) godoo.FullUserQuery {
+	return godoo.FullUserQuery{QueryOptions: []godoo.UserQueryOption{{Elem: godoo.ByBody}, {Elem: godoo.ByReplacement}}, QueryData: godoo.TodoItem{Body: body}}
+}
+
+func newItem(body string) *godoo.TodoItem {
+	itm := godoo.NewTodoItem(godoo.WithPriorityLevel(godoo.None))
+	itm.CreationDate = time.Date(2022, 6, 1, 0, 0, 0, 0, time.UTC)
+	itm.Body = body
+	return itm
+}
+
+// Returns the offline repo, the server's repo behind it, & the switch
+// that takes the server down. Items 1 & 2 are already cached.
+func setupOffline(t *testing.T) (*Repo, *sqlite.Repo, *bool) {
+	lg.Logger = lg.NewDummyLogger()
+	dir := t.TempDir()
+
+	srv, err := sqlite.SetupRepo(filepath.Join(dir, "server.db"), godoo.Sqlite, "2006-01-02", 0)
+	if err != nil {
+		t.Fatalf("couldn't set up server repo: %v", err)
+	}
+	box, err := sqlite.OpenOutbox(filepath.Join(dir, "outbox.db"), "2006-01-02")
+	if err != nil {
+		t.Fatalf("couldn't open outbox: %v", err)
+	}
+
+	for _, b := range []string{"plan sprint", "write report"} {
+		if _, err = srv.Add(newItem(b)); err != nil {
+			t.Fatalf("seeding failed: %v", err)
+		}
+	}
+
+	down := false
+	r := NewRepo(flakyRepo{IRepository: srv, down: &down}, box)
+	if _, err = r.GetAll(); err != nil {
+		t.Fatalf("first pull failed: %v", err)
+	}
+	return r, srv, &down
+}
+
+func TestOfflineFallback(t *testing.T) {
+	r, srv, down := setupOffline(t)
+	*down = true
+
+	var q *godoo.QueuedError
+	if _, err := r.Add(newItem("call the bank")); !errors.As(err, &q) {
+		t.Errorf(">>>>FAILED (add): expected the item to be queued, got %v", err)
+	}
+	if n, err := r.UpdateWhere(byId(2), replaceBody("write the report")); !errors.As(err, &q) || n != 1 {
+		t.Errorf(">>>>FAILED (edit): expected 1 item queued, got %v (err: %v)", n, err)
+	}
+
+	var nc *NothingCachedError
+	if n, err := r.UpdateWhere(byId(7), replaceBody("never pulled")); !errors.As(err, &nc) || n != 0 {
+		t.Errorf(">>>>FAILED (edit): expected an uncached item to be refused, got %v (err: %v)", n, err)
+	}
+
+	itms, err := r.GetWhere(byId(1))
+	if err != nil || len(itms) != 1 || itms[0].Body != "plan sprint" {
+		t.Errorf(">>>>FAILED (get): expected the cached item, got %v (err: %v)", itms, err)
+	}
+	if p, err := r.PreviewUpdate(byId(1), replaceBody("x")); err != nil || p.Matched != 1 {
+		t.Errorf(">>>>FAILED (preview): expected 1 cached match, got %v (err: %v)", p.Matched, err)
+	}
+
+	*down = false
+	rep, err := r.Sync()
+	if err != nil || rep.Sent != 2 || len(rep.Conflicts) != 0 || rep.Cached != 3 {
+		t.Errorf(">>>>FAILED (sync): %+v (err: %v)", rep, err)
+	}
+	itms, _ = srv.GetWhere(byId(2))
+	if len(itms) != 1 || itms[0].Body != "write the report" {
+		t.Errorf(">>>>FAILED: queued edit not applied: %v", itms)
+	}
+}
+
+type sync_test_case struct {
+	offline        []godoo.FullUserQuery // body edits made to item 1 while the server's down
+	onServer       func(srv *sqlite.Repo) error
+	downDuringSync bool
+	expBody        string // item 1's body on the server afterwards
+	expConflicts   int
+	expPending     int
+	name           string
+}
+
+func getSyncTestCases() []sync_test_case {
+	return []sync_test_case{{
+		offline: []godoo.FullUserQuery{replaceBody("plan the sprint")},
+		expBody: "plan the sprint",
+		name:    "edit applied",
+	}, {
+		offline: []godoo.FullUserQuery{replaceBody("plan the sprint"), replaceBody("plan the next sprint")},
+		expBody: "plan the next sprint",
+		name:    "later edits aren't held up by earlier ones",
+	}, {
+		offline: []godoo.FullUserQuery{replaceBody("plan the sprint")},
+		onServer: func(srv *sqlite.Repo) error {
+			_, err := srv.UpdateWhere(byId(1), replaceBody("plan sprint with the team"))
+			return err
+		},
+		expBody:      "plan sprint with the team",
+		expConflicts: 1,
+		name:         "changed on the server",
+	}, {
+		offline: []godoo.FullUserQuery{replaceBody("plan the sprint")},
+		onServer: func(srv *sqlite.Repo) error {
+			_, err := srv.DeleteWhere(byId(1))
+			return err
+		},
+		expConflicts: 1,
+		name:         "deleted on the server",
+	}, {
+		offline:        []godoo.FullUserQuery{replaceBody("plan the sprint")},
+		downDuringSync: true,
+		expBody:        "plan sprint",
+		expPending:     1,
+		name:           "server still down",
+	}}
+}
+
+func TestSync(t *testing.T) {
+	tcs := getSyncTestCases()
+	for _, tc := range tcs {
+		t.Run(tc.name, func(t *testing.T) {
+			runSyncTest(t, tc)
+		})
+	}
+}
+
+func runSyncTest(t *testing.T, tc sync_test_case) {
+	r, srv, down := setupOffline(t)
+
+	*down = true
+	for _, edt := range tc.offline {
+		r.UpdateWhere(byId(1), edt)
+	}
+	if tc.onServer != nil {
+		if err := tc.onServer(srv); err != nil {
+			t.Fatalf("server change failed: %v", err)
+		}
+	}
+
+	*down = tc.downDuringSync
+	rep, err := r.Sync()
+	if (err != nil) != tc.downDuringSync {
+		t.Errorf(">>>>FAILED: unexpected error: %v", err)
+	}
+	if len(rep.Conflicts) != tc.expConflicts || rep.Pending != tc.expPending {
+		t.Errorf(">>>>FAILED: expected %v conflicts & %v pending, got %+v", tc.expConflicts, tc.expPending, rep)
+	}
+
+	var body string
+	if itms, _ := srv.GetWhere(byId(1)); len(itms) > 0 {
+		body = itms[0].Body
+	}
+	if body != tc.expBody {
+		t.Errorf(">>>>FAILED: expected '%v' on the server, got '%v'", tc.expBody, body)
+	}
+	t.Logf(">>>>PASSED: %v", tc.name)
+}
+
+// flakyRepo that goes down after sending the given number of edits
+type cutOffRepo struct {
+	flakyRepo
+	left *int
+}
+
+func (c cutOffRepo) UpdateIfUnchanged(srchQry, edtQry godoo.FullUserQuery, versions map[int]int) (int, error) {
+	if *c.left == 0 {
+		*c.down = true
+	}
+	*c.left--
+	return c.flakyRepo.UpdateIfUnchanged(srchQry, edtQry, versions)
+}
+
+func TestPartialSync(t *testing.T) {
+	r, srv, down := setupOffline(t)
+	left := 1
+	r.remote = cutOffRepo{flakyRepo: r.remote.(flakyRepo), left: &left}
+
+	*down = true
+	both := godoo.FullUserQuery{QueryOptions: []godoo.UserQueryOption{{Elem: godoo.ByBody}}, QueryData: godoo.TodoItem{Body: "r"}}
+	for _, e := range []struct{ srch, edt godoo.FullUserQuery }{
+		{both, replaceBody("q3")},
+		{byId(1), replaceBody("plan the sprint")},
+	} {
+		if _, err := r.UpdateWhere(e.srch, e.edt); err == nil {
+			t.Fatalf("expected the edit to be queued")
+		}
+	}
+
+	// item 1 gets the first edit, then the server goes away
+	*down = false
+	rep, err := r.Sync()
+	if err == nil || rep.Pending != 2 {
+		t.Fatalf(">>>>FAILED: expected the sync to be cut short, got %+v (err: %v)", rep, err)
+	}
+
+	*down = false
+	rep, err = r.Sync()
+	if err != nil || rep.Sent != 2 || len(rep.Conflicts) != 0 {
+		t.Errorf(">>>>FAILED: expected the rest to be sent without conflicts, got %+v (err: %v)", rep, err)
+	}
+
+	itms, _ := srv.GetAll()
+	if len(itms) != 2 || itms[0].Body != "plan the sprint" || itms[1].Body != "q3" {
+		t.Errorf(">>>>FAILED: unexpected items on the server: %+v", itms)
+	}
+	entries, _ := srv.History(1)
+	if len(entries) != 3 {
+		t.Errorf(">>>>FAILED: expected item 1 to be edited once per queued edit, got %v history entries", len(entries))
+	}
+}
+
+// flakyRepo whose adds & edits reach the server, but whose
+// replies are lost, as when the request times out
+type lostReplyRepo struct {
+	flakyRepo
+}
+
+func lostReply() error {
+	return &url.Error{Op: "Post", URL: "http://192.168.0.123:8080/add", Err: errors.New("context deadline exceeded (Client.Timeout exceeded while awaiting headers)")}
+}
+
+func (l lostReplyRepo) Add(itm *godoo.TodoItem) (int64, error) {
+	if _, err := l.flakyRepo.Add(itm); err != nil {
+		return 0, err
+	}
+	return 0, lostReply()
+}
+
+func (l lostReplyRepo) UpdateIfUnchanged(srchQry, edtQry godoo.FullUserQuery, versions map[int]int) (int, error) {
+	if _, err := l.flakyRepo.UpdateIfUnchanged(srchQry, edtQry, versions); err != nil {
+		return 0, err
+	}
+	return 0, lostReply()
+}
+
+func TestLostReplyNotQueued(t *testing.T) {
+	r, srv, _ := setupOffline(t)
+	r.remote = lostReplyRepo{flakyRepo: r.remote.(flakyRepo)}
+
+	var q *godoo.QueuedError
+	if _, err := r.Add(newItem("call the bank")); err == nil || errors.As(err, &q) {
+		t.Errorf(">>>>FAILED: expected the error back rather than the item queued, got %v", err)
+	}
+	if entries, _ := r.box.Queued(); len(entries) != 0 {
+		t.Errorf(">>>>FAILED: expected nothing queued, got %+v", entries)
+	}
+	if itms, _ := srv.GetAll(); len(itms) != 3 {
+		t.Errorf(">>>>FAILED: expected the item to be on the server once, got %v items", len(itms))
+	}
+}
+
+func TestSyncNeverSendsTwice(t *testing.T) {
+	r, srv, down := setupOffline(t)
+
+	*down = true
+	if _, err := r.Add(newItem("call the bank")); err == nil {
+		t.Fatalf("expected the item to be queued")
+	}
+	if _, err := r.UpdateWhere(byId(1), replaceBody("plan the sprint")); err == nil {
+		t.Fatalf("expected the edit to be queued")
+	}
+
+	// still down: both are put back, in the same order
+	rep, err := r.Sync()
+	if err == nil || rep.Pending != 2 {
+		t.Errorf(">>>>FAILED: expected both changes still queued, got %+v (err: %v)", rep, err)
+	}
+	entries, _ := r.box.Queued()
+	if len(entries) != 2 || entries[0].Action != godoo.Added || len(entries[1].Versions) != 1 {
+		t.Errorf(">>>>FAILED: expected the add then the edit still queued, got %+v", entries)
+	}
+
+	// sent, but the replies are lost
+	*down = false
+	r.remote = lostReplyRepo{flakyRepo: r.remote.(flakyRepo)}
+	rep, err = r.Sync()
+	if err != nil || rep.Pending != 0 || len(rep.Conflicts) != 2 {
+		t.Errorf(">>>>FAILED: expected both changes reported as conflicts, got %+v (err: %v)", rep, err)
+	}
+
+	rep, err = r.Sync()
+	if err != nil || rep.Sent != 0 {
+		t.Errorf(">>>>FAILED: expected nothing left to send, got %+v (err: %v)", rep, err)
+	}
+	itms, _ := srv.GetAll()
+	if len(itms) != 3 || itms[0].Body != "plan the sprint" {
+		t.Errorf(">>>>FAILED: expected each change made once on the server, got %+v", itms)
+	}
+	if h, _ := srv.History(1); len(h) != 2 {
+		t.Errorf(">>>>FAILED: expected item 1 edited once, got %v history entries", len(h))
+	}
+}
@@ -0,0 +1,67 @@
+package godoo
+
+import (
+	"fmt"
+	"time"
+)
+
+// A change made while the server couldn't be reached, kept until
+// 'godoo sync' sends it. Adds hold the Item; edits hold the Search &
+// Edit queries along with the Versions of the items they matched.
+type OutboxEntry struct {
+	Id       int            `json:"id"`
+	Action   HistoryAction  `json:"action"` // Added or Updated
+	Item     *TodoItem      `json:"item,omitempty"`
+	Search   *FullUserQuery `json:"search,omitempty"`
+	Edit     *FullUserQuery `json:"edit,omitempty"`
+	Versions map[int]int    `json:"versions,omitempty"` // item id -> version when the edit was made
+	QueuedAt time.Time      `json:"queuedAt"`
+}
+
+// Implemented by stores that keep changes made while offline, along
+// with a copy of the items last pulled from the server. The cached
+// items are read through the IRepository methods.
+type IOutbox interface {
+	IRepository
+	Queue(e OutboxEntry) (int, error) // e keeps its id, & so its place, if it has one
+	Queued() ([]OutboxEntry, error)   // oldest first
+	Update(e OutboxEntry) error       // saves changes to the queued entry with e's id
+	Remove(id int) error
+	// Saves itms to the cache, replacing everything in it if replaceAll is true
+	CacheItems(itms []TodoItem, replaceAll bool) error
+}
+
+// Implemented by repositories that can send changes made while offline
+type ISyncer interface {
+	Sync() (SyncReport, error)
+}
+
+// What a sync did. Sent counts queued changes that reached the server,
+// including edits that were only partly applied because of conflicts.
+type SyncReport struct {
+	Sent      int            `json:"sent"`
+	Conflicts []SyncConflict `json:"conflicts"`
+	Pending   int            `json:"pending"` // still queued, e.g. because the server went away again
+	Cached    int            `json:"cached"`  // items pulled into the local cache afterwards
+}
+
+// An item a queued edit wasn't applied to, & why
+type SyncConflict struct {
+	Entry  OutboxEntry `json:"entry"`
+	ItemId int         `json:"itemId"`
+	Reason string      `json:"reason"`
+}
+
+// Returned when a change couldn't reach the server & has
+// been queued for 'godoo sync' to send later instead
+type QueuedError struct {
+	Err error
+}
+
+func (q *QueuedError) Error() string {
+	return fmt.Sprintf("server unreachable, so the change was saved for 'godoo sync': %v", q.Err)
+}
+
+func (q *QueuedError) Unwrap() error {
+	return q.Err
+}
@@ -0,0 +1,175 @@
+package godoo
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/mundacity/go-doo/util"
+)
+
+// Where a page ended: the last item's sort values & id. Only the
+// values the query sorts on are used, but all are kept so a cursor
+// doesn't need to know which those were. Cursors are opaque to
+// clients; they only need to pass back whatever came with a page.
+type PagePosition struct {
+	Id       int     `json:"i"`
+	Deadline string  `json:"d,omitempty"`
+	Creation string  `json:"c,omitempty"`
+	Priority int     `json:"p,omitempty"`
+	Body     string  `json:"b,omitempty"`
+	Rank     float64 `json:"r,omitempty"`
+}
+
+// Returns a cursor for the page after the one ending with last. The
+// next page holds whatever sorts after last, so items added or
+// removed in the meantime don't shift it.
+func NewCursor(last TodoItem) string {
+	pos := PagePosition{Id: last.Id, Priority: int(last.Priority), Body: last.Body, Rank: last.Rank}
+	if !last.Deadline.IsZero() {
+		pos.Deadline = util.StringFromDate(last.Deadline)
+	}
+	if !last.CreationDate.IsZero() {
+		pos.Creation = util.StringFromDate(last.CreationDate)
+	}
+
+	b, _ := json.Marshal(pos)
+	return base64.RawURLEncoding.EncodeToString(b)
+}
+
+// Returns the offset of the first item on the page. It's always
+// 0 with a cursor, as the cursor says where the page starts.
+func (q FullUserQuery) PageStart() (int, error) {
+	if q.Offset < 0 {
+		return 0, &InvalidCursorError{Cursor: strconv.Itoa(q.Offset)}
+	}
+	if q.Cursor != "" {
+		return 0, nil
+	}
+	return q.Offset, nil
+}
+
+// Returns where the previous page ended, or nil without a cursor
+func (q FullUserQuery) PageAfter() (*PagePosition, error) {
+	if q.Cursor == "" {
+		return nil, nil
+	}
+
+	b, err := base64.RawURLEncoding.DecodeString(q.Cursor)
+	if err != nil {
+		return nil, &InvalidCursorError{Cursor: q.Cursor}
+	}
+	var pos PagePosition
+	if err = json.Unmarshal(b, &pos); err != nil || pos.Id <= 0 {
+		return nil, &InvalidCursorError{Cursor: q.Cursor}
+	}
+	return &pos, nil
+}
+
+// Gets a page of items along with the cursor for the next page, which
+// is empty on the last one. Repos that can't say where the next page
+// starts are asked for an extra item to tell whether there is one.
+func GetPage(rp IRepository, qry FullUserQuery) ([]TodoItem, string, error) {
+	if p, ok := rp.(IPager); ok {
+		return p.GetPage(qry)
+	}
+	if qry.Limit <= 0 {
+		itms, err := rp.GetWhere(qry)
+		return itms, "", err
+	}
+
+	qry.Limit++
+	itms, err := rp.GetWhere(qry)
+	if err != nil || len(itms) < qry.Limit {
+		return itms, "", err
+	}
+	itms = itms[:len(itms)-1]
+	return itms, NewCursor(itms[len(itms)-1]), nil
+}
+
+// Whether the query asks for anything other than the whole result set
+func (q FullUserQuery) IsPaged() bool {
+	return q.Limit > 0 || q.Offset > 0 || q.Cursor != ""
+}
+
+// Checks every key is one that can be sorted on
+func ValidateSortKeys(keys []SortKey) error {
+	for _, k := range keys {
+		switch k {
+		case SortById, SortByDeadline, SortByCreation, SortByPriority, SortByBody:
+		default:
+			return &InvalidSortKeyError{Key: k}
+		}
+	}
+	return nil
+}
+
+// Orders itms the same way the sqlite repository does, so results
+// merged from several places end up in a consistent order
+func SortItems(itms []TodoItem, keys []SortKey, desc bool) {
+	sort.SliceStable(itms, func(i, j int) bool {
+		return compareItems(itms[i], itms[j], keys, desc) < 0
+	})
+}
+
+func compareItems(a, b TodoItem, keys []SortKey, desc bool) int {
+	dir := 1
+	if desc {
+		dir = -1
+	}
+
+	for _, k := range keys {
+		var c int
+		switch k {
+		case SortByDeadline:
+			// items without a deadline go last whichever the direction
+			if c = compareBools(a.Deadline.IsZero(), b.Deadline.IsZero()); c != 0 {
+				return c
+			}
+			c = compareInts(int(a.Deadline.Unix()), int(b.Deadline.Unix()))
+		case SortByCreation:
+			c = compareInts(int(a.CreationDate.Unix()), int(b.CreationDate.Unix()))
+		case SortByPriority:
+			c = compareInts(int(a.Priority), int(b.Priority))
+		case SortByBody:
+			c = strings.Compare(strings.ToLower(a.Body), strings.ToLower(b.Body))
+		}
+		if c != 0 {
+			return c * dir
+		}
+	}
+	return compareInts(a.Id, b.Id) * dir
+}
+
+func compareInts(a, b int) int {
+	if a < b {
+		return -1
+	} else if a > b {
+		return 1
+	}
+	return 0
+}
+
+// false before true
+func compareBools(a, b bool) int {
+	if a == b {
+		return 0
+	} else if b {
+		return -1
+	}
+	return 1
+}
+
+// Returns the slice of itms that falls on the page starting at start
+func PageItems(itms []TodoItem, start, limit int) []TodoItem {
+	if start >= len(itms) {
+		return []TodoItem{}
+	}
+	itms = itms[start:]
+	if limit > 0 && limit < len(itms) {
+		itms = itms[:limit]
+	}
+	return itms
+}
@@ -0,0 +1,354 @@
+package godoo
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+)
+
+// How a QueryExpr node combines its children, or ExprCond for a leaf
+type ExprOp string
+
+const (
+	ExprAnd  ExprOp = "and"
+	ExprOr   ExprOp = "or"
+	ExprNot  ExprOp = "not" // exactly one child
+	ExprCond ExprOp = "cond"
+)
+
+// What a leaf condition tests
+type ExprField string
+
+const (
+	FieldId        ExprField = "id"
+	FieldTag       ExprField = "tag"
+	FieldBody      ExprField = "body" // contains
+	FieldDone      ExprField = "done" // 'true' or 'false'
+	FieldParent    ExprField = "parent"
+	FieldPriority  ExprField = "priority" // none, low, medium or high
+	FieldDeadline  ExprField = "deadline" // yyyy-mm-dd, or a range yyyy-mm-dd:yyyy-mm-dd
+	FieldCreated   ExprField = "created"
+	FieldCompleted ExprField = "completed"
+)
+
+// A boolean query. Leaves (Op == ExprCond) test a single Field against
+// Value; every other node combines its Children. Values are kept as
+// strings so the tree serialises the same way whichever field it tests.
+type QueryExpr struct {
+	Op       ExprOp      `json:"op"`
+	Field    ExprField   `json:"field,omitempty"`
+	Value    string      `json:"value,omitempty"`
+	Children []QueryExpr `json:"children,omitempty"`
+}
+
+var priorityNames = map[string]PriorityLevel{"none": None, "low": Low, "medium": Medium, "high": High}
+
+// Returns the level for one of the names used in queries - none, low, medium or high
+func PriorityFromName(name string) (PriorityLevel, bool) {
+	p, ok := priorityNames[name]
+	return p, ok
+}
+
+// Returned when a query expression can't be parsed or doesn't make sense
+type QuerySyntaxError struct {
+	Expr   string
+	Reason string
+}
+
+func (e *QuerySyntaxError) Error() string {
+	return fmt.Sprintf("invalid query '%v': %v", e.Expr, e.Reason)
+}
+
+// Checks the tree is well formed & every value suits its field. Trees
+// from ParseQueryExpr always are, but those sent to the server may not be.
+func (e QueryExpr) Validate() error {
+	bad := func(reason string, args ...any) error {
+		return &QuerySyntaxError{Expr: e.String(), Reason: fmt.Sprintf(reason, args...)}
+	}
+
+	switch e.Op {
+	case ExprAnd, ExprOr:
+		if len(e.Children) == 0 {
+			return bad("'%v' needs at least one condition", e.Op)
+		}
+	case ExprNot:
+		if len(e.Children) != 1 {
+			return bad("'not' takes exactly one condition")
+		}
+	case ExprCond:
+		return e.validateCond(bad)
+	default:
+		return bad("unknown operator '%v'", e.Op)
+	}
+
+	for _, c := range e.Children {
+		if err := c.Validate(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (e QueryExpr) validateCond(bad func(string, ...any) error) error {
+	switch e.Field {
+	case FieldId, FieldParent:
+		if n, err := strconv.Atoi(e.Value); err != nil || n < 0 {
+			return bad("%v needs a number", e.Field)
+		}
+	case FieldTag, FieldBody:
+		if e.Value == "" {
+			return bad("%v can't be empty", e.Field)
+		}
+	case FieldDone:
+		if e.Value != "true" && e.Value != "false" {
+			return bad("done is either 'true' or 'false'")
+		}
+	case FieldPriority:
+		if _, ok := priorityNames[e.Value]; !ok {
+			return bad("priority is one of none, low, medium or high")
+		}
+	case FieldDeadline, FieldCreated, FieldCompleted:
+		ds := strings.Split(e.Value, ":")
+		if len(ds) > 2 {
+			return bad("%v ranges have two dates", e.Field)
+		}
+		for _, d := range ds {
+			if _, err := time.Parse("2006-01-02", d); err != nil {
+				return bad("%v needs a yyyy-mm-dd date or range", e.Field)
+			}
+		}
+	default:
+		return bad("unknown field '%v'", e.Field)
+	}
+	return nil
+}
+
+// Writes the expression back out in the syntax ParseQueryExpr reads
+func (e QueryExpr) String() string {
+	switch e.Op {
+	case ExprCond:
+		if strings.ContainsAny(e.Value, " ()\"") {
+			return fmt.Sprintf("%v:%q", e.Field, e.Value)
+		}
+		return fmt.Sprintf("%v:%v", e.Field, e.Value)
+	case ExprNot:
+		if len(e.Children) == 1 {
+			return "not " + e.Children[0].String()
+		}
+	case ExprAnd, ExprOr:
+		var parts []string
+		for _, c := range e.Children {
+			parts = append(parts, c.String())
+		}
+		return "(" + strings.Join(parts, " "+string(e.Op)+" ") + ")"
+	}
+	return string(e.Op)
+}
+
+type query_token struct {
+	text   string
+	quoted bool // quoted text is never an operator
+}
+
+// Reads a query such as 'tag:work or (tag:urgent and not done)'. 'not'
+// binds tightest, then 'and', then 'or'; terms next to each other are
+// and-ed. Conditions are field:value pairs - a bare word searches the
+// body, & a bare 'done' matches completed items. Dates are read using
+// dateLayout & can be ranges, e.g. deadline:2022-06-01:2022-06-30.
+func ParseQueryExpr(query, dateLayout string) (QueryExpr, error) {
+	p := query_parser{query: query, layout: dateLayout}
+
+	var err error
+	if p.tokens, err = tokeniseQuery(query); err != nil {
+		return QueryExpr{}, err
+	}
+	if len(p.tokens) == 0 {
+		return QueryExpr{}, p.fail("nothing to search for")
+	}
+
+	e, err := p.parseOr()
+	if err != nil {
+		return QueryExpr{}, err
+	}
+	if p.pos < len(p.tokens) {
+		return QueryExpr{}, p.fail("unexpected '%v'", p.tokens[p.pos].text)
+	}
+	return e, nil
+}
+
+func tokeniseQuery(query string) ([]query_token, error) {
+	var ret []query_token
+	rs := []rune(query)
+
+	for i := 0; i < len(rs); {
+		r := rs[i]
+		switch {
+		case unicode.IsSpace(r):
+			i++
+		case r == '(' || r == ')':
+			ret = append(ret, query_token{text: string(r)})
+			i++
+		default:
+			// a word, which can have a quoted part - e.g. body:"weekly report"
+			var sb strings.Builder
+			quoted := false
+			for i < len(rs) && !unicode.IsSpace(rs[i]) && rs[i] != '(' && rs[i] != ')' {
+				if rs[i] != '"' {
+					sb.WriteRune(rs[i])
+					i++
+					continue
+				}
+				end := i + 1
+				for end < len(rs) && rs[end] != '"' {
+					end++
+				}
+				if end == len(rs) {
+					return nil, &QuerySyntaxError{Expr: query, Reason: "missing closing quote"}
+				}
+				sb.WriteString(string(rs[i+1 : end]))
+				i = end + 1
+				quoted = true
+			}
+			ret = append(ret, query_token{text: sb.String(), quoted: quoted})
+		}
+	}
+	return ret, nil
+}
+
+type query_parser struct {
+	query  string
+	layout string
+	tokens []query_token
+	pos    int
+}
+
+func (p *query_parser) fail(reason string, args ...any) error {
+	return &QuerySyntaxError{Expr: p.query, Reason: fmt.Sprintf(reason, args...)}
+}
+
+// Whether the next token is the operator or bracket s
+func (p *query_parser) peekIs(s string) bool {
+	if p.pos >= len(p.tokens) || p.tokens[p.pos].quoted {
+		return false
+	}
+	return strings.EqualFold(p.tokens[p.pos].text, s)
+}
+
+func (p *query_parser) parseOr() (QueryExpr, error) {
+	return p.parseList(ExprOr, p.parseAnd, func() bool {
+		if p.peekIs("or") {
+			p.pos++
+			return true
+		}
+		return false
+	})
+}
+
+func (p *query_parser) parseAnd() (QueryExpr, error) {
+	return p.parseList(ExprAnd, p.parseNot, func() bool {
+		if p.peekIs("and") {
+			p.pos++
+			return true
+		}
+		// anything that can start a term carries on the list
+		return p.pos < len(p.tokens) && !p.peekIs("or") && !p.peekIs(")")
+	})
+}
+
+// Reads terms separated by op, returning the only term if there's just one
+func (p *query_parser) parseList(op ExprOp, term func() (QueryExpr, error), more func() bool) (QueryExpr, error) {
+	e, err := term()
+	if err != nil {
+		return e, err
+	}
+
+	ret := QueryExpr{Op: op, Children: []QueryExpr{e}}
+	for more() {
+		if e, err = term(); err != nil {
+			return e, err
+		}
+		ret.Children = append(ret.Children, e)
+	}
+
+	if len(ret.Children) == 1 {
+		return ret.Children[0], nil
+	}
+	return ret, nil
+}
+
+func (p *query_parser) parseNot() (QueryExpr, error) {
+	if p.peekIs("not") {
+		p.pos++
+		e, err := p.parseNot()
+		return QueryExpr{Op: ExprNot, Children: []QueryExpr{e}}, err
+	}
+	return p.parseTerm()
+}
+
+func (p *query_parser) parseTerm() (QueryExpr, error) {
+	if p.pos >= len(p.tokens) {
+		return QueryExpr{}, p.fail("expected a condition at the end")
+	}
+
+	if p.peekIs("(") {
+		p.pos++
+		e, err := p.parseOr()
+		if err != nil {
+			return e, err
+		}
+		if !p.peekIs(")") {
+			return e, p.fail("missing ')'")
+		}
+		p.pos++
+		return e, nil
+	}
+
+	for _, op := range []string{")", "and", "or"} {
+		if p.peekIs(op) {
+			return QueryExpr{}, p.fail("expected a condition before '%v'", p.tokens[p.pos].text)
+		}
+	}
+
+	tok := p.tokens[p.pos]
+	p.pos++
+	return p.parseCond(tok)
+}
+
+func (p *query_parser) parseCond(tok query_token) (QueryExpr, error) {
+	field, val, found := strings.Cut(tok.text, ":")
+	if !found {
+		if !tok.quoted && strings.EqualFold(tok.text, string(FieldDone)) {
+			return QueryExpr{Op: ExprCond, Field: FieldDone, Value: "true"}, nil
+		}
+		return QueryExpr{Op: ExprCond, Field: FieldBody, Value: tok.text}, nil
+	}
+
+	e := QueryExpr{Op: ExprCond, Field: ExprField(strings.ToLower(field)), Value: val}
+	switch e.Field {
+	case FieldDone:
+		e.Value = strings.ToLower(val)
+	case FieldPriority:
+		for n := range priorityNames {
+			if strings.EqualFold(val, n) || strings.EqualFold(val, n[:1]) {
+				e.Value = n
+			}
+		}
+	case FieldDeadline, FieldCreated, FieldCompleted:
+		var ds []string
+		for _, s := range strings.Split(val, ":") {
+			d, err := time.Parse(p.layout, s)
+			if err != nil {
+				return e, p.fail("can't read date '%v'", s)
+			}
+			ds = append(ds, d.Format("2006-01-02"))
+		}
+		e.Value = strings.Join(ds, ":")
+	}
+
+	if err := e.Validate(); err != nil {
+		return e, p.fail("%v", err.(*QuerySyntaxError).Reason)
+	}
+	return e, nil
+}
@@ -0,0 +1,177 @@
+package remote
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+
+	godoo "github.com/mundacity/go-doo"
+	"github.com/mundacity/go-doo/util"
+)
+
+// Repo implements IRepository on top of the server's JSON api so
+// that a remote server can be used wherever a local repo can
+type Repo struct {
+	url    string
+	client *http.Client
+	name   string // sent with every request so the server knows who made each change
+	token  string // for servers that require one
+}
+
+type RepoOption func(r *Repo)
+
+// Sends token with every request, for servers that require auth
+func WithToken(token string) RepoOption {
+	return func(r *Repo) {
+		r.token = token
+	}
+}
+
+// Returns a new Repo that sends requests to baseUrl (e.g. http://192.168.0.123:8080)
+func NewRepo(baseUrl string, client *http.Client, opts ...RepoOption) *Repo {
+	if client == nil {
+		client = http.DefaultClient
+	}
+	r := &Repo{url: strings.TrimSuffix(baseUrl, "/"), client: client, name: util.ClientName()}
+	for _, o := range opts {
+		o(r)
+	}
+	return r
+}
+
+func (r *Repo) GetAll() ([]godoo.TodoItem, error) {
+	return r.GetWhere(godoo.FullUserQuery{})
+}
+
+func (r *Repo) GetWhere(qry godoo.FullUserQuery) ([]godoo.TodoItem, error) {
+	itms, _, err := r.GetPage(qry)
+	return itms, err
+}
+
+// The server works out where the next page starts, and sends
+// it back in a header that's left out on the last page
+func (r *Repo) GetPage(qry godoo.FullUserQuery) ([]godoo.TodoItem, string, error) {
+	var itms []godoo.TodoItem
+	resp, err := r.sendWithHeader(http.MethodGet, "/get", nil, qry, &itms)
+	if err != nil {
+		return nil, "", err
+	}
+	return itms, resp.Get(godoo.NextCursorHeader), nil
+}
+
+func (r *Repo) Add(itm *godoo.TodoItem) (int64, error) {
+	var id int64
+	err := r.send(http.MethodPost, "/add", itm, &id)
+	return id, err
+}
+
+func (r *Repo) UpdateWhere(srchQry, edtQry godoo.FullUserQuery) (int, error) {
+	var n int
+	err := r.send(http.MethodPut, "/edit", []godoo.FullUserQuery{srchQry, edtQry}, &n)
+	return n, err
+}
+
+// Sends the versions in an If-Match header, so the server refuses the edit
+// if any of the items has changed since. The items that have are returned
+// in a *VersionConflictError.
+func (r *Repo) UpdateIfUnchanged(srchQry, edtQry godoo.FullUserQuery, versions map[int]int) (int, error) {
+	var itms []godoo.TodoItem
+	for id, v := range versions {
+		itms = append(itms, godoo.TodoItem{Id: id, Version: v})
+	}
+	hdr := http.Header{}
+	hdr.Set("If-Match", godoo.VersionTag(itms))
+
+	var n int
+	_, err := r.sendWithHeader(http.MethodPut, "/edit", hdr, []godoo.FullUserQuery{srchQry, edtQry}, &n)
+
+	var se *StatusError
+	if errors.As(err, &se) && se.Code == http.StatusConflict {
+		var ce godoo.VersionConflictError
+		if json.Unmarshal([]byte(se.Msg), &ce) == nil && len(ce.Conflicts) > 0 {
+			return 0, &ce
+		}
+	}
+	return n, err
+}
+
+func (r *Repo) DeleteWhere(srchQry godoo.FullUserQuery) ([]int, error) {
+	var ids []int
+	err := r.send(http.MethodDelete, "/delete", srchQry, &ids)
+	return ids, err
+}
+
+func (r *Repo) History(itemId int) ([]godoo.HistoryEntry, error) {
+	var entries []godoo.HistoryEntry
+	err := r.send(http.MethodGet, fmt.Sprintf("/history?id=%v", itemId), nil, &entries)
+	return entries, err
+}
+
+func (r *Repo) PreviewUpdate(srchQry, edtQry godoo.FullUserQuery) (godoo.EditPreview, error) {
+	var p godoo.EditPreview
+	err := r.send(http.MethodPut, "/preview", []godoo.FullUserQuery{srchQry, edtQry}, &p)
+	return p, err
+}
+
+func (r *Repo) Undo() ([]godoo.HistoryEntry, error) {
+	var entries []godoo.HistoryEntry
+	err := r.send(http.MethodPost, "/undo", nil, &entries)
+	return entries, err
+}
+
+// Encodes body, sends it to the endpoint at path and decodes
+// the response into out. Non-2xx responses are returned as a
+// *StatusError rather than being decoded.
+func (r *Repo) send(method, path string, body, out any) error {
+	_, err := r.sendWithHeader(method, path, nil, body, out)
+	return err
+}
+
+// As send, with hdr added to the request. The response's headers
+// are returned too.
+func (r *Repo) sendWithHeader(method, path string, hdr http.Header, body, out any) (http.Header, error) {
+	b, err := json.Marshal(body)
+	if err != nil {
+		return nil, err
+	}
+
+	rq, err := http.NewRequest(method, r.url+path, bytes.NewBuffer(b))
+	if err != nil {
+		return nil, err
+	}
+	for k, v := range hdr {
+		rq.Header[k] = v
+	}
+	rq.Header.Set("content-type", "application/json")
+	rq.Header.Set(godoo.ClientHeader, r.name)
+	if r.token != "" {
+		rq.Header.Set(godoo.AuthHeader, godoo.BearerToken(r.token))
+	}
+
+	resp, err := r.client.Do(rq)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		msg, _ := io.ReadAll(resp.Body)
+		return resp.Header, &StatusError{Code: resp.StatusCode, Msg: strings.TrimSpace(string(msg))}
+	}
+
+	return resp.Header, json.NewDecoder(resp.Body).Decode(out)
+}
+
+// Returned when the server responds with a non-2xx status code
+type StatusError struct {
+	Code int
+	Msg  string
+}
+
+func (s *StatusError) Error() string {
+	return fmt.Sprintf("server responded with %v: %v", s.Code, s.Msg)
+}
@@ -0,0 +1,206 @@
+package remote
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	godoo "github.com/mundacity/go-doo"
+	"github.com/mundacity/go-doo/fake"
+	"github.com/mundacity/go-doo/sqlite"
+	"github.com/mundacity/go-doo/srv"
+	lg "github.com/mundacity/quick-logger"
+)
+
+func getTestServer() *httptest.Server {
+	c := godoo.ServerConfigVals{DateFormat: "2006-01-02", Repo: fake.RepoDud{}}
+	h := srv.NewHandler(c)
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/add", h.HandleRequests)
+	mux.HandleFunc("/get", h.HandleRequests)
+	mux.HandleFunc("/edit", h.HandleRequests)
+	mux.HandleFunc("/delete", h.HandleRequests)
+	mux.HandleFunc("/history", h.HistoryHandler)
+	mux.HandleFunc("/undo", h.UndoHandler)
+	mux.HandleFunc("/preview", h.PreviewHandler)
+	mux.HandleFunc("/broken", func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "something went wrong", http.StatusInternalServerError)
+	})
+	return httptest.NewServer(mux)
+}
+
+func TestRoundTrip(t *testing.T) {
+	lg.Logger = lg.NewDummyLogger()
+	ts := getTestServer()
+	defer ts.Close()
+
+	r := NewRepo(ts.URL, ts.Client())
+
+	itms, err := r.GetWhere(godoo.FullUserQuery{QueryOptions: []godoo.UserQueryOption{{Elem: godoo.ById}}, QueryData: godoo.TodoItem{Id: 1}})
+	if err != nil || len(itms) != 1 {
+		t.Errorf(">>>>FAILED (get): got %v items, err: %v", len(itms), err)
+	}
+
+	id, err := r.Add(godoo.NewTodoItem(godoo.WithPriorityLevel(godoo.None)))
+	if err == nil {
+		t.Errorf(">>>>FAILED (add): expected bad request for item without creation date, got id %v", id)
+	}
+	if se, ok := err.(*StatusError); !ok || se.Code != http.StatusBadRequest {
+		t.Errorf(">>>>FAILED (add): expected 400 StatusError, got '%v'", err)
+	}
+
+	n, err := r.UpdateWhere(godoo.FullUserQuery{}, godoo.FullUserQuery{})
+	if err != nil || n != 3 {
+		t.Errorf(">>>>FAILED (edit): got %v, err: %v", n, err)
+	}
+
+	ids, err := r.DeleteWhere(godoo.FullUserQuery{QueryOptions: []godoo.UserQueryOption{{Elem: godoo.ById}}})
+	if err != nil || len(ids) != 2 {
+		t.Errorf(">>>>FAILED (delete): got %v, err: %v", ids, err)
+	}
+
+	entries, err := r.History(4)
+	if err != nil || len(entries) != 1 || entries[0].ItemId != 4 {
+		t.Errorf(">>>>FAILED (history): got %v, err: %v", entries, err)
+	}
+
+	p, err := r.PreviewUpdate(godoo.FullUserQuery{}, godoo.FullUserQuery{})
+	if err != nil || p.Matched != 3 || len(p.Changes) != 1 {
+		t.Errorf(">>>>FAILED (preview): got %v, err: %v", p, err)
+	}
+
+	entries, err = r.Undo()
+	if err != nil || len(entries) != 1 {
+		t.Errorf(">>>>FAILED (undo): got %v, err: %v", entries, err)
+	}
+}
+
+func TestStatusCodeChecking(t *testing.T) {
+	lg.Logger = lg.NewDummyLogger()
+	ts := getTestServer()
+	defer ts.Close()
+
+	r := NewRepo(ts.URL, ts.Client())
+
+	var n int
+	err := r.send(http.MethodPut, "/broken", nil, &n)
+
+	se, ok := err.(*StatusError)
+	if !ok || se.Code != http.StatusInternalServerError {
+		t.Errorf(">>>>FAILED: expected 500 StatusError, got '%v'", err)
+	} else {
+		t.Logf(">>>>PASSED: %v", err)
+	}
+}
+
+func TestConditionalUpdate(t *testing.T) {
+	lg.Logger = lg.NewDummyLogger()
+	db, err := sqlite.SetupRepo("", godoo.Sqlite, "2006-01-02", 0)
+	if err != nil {
+		t.Fatalf("couldn't set up repo: %v", err)
+	}
+	itm := godoo.NewTodoItem(godoo.WithPriorityLevel(godoo.None))
+	itm.CreationDate, itm.Body = time.Now(), "plan sprint"
+	db.Add(itm)
+
+	h := srv.NewHandler(godoo.ServerConfigVals{DateFormat: "2006-01-02", Repo: db})
+	ts := httptest.NewServer(http.HandlerFunc(h.HandleRequests))
+	defer ts.Close()
+	r := NewRepo(ts.URL, ts.Client())
+
+	byId := godoo.FullUserQuery{QueryOptions: []godoo.UserQueryOption{{Elem: godoo.ById}}, QueryData: godoo.TodoItem{Id: 1}}
+	newBody := func(body string) godoo.FullUserQuery {
+		return godoo.FullUserQuery{QueryOptions: []godoo.UserQueryOption{{Elem: godoo.ByBody}, {Elem: godoo.ByReplacement}}, QueryData: godoo.TodoItem{Body: body}}
+	}
+
+	read, err := r.GetWhere(byId)
+	if err != nil || len(read) != 1 || read[0].Version != 1 {
+		t.Fatalf(">>>>FAILED (get): got %v, err: %v", read, err)
+	}
+	db.UpdateWhere(byId, newBody("plan sprint with the team"))
+
+	_, err = r.UpdateIfUnchanged(byId, newBody("plan the sprint"), godoo.GetVersions(read))
+	ce, ok := err.(*godoo.VersionConflictError)
+	if !ok || len(ce.Conflicts) != 1 || ce.Conflicts[0] != (godoo.VersionConflict{ItemId: 1, Expected: 1, Current: 2}) {
+		t.Errorf(">>>>FAILED (stale edit): expected a conflict for item 1, got '%v'", err)
+	}
+
+	read, _ = r.GetWhere(byId)
+	if n, err := r.UpdateIfUnchanged(byId, newBody("plan the sprint"), godoo.GetVersions(read)); err != nil || n != 1 {
+		t.Errorf(">>>>FAILED (fresh edit): got %v, err: %v", n, err)
+	}
+}
+
+// Pages are walked with the cursor the server sends back
+func TestGetPage(t *testing.T) {
+	lg.Logger = lg.NewDummyLogger()
+	db, err := sqlite.SetupRepo("", godoo.Sqlite, "2006-01-02", 0)
+	if err != nil {
+		t.Fatalf("couldn't set up repo: %v", err)
+	}
+	for _, body := range []string{"plan sprint", "draft backlog", "water plants"} {
+		itm := godoo.NewTodoItem(godoo.WithPriorityLevel(godoo.None))
+		itm.CreationDate, itm.Body = time.Now(), body
+		db.Add(itm)
+	}
+
+	h := srv.NewHandler(godoo.ServerConfigVals{DateFormat: "2006-01-02", Repo: db})
+	ts := httptest.NewServer(http.HandlerFunc(h.HandleRequests))
+	defer ts.Close()
+	r := NewRepo(ts.URL, ts.Client())
+
+	qry := godoo.FullUserQuery{Sort: []godoo.SortKey{godoo.SortByBody}, Limit: 2}
+	var bodies []string
+	for pages := 1; ; pages++ {
+		itms, next, err := godoo.GetPage(r, qry)
+		if err != nil {
+			t.Fatalf(">>>>FAILED (page %v): %v", pages, err)
+		}
+		for _, itm := range itms {
+			bodies = append(bodies, itm.Body)
+		}
+		if next == "" {
+			break
+		}
+		if pages == 3 {
+			t.Fatalf(">>>>FAILED: still handed a cursor after %v pages", pages)
+		}
+		qry.Cursor = next
+	}
+
+	if exp := "[draft backlog plan sprint water plants]"; fmt.Sprint(bodies) != exp {
+		t.Errorf(">>>>FAILED: expected %v, got %v", exp, bodies)
+	}
+}
+
+func TestWithToken(t *testing.T) {
+	lg.Logger = lg.NewDummyLogger()
+	db, err := sqlite.SetupRepo("", godoo.Sqlite, "2006-01-02", 0)
+	if err != nil {
+		t.Fatalf("couldn't set up repo: %v", err)
+	}
+	for _, owner := range []string{"alice", "bob"} {
+		itm := godoo.NewTodoItem(godoo.WithPriorityLevel(godoo.None))
+		itm.CreationDate, itm.Body, itm.Owner, itm.Visibility = time.Now(), owner+"'s item", owner, godoo.Private
+		db.Add(itm)
+	}
+	_, token, _ := db.CreateToken("alice")
+
+	f := &srv.FakeSrvContext{}
+	f.SetupServerContext(godoo.ServerConfigVals{DateFormat: "2006-01-02", Repo: db, AuthRequired: true})
+	ts := httptest.NewServer(f.Server.Handler)
+	defer ts.Close()
+
+	_, err = NewRepo(ts.URL, ts.Client()).GetAll()
+	if se, ok := err.(*StatusError); !ok || se.Code != http.StatusUnauthorized {
+		t.Errorf(">>>>FAILED (no token): expected 401 StatusError, got '%v'", err)
+	}
+
+	itms, err := NewRepo(ts.URL, ts.Client(), WithToken(token)).GetAll()
+	if err != nil || len(itms) != 1 || itms[0].Owner != "alice" {
+		t.Errorf(">>>>FAILED (token): expected alice's item only, got %v, err: %v", itms, err)
+	}
+}
@@ -0,0 +1,156 @@
+package sqlite
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/mattn/go-sqlite3"
+)
+
+// Copies the db to path using sqlite's online backup API, so it can run
+// while the app or server is in use. Changes made through the repo wait
+// until the copy is done. The copy is checked before it replaces anything
+// already at path.
+func (r *Repo) Backup(path string) error {
+	tmp := path + ".tmp"
+	os.Remove(tmp) // left over from a backup that didn't finish
+
+	dest, err := returnSqliteDb(tmp)
+	if err != nil {
+		return &ConnectionError{Path: tmp, Err: err}
+	}
+
+	r.Mtx.Lock()
+	err = copyDb(dest, r.db)
+	r.Mtx.Unlock()
+
+	if err == nil {
+		err = checkIntegrity(dest, path)
+	}
+	dest.Close()
+
+	if err != nil {
+		os.Remove(tmp)
+		return err
+	}
+	return os.Rename(tmp, path)
+}
+
+// Replaces the contents of the db with the backup at path, once it's passed
+// sqlite's integrity check. Backups made by older versions of the app are
+// migrated straight away.
+func (r *Repo) Restore(path string) error {
+	if _, err := os.Stat(path); err != nil {
+		return &ConnectionError{Path: path, Err: err}
+	}
+
+	// not pinged, so files that aren't dbs at all fail the integrity check instead
+	src, err := sql.Open("sqlite3", path)
+	if err != nil {
+		return &ConnectionError{Path: path, Err: err}
+	}
+	defer src.Close()
+
+	if err = checkIntegrity(src, path); err != nil {
+		return err
+	}
+	if ok, err := tableExists(src, "items"); err != nil || !ok {
+		return &IntegrityError{Path: path, Problems: []string{"not a go-doo database"}}
+	}
+
+	r.Mtx.Lock()
+	defer r.Mtx.Unlock()
+
+	if err = copyDb(r.db, src); err != nil {
+		return err
+	}
+	if _, err = migrate(r.db); err != nil {
+		return err
+	}
+	if err = validateSchema(r.db); err != nil {
+		return err
+	}
+
+	r.fts, err = hasFullText(r.db)
+	return err
+}
+
+// Copies every page of src into dest in one step
+func copyDb(dest, src *sql.DB) error {
+	ctx := context.Background()
+
+	dc, err := dest.Conn(ctx)
+	if err != nil {
+		return err
+	}
+	defer dc.Close()
+
+	sc, err := src.Conn(ctx)
+	if err != nil {
+		return err
+	}
+	defer sc.Close()
+
+	return dc.Raw(func(d any) error {
+		return sc.Raw(func(s any) error {
+			dConn, ok := d.(*sqlite3.SQLiteConn)
+			sConn, ok2 := s.(*sqlite3.SQLiteConn)
+			if !ok || !ok2 {
+				return errors.New("backups need the sqlite3 driver")
+			}
+
+			b, err := dConn.Backup("main", sConn, "main")
+			if err != nil {
+				return err
+			}
+			if _, err = b.Step(-1); err != nil {
+				b.Finish()
+				return err
+			}
+			return b.Finish()
+		})
+	})
+}
+
+// Runs sqlite's integrity check over db, which was opened from path
+func checkIntegrity(db *sql.DB, path string) error {
+	rows, err := db.Query("pragma integrity_check")
+	if err != nil {
+		// e.g. the file isn't a sqlite db at all
+		return &IntegrityError{Path: path, Problems: []string{err.Error()}}
+	}
+	defer rows.Close()
+
+	var problems []string
+	for rows.Next() {
+		var p string
+		if err = rows.Scan(&p); err != nil {
+			return err
+		}
+		if p != "ok" {
+			problems = append(problems, p)
+		}
+	}
+	if err = rows.Err(); err != nil {
+		return &IntegrityError{Path: path, Problems: []string{err.Error()}}
+	}
+
+	if len(problems) > 0 {
+		return &IntegrityError{Path: path, Problems: problems}
+	}
+	return nil
+}
+
+// Returned when a backup fails sqlite's integrity check
+type IntegrityError struct {
+	Path     string
+	Problems []string
+}
+
+func (i *IntegrityError) Error() string {
+	return fmt.Sprintf("'%v' failed the integrity check: %v", i.Path, strings.Join(i.Problems, "; "))
+}
@@ -0,0 +1,172 @@
+package sqlite
+
+import (
+	"database/sql"
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+
+	godoo "github.com/mundacity/go-doo"
+)
+
+// A seeded repo kept in a file, as backups copy between connections
+func seedFileRepo(t *testing.T, path string) *Repo {
+	r, err := SetupRepo(path, godoo.Sqlite, "2006-01-02", 0)
+	if err != nil {
+		t.Fatalf("couldn't set up repo: %v", err)
+	}
+	t.Cleanup(func() { r.db.Close() })
+
+	for _, b := range []string{"first", "second", "third"} {
+		itm := godoo.TodoItem{CreationDate: parseDate("2022-06-01"), Body: b, Tags: map[string]struct{}{"work": {}}}
+		if _, err = r.Add(&itm); err != nil {
+			t.Fatalf("seeding failed: %v", err)
+		}
+	}
+	return r
+}
+
+func countItems(t *testing.T, r *Repo) int {
+	itms, err := r.GetAll()
+	if err != nil {
+		t.Fatalf(">>>>FAILED: couldn't get items: %v", err)
+	}
+	return len(itms)
+}
+
+func TestBackup(t *testing.T) {
+	dir := t.TempDir()
+	r := seedFileRepo(t, filepath.Join(dir, "live.db"))
+	path := filepath.Join(dir, "backup.db")
+
+	// the second backup replaces the first
+	for _, exp := range []int{3, 4} {
+		if err := r.Backup(path); err != nil {
+			t.Fatalf(">>>>FAILED: %v", err)
+		}
+
+		b, err := OpenRepo(path, godoo.Sqlite, "2006-01-02", 0)
+		if err != nil {
+			t.Fatalf(">>>>FAILED: couldn't open backup: %v", err)
+		}
+		if n := countItems(t, b); n != exp {
+			t.Errorf(">>>>FAILED: expected %v items in the backup, got %v", exp, n)
+		}
+		b.db.Close()
+
+		r.Add(&godoo.TodoItem{CreationDate: parseDate("2022-06-02"), Body: "fourth"})
+	}
+
+	if _, err := os.Stat(path + ".tmp"); !errors.Is(err, os.ErrNotExist) {
+		t.Errorf(">>>>FAILED: temporary file left behind")
+	}
+}
+
+type restore_test_case struct {
+	setup    func(t *testing.T, r *Repo, path string) // writes the file to restore
+	expItems int
+	expErr   error
+	name     string
+}
+
+func getRestoreTestCases() []restore_test_case {
+	return []restore_test_case{{
+		setup: func(t *testing.T, r *Repo, path string) {
+			r.Backup(path)
+			r.Add(&godoo.TodoItem{CreationDate: parseDate("2022-06-02"), Body: "after the backup"})
+		},
+		expItems: 3,
+		name:     "changes since the backup are undone",
+	}, {
+		setup: func(t *testing.T, r *Repo, path string) {
+			db, _ := sql.Open("sqlite3", path)
+			defer db.Close()
+			if _, err := db.Exec(migrations[0].stmts[0] + migrations[0].stmts[1] +
+				"insert into items (parentId, creationDate, deadline, body) values (0, '2022-01-01', '', 'old item');"); err != nil {
+				t.Fatalf("couldn't create legacy db: %v", err)
+			}
+		},
+		expItems: 1,
+		name:     "older backups are migrated",
+	}, {
+		setup: func(t *testing.T, r *Repo, path string) {
+			os.WriteFile(path, []byte("not a database, just some text that's long enough to look like a header"), 0644)
+		},
+		expItems: 3,
+		expErr:   &IntegrityError{},
+		name:     "not a sqlite db",
+	}, {
+		setup: func(t *testing.T, r *Repo, path string) {
+			db, _ := sql.Open("sqlite3", path)
+			defer db.Close()
+			db.Exec("create table notes (body text);")
+		},
+		expItems: 3,
+		expErr:   &IntegrityError{},
+		name:     "sqlite db from another app",
+	}, {
+		setup:    func(t *testing.T, r *Repo, path string) {},
+		expItems: 3,
+		expErr:   &ConnectionError{},
+		name:     "missing file",
+	}}
+}
+
+func TestRestore(t *testing.T) {
+	tcs := getRestoreTestCases()
+	for _, tc := range tcs {
+		t.Run(tc.name, func(t *testing.T) {
+			runRestoreTest(t, tc)
+		})
+	}
+}
+
+func runRestoreTest(t *testing.T, tc restore_test_case) {
+	dir := t.TempDir()
+	r := seedFileRepo(t, filepath.Join(dir, "live.db"))
+	path := filepath.Join(dir, "backup.db")
+	tc.setup(t, r, path)
+
+	err := r.Restore(path)
+	if reflect.TypeOf(err) != reflect.TypeOf(tc.expErr) {
+		t.Fatalf(">>>>FAILED: expected %T, got %v", tc.expErr, err)
+	}
+
+	if n := countItems(t, r); n != tc.expItems {
+		t.Errorf(">>>>FAILED: expected %v items after restoring, got %v", tc.expItems, n)
+	}
+	if err = validateSchema(r.db); err != nil {
+		t.Errorf(">>>>FAILED: %v", err)
+	}
+	t.Logf(">>>>PASSED: %v", tc.name)
+}
+
+func TestSnapshotRetention(t *testing.T) {
+	dir := t.TempDir()
+	r := seedFileRepo(t, filepath.Join(dir, "live.db"))
+	other := filepath.Join(dir, "notes.txt")
+	os.WriteFile(other, []byte("not a snapshot"), 0644)
+
+	start := time.Date(2022, 6, 1, 9, 0, 0, 0, time.UTC)
+	var paths []string
+	for i := 0; i < 4; i++ {
+		p, _, err := godoo.TakeSnapshot(r, dir, 2, start.Add(time.Duration(i)*time.Hour))
+		if err != nil {
+			t.Fatalf(">>>>FAILED: %v", err)
+		}
+		paths = append(paths, p)
+	}
+
+	for i, p := range paths {
+		_, err := os.Stat(p)
+		if kept := err == nil; kept != (i >= 2) {
+			t.Errorf(">>>>FAILED: snapshot %v kept: %v", filepath.Base(p), kept)
+		}
+	}
+	if _, err := os.Stat(other); err != nil {
+		t.Errorf(">>>>FAILED: other files should be left alone: %v", err)
+	}
+}
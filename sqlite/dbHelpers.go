@@ -3,6 +3,8 @@ package sqlite
 import (
 	"database/sql"
 	"fmt"
+	"strconv"
+	"strings"
 	"sync"
 	"time"
 
@@ -22,18 +24,27 @@ const (
 	all
 )
 
-// Repo used by the app
-var AppRepo Repo
-
 // Basic type to encapsulate the various IRepository methods
 type Repo struct {
-	db   *sql.DB
-	dl   string
-	kind godoo.DbType
-	Port int
-	Mtx  sync.Mutex
+	db     *sql.DB
+	dl     string
+	kind   godoo.DbType
+	Port   int
+	Mtx    sync.Mutex
+	fts    bool   // full-text index available
+	client string // recorded against changes in item_history; see ForClient
 }
 
+// Describes how the tags of matched items are changed during an edit
+type tag_edit_mode int
+
+const (
+	noTagEdit tag_edit_mode = iota
+	appendTags
+	replaceTags
+	removeTags
+)
+
 // Helps when scanning using sql.Rows.Scan
 type temp_item struct {
 	id           int
@@ -44,6 +55,13 @@ type temp_item struct {
 	isComplete   bool
 	tag          string
 	priority     int
+	recurrence   string
+	completedAt  string
+	version      int
+	owner        string
+	visibility   string
+	rank         float64
+	snippet      string
 }
 
 // Field & value pairing to allow for composite where clauses
@@ -56,15 +74,24 @@ type where_map_entry struct {
 func (r *Repo) tempConversion(tmp temp_item) godoo.TodoItem {
 	var ret godoo.TodoItem
 	ret.Tags = make(map[string]struct{})
+	ret.ChildItems = make(map[int]struct{})
 
 	ret.Id = tmp.id
 	ret.ParentId = tmp.parentId
+	ret.IsChild = tmp.parentId != 0
 	ret.CreationDate, _ = time.Parse(r.dl, tmp.creationDate)
 	ret.Deadline, _ = time.Parse(r.dl, tmp.deadline)
 	ret.Body = tmp.body
 	ret.IsComplete = tmp.isComplete
 	ret.Tags[tmp.tag] = struct{}{}
 	ret.Priority = godoo.PriorityLevel(tmp.priority)
+	ret.Recurrence = tmp.recurrence
+	ret.CompletedAt, _ = time.Parse(time.RFC3339, tmp.completedAt)
+	ret.Version = tmp.version
+	ret.Owner = tmp.owner
+	ret.Visibility = godoo.Visibility(tmp.visibility)
+	ret.Rank = tmp.rank
+	ret.Snippet = tmp.snippet
 
 	return ret
 }
@@ -77,6 +104,8 @@ func getSql(qType godoo.QueryType, dbKind godoo.DbType, tbl table) string {
 		return getSelectSql(dbKind, tbl)
 	case godoo.Update:
 		return getBaseUpdateSql(dbKind, tbl)
+	case godoo.Delete:
+		return getDeleteSql(dbKind, tbl)
 	default:
 		return ""
 	}
@@ -86,7 +115,7 @@ func getInsertSql(db godoo.DbType, tbl table) string {
 	switch db {
 	case godoo.Sqlite:
 		if tbl == items {
-			return "insert into items (parentId, creationDate, deadline, body, priority) values (?, ?, ?, ?, ?)"
+			return "insert into items (parentId, creationDate, deadline, body, priority, recurrence, owner, visibility) values (?, ?, ?, ?, ?, ?, ?, ?)"
 		} else if tbl == tags {
 			return "INSERT INTO tags (itemId, tag) VALUES (?, ?)"
 		}
@@ -98,7 +127,7 @@ func getSelectSql(db godoo.DbType, tbl table) string {
 	// table doesn't matter atm
 	switch db {
 	case godoo.Sqlite:
-		return "select i.id, parentId, creationDate, deadline, body, isComplete, ifnull(tag, '') tag, priority " +
+		return "select i.id, parentId, creationDate, deadline, body, isComplete, ifnull(tag, '') tag, priority, recurrence, completedAt, version, owner, visibility " +
 			"from items i left join tags t " +
 			"on i.id = t.itemId"
 	}
@@ -117,14 +146,479 @@ func getBaseUpdateSql(db godoo.DbType, tbl table) string {
 	return ""
 }
 
-func (sr *Repo) processQuery(all *sql.Rows, mp map[int]*godoo.TodoItem) ([]godoo.TodoItem, error) {
+func getDeleteSql(db godoo.DbType, tbl table) string {
+	switch db {
+	case godoo.Sqlite:
+		if tbl == items {
+			return "delete from items where id = ?"
+		} else if tbl == tags {
+			return "delete from tags where itemId = ?"
+		}
+	}
+	return ""
+}
+
+// Returns the ids of any items whose parent is one of n items,
+// limited to those scope lets through if it isn't empty
+func getChildSelectSql(db godoo.DbType, n int, scope string) string {
+	switch db {
+	case godoo.Sqlite:
+		return "select i.id, i.parentId from items i where i.parentId in (" + getPlaceholders(n) + ")" + andScope(scope)
+	}
+	return ""
+}
+
+func andScope(scope string) string {
+	if scope == "" {
+		return ""
+	}
+	return " and " + scope
+}
+
+// Select statement for an item and all of its descendants. Uses union rather
+// than union all so the recursion ends even if the parent links form a cycle.
+// If scope isn't empty, items it doesn't let through are left out, along with
+// their descendants, & its values are needed twice after the id.
+func getSubtreeSelectSql(db godoo.DbType, scope string) string {
+	switch db {
+	case godoo.Sqlite:
+		rec := ""
+		if scope != "" {
+			rec = " where " + scope
+		}
+		return "with recursive subtree(id) as (" +
+			"select i.id from items i where i.id = ?" + andScope(scope) + " " +
+			"union select i.id from items i inner join subtree s on i.parentId = s.id" + rec + ") " +
+			"select i.id, parentId, creationDate, deadline, body, isComplete, ifnull(tag, '') tag, priority, recurrence, completedAt, version, owner, visibility " +
+			"from items i inner join subtree s on i.id = s.id " +
+			"left join tags t on i.id = t.itemId"
+	}
+	return ""
+}
+
+// Selects matches ordered by relevance; needs the highlight
+// markers & search expression as the first three values
+func getFullTextSelectSql(db godoo.DbType) string {
+	switch db {
+	case godoo.Sqlite:
+		return "select i.id, parentId, creationDate, deadline, body, isComplete, ifnull(tag, '') tag, priority, recurrence, completedAt, version, owner, visibility, " +
+			"bm25(items_fts) relevance, snippet(items_fts, -1, ?, ?, '...', 12) snip " +
+			"from items_fts inner join items i on i.id = items_fts.rowid " +
+			"left join tags t on i.id = t.itemId " +
+			"where items_fts match ?"
+	}
+	return ""
+}
+
+// Recurring items among the ids passed that haven't been completed yet
+func getRecurringSelectSql(db godoo.DbType, n int) string {
+	switch db {
+	case godoo.Sqlite:
+		return fmt.Sprintf("select id from items where recurrence != '' and isComplete = false and id in (%v)", getPlaceholders(n))
+	}
+	return ""
+}
+
+// Those ids passed whose completion state an edit will change; expects
+// the ids, followed by the new state unless toggling
+func getCompletionChangeSql(db godoo.DbType, n int, toggling bool) string {
+	switch db {
+	case godoo.Sqlite:
+		if toggling {
+			return fmt.Sprintf("select id from items where id in (%v)", getPlaceholders(n))
+		}
+		return fmt.Sprintf("select id from items where id in (%v) and isComplete != ?", getPlaceholders(n))
+	}
+	return ""
+}
+
+// Stamps the completion time of the ids passed & records the change.
+// Expects the time followed by the ids, for each statement.
+func getCompletionSql(db godoo.DbType, n int) []string {
+	switch db {
+	case godoo.Sqlite:
+		return []string{
+			fmt.Sprintf("update items set completedAt = case when isComplete then ? else '' end where id in (%v)", getPlaceholders(n)),
+			fmt.Sprintf("insert into completion_events (itemId, isComplete, occurredAt) select id, isComplete, ? from items where id in (%v)", getPlaceholders(n)),
+		}
+	}
+	return nil
+}
+
+func getSetCompleteSql(db godoo.DbType) string {
+	switch db {
+	case godoo.Sqlite:
+		return "update items set isComplete = true where id = ?"
+	}
+	return ""
+}
+
+// Select statement for the items with the ids passed, tags included
+func getSnapshotSelectSql(db godoo.DbType, n int) string {
+	switch db {
+	case godoo.Sqlite:
+		return getSelectSql(db, all) + fmt.Sprintf(" where i.id in (%v)", getPlaceholders(n))
+	}
+	return ""
+}
+
+func getHistoryInsertSql(db godoo.DbType) string {
+	switch db {
+	case godoo.Sqlite:
+		return "insert into item_history (itemId, action, beforeJson, afterJson, client, occurredAt, operation, undoes) values (?, ?, ?, ?, ?, ?, ?, ?)"
+	}
+	return ""
+}
+
+// Oldest change first
+func getHistorySelectSql(db godoo.DbType) string {
+	switch db {
+	case godoo.Sqlite:
+		return "select id, itemId, action, beforeJson, afterJson, client, occurredAt, operation, undoes from item_history where itemId = ? order by id"
+	}
+	return ""
+}
+
+func getNextOperationSql(db godoo.DbType) string {
+	switch db {
+	case godoo.Sqlite:
+		return "select ifnull(max(operation), 0) + 1 from item_history"
+	}
+	return ""
+}
+
+// The client's most recent operation that isn't an undo & hasn't been undone
+func getLastOperationSql(db godoo.DbType) string {
+	switch db {
+	case godoo.Sqlite:
+		return "select ifnull(max(operation), 0) from item_history " +
+			"where client = ? and undoes = 0 " +
+			"and operation not in (select undoes from item_history where undoes != 0)"
+	}
+	return ""
+}
+
+// Entries for a single operation, newest first so they can be reverted in order
+func getOperationSelectSql(db godoo.DbType) string {
+	switch db {
+	case godoo.Sqlite:
+		return "select id, itemId, action, beforeJson, afterJson from item_history where operation = ? order by id desc"
+	}
+	return ""
+}
+
+func getOutboxTableSql(db godoo.DbType) string {
+	switch db {
+	case godoo.Sqlite:
+		return "create table if not exists outbox (id integer primary key autoincrement, " +
+			"entryJson text not null, " +
+			"queuedAt text not null);"
+	}
+	return ""
+}
+
+func getOutboxInsertSql(db godoo.DbType) string {
+	switch db {
+	case godoo.Sqlite:
+		return "insert into outbox (entryJson, queuedAt) values (?, ?)"
+	}
+	return ""
+}
+
+func getOutboxRequeueSql(db godoo.DbType) string {
+	switch db {
+	case godoo.Sqlite:
+		return "insert into outbox (id, entryJson, queuedAt) values (?, ?, ?)"
+	}
+	return ""
+}
+
+func getOutboxSelectSql(db godoo.DbType) string {
+	switch db {
+	case godoo.Sqlite:
+		return "select id, entryJson from outbox order by id"
+	}
+	return ""
+}
+
+func getOutboxUpdateSql(db godoo.DbType) string {
+	switch db {
+	case godoo.Sqlite:
+		return "update outbox set entryJson = ? where id = ?"
+	}
+	return ""
+}
+
+func getOutboxDeleteSql(db godoo.DbType) string {
+	switch db {
+	case godoo.Sqlite:
+		return "delete from outbox where id = ?"
+	}
+	return ""
+}
+
+// Empties the item cache kept alongside the outbox
+func getClearCacheSql(db godoo.DbType) []string {
+	switch db {
+	case godoo.Sqlite:
+		return []string{"delete from tags", "delete from items"}
+	}
+	return nil
+}
+
+// Like getReinsertSql, but with the version last
+func getCacheInsertSql(db godoo.DbType) string {
+	switch db {
+	case godoo.Sqlite:
+		return "insert into items (id, parentId, creationDate, deadline, body, isComplete, priority, recurrence, completedAt, owner, visibility, version) values (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)"
+	}
+	return ""
+}
+
+// Moves an item on to its next version after a change
+func getVersionBumpSql(db godoo.DbType) string {
+	switch db {
+	case godoo.Sqlite:
+		return "update items set version = version + 1 where id = ?"
+	}
+	return ""
+}
+
+func getVersionSelectSql(db godoo.DbType, n int) string {
+	switch db {
+	case godoo.Sqlite:
+		return fmt.Sprintf("select id, version from items where id in (%v)", getPlaceholders(n))
+	}
+	return ""
+}
+
+func getTokenInsertSql(db godoo.DbType) string {
+	switch db {
+	case godoo.Sqlite:
+		return "insert into tokens (owner, tokenHash, createdAt) values (?, ?, ?)"
+	}
+	return ""
+}
+
+// Keeps the time a token was first revoked
+func getTokenRevokeSql(db godoo.DbType) string {
+	switch db {
+	case godoo.Sqlite:
+		return "update tokens set revokedAt = case when revokedAt = '' then ? else revokedAt end where id = ?"
+	}
+	return ""
+}
+
+func getTokenSelectSql(db godoo.DbType) string {
+	switch db {
+	case godoo.Sqlite:
+		return "select id, owner, createdAt, revokedAt from tokens order by id"
+	}
+	return ""
+}
+
+func getTokenOwnerSql(db godoo.DbType) string {
+	switch db {
+	case godoo.Sqlite:
+		return "select owner from tokens where tokenHash = ? and revokedAt = ''"
+	}
+	return ""
+}
+
+// Overwrites every column of an existing item; expects the id last
+func getRestoreSql(db godoo.DbType) string {
+	switch db {
+	case godoo.Sqlite:
+		return "update items set parentId = ?, creationDate = ?, deadline = ?, body = ?, isComplete = ?, priority = ?, recurrence = ?, completedAt = ?, owner = ?, visibility = ? where id = ?"
+	}
+	return ""
+}
+
+// Puts a deleted item back with its original id; expects the id first
+func getReinsertSql(db godoo.DbType) string {
+	switch db {
+	case godoo.Sqlite:
+		return "insert into items (id, parentId, creationDate, deadline, body, isComplete, priority, recurrence, completedAt, owner, visibility) values (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)"
+	}
+	return ""
+}
+
+func getCompletionEventSql(db godoo.DbType) string {
+	switch db {
+	case godoo.Sqlite:
+		return "insert into completion_events (itemId, isComplete, occurredAt) values (?, ?, ?)"
+	}
+	return ""
+}
+
+func getChildCountSql(db godoo.DbType) string {
+	switch db {
+	case godoo.Sqlite:
+		return "select count(*) from items where parentId = ?"
+	}
+	return ""
+}
+
+func getExistsSql(db godoo.DbType) string {
+	switch db {
+	case godoo.Sqlite:
+		return "select exists (select 1 from items where id = ?)"
+	}
+	return ""
+}
+
+// Select statement for an item's id along with the ids of all of its ancestors
+func getAncestorSelectSql(db godoo.DbType) string {
+	switch db {
+	case godoo.Sqlite:
+		return "with recursive ancestors(id) as (" +
+			"select ? " +
+			"union select i.parentId from items i inner join ancestors a on i.id = a.id where i.parentId <> 0) " +
+			"select id from ancestors"
+	}
+	return ""
+}
+
+func getPlaceholders(n int) string {
+	return strings.TrimSuffix(strings.Repeat("?, ", n), ", ")
+}
+
+// Where clause for items tagged with all n tags, or any of them
+func getTagWhereSql(n int, matchAny bool) string {
+	if matchAny {
+		return "exists (select 1 from tags where itemId = i.id and tag in (" + getPlaceholders(n) + "))"
+	}
+	return strings.TrimSuffix(strings.Repeat("exists (select 1 from tags where itemId = i.id and tag = ?) and ", n), " and ")
+}
+
+// Orders the rows of a wrapped select. Every key goes in the same
+// direction, & id always comes last so the order is stable.
+// A column results are ordered by, along with its value in a cursor
+type sort_column struct {
+	expr   string
+	always bool // ascending whichever the direction
+	val    any
+}
+
+func getSortColumns(keys []godoo.SortKey, ranked bool, pos godoo.PagePosition) []sort_column {
+	var ret []sort_column
+	if len(keys) == 0 && ranked {
+		ret = append(ret, sort_column{expr: "relevance", val: pos.Rank})
+	}
+	for _, k := range keys {
+		switch k {
+		case godoo.SortByDeadline:
+			// items without a deadline go last whichever the direction
+			undated := 0
+			if pos.Deadline == "" {
+				undated = 1
+			}
+			ret = append(ret, sort_column{expr: "deadline = ''", always: true, val: undated}, sort_column{expr: "deadline", val: pos.Deadline})
+		case godoo.SortByCreation:
+			ret = append(ret, sort_column{expr: "creationDate", val: pos.Creation})
+		case godoo.SortByPriority:
+			ret = append(ret, sort_column{expr: "priority", val: pos.Priority})
+		case godoo.SortByBody:
+			ret = append(ret, sort_column{expr: "body collate nocase", val: pos.Body})
+		}
+	}
+	return append(ret, sort_column{expr: "id", val: pos.Id})
+}
+
+func getOrderBySql(db godoo.DbType, keys []godoo.SortKey, desc, ranked bool) string {
+	switch db {
+	case godoo.Sqlite:
+		var cols []string
+		for _, c := range getSortColumns(keys, ranked, godoo.PagePosition{}) {
+			if desc && !c.always {
+				c.expr += " desc"
+			}
+			cols = append(cols, c.expr)
+		}
+		return "order by " + strings.Join(cols, ", ")
+	}
+	return ""
+}
+
+// Matches rows that sort after the position, i.e. those whose first
+// differing sort column is past the position's value for it
+func getKeysetSql(db godoo.DbType, keys []godoo.SortKey, desc, ranked bool, pos godoo.PagePosition) (string, []any) {
+	switch db {
+	case godoo.Sqlite:
+		var ors, equal []string
+		var vals, equalVals []any
+		for _, c := range getSortColumns(keys, ranked, pos) {
+			op := ">"
+			if desc && !c.always {
+				op = "<"
+			}
+			ands := append(append([]string{}, equal...), fmt.Sprintf("(%v) %v ?", c.expr, op))
+			ors = append(ors, "("+strings.Join(ands, " and ")+")")
+			vals = append(append(vals, equalVals...), c.val)
+
+			equal = append(equal, fmt.Sprintf("(%v) = ?", c.expr))
+			equalVals = append(equalVals, c.val)
+		}
+		return "(" + strings.Join(ors, " or ") + ")", vals
+	}
+	return "", nil
+}
+
+// Only adds the tag if the item doesn't already have it
+func getTagAppendSql(db godoo.DbType) string {
+	switch db {
+	case godoo.Sqlite:
+		return "insert into tags (itemId, tag) select ?, ? " +
+			"where not exists (select 1 from tags where itemId = ? and tag = ?)"
+	}
+	return ""
+}
+
+func getTagRemoveSql(db godoo.DbType) string {
+	switch db {
+	case godoo.Sqlite:
+		return "delete from tags where itemId = ? and tag = ?"
+	}
+	return ""
+}
+
+// Only need the ids when working out what to delete or edit
+func getCountSelectSql(db godoo.DbType) string {
+	switch db {
+	case godoo.Sqlite:
+		return "select count(distinct i.id) " +
+			"from items i left join tags t " +
+			"on i.id = t.itemId"
+	}
+	return ""
+}
+
+func getIdSelectSql(db godoo.DbType) string {
+	switch db {
+	case godoo.Sqlite:
+		return "select distinct i.id " +
+			"from items i left join tags t " +
+			"on i.id = t.itemId"
+	}
+	return ""
+}
+
+// Reads rows into items, one per i.id. Ranked rows come from a
+// full-text search and have relevance & snippet columns at the end.
+// Child ids are limited to the items scope lets through.
+func (sr *Repo) processQuery(all *sql.Rows, mp map[int]*godoo.TodoItem, ranked bool, scope []where_map_entry) ([]godoo.TodoItem, error) {
 	var ret []godoo.TodoItem
+	var order []int // ids in the order the rows came back
 
 	defer all.Close()
 	for all.Next() {
 		// read row into temp item
 		var itm temp_item
-		if err := all.Scan(&itm.id, &itm.parentId, &itm.creationDate, &itm.deadline, &itm.body, &itm.isComplete, &itm.tag, &itm.priority); err != nil {
+		dest := []any{&itm.id, &itm.parentId, &itm.creationDate, &itm.deadline, &itm.body, &itm.isComplete, &itm.tag, &itm.priority, &itm.recurrence, &itm.completedAt, &itm.version, &itm.owner, &itm.visibility}
+		if ranked {
+			dest = append(dest, &itm.rank, &itm.snippet)
+		}
+		if err := all.Scan(dest...); err != nil {
 			return nil, err
 		}
 
@@ -135,20 +629,55 @@ func (sr *Repo) processQuery(all *sql.Rows, mp map[int]*godoo.TodoItem) ([]godoo
 			td.Tags[itm.tag] = struct{}{}
 		} else {
 			mp[conv.Id] = &conv
+			order = append(order, conv.Id)
 		}
 
 	}
 	if err := all.Err(); err != nil {
 		return nil, err
 	}
+	all.Close() // free up the connection before querying again
+
+	if err := sr.populateChildItems(mp, scope); err != nil {
+		return nil, err
+	}
 
 	// convert to slice
-	for _, v := range mp {
-		ret = append(ret, *v)
+	for _, id := range order {
+		ret = append(ret, *mp[id])
 	}
 	return ret, nil
 }
 
+// Fills in TodoItem.ChildItems for every item in mp, leaving
+// out children that scope doesn't let through
+func (sr *Repo) populateChildItems(mp map[int]*godoo.TodoItem, scope []where_map_entry) error {
+	if len(mp) == 0 {
+		return nil
+	}
+
+	var ids []any
+	for id := range mp {
+		ids = append(ids, id)
+	}
+
+	scopeSql, scopeVals := buildAndWhere(scope, "")
+	rows, err := sr.db.Query(getChildSelectSql(sr.kind, len(ids), scopeSql), append(ids, scopeVals...)...)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var id, parentId int
+		if err := rows.Scan(&id, &parentId); err != nil {
+			return err
+		}
+		mp[parentId].AddChildItem(id)
+	}
+	return rows.Err()
+}
+
 func (r *Repo) assembleUpdateData(sql string, srchQry, edtQry godoo.FullUserQuery) (string, []any) {
 
 	updateLst := getWhereList(edtQry) // to generate 'a-h' in 'update items set a=b, c=d, e=f, g=h where x'
@@ -177,7 +706,33 @@ func buildAndWhere(input []where_map_entry, sqlBase string) (string, []any) {
 			vals[i+offset] = w.colValue
 			continue
 		}
-		if w.columnName == "creationDate" || w.columnName == "deadline" {
+		if w.columnName == "tag" || w.columnName == "anyTag" {
+			// tested against the item rather than the joined tag
+			// rows, so matching items come back with all their tags
+			tgs := w.colValue.([]string)
+			sqlBase += andStr + getTagWhereSql(len(tgs), w.columnName == "anyTag")
+			vals[i+offset] = tgs[0]
+			for _, t := range tgs[1:] {
+				offset++
+				vals = append(vals, nil)
+				vals[i+offset] = t
+			}
+			continue
+		}
+		if w.columnName == "visibleTo" {
+			sqlBase += fmt.Sprintf("%v(i.owner = ? or i.visibility = '%v')", andStr, godoo.Shared)
+			vals[i+offset] = w.colValue
+			continue
+		}
+		if w.columnName == "childId" { // i.e. searching for the parent of the item with this id
+			sqlBase += fmt.Sprintf("%vi.id = (select parentId from items where id = ?)", andStr)
+			vals[i+offset] = w.colValue
+			continue
+		}
+		if w.columnName == "creationDate" || w.columnName == "deadline" || w.columnName == "completedAt" {
+			if w.columnName == "completedAt" { // timestamp rather than date, so compare the date part only
+				w.columnName = "substr(completedAt, 1, 10)"
+			}
 
 			vs := w.colValue.([]string)
 			if len(vs) > 1 { //it's a range search
@@ -198,16 +753,18 @@ func buildAndWhere(input []where_map_entry, sqlBase string) (string, []any) {
 }
 
 func buildUpdatePairs(input []where_map_entry, sqlBase string, qry godoo.FullUserQuery) (string, []any) {
-	var appending, replacing bool
+	var appending, replacing, toggling bool
 
 	for _, o := range qry.QueryOptions {
 		if o.Elem == godoo.ByAppending {
 			appending = true
-			break
 		}
 		if o.Elem == godoo.ByReplacement {
 			replacing = true
 		}
+		if o.Elem == godoo.ByToggle {
+			toggling = true
+		}
 	}
 
 	comma := ", "
@@ -226,7 +783,7 @@ func buildUpdatePairs(input []where_map_entry, sqlBase string, qry godoo.FullUse
 			vals = append(vals, itm.colValue)
 			continue
 		}
-		if itm.columnName == "isComplete" {
+		if itm.columnName == "isComplete" && toggling {
 			sqlBase += fmt.Sprintf("%v = not %v%v", itm.columnName, itm.columnName, comma)
 			continue
 		}
@@ -241,3 +798,52 @@ func buildUpdatePairs(input []where_map_entry, sqlBase string, qry godoo.FullUse
 	}
 	return sqlBase, vals
 }
+
+// Turns a boolean query into a where clause for the item select. Values
+// are always passed as parameters rather than written into the sql.
+func buildExprWhere(e godoo.QueryExpr) (string, []any) {
+	switch e.Op {
+	case godoo.ExprNot:
+		s, vals := buildExprWhere(e.Children[0])
+		return "not (" + s + ")", vals
+	case godoo.ExprAnd, godoo.ExprOr:
+		var parts []string
+		var vals []any
+		for _, c := range e.Children {
+			s, v := buildExprWhere(c)
+			parts = append(parts, s)
+			vals = append(vals, v...)
+		}
+		return "(" + strings.Join(parts, " "+string(e.Op)+" ") + ")", vals
+	}
+
+	switch e.Field {
+	case godoo.FieldId:
+		id, _ := strconv.Atoi(e.Value)
+		return "i.id = ?", []any{id}
+	case godoo.FieldParent:
+		id, _ := strconv.Atoi(e.Value)
+		return "i.parentId = ?", []any{id}
+	case godoo.FieldTag:
+		// not tag:x should keep untagged items, so test the item rather than the joined row
+		return "i.id in (select itemId from tags where tag = ?)", []any{e.Value}
+	case godoo.FieldBody:
+		return "i.body like ?", []any{fmt.Sprintf("%%%v%%", e.Value)}
+	case godoo.FieldDone:
+		return "i.isComplete = ?", []any{e.Value == "true"}
+	case godoo.FieldPriority:
+		p, _ := godoo.PriorityFromName(e.Value)
+		return "i.priority = ?", []any{int(p)}
+	}
+
+	col := "i.deadline"
+	if e.Field == godoo.FieldCreated {
+		col = "i.creationDate"
+	} else if e.Field == godoo.FieldCompleted {
+		col = "substr(i.completedAt, 1, 10)"
+	}
+	if from, to, ok := strings.Cut(e.Value, ":"); ok {
+		return col + " between ? and ?", []any{from, to}
+	}
+	return col + " = ?", []any{e.Value}
+}
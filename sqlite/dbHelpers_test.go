@@ -43,7 +43,7 @@ func getUpdateAssemblingTestCases() []update_data_assembling_test_case {
 		sql:      getSql(godoo.Update, godoo.Sqlite, items),
 		srchOpts: []godoo.UserQueryOption{{Elem: godoo.ByCreationDate}, {Elem: godoo.ByDeadline, UpperBoundDate: convertToUpperBound("2022-06-22")}},
 		slctr:    godoo.TodoItem{Deadline: parseDate("2022-06-10"), CreationDate: parseDate("2022-06-01")},
-		edtOpts:  []godoo.UserQueryOption{{Elem: godoo.ByCompletion}},
+		edtOpts:  []godoo.UserQueryOption{{Elem: godoo.ByCompletion}, {Elem: godoo.ByToggle}},
 		newData:  godoo.TodoItem{IsComplete: true},
 		expSql:   "update items as i set isComplete = not isComplete where creationDate = ? and deadline between ? and ?",
 		expVals:  []any{"2022-06-01", "2022-06-10", "2022-06-22"},
@@ -52,7 +52,7 @@ func getUpdateAssemblingTestCases() []update_data_assembling_test_case {
 		sql:      getSql(godoo.Update, godoo.Sqlite, items),
 		srchOpts: []godoo.UserQueryOption{{Elem: godoo.ByCreationDate, UpperBoundDate: convertToUpperBound("2022-06-05")}, {Elem: godoo.ByDeadline, UpperBoundDate: convertToUpperBound("2022-06-22")}},
 		slctr:    godoo.TodoItem{Deadline: parseDate("2022-06-10"), CreationDate: parseDate("2022-06-01")},
-		edtOpts:  []godoo.UserQueryOption{{Elem: godoo.ByCompletion}},
+		edtOpts:  []godoo.UserQueryOption{{Elem: godoo.ByCompletion}, {Elem: godoo.ByToggle}},
 		newData:  godoo.TodoItem{IsComplete: true},
 		expSql:   "update items as i set isComplete = not isComplete where creationDate between ? and ? and deadline between ? and ?",
 		expVals:  []any{"2022-06-01", "2022-06-05", "2022-06-10", "2022-06-22"},
@@ -61,11 +61,38 @@ func getUpdateAssemblingTestCases() []update_data_assembling_test_case {
 		sql:      getSql(godoo.Update, godoo.Sqlite, items),
 		srchOpts: []godoo.UserQueryOption{{Elem: godoo.ByCreationDate}, {Elem: godoo.ByDeadline}},
 		slctr:    godoo.TodoItem{Deadline: parseDate("2022-06-10"), CreationDate: parseDate("2022-06-01")},
-		edtOpts:  []godoo.UserQueryOption{{Elem: godoo.ByCompletion}},
+		edtOpts:  []godoo.UserQueryOption{{Elem: godoo.ByCompletion}, {Elem: godoo.ByToggle}},
 		newData:  godoo.TodoItem{IsComplete: true},
 		expSql:   "update items as i set isComplete = not isComplete where creationDate = ? and deadline = ?",
 		expVals:  []any{"2022-06-01", "2022-06-10"},
 		name:     "toggle completion search set creationDate and set deadline",
+	}, {
+		sql:      getSql(godoo.Update, godoo.Sqlite, items),
+		srchOpts: []godoo.UserQueryOption{{Elem: godoo.ByTag}},
+		slctr:    godoo.TodoItem{Tags: map[string]struct{}{"sprint": {}}},
+		edtOpts:  []godoo.UserQueryOption{{Elem: godoo.ByCompletion}},
+		newData:  godoo.TodoItem{IsComplete: true},
+		expSql:   "update items as i set isComplete = ? where exists (select 1 from tags where itemId = i.id and tag = ?)",
+		expVals:  []any{true, "sprint"},
+		name:     "set complete search tag",
+	}, {
+		sql:      getSql(godoo.Update, godoo.Sqlite, items),
+		srchOpts: []godoo.UserQueryOption{{Elem: godoo.ByTag}, {Elem: godoo.ByBody}},
+		slctr:    godoo.TodoItem{Tags: map[string]struct{}{"sprint": {}, "backend": {}}, Body: "api"},
+		edtOpts:  []godoo.UserQueryOption{{Elem: godoo.ByCompletion}},
+		newData:  godoo.TodoItem{IsComplete: true},
+		expSql:   "update items as i set isComplete = ? where exists (select 1 from tags where itemId = i.id and tag = ?) and exists (select 1 from tags where itemId = i.id and tag = ?) and body like ?",
+		expVals:  []any{true, "backend", "sprint", "%api%"},
+		name:     "set complete search all of several tags & body",
+	}, {
+		sql:      getSql(godoo.Update, godoo.Sqlite, items),
+		srchOpts: []godoo.UserQueryOption{{Elem: godoo.ByTag}, {Elem: godoo.ByAnyTag}},
+		slctr:    godoo.TodoItem{Tags: map[string]struct{}{"sprint": {}, "backend": {}}},
+		edtOpts:  []godoo.UserQueryOption{{Elem: godoo.ByCompletion}},
+		newData:  godoo.TodoItem{IsComplete: true},
+		expSql:   "update items as i set isComplete = ? where exists (select 1 from tags where itemId = i.id and tag in (?, ?))",
+		expVals:  []any{true, "backend", "sprint"},
+		name:     "set complete search any of several tags",
 	}, {
 		sql:      getSql(godoo.Update, godoo.Sqlite, items),
 		srchOpts: []godoo.UserQueryOption{{Elem: godoo.ByCreationDate}, {Elem: godoo.ByDeadline}, {Elem: godoo.ByBody}},
@@ -107,7 +134,11 @@ func convertToUpperBound(dStr string) time.Time {
 }
 
 func getInMemDb() *Repo {
-	return SetupRepo("", godoo.Sqlite, "2006-01-02", 0)
+	r, err := SetupRepo("", godoo.Sqlite, "2006-01-02", 0)
+	if err != nil {
+		panic(err)
+	}
+	return r
 }
 
 func TestUpdateAssembling(t *testing.T) {
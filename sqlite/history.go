@@ -0,0 +1,183 @@
+package sqlite
+
+import (
+	"database/sql"
+	"encoding/json"
+	"time"
+
+	godoo "github.com/mundacity/go-doo"
+)
+
+// Works on the same db as the Repo it wraps, but records
+// its changes against a different client. Used by the
+// server so that each request is attributed to its sender.
+type clientRepo struct {
+	*Repo
+	client string
+}
+
+// Returns a repo whose changes are recorded against client
+func (r *Repo) ForClient(client string) godoo.IRepository {
+	return &clientRepo{Repo: r, client: client}
+}
+
+func (c *clientRepo) Add(itm *godoo.TodoItem) (int64, error) {
+	return c.Repo.add(itm, c.client)
+}
+
+func (c *clientRepo) UpdateWhere(srchQry, edtQry godoo.FullUserQuery) (int, error) {
+	return c.Repo.updateWhere(srchQry, edtQry, nil, c.client)
+}
+
+func (c *clientRepo) UpdateIfUnchanged(srchQry, edtQry godoo.FullUserQuery, versions map[int]int) (int, error) {
+	if versions == nil {
+		versions = make(map[int]int)
+	}
+	return c.Repo.updateWhere(srchQry, edtQry, versions, c.client)
+}
+
+func (c *clientRepo) DeleteWhere(srchQry godoo.FullUserQuery) ([]int, error) {
+	return c.Repo.deleteWhere(srchQry, c.client)
+}
+
+func (c *clientRepo) PreviewUpdate(srchQry, edtQry godoo.FullUserQuery) (godoo.EditPreview, error) {
+	return c.Repo.previewUpdate(srchQry, edtQry, c.client)
+}
+
+// Reverts the most recent add, edit or delete made by this repo's client
+func (c *clientRepo) Undo() ([]godoo.HistoryEntry, error) {
+	return c.Repo.undo(c.client)
+}
+
+// Returns every recorded change to the item with the id passed, oldest first.
+// Deleted items keep their history.
+func (r *Repo) History(itemId int) ([]godoo.HistoryEntry, error) {
+	r.Mtx.Lock()
+	defer r.Mtx.Unlock()
+
+	rows, err := r.db.Query(getHistorySelectSql(r.kind), itemId)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var ret []godoo.HistoryEntry
+	for rows.Next() {
+		var e godoo.HistoryEntry
+		var before, after, at string
+		if err = rows.Scan(&e.Id, &e.ItemId, &e.Action, &before, &after, &e.Client, &at, &e.Operation, &e.Undoes); err != nil {
+			return nil, err
+		}
+		if e.Before, err = unmarshalSnapshot(before); err != nil {
+			return nil, err
+		}
+		if e.After, err = unmarshalSnapshot(after); err != nil {
+			return nil, err
+		}
+		e.OccurredAt, _ = time.Parse(time.RFC3339, at)
+		ret = append(ret, e)
+	}
+	return ret, rows.Err()
+}
+
+// Reads the current state of the items with the ids passed, keyed
+// by id. Child items aren't included; they're recorded against the
+// child's parentId instead.
+func (r *Repo) getSnapshots(tx *sql.Tx, ids []int) (map[int]godoo.TodoItem, error) {
+	ret := make(map[int]godoo.TodoItem)
+	if len(ids) == 0 {
+		return ret, nil
+	}
+
+	var vals []any
+	for _, id := range ids {
+		vals = append(vals, id)
+	}
+
+	rows, err := tx.Query(getSnapshotSelectSql(r.kind, len(ids)), vals...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var tmp temp_item
+		if err = rows.Scan(&tmp.id, &tmp.parentId, &tmp.creationDate, &tmp.deadline, &tmp.body, &tmp.isComplete, &tmp.tag, &tmp.priority, &tmp.recurrence, &tmp.completedAt, &tmp.version, &tmp.owner, &tmp.visibility); err != nil {
+			return nil, err
+		}
+		itm, exists := ret[tmp.id]
+		if !exists {
+			itm = r.tempConversion(tmp)
+		}
+		itm.Tags[tmp.tag] = struct{}{}
+		delete(itm.Tags, "") // left join artefact for items without tags
+		ret[tmp.id] = itm
+	}
+	return ret, rows.Err()
+}
+
+// Groups the history entries written by a single add, edit, delete or undo
+type operation struct {
+	id     int
+	client string
+	undoes int // the operation reverted, if this is an undo
+}
+
+func (r *Repo) newOperation(tx *sql.Tx, client string) (operation, error) {
+	op := operation{client: client}
+	err := tx.QueryRow(getNextOperationSql(r.kind)).Scan(&op.id)
+	return op, err
+}
+
+// Appends a history entry for each id whose state differs between before
+// & after. Added items won't be in before, & deleted ones won't be in after.
+func (r *Repo) recordHistory(tx *sql.Tx, op operation, action godoo.HistoryAction, ids []int, before, after map[int]godoo.TodoItem) error {
+	at := time.Now().UTC().Format(time.RFC3339)
+
+	for _, id := range ids {
+		b, err := marshalSnapshot(before, id)
+		if err != nil {
+			return err
+		}
+		a, err := marshalSnapshot(after, id)
+		if err != nil {
+			return err
+		}
+		if a == b {
+			continue // matched but not actually changed
+		}
+
+		if _, err = tx.Exec(getHistoryInsertSql(r.kind), id, string(action), b, a, op.client, at, op.id, op.undoes); err != nil {
+			return err
+		}
+		if action == godoo.Updated {
+			if _, err = tx.Exec(getVersionBumpSql(r.kind), id); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// Returns the json for the item with id in mp, or an empty string if it isn't there.
+// Versions are left out, as they change whenever anything else does.
+func marshalSnapshot(mp map[int]godoo.TodoItem, id int) (string, error) {
+	itm, exists := mp[id]
+	if !exists {
+		return "", nil
+	}
+	itm.Version = 0
+	b, err := json.Marshal(itm)
+	return string(b), err
+}
+
+func unmarshalSnapshot(s string) (*godoo.TodoItem, error) {
+	if s == "" {
+		return nil, nil
+	}
+	var itm godoo.TodoItem
+	if err := json.Unmarshal([]byte(s), &itm); err != nil {
+		return nil, err
+	}
+	return &itm, nil
+}
@@ -0,0 +1,302 @@
+package sqlite
+
+import (
+	"reflect"
+	"testing"
+
+	godoo "github.com/mundacity/go-doo"
+)
+
+type history_test_case struct {
+	id         int
+	edits      []godoo.FullUserQuery // run in order against item id
+	delete     bool
+	expActions []godoo.HistoryAction
+	name       string
+}
+
+func byId(id int) godoo.FullUserQuery {
+	return godoo.FullUserQuery{QueryOptions: []godoo.UserQueryOption{{Elem: godoo.ById}}, QueryData: godoo.TodoItem{Id: id}}
+}
+
+func getHistoryTestCases() []history_test_case {
+	newBody := godoo.FullUserQuery{QueryOptions: []godoo.UserQueryOption{{Elem: godoo.ByBody}, {Elem: godoo.ByReplacement}}, QueryData: godoo.TodoItem{Body: "first, reworded"}}
+	newTag := godoo.FullUserQuery{QueryOptions: []godoo.UserQueryOption{{Elem: godoo.ByTag}}, QueryData: godoo.TodoItem{Tags: map[string]struct{}{"urgent": {}}}}
+
+	return []history_test_case{{
+		id:         1,
+		expActions: []godoo.HistoryAction{godoo.Added},
+		name:       "added",
+	}, {
+		id:         1,
+		edits:      []godoo.FullUserQuery{newBody, newTag},
+		expActions: []godoo.HistoryAction{godoo.Added, godoo.Updated, godoo.Updated},
+		name:       "body & tag edits",
+	}, {
+		id:         1,
+		edits:      []godoo.FullUserQuery{setComplete(true), setComplete(true)},
+		expActions: []godoo.HistoryAction{godoo.Added, godoo.Updated},
+		name:       "edit that changes nothing isn't recorded",
+	}, {
+		id:         2,
+		edits:      []godoo.FullUserQuery{newBody},
+		delete:     true,
+		expActions: []godoo.HistoryAction{godoo.Added, godoo.Updated, godoo.Deleted},
+		name:       "deleted items keep their history",
+	}, {
+		id:   7,
+		name: "no such item",
+	}}
+}
+
+func TestHistory(t *testing.T) {
+	tcs := getHistoryTestCases()
+	for _, tc := range tcs {
+		t.Run(tc.name, func(t *testing.T) {
+			runHistoryTest(t, tc)
+		})
+	}
+}
+
+func runHistoryTest(t *testing.T, tc history_test_case) {
+	r := seedRepo(t)
+	cr := r.ForClient("alice@laptop")
+
+	for _, edt := range tc.edits {
+		if _, err := cr.UpdateWhere(byId(tc.id), edt); err != nil {
+			t.Fatalf(">>>>FAILED: %v", err)
+		}
+	}
+	if tc.delete {
+		if _, err := cr.DeleteWhere(byId(tc.id)); err != nil {
+			t.Fatalf(">>>>FAILED: %v", err)
+		}
+	}
+
+	entries, err := r.History(tc.id)
+	if err != nil {
+		t.Fatalf(">>>>FAILED: %v", err)
+	}
+	if len(entries) != len(tc.expActions) {
+		t.Fatalf(">>>>FAILED: expected %v entries, got %v", len(tc.expActions), len(entries))
+	}
+
+	for i, e := range entries {
+		if e.Action != tc.expActions[i] {
+			t.Errorf(">>>>FAILED: entry %v - expected '%v', got '%v'", i, tc.expActions[i], e.Action)
+		}
+		if (e.Before == nil) != (e.Action == godoo.Added) || (e.After == nil) != (e.Action == godoo.Deleted) {
+			t.Errorf(">>>>FAILED: entry %v - unexpected before/after state for %v", i, e.Action)
+		}
+		if i > 0 && e.Client != "alice@laptop" {
+			t.Errorf(">>>>FAILED: entry %v - expected change by 'alice@laptop', got '%v'", i, e.Client)
+		}
+	}
+}
+
+func TestHistorySnapshots(t *testing.T) {
+	r := seedRepo(t)
+	edt := godoo.FullUserQuery{QueryOptions: []godoo.UserQueryOption{{Elem: godoo.ByTag}, {Elem: godoo.ByReplacement}}, QueryData: godoo.TodoItem{Tags: map[string]struct{}{"backlog": {}}}}
+	if _, err := r.UpdateWhere(byId(1), edt); err != nil {
+		t.Fatalf(">>>>FAILED: %v", err)
+	}
+
+	entries, err := r.History(1)
+	if err != nil || len(entries) != 2 {
+		t.Fatalf(">>>>FAILED: expected 2 entries, got %v (err: %v)", len(entries), err)
+	}
+
+	before, after := entries[1].Before, entries[1].After
+	if _, ok := before.Tags["work"]; !ok || len(before.Tags) != 2 {
+		t.Errorf(">>>>FAILED: expected original tags before the edit, got %v", before.Tags)
+	}
+	if _, ok := after.Tags["backlog"]; !ok || len(after.Tags) != 1 {
+		t.Errorf(">>>>FAILED: expected replaced tags after the edit, got %v", after.Tags)
+	}
+	if before.Body != "first" || after.Body != "first" {
+		t.Errorf(">>>>FAILED: body shouldn't have changed")
+	}
+}
+
+func TestRecurringSpawnIsRecorded(t *testing.T) {
+	r := getInMemDb()
+	itm := godoo.TodoItem{Body: "standup", Recurrence: "1d", CreationDate: parseDate("2022-06-01")}
+	id, _ := r.Add(&itm)
+
+	if _, err := r.UpdateWhere(byId(int(id)), setComplete(true)); err != nil {
+		t.Fatalf(">>>>FAILED: %v", err)
+	}
+
+	entries, err := r.History(int(id) + 1)
+	if err != nil || len(entries) != 1 || entries[0].Action != godoo.Added {
+		t.Errorf(">>>>FAILED: expected spawned item to have an add entry, got %v (err: %v)", entries, err)
+	}
+}
+
+func TestHistoryIsAppendOnly(t *testing.T) {
+	r := seedRepo(t)
+
+	if _, err := r.db.Exec("update item_history set client = 'mallory'"); err == nil {
+		t.Errorf(">>>>FAILED: history rows shouldn't be editable")
+	}
+	if _, err := r.db.Exec("delete from item_history"); err == nil {
+		t.Errorf(">>>>FAILED: history rows shouldn't be deletable")
+	}
+}
+
+func TestPreviewUpdate(t *testing.T) {
+	r := seedRepo(t)
+	if _, err := r.UpdateWhere(byId(3), setComplete(true)); err != nil {
+		t.Fatalf(">>>>FAILED: %v", err)
+	}
+
+	p, err := r.ForClient("alice@laptop").(godoo.IPreviewer).PreviewUpdate(byTag("work"), setComplete(true))
+	if err != nil {
+		t.Fatalf(">>>>FAILED: %v", err)
+	}
+	if p.Matched != 2 || len(p.Changes) != 1 {
+		t.Fatalf(">>>>FAILED: expected 2 matched & 1 change, got %v & %v", p.Matched, len(p.Changes))
+	}
+	e := p.Changes[0]
+	if e.ItemId != 1 || e.Before.IsComplete || !e.After.IsComplete || e.Client != "alice@laptop" {
+		t.Errorf(">>>>FAILED: unexpected change %+v", e)
+	}
+
+	itms, _ := r.GetWhere(byId(1))
+	if len(itms) != 1 || itms[0].IsComplete {
+		t.Errorf(">>>>FAILED: preview shouldn't change the item")
+	}
+	entries, _ := r.History(1)
+	if len(entries) != 1 {
+		t.Errorf(">>>>FAILED: preview shouldn't be recorded, got %v entries", len(entries))
+	}
+}
+
+func TestCountWhere(t *testing.T) {
+	r := seedRepo(t)
+	byBody := godoo.FullUserQuery{QueryOptions: []godoo.UserQueryOption{{Elem: godoo.ByBody}}, QueryData: godoo.TodoItem{Body: "first"}}
+
+	for _, qry := range []godoo.FullUserQuery{byBody, byTag("work"), byTag("nothing")} {
+		p, err := r.PreviewUpdate(qry, setComplete(true))
+		if err != nil {
+			t.Fatalf(">>>>FAILED: %v", err)
+		}
+		n, err := r.CountWhere(qry)
+		if err != nil || n != p.Matched {
+			t.Errorf(">>>>FAILED: expected %v, as matched by the preview, got %v (err: %v)", p.Matched, n, err)
+		}
+	}
+
+	if _, err := r.CountWhere(godoo.FullUserQuery{}); err == nil {
+		t.Errorf(">>>>FAILED: expected NoQueryOptionsError")
+	}
+}
+
+func TestItemVersions(t *testing.T) {
+	r := seedRepo(t)
+	version := func() int {
+		itms, err := r.GetWhere(byId(1))
+		if err != nil || len(itms) != 1 {
+			t.Fatalf(">>>>FAILED: couldn't get item: %v", err)
+		}
+		return itms[0].Version
+	}
+
+	steps := []struct {
+		run func() error
+		exp int
+	}{
+		{func() error { return nil }, 1},
+		{func() error { _, err := r.UpdateWhere(byId(1), replaceBody("first, reworded")); return err }, 2},
+		{func() error { _, err := r.UpdateWhere(byId(1), replaceBody("first, reworded")); return err }, 2}, // nothing changed
+		{func() error { _, err := r.UpdateWhere(byTag("dev"), setComplete(true)); return err }, 3},
+		{func() error { _, err := r.Undo(); return err }, 4},
+	}
+	for i, s := range steps {
+		if err := s.run(); err != nil {
+			t.Fatalf(">>>>FAILED: step %v: %v", i, err)
+		}
+		if v := version(); v != s.exp {
+			t.Errorf(">>>>FAILED: step %v: expected version %v, got %v", i, s.exp, v)
+		}
+	}
+}
+
+type conditional_update_test_case struct {
+	meanwhile    func(r *Repo) error // someone else's change after the items were read
+	expConflicts []godoo.VersionConflict
+	name         string
+}
+
+func getConditionalUpdateTestCases() []conditional_update_test_case {
+	return []conditional_update_test_case{{
+		name: "unchanged",
+	}, {
+		meanwhile: func(r *Repo) error {
+			_, err := r.UpdateWhere(byId(3), replaceBody("third, reworded"))
+			return err
+		},
+		expConflicts: []godoo.VersionConflict{{ItemId: 3, Expected: 1, Current: 2}},
+		name:         "changed",
+	}, {
+		meanwhile: func(r *Repo) error {
+			_, err := r.DeleteWhere(byId(3))
+			return err
+		},
+		expConflicts: []godoo.VersionConflict{{ItemId: 3, Expected: 1}},
+		name:         "deleted",
+	}, {
+		meanwhile: func(r *Repo) error {
+			_, err := r.UpdateWhere(byId(2), byTag("work"))
+			return err
+		},
+		expConflicts: []godoo.VersionConflict{{ItemId: 2, Current: 2}},
+		name:         "newly matched",
+	}, {
+		meanwhile: func(r *Repo) error {
+			_, err := r.UpdateWhere(byId(2), replaceBody("second, reworded"))
+			return err
+		},
+		name: "other items changing doesn't matter",
+	}}
+}
+
+func TestUpdateIfUnchanged(t *testing.T) {
+	tcs := getConditionalUpdateTestCases()
+	for _, tc := range tcs {
+		t.Run(tc.name, func(t *testing.T) {
+			runConditionalUpdateTest(t, tc)
+		})
+	}
+}
+
+func runConditionalUpdateTest(t *testing.T, tc conditional_update_test_case) {
+	r := seedRepo(t)
+
+	read, err := r.GetWhere(byTag("work"))
+	mustRun(t, err)
+	if tc.meanwhile != nil {
+		mustRun(t, tc.meanwhile(r))
+	}
+
+	n, err := r.UpdateIfUnchanged(byTag("work"), replaceBody("edited"), godoo.GetVersions(read))
+
+	if tc.expConflicts == nil {
+		if err != nil || n != 2 {
+			t.Errorf(">>>>FAILED: expected 2 items edited, got %v (err: %v)", n, err)
+		}
+		return
+	}
+
+	ce, ok := err.(*godoo.VersionConflictError)
+	if !ok || !reflect.DeepEqual(ce.Conflicts, tc.expConflicts) {
+		t.Errorf(">>>>FAILED: expected conflicts %v, got '%v'", tc.expConflicts, err)
+	}
+	itms, _ := r.GetAll()
+	for _, itm := range itms {
+		if itm.Body == "edited" {
+			t.Errorf(">>>>FAILED: expected nothing edited, but item %v was", itm.Id)
+		}
+	}
+	t.Logf(">>>>PASSED: %v", err)
+}
@@ -0,0 +1,306 @@
+package sqlite
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"time"
+
+	godoo "github.com/mundacity/go-doo"
+)
+
+// A single, ordered change to the db schema. Once released, a
+// migration must never be edited - add a new one instead.
+type migration struct {
+	version     int
+	description string
+	stmts       []string
+	requires    string // compile option sqlite must have been built with, if any
+}
+
+// Every schema change, in the order it needs to be applied. The initial
+// schema uses 'if not exists' so dbs created before versioning was
+// introduced can be brought under version control without changes.
+var migrations = []migration{{
+	version:     1,
+	description: "create items and tags tables",
+	stmts: []string{
+		"create table if not exists items (id integer primary key autoincrement, " +
+			"parentId integer, " +
+			"creationDate text not null, " +
+			"deadline text not null, " +
+			"body text not null, " +
+			"isComplete boolean default false not null, " +
+			"priority integer default 0 not null);",
+		"create table if not exists tags (id integer primary key autoincrement, " +
+			"itemId integer, " +
+			"tag text not null);",
+	},
+}, {
+	version:     2,
+	description: "index tags by item id",
+	stmts: []string{
+		"create index if not exists idx_tags_itemId on tags (itemId);",
+	},
+}, {
+	version:     3,
+	description: "full-text index over item bodies & tags",
+	requires:    "ENABLE_FTS5",
+	stmts: []string{
+		"create virtual table if not exists items_fts using fts5(itmBody, itmTags);",
+		"insert into items_fts (rowid, itmBody, itmTags) " +
+			"select i.id, i.body, ifnull((select group_concat(tag, ' ') from tags where itemId = i.id), '') from items i;",
+		"create trigger if not exists items_fts_ai after insert on items begin " +
+			"insert into items_fts (rowid, itmBody, itmTags) values (new.id, new.body, ''); end;",
+		"create trigger if not exists items_fts_au after update of body on items begin " +
+			"update items_fts set itmBody = new.body where rowid = new.id; end;",
+		"create trigger if not exists items_fts_ad after delete on items begin " +
+			"delete from items_fts where rowid = old.id; end;",
+		"create trigger if not exists tags_fts_ai after insert on tags begin " +
+			"update items_fts set itmTags = (select group_concat(tag, ' ') from tags where itemId = new.itemId) where rowid = new.itemId; end;",
+		"create trigger if not exists tags_fts_ad after delete on tags begin " +
+			"update items_fts set itmTags = ifnull((select group_concat(tag, ' ') from tags where itemId = old.itemId), '') where rowid = old.itemId; end;",
+		"create trigger if not exists tags_fts_au after update on tags begin " +
+			"update items_fts set itmTags = ifnull((select group_concat(tag, ' ') from tags where itemId = old.itemId), '') where rowid = old.itemId; " +
+			"update items_fts set itmTags = ifnull((select group_concat(tag, ' ') from tags where itemId = new.itemId), '') where rowid = new.itemId; end;",
+	},
+}, {
+	version:     4,
+	description: "add recurrence rule to items",
+	stmts: []string{
+		"alter table items add column recurrence text default '' not null;",
+	},
+}, {
+	version:     5,
+	description: "record completion times & history",
+	stmts: []string{
+		"alter table items add column completedAt text default '' not null;",
+		"create table if not exists completion_events (id integer primary key autoincrement, " +
+			"itemId integer not null, " +
+			"isComplete boolean not null, " +
+			"occurredAt text not null);",
+		"create index if not exists idx_completion_events_itemId on completion_events (itemId);",
+		"create trigger if not exists completion_events_no_update before update on completion_events begin " +
+			"select raise(abort, 'completion_events is append-only'); end;",
+		"create trigger if not exists completion_events_no_delete before delete on completion_events begin " +
+			"select raise(abort, 'completion_events is append-only'); end;",
+	},
+}, {
+	version:     6,
+	description: "record every change made to items",
+	stmts: []string{
+		"create table if not exists item_history (id integer primary key autoincrement, " +
+			"itemId integer not null, " +
+			"action text not null, " +
+			"beforeJson text default '' not null, " +
+			"afterJson text default '' not null, " +
+			"client text not null, " +
+			"occurredAt text not null);",
+		"create index if not exists idx_item_history_itemId on item_history (itemId);",
+		"create trigger if not exists item_history_no_update before update on item_history begin " +
+			"select raise(abort, 'item_history is append-only'); end;",
+		"create trigger if not exists item_history_no_delete before delete on item_history begin " +
+			"select raise(abort, 'item_history is append-only'); end;",
+	},
+}, {
+	version:     7,
+	description: "group history entries by operation so they can be undone",
+	stmts: []string{
+		"alter table item_history add column operation integer default 0 not null;",
+		"alter table item_history add column undoes integer default 0 not null;",
+		// existing entries each become their own operation
+		"drop trigger if exists item_history_no_update;",
+		"update item_history set operation = id;",
+		"create trigger if not exists item_history_no_update before update on item_history begin " +
+			"select raise(abort, 'item_history is append-only'); end;",
+		"create index if not exists idx_item_history_client_operation on item_history (client, operation);",
+	},
+}, {
+	version:     8,
+	description: "version items so conflicting changes can be spotted",
+	stmts: []string{
+		"alter table items add column version integer default 1 not null;",
+	},
+}, {
+	version:     9,
+	description: "add auth tokens & item owners, so a server can keep each user's items private",
+	stmts: []string{
+		"create table if not exists tokens (" +
+			"id integer primary key autoincrement, " +
+			"owner text not null, " +
+			"tokenHash text not null unique, " +
+			"createdAt text not null, " +
+			"revokedAt text default '' not null);",
+		"alter table items add column owner text default '' not null;",
+		// everything added before now stays visible to everyone
+		"alter table items add column visibility text default 'shared' not null;",
+		"create index if not exists idx_items_owner on items (owner);",
+	},
+}}
+
+const schemaVersionSql = "create table if not exists schema_version (" +
+	"version integer primary key, " +
+	"description text not null, " +
+	"appliedAt text not null);"
+
+// Applies any pending migrations in a single transaction. Returns the number applied.
+// Migrations needing features this build of sqlite lacks stay pending.
+func (r *Repo) Migrate() (int, error) {
+	r.Mtx.Lock()
+	defer r.Mtx.Unlock()
+
+	n, err := migrate(r.db)
+	if err != nil {
+		return n, err
+	}
+
+	r.fts, err = hasFullText(r.db)
+	return n, err
+}
+
+// Reports every known migration and whether it has been applied to the db
+func (r *Repo) MigrationStatus() ([]godoo.MigrationInfo, error) {
+	r.Mtx.Lock()
+	defer r.Mtx.Unlock()
+
+	applied, err := getAppliedVersions(r.db)
+	if err != nil {
+		return nil, err
+	}
+
+	var ret []godoo.MigrationInfo
+	for _, m := range migrations {
+		info := godoo.MigrationInfo{Version: m.version, Description: m.description}
+		info.AppliedAt, info.Applied = applied[m.version]
+		ret = append(ret, info)
+	}
+	return ret, nil
+}
+
+func migrate(db *sql.DB) (int, error) {
+	tx, err := db.BeginTx(context.Background(), nil)
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	if _, err = tx.Exec(schemaVersionSql); err != nil {
+		return 0, err
+	}
+
+	applied, err := getAppliedVersions(tx)
+	if err != nil {
+		return 0, err
+	}
+
+	n := 0
+	for _, m := range migrations {
+		if _, done := applied[m.version]; done {
+			continue
+		}
+		if m.requires != "" {
+			var supported bool
+			if err = tx.QueryRow("select sqlite_compileoption_used(?)", m.requires).Scan(&supported); err != nil {
+				return 0, err
+			}
+			if !supported {
+				continue
+			}
+		}
+		for _, stmt := range m.stmts {
+			if _, err = tx.Exec(stmt); err != nil {
+				return 0, &MigrationError{Version: m.version, Err: err}
+			}
+		}
+
+		_, err = tx.Exec("insert into schema_version (version, description, appliedAt) values (?, ?, ?)",
+			m.version, m.description, time.Now().UTC().Format(time.RFC3339))
+		if err != nil {
+			return 0, err
+		}
+		n++
+	}
+
+	if err = tx.Commit(); err != nil {
+		return 0, err
+	}
+	return n, nil
+}
+
+// Satisfied by both *sql.DB and *sql.Tx
+type querier interface {
+	Query(query string, args ...any) (*sql.Rows, error)
+	QueryRow(query string, args ...any) *sql.Row
+}
+
+func tableExists(db querier, name string) (bool, error) {
+	var exists bool
+	err := db.QueryRow("select exists (select 1 from sqlite_master where type = 'table' and name = ?)", name).Scan(&exists)
+	return exists, err
+}
+
+// Reports whether the db has a full-text index. Once it does, writes
+// to items go through its triggers, so a build without FTS5 can't use it.
+func hasFullText(db querier) (bool, error) {
+	exists, err := tableExists(db, "items_fts")
+	if err != nil || !exists {
+		return false, err
+	}
+
+	var supported bool
+	if err = db.QueryRow("select sqlite_compileoption_used('ENABLE_FTS5')").Scan(&supported); err != nil {
+		return false, err
+	}
+	if !supported {
+		return false, &FullTextBuildError{}
+	}
+	return true, nil
+}
+
+// Returns a map of applied version numbers to when they were applied
+func getAppliedVersions(db querier) (map[int]string, error) {
+	ret := make(map[int]string)
+
+	exists, err := tableExists(db, "schema_version")
+	if err != nil || !exists {
+		return ret, err
+	}
+
+	rows, err := db.Query("select version, appliedAt from schema_version")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var v int
+		var at string
+		if err := rows.Scan(&v, &at); err != nil {
+			return nil, err
+		}
+		ret[v] = at
+	}
+	return ret, rows.Err()
+}
+
+// Returned when one of a migration's statements fails;
+// none of the pending migrations will have been applied
+type MigrationError struct {
+	Version int
+	Err     error
+}
+
+func (m *MigrationError) Error() string {
+	return fmt.Sprintf("migration %v failed: %v", m.Version, m.Err)
+}
+
+func (m *MigrationError) Unwrap() error {
+	return m.Err
+}
+
+// Returned when the db has a full-text index but this build can't write to it
+type FullTextBuildError struct{}
+
+func (f *FullTextBuildError) Error() string {
+	return "the db has a full-text search index, but this build doesn't support FTS5; rebuild with -tags sqlite_fts5"
+}
@@ -0,0 +1,196 @@
+package sqlite
+
+import (
+	"database/sql"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	godoo "github.com/mundacity/go-doo"
+)
+
+type migration_test_case struct {
+	legacy bool // tables created before versioning was introduced
+	name   string
+}
+
+func getMigrationTestCases() []migration_test_case {
+	return []migration_test_case{{
+		name: "fresh db",
+	}, {
+		legacy: true,
+		name:   "legacy db adopted",
+	}}
+}
+
+// Migrations this build of sqlite can apply
+func getSupportedVersions(t *testing.T, db *sql.DB) map[int]bool {
+	ret := make(map[int]bool)
+	for _, m := range migrations {
+		supported := true
+		if m.requires != "" {
+			if err := db.QueryRow("select sqlite_compileoption_used(?)", m.requires).Scan(&supported); err != nil {
+				t.Fatalf(">>>>FAILED: couldn't check compile options: %v", err)
+			}
+		}
+		ret[m.version] = supported
+	}
+	return ret
+}
+
+func TestMigrate(t *testing.T) {
+	tcs := getMigrationTestCases()
+	for _, tc := range tcs {
+		t.Run(tc.name, func(t *testing.T) {
+			runMigrationTest(t, tc)
+		})
+	}
+}
+
+func runMigrationTest(t *testing.T, tc migration_test_case) {
+	path := filepath.Join(t.TempDir(), "test.db")
+	var err error
+
+	if tc.legacy {
+		db, _ := sql.Open("sqlite3", path)
+		_, err = db.Exec(migrations[0].stmts[0] + migrations[0].stmts[1] +
+			"insert into items (parentId, creationDate, deadline, body) values (0, '2022-01-01', '', 'old item');")
+		db.Close()
+		if err != nil {
+			t.Fatalf(">>>>FAILED: couldn't create legacy db: %v", err)
+		}
+	}
+
+	r, err := OpenRepo(path, godoo.Sqlite, "2006-01-02", 0)
+	if err != nil {
+		t.Fatalf(">>>>FAILED: couldn't open db: %v", err)
+	}
+	defer r.db.Close()
+
+	infos, err := r.MigrationStatus()
+	if err != nil || len(infos) != len(migrations) || infos[0].Applied {
+		t.Fatalf(">>>>FAILED: expected all migrations pending, got %+v (err: %v)", infos, err)
+	}
+
+	supported := getSupportedVersions(t, r.db)
+	exp := 0
+	for _, ok := range supported {
+		if ok {
+			exp++
+		}
+	}
+
+	n, err := r.Migrate()
+	if err != nil || n != exp {
+		t.Fatalf(">>>>FAILED: expected %v migrations applied, got %v (err: %v)", exp, n, err)
+	}
+
+	n, err = r.Migrate()
+	if err != nil || n != 0 {
+		t.Errorf(">>>>FAILED: second run should apply nothing, got %v (err: %v)", n, err)
+	}
+
+	infos, _ = r.MigrationStatus()
+	for _, info := range infos {
+		if info.Applied != supported[info.Version] || info.Applied != (info.AppliedAt != "") {
+			t.Errorf(">>>>FAILED: migration %v applied = %v, expected %v", info.Version, info.Applied, supported[info.Version])
+		}
+	}
+
+	if tc.legacy {
+		itms, err := r.GetAll()
+		if err != nil || len(itms) != 1 {
+			t.Errorf(">>>>FAILED: legacy data lost - got %v items (err: %v)", len(itms), err)
+			return
+		}
+	}
+	t.Logf(">>>>PASSED: %v", tc.name)
+}
+
+type setup_test_case struct {
+	path     func(dir string) string
+	existing string // sql run against the db before setting up the repo
+	expErr   error
+	name     string
+}
+
+func getSetupTestCases() []setup_test_case {
+	return []setup_test_case{{
+		path:   func(dir string) string { return filepath.Join(dir, "test.db") },
+		expErr: nil,
+		name:   "new db",
+	}, {
+		path:   func(dir string) string { return filepath.Join(dir, "missing", "test.db") },
+		expErr: &ConnectionError{},
+		name:   "directory doesn't exist",
+	}, {
+		path:     func(dir string) string { return filepath.Join(dir, "test.db") },
+		existing: "create table items (id integer primary key, body text not null);",
+		expErr:   &SchemaError{},
+		name:     "items table missing columns",
+	}}
+}
+
+func TestSetupRepo(t *testing.T) {
+	tcs := getSetupTestCases()
+	for _, tc := range tcs {
+		t.Run(tc.name, func(t *testing.T) {
+			runSetupTest(t, tc)
+		})
+	}
+}
+
+func runSetupTest(t *testing.T, tc setup_test_case) {
+	path := tc.path(t.TempDir())
+
+	if tc.existing != "" {
+		db, _ := sql.Open("sqlite3", path)
+		_, err := db.Exec(tc.existing)
+		db.Close()
+		if err != nil {
+			t.Fatalf(">>>>FAILED: couldn't prepare db: %v", err)
+		}
+	}
+
+	r, err := SetupRepo(path, godoo.Sqlite, "2006-01-02", 0)
+	if r != nil {
+		defer r.db.Close()
+	}
+
+	if reflect.TypeOf(err) != reflect.TypeOf(tc.expErr) {
+		t.Errorf(">>>>FAILED: expected error of type %T, got '%v'", tc.expErr, err)
+		return
+	}
+	if (r == nil) != (tc.expErr != nil) {
+		t.Errorf(">>>>FAILED: repo returned alongside error '%v'", err)
+		return
+	}
+	t.Logf(">>>>PASSED: %v", err)
+}
+
+func TestFullTextBuildMismatch(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "test.db")
+
+	db, _ := sql.Open("sqlite3", path)
+	var supported bool
+	if err := db.QueryRow("select sqlite_compileoption_used('ENABLE_FTS5')").Scan(&supported); err != nil {
+		t.Fatalf(">>>>FAILED: couldn't check compile options: %v", err)
+	}
+	if supported {
+		db.Close()
+		t.Skip("built with FTS5")
+	}
+	// stands in for the index a build with FTS5 would have created
+	_, err := db.Exec("create table items_fts (itmBody, itmTags);")
+	db.Close()
+	if err != nil {
+		t.Fatalf(">>>>FAILED: couldn't prepare db: %v", err)
+	}
+
+	r, err := SetupRepo(path, godoo.Sqlite, "2006-01-02", 0)
+	if _, ok := err.(*FullTextBuildError); !ok || r != nil {
+		t.Errorf(">>>>FAILED: expected FullTextBuildError, got '%v'", err)
+		return
+	}
+	t.Logf(">>>>PASSED: %v", err)
+}
@@ -0,0 +1,142 @@
+package sqlite
+
+import (
+	"context"
+	"encoding/json"
+	"time"
+
+	godoo "github.com/mundacity/go-doo"
+)
+
+// Outbox implements IOutbox. Cached items are kept in the usual tables,
+// so they can be queried like any others, & queued changes in their own.
+type Outbox struct {
+	*Repo
+}
+
+// Opens the outbox db at path, creating it if necessary
+func OpenOutbox(path, dateLayout string) (*Outbox, error) {
+	r, err := SetupRepo(path, godoo.Sqlite, dateLayout, 0)
+	if err != nil {
+		return nil, err
+	}
+
+	if _, err = r.db.Exec(getOutboxTableSql(r.kind)); err != nil {
+		r.db.Close()
+		return nil, err
+	}
+	return &Outbox{Repo: r}, nil
+}
+
+func (o *Outbox) Queue(e godoo.OutboxEntry) (int, error) {
+	o.Mtx.Lock()
+	defer o.Mtx.Unlock()
+
+	b, err := json.Marshal(e)
+	if err != nil {
+		return 0, err
+	}
+
+	queuedAt := e.QueuedAt.UTC().Format(time.RFC3339)
+	if e.Id > 0 {
+		// an entry being put back keeps its place in the queue
+		_, err = o.db.Exec(getOutboxRequeueSql(o.kind), e.Id, string(b), queuedAt)
+		return e.Id, err
+	}
+
+	res, err := o.db.Exec(getOutboxInsertSql(o.kind), string(b), queuedAt)
+	if err != nil {
+		return 0, err
+	}
+	id, err := res.LastInsertId()
+	return int(id), err
+}
+
+func (o *Outbox) Queued() ([]godoo.OutboxEntry, error) {
+	o.Mtx.Lock()
+	defer o.Mtx.Unlock()
+
+	rows, err := o.db.Query(getOutboxSelectSql(o.kind))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var ret []godoo.OutboxEntry
+	for rows.Next() {
+		var id int
+		var s string
+		if err = rows.Scan(&id, &s); err != nil {
+			return nil, err
+		}
+
+		var e godoo.OutboxEntry
+		if err = json.Unmarshal([]byte(s), &e); err != nil {
+			return nil, err
+		}
+		e.Id = id
+		ret = append(ret, e)
+	}
+	return ret, rows.Err()
+}
+
+func (o *Outbox) Update(e godoo.OutboxEntry) error {
+	o.Mtx.Lock()
+	defer o.Mtx.Unlock()
+
+	b, err := json.Marshal(e)
+	if err != nil {
+		return err
+	}
+
+	_, err = o.db.Exec(getOutboxUpdateSql(o.kind), string(b), e.Id)
+	return err
+}
+
+func (o *Outbox) Remove(id int) error {
+	o.Mtx.Lock()
+	defer o.Mtx.Unlock()
+
+	_, err := o.db.Exec(getOutboxDeleteSql(o.kind), id)
+	return err
+}
+
+// Saves copies of items pulled from the server, keeping their ids &
+// versions. Nothing is recorded in the history, as the changes were
+// made on the server.
+func (o *Outbox) CacheItems(itms []godoo.TodoItem, replaceAll bool) error {
+	o.Mtx.Lock()
+	defer o.Mtx.Unlock()
+
+	tx, err := o.db.BeginTx(context.Background(), nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if replaceAll {
+		for _, stmt := range getClearCacheSql(o.kind) {
+			if _, err = tx.Exec(stmt); err != nil {
+				return err
+			}
+		}
+	}
+
+	for _, itm := range itms {
+		if _, err = tx.Exec(getSql(godoo.Delete, o.kind, tags), itm.Id); err != nil {
+			return err
+		}
+		if _, err = tx.Exec(getSql(godoo.Delete, o.kind, items), itm.Id); err != nil {
+			return err
+		}
+
+		vals := append([]any{itm.Id}, getRestoreVals(itm)...)
+		if _, err = tx.Exec(getCacheInsertSql(o.kind), append(vals, itm.Version)...); err != nil {
+			return err
+		}
+		if err = o.restoreTags(tx, itm); err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
@@ -0,0 +1,125 @@
+package sqlite
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+
+	godoo "github.com/mundacity/go-doo"
+)
+
+func getOutbox(t *testing.T) *Outbox {
+	o, err := OpenOutbox(filepath.Join(t.TempDir(), "outbox.db"), "2006-01-02")
+	if err != nil {
+		t.Fatalf("couldn't open outbox: %v", err)
+	}
+	t.Cleanup(func() { o.db.Close() })
+	return o
+}
+
+func TestOutboxQueue(t *testing.T) {
+	o := getOutbox(t)
+	at := time.Date(2022, 6, 1, 9, 30, 0, 0, time.UTC)
+	srch, edt := byId(4), replaceBody("reworded")
+
+	entries := []godoo.OutboxEntry{
+		{Action: godoo.Added, Item: &godoo.TodoItem{Body: "written offline", CreationDate: parseDate("2022-06-01")}, QueuedAt: at},
+		{Action: godoo.Updated, Search: &srch, Edit: &edt, Versions: map[int]int{4: 2}, QueuedAt: at},
+	}
+	for _, e := range entries {
+		if _, err := o.Queue(e); err != nil {
+			t.Fatalf(">>>>FAILED: %v", err)
+		}
+	}
+
+	got, err := o.Queued()
+	if err != nil || len(got) != 2 {
+		t.Fatalf(">>>>FAILED: expected 2 entries, got %v (err: %v)", len(got), err)
+	}
+	if got[0].Item.Body != "written offline" || got[1].Edit.QueryData.Body != "reworded" || got[1].Versions[4] != 2 || !got[1].QueuedAt.Equal(at) {
+		t.Errorf(">>>>FAILED: entries not kept as queued: %+v", got)
+	}
+
+	got[1].Versions = map[int]int{4: 3}
+	if err = o.Update(got[1]); err != nil {
+		t.Fatalf(">>>>FAILED: %v", err)
+	}
+	if got, _ = o.Queued(); len(got) != 2 || got[1].Versions[4] != 3 || got[1].Edit.QueryData.Body != "reworded" {
+		t.Errorf(">>>>FAILED: entry not updated: %+v", got)
+	}
+
+	if err = o.Remove(got[0].Id); err != nil {
+		t.Fatalf(">>>>FAILED: %v", err)
+	}
+	if got, _ = o.Queued(); len(got) != 1 || got[0].Action != godoo.Updated {
+		t.Errorf(">>>>FAILED: expected only the edit left, got %+v", got)
+	}
+}
+
+type item_cache_test_case struct {
+	pulls   [][]godoo.TodoItem
+	replace []bool // whether each pull replaces the whole cache
+	expIds  []int  // tagged 'work'
+	name    string
+}
+
+func getItemCacheTestCases() []item_cache_test_case {
+	work := map[string]struct{}{"work": {}}
+	first := []godoo.TodoItem{
+		{Id: 4, Body: "plan sprint", Version: 3, Tags: work},
+		{Id: 9, Body: "write report", Version: 1, Tags: work},
+	}
+	return []item_cache_test_case{{
+		pulls:   [][]godoo.TodoItem{first},
+		replace: []bool{true},
+		expIds:  []int{4, 9},
+		name:    "ids & versions kept",
+	}, {
+		pulls:   [][]godoo.TodoItem{first, {{Id: 9, Body: "write report", Version: 2, Tags: map[string]struct{}{"home": {}}}}},
+		replace: []bool{true, false},
+		expIds:  []int{4},
+		name:    "partial pulls update what they return",
+	}, {
+		pulls:   [][]godoo.TodoItem{first, {{Id: 12, Body: "new", Version: 1, Tags: work}}},
+		replace: []bool{true, true},
+		expIds:  []int{12},
+		name:    "full pulls replace everything",
+	}}
+}
+
+func TestItemCache(t *testing.T) {
+	tcs := getItemCacheTestCases()
+	for _, tc := range tcs {
+		t.Run(tc.name, func(t *testing.T) {
+			runItemCacheTest(t, tc)
+		})
+	}
+}
+
+func runItemCacheTest(t *testing.T, tc item_cache_test_case) {
+	o := getOutbox(t)
+	for i, itms := range tc.pulls {
+		for j := range itms {
+			itms[j].CreationDate = parseDate("2022-06-01")
+		}
+		if err := o.CacheItems(itms, tc.replace[i]); err != nil {
+			t.Fatalf(">>>>FAILED: %v", err)
+		}
+	}
+
+	itms, err := o.GetWhere(byTag("work"))
+	if err != nil {
+		t.Fatalf(">>>>FAILED: %v", err)
+	}
+	var ids []int
+	for _, itm := range itms {
+		ids = append(ids, itm.Id)
+		if itm.Id == 4 && itm.Version != 3 {
+			t.Errorf(">>>>FAILED: expected version 3, got %v", itm.Version)
+		}
+	}
+	if len(ids) != len(tc.expIds) || (len(ids) > 0 && ids[0] != tc.expIds[0]) {
+		t.Errorf(">>>>FAILED: expected %v, got %v", tc.expIds, ids)
+	}
+	t.Logf(">>>>PASSED: %v", tc.name)
+}
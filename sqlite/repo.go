@@ -3,7 +3,10 @@ package sqlite
 import (
 	"context"
 	"database/sql"
+	"fmt"
 	"os"
+	"sort"
+	"strings"
 	"time"
 
 	_ "github.com/mattn/go-sqlite3"
@@ -11,30 +14,102 @@ import (
 	"github.com/mundacity/go-doo/util"
 )
 
-func SetupRepo(conn string, dbKind godoo.DbType, dateLayout string, port int) *Repo {
-	Db := setup(conn)
-	AppRepo = Repo{db: Db, dl: dateLayout, kind: dbKind, Port: port}
-	return &AppRepo
+// Opens the db at conn, creating it if necessary, applies any pending
+// migrations and then checks the schema is what the app expects
+func SetupRepo(conn string, dbKind godoo.DbType, dateLayout string, port int) (*Repo, error) {
+	r, err := OpenRepo(conn, dbKind, dateLayout, port)
+	if err != nil {
+		return nil, err
+	}
+
+	if _, err = r.Migrate(); err != nil {
+		r.db.Close()
+		return nil, err
+	}
+
+	if err = validateSchema(r.db); err != nil {
+		r.db.Close()
+		return nil, err
+	}
+	return r, nil
 }
 
-func setup(path string) *sql.DB {
-	var newDb bool
-	if _, err := os.Stat(path); err != nil {
-		newDb = true
-		os.Create(path)
+// Opens the db at conn, creating it if necessary, but leaves the schema as is.
+// Used when the user wants to check the migration status before upgrading.
+func OpenRepo(conn string, dbKind godoo.DbType, dateLayout string, port int) (*Repo, error) {
+	Db, err := setup(conn)
+	if err != nil {
+		return nil, err
 	}
+	return &Repo{db: Db, dl: dateLayout, kind: dbKind, Port: port, client: util.ClientName()}, nil
+}
 
-	return returnSqliteDb(path, newDb)
+// Creates the db file if it doesn't exist yet & makes sure it can be reached.
+// An empty path is a temporary db, so there's no file to create.
+func setup(path string) (*sql.DB, error) {
+	if path != "" {
+		if _, err := os.Stat(path); err != nil {
+			f, err := os.Create(path)
+			if err != nil {
+				return nil, &ConnectionError{Path: path, Err: err}
+			}
+			f.Close()
+		}
+	}
+
+	db, err := returnSqliteDb(path)
+	if err != nil {
+		return nil, &ConnectionError{Path: path, Err: err}
+	}
+	return db, nil
 }
 
-func (r *Repo) Add(itm *godoo.TodoItem) (int64, error) {
-	var d string
-	if itm.Deadline.IsZero() {
-		d = ""
-	} else {
-		d = util.StringFromDate(itm.Deadline)
+// Columns the app reads & writes, by table. Anything
+// missing means the db wasn't created or migrated by godoo.
+var requiredColumns = map[string][]string{
+	"items":             {"id", "parentId", "creationDate", "deadline", "body", "isComplete", "priority", "recurrence", "completedAt", "version", "owner", "visibility"},
+	"tags":              {"id", "itemId", "tag"},
+	"completion_events": {"id", "itemId", "isComplete", "occurredAt"},
+	"item_history":      {"id", "itemId", "action", "beforeJson", "afterJson", "client", "occurredAt", "operation", "undoes"},
+	"tokens":            {"id", "owner", "tokenHash", "createdAt", "revokedAt"},
+}
+
+// Checks every required table & column exists
+func validateSchema(db *sql.DB) error {
+	for tbl, cols := range requiredColumns {
+		rows, err := db.Query(fmt.Sprintf("select name from pragma_table_info('%v')", tbl))
+		if err != nil {
+			return err
+		}
+
+		found := make(map[string]bool)
+		for rows.Next() {
+			var name string
+			if err = rows.Scan(&name); err != nil {
+				rows.Close()
+				return err
+			}
+			found[name] = true
+		}
+		rows.Close()
+
+		if len(found) == 0 {
+			return &SchemaError{Table: tbl}
+		}
+		for _, c := range cols {
+			if !found[c] {
+				return &SchemaError{Table: tbl, Column: c}
+			}
+		}
 	}
+	return nil
+}
+
+func (r *Repo) Add(itm *godoo.TodoItem) (int64, error) {
+	return r.add(itm, r.client)
+}
 
+func (r *Repo) add(itm *godoo.TodoItem, client string) (int64, error) {
 	r.Mtx.Lock()
 	defer r.Mtx.Unlock()
 
@@ -44,9 +119,103 @@ func (r *Repo) Add(itm *godoo.TodoItem) (int64, error) {
 	}
 	defer tx.Rollback()
 
+	// brand new item so can't have descendants; only need to check the parent exists
+	if err = r.checkParent(tx, itm.ParentId, nil); err != nil {
+		return 0, err
+	}
+
+	id, err := r.insertItem(tx, itm)
+	if err != nil {
+		return 0, err
+	}
+	if itm.IsComplete {
+		// e.g. an imported item; keeps its completion time if it has one
+		if err = r.addCompleted(tx, id, itm.CompletedAt); err != nil {
+			return 0, err
+		}
+	}
+
+	op, err := r.newOperation(tx, client)
+	if err != nil {
+		return 0, err
+	}
+	if err = r.recordAdd(tx, id, op); err != nil {
+		return 0, err
+	}
+
+	if err = tx.Commit(); err != nil {
+		return 0, err
+	}
+
+	return id, nil
+}
+
+// Adds the items in one transaction, as a single operation so that one
+// undo removes them all. Nothing is added if any of them can't be.
+func (r *Repo) AddAll(itms []godoo.TodoItem, parents []int) ([]int64, error) {
+	r.Mtx.Lock()
+	defer r.Mtx.Unlock()
+
+	tx, err := r.db.BeginTx(context.Background(), nil)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	op, err := r.newOperation(tx, r.client)
+	if err != nil {
+		return nil, err
+	}
+
+	ids := make([]int64, 0, len(itms))
+	for i := range itms {
+		itm := godoo.SetBatchParent(itms[i], parents[i], ids)
+		if err = r.checkParent(tx, itm.ParentId, nil); err != nil {
+			return nil, err
+		}
+
+		id, err := r.insertItem(tx, &itm)
+		if err != nil {
+			return nil, err
+		}
+		if itm.IsComplete {
+			if err = r.addCompleted(tx, id, itm.CompletedAt); err != nil {
+				return nil, err
+			}
+		}
+		if err = r.recordAdd(tx, id, op); err != nil {
+			return nil, err
+		}
+		ids = append(ids, id)
+	}
+
+	if err = tx.Commit(); err != nil {
+		return nil, err
+	}
+	return ids, nil
+}
+
+// Records the newly inserted item with the id passed in its history
+func (r *Repo) recordAdd(tx *sql.Tx, id int64, op operation) error {
+	after, err := r.getSnapshots(tx, []int{int(id)})
+	if err != nil {
+		return err
+	}
+	return r.recordHistory(tx, op, godoo.Added, []int{int(id)}, nil, after)
+}
+
+// Inserts itm & its tags as part of tx
+func (r *Repo) insertItem(tx *sql.Tx, itm *godoo.TodoItem) (int64, error) {
+	var d string
+	if itm.Deadline.IsZero() {
+		d = ""
+	} else {
+		d = util.StringFromDate(itm.Deadline)
+	}
+
 	sql := getSql(godoo.Add, r.kind, items)
 
-	res, err := tx.Exec(sql, itm.ParentId, util.StringFromDate(itm.CreationDate), d, itm.Body, int(itm.Priority))
+	res, err := tx.Exec(sql, itm.ParentId, util.StringFromDate(itm.CreationDate), d, itm.Body, int(itm.Priority), itm.Recurrence, itm.Owner, string(getVisibility(itm.Visibility)))
 	if err != nil {
 		return 0, err
 	}
@@ -63,20 +232,29 @@ func (r *Repo) Add(itm *godoo.TodoItem) (int64, error) {
 			return 0, err
 		}
 	}
-
-	if err = tx.Commit(); err != nil {
-		return 0, err
-	}
-
 	return id, nil
 }
 
 func (r *Repo) UpdateWhere(srchQry, edtQry godoo.FullUserQuery) (int, error) {
+	return r.updateWhere(srchQry, edtQry, nil, r.client)
+}
 
-	itmSql := getSql(godoo.Update, r.kind, items)
-	//tagSql := "update tags set " // will need to do these separately
+// Edits the items matched as UpdateWhere does, unless any of them has changed
+// since it was read at the versions passed. A *VersionConflictError lists those
+// that have, & nothing is edited.
+func (r *Repo) UpdateIfUnchanged(srchQry, edtQry godoo.FullUserQuery, versions map[int]int) (int, error) {
+	if versions == nil {
+		versions = make(map[int]int) // nil means unconditional
+	}
+	return r.updateWhere(srchQry, edtQry, versions, r.client)
+}
 
-	itmSql, data := r.assembleUpdateData(itmSql, srchQry, edtQry)
+// Edits unconditionally if versions is nil
+func (r *Repo) updateWhere(srchQry, edtQry godoo.FullUserQuery, versions map[int]int, client string) (int, error) {
+
+	if !hasSearchCriteria(srchQry) {
+		return 0, &godoo.NoQueryOptionsError{}
+	}
 
 	r.Mtx.Lock()
 	defer r.Mtx.Unlock()
@@ -87,7 +265,13 @@ func (r *Repo) UpdateWhere(srchQry, edtQry godoo.FullUserQuery) (int, error) {
 	}
 	defer tx.Rollback()
 
-	res, err := tx.Exec(itmSql, data...)
+	if versions != nil {
+		if err = r.checkVersions(tx, srchQry, versions); err != nil {
+			return 0, err
+		}
+	}
+
+	n, _, err := r.update(tx, srchQry, edtQry, client)
 	if err != nil {
 		return 0, err
 	}
@@ -95,66 +279,641 @@ func (r *Repo) UpdateWhere(srchQry, edtQry godoo.FullUserQuery) (int, error) {
 	if err = tx.Commit(); err != nil {
 		return 0, err
 	}
+	return n, nil
+}
+
+// Counts the items srchQry matches, using the same conditions as an edit
+func (r *Repo) CountWhere(srchQry godoo.FullUserQuery) (int, error) {
+	if !hasSearchCriteria(srchQry) {
+		return 0, &godoo.NoQueryOptionsError{}
+	}
+
+	r.Mtx.Lock()
+	defer r.Mtx.Unlock()
+
+	var n int
+	countSql, vals := buildAndWhere(getWhereList(srchQry), getCountSelectSql(r.kind)+" where ")
+	err := r.db.QueryRow(countSql, vals...).Scan(&n)
+	return n, err
+}
+
+// Reports the items the edit would match & how each would change,
+// without changing anything
+func (r *Repo) PreviewUpdate(srchQry, edtQry godoo.FullUserQuery) (godoo.EditPreview, error) {
+	return r.previewUpdate(srchQry, edtQry, r.client)
+}
+
+// Runs the edit for real, so the preview can't differ from what the
+// edit would do, but never commits it
+func (r *Repo) previewUpdate(srchQry, edtQry godoo.FullUserQuery, client string) (godoo.EditPreview, error) {
+	var ret godoo.EditPreview
+
+	if !hasSearchCriteria(srchQry) {
+		return ret, &godoo.NoQueryOptionsError{}
+	}
 
-	rows, err := res.RowsAffected()
+	r.Mtx.Lock()
+	defer r.Mtx.Unlock()
+
+	tx, err := r.db.BeginTx(context.Background(), nil)
 	if err != nil {
-		return 0, err
+		return ret, err
+	}
+	defer tx.Rollback()
+
+	n, op, err := r.update(tx, srchQry, edtQry, client)
+	if err != nil {
+		return ret, err
 	}
+	ret.Matched = n
+	ret.Changes = []godoo.HistoryEntry{}
 
-	return int(rows), nil
+	rows, err := getOperationRows(tx, getOperationSelectSql(r.kind), op.id)
+	if err != nil {
+		return ret, err
+	}
+	for i := len(rows) - 1; i >= 0; i-- { // oldest first
+		e, err := rows[i].toEntry(client, op.id)
+		if err != nil {
+			return ret, err
+		}
+		ret.Changes = append(ret.Changes, e)
+	}
+	return ret, nil
 }
 
-func (r *Repo) GetWhere(qry godoo.FullUserQuery) ([]godoo.TodoItem, error) {
+// Compares the items srchQry matches now, & those it matched when they were
+// read, with the versions they were read at
+func (r *Repo) checkVersions(tx *sql.Tx, srchQry godoo.FullUserQuery, versions map[int]int) error {
+	idSql, vals := buildAndWhere(getWhereList(srchQry), getIdSelectSql(r.kind)+" where ")
+	ids, err := getMatchingIds(tx, idSql, vals)
+	if err != nil {
+		return err
+	}
 
-	if len(qry.QueryOptions) == 0 {
-		return r.GetAll()
+	all := make(map[int]struct{})
+	for _, id := range ids {
+		all[id] = struct{}{}
+	}
+	for id := range versions {
+		all[id] = struct{}{}
+	}
+	if len(all) == 0 {
+		return nil
 	}
 
-	mp := make(map[int]*godoo.TodoItem)
-	whereLst := getWhereList(qry)
-	sql, vals := buildAndWhere(whereLst, getSql(godoo.Get, r.kind, all)+" where ")
+	var idVals []any
+	for id := range all {
+		idVals = append(idVals, id)
+	}
+	rows, err := tx.Query(getVersionSelectSql(r.kind, len(idVals)), idVals...)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	current := make(map[int]int)
+	for rows.Next() {
+		var id, v int
+		if err = rows.Scan(&id, &v); err != nil {
+			return err
+		}
+		current[id] = v
+	}
+	if err = rows.Err(); err != nil {
+		return err
+	}
+
+	var conflicts []godoo.VersionConflict
+	for id := range all {
+		if current[id] != versions[id] {
+			conflicts = append(conflicts, godoo.VersionConflict{ItemId: id, Expected: versions[id], Current: current[id]})
+		}
+	}
+	if len(conflicts) > 0 {
+		sort.Slice(conflicts, func(i, j int) bool { return conflicts[i].ItemId < conflicts[j].ItemId })
+		return &godoo.VersionConflictError{Conflicts: conflicts}
+	}
+	return nil
+}
+
+// Applies the edit as part of tx. Returns the number of items matched
+// & the operation the changes are recorded under.
+func (r *Repo) update(tx *sql.Tx, srchQry, edtQry godoo.FullUserQuery, client string) (int, operation, error) {
+	var op operation
+
+	// tags live in their own table so are handled separately from the items update
+	itmQry, tagMode := splitTagEdit(edtQry)
+
+	// get matching ids before the items update can change what matches
+	idSql, vals := buildAndWhere(getWhereList(srchQry), getIdSelectSql(r.kind)+" where ")
+	ids, err := getMatchingIds(tx, idSql, vals)
+	if err != nil {
+		return 0, op, err
+	}
+	parentEdit := isParentEdit(edtQry)
+	completionEdit := isCompletionEdit(edtQry)
+
+	before, err := r.getSnapshots(tx, ids)
+	if err != nil {
+		return 0, op, err
+	}
+
+	// only items whose state actually changes get a completion event, and
+	// of those, only recurring ones not yet done need replacing
+	var changed, recurring []int
+	if completionEdit && len(ids) > 0 {
+		if changed, err = r.getCompletionChanges(tx, ids, edtQry); err != nil {
+			return 0, op, err
+		}
+	}
+	if len(changed) > 0 {
+		var vals []any
+		for _, id := range changed {
+			vals = append(vals, id)
+		}
+		if recurring, err = getMatchingIds(tx, getRecurringSelectSql(r.kind, len(changed)), vals); err != nil {
+			return 0, op, err
+		}
+	}
+
+	if parentEdit {
+		if err = r.checkParent(tx, edtQry.QueryData.ParentId, ids); err != nil {
+			return 0, op, err
+		}
+	}
+
+	var rows int64
+	if len(getWhereList(itmQry)) > 0 {
+		itmSql, data := r.assembleUpdateData(getSql(godoo.Update, r.kind, items), srchQry, itmQry)
+
+		res, err := tx.Exec(itmSql, data...)
+		if err != nil {
+			return 0, op, err
+		}
+		if rows, err = res.RowsAffected(); err != nil {
+			return 0, op, err
+		}
+	}
+
+	if tagMode != noTagEdit {
+		for _, id := range ids {
+			if err = r.editTags(tx, id, tagMode, edtQry.QueryData.Tags); err != nil {
+				return 0, op, err
+			}
+		}
+	}
+
+	if len(changed) > 0 {
+		if err = r.recordCompletion(tx, changed, time.Now()); err != nil {
+			return 0, op, err
+		}
+	}
+
+	after, err := r.getSnapshots(tx, ids)
+	if err != nil {
+		return 0, op, err
+	}
+	if op, err = r.newOperation(tx, client); err != nil {
+		return 0, op, err
+	}
+	if err = r.recordHistory(tx, op, godoo.Updated, ids, before, after); err != nil {
+		return 0, op, err
+	}
+
+	for _, id := range recurring {
+		if err = r.spawnNextOccurrence(tx, after[id], op); err != nil {
+			return 0, op, err
+		}
+	}
+
+	if len(ids) > int(rows) {
+		return len(ids), op, nil
+	}
+	return int(rows), op, nil
+}
+
+func isCompletionEdit(edtQry godoo.FullUserQuery) bool {
+	for _, o := range edtQry.QueryOptions {
+		if o.Elem == godoo.ByCompletion {
+			return true
+		}
+	}
+	return false
+}
+
+// Returns those ids whose completion state the edit will change
+func (r *Repo) getCompletionChanges(tx *sql.Tx, ids []int, edtQry godoo.FullUserQuery) ([]int, error) {
+	toggling := false
+	for _, o := range edtQry.QueryOptions {
+		if o.Elem == godoo.ByToggle {
+			toggling = true
+		}
+	}
+
+	var vals []any
+	for _, id := range ids {
+		vals = append(vals, id)
+	}
+	if !toggling {
+		vals = append(vals, edtQry.QueryData.IsComplete)
+	}
+	return getMatchingIds(tx, getCompletionChangeSql(r.kind, len(ids), toggling), vals)
+}
+
+// Sets or clears completedAt for the ids passed, depending on their new
+// state, & appends a completion event for each one
+func (r *Repo) recordCompletion(tx *sql.Tx, ids []int, at time.Time) error {
+	vals := []any{at.Format(time.RFC3339)}
+	for _, id := range ids {
+		vals = append(vals, id)
+	}
+
+	for _, stmt := range getCompletionSql(r.kind, len(ids)) {
+		if _, err := tx.Exec(stmt, vals...); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Marks a newly inserted item as complete, as of at or now if at isn't set
+func (r *Repo) addCompleted(tx *sql.Tx, id int64, at time.Time) error {
+	if at.IsZero() {
+		at = time.Now()
+	}
+	if _, err := tx.Exec(getSetCompleteSql(r.kind), id); err != nil {
+		return err
+	}
+	return r.recordCompletion(tx, []int{int(id)}, at)
+}
+
+// Adds the next occurrence of a recurring item that's just been completed
+func (r *Repo) spawnNextOccurrence(tx *sql.Tx, itm godoo.TodoItem, op operation) error {
+	next, err := itm.NextOccurrence(time.Now())
+	if err != nil {
+		return err
+	}
+
+	id, err := r.insertItem(tx, &next)
+	if err != nil {
+		return err
+	}
+	return r.recordAdd(tx, id, op)
+}
+
+// Applies a single tag edit to the item with the supplied id
+func (r *Repo) editTags(tx *sql.Tx, id int, mode tag_edit_mode, tgs map[string]struct{}) error {
+	if mode == replaceTags {
+		if _, err := tx.Exec(getSql(godoo.Delete, r.kind, tags), id); err != nil {
+			return err
+		}
+	}
+
+	for t := range tgs {
+		var err error
+		switch mode {
+		case appendTags:
+			_, err = tx.Exec(getTagAppendSql(r.kind), id, t, id, t)
+		case replaceTags:
+			_, err = tx.Exec(getSql(godoo.Add, r.kind, tags), id, t)
+		case removeTags:
+			_, err = tx.Exec(getTagRemoveSql(r.kind), id, t)
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Checks that parentId refers to an existing item and that none of
+// the items in children is parentId itself or one of its ancestors,
+// which would create a cycle. A parentId of 0 means no parent.
+func (r *Repo) checkParent(tx *sql.Tx, parentId int, children []int) error {
+	if parentId == 0 {
+		return nil
+	}
+	if parentId < 0 {
+		return &godoo.NegativeParentIdError{}
+	}
+
+	var exists bool
+	if err := tx.QueryRow(getExistsSql(r.kind), parentId).Scan(&exists); err != nil {
+		return err
+	}
+	if !exists {
+		return &godoo.ParentNotFoundError{ParentId: parentId}
+	}
+
+	if len(children) == 0 {
+		return nil
+	}
+
+	ancestors, err := getMatchingIds(tx, getAncestorSelectSql(r.kind), []any{parentId})
+	if err != nil {
+		return err
+	}
+
+	for _, a := range ancestors {
+		for _, c := range children {
+			if a == c {
+				return &godoo.ParentCycleError{ItemId: c, ParentId: parentId}
+			}
+		}
+	}
+	return nil
+}
+
+func isParentEdit(edtQry godoo.FullUserQuery) bool {
+	for _, o := range edtQry.QueryOptions {
+		if o.Elem == godoo.ByParentId {
+			return true
+		}
+	}
+	return false
+}
+
+// Separates any tag edit from the rest of an edit query. Returns the
+// query without the ByTag option, and how the tags should be changed.
+func splitTagEdit(edtQry godoo.FullUserQuery) (godoo.FullUserQuery, tag_edit_mode) {
+	ret := godoo.FullUserQuery{QueryData: edtQry.QueryData}
+	mode := noTagEdit
+	var tagging, appending, replacing, removing bool
+
+	for _, o := range edtQry.QueryOptions {
+		switch o.Elem {
+		case godoo.ByTag:
+			tagging = true
+			continue
+		case godoo.ByAppending:
+			appending = true
+		case godoo.ByReplacement:
+			replacing = true
+		case godoo.ByRemoval:
+			removing = true
+		}
+		ret.QueryOptions = append(ret.QueryOptions, o)
+	}
+
+	if tagging {
+		switch {
+		case removing:
+			mode = removeTags
+		case replacing:
+			mode = replaceTags
+		case appending:
+			mode = appendTags
+		default:
+			mode = appendTags // adding a tag is the least destructive option
+		}
+	}
+	return ret, mode
+}
+
+func (r *Repo) DeleteWhere(srchQry godoo.FullUserQuery) ([]int, error) {
+	return r.deleteWhere(srchQry, r.client)
+}
+
+func (r *Repo) deleteWhere(srchQry godoo.FullUserQuery, client string) ([]int, error) {
+
+	if !hasSearchCriteria(srchQry) {
+		return nil, &godoo.NoQueryOptionsError{}
+	}
+
+	whereLst := getWhereList(srchQry)
+	idSql, vals := buildAndWhere(whereLst, getIdSelectSql(r.kind)+" where ")
 
 	r.Mtx.Lock()
 	defer r.Mtx.Unlock()
 
-	all, err := r.db.Query(sql, vals...)
+	tx, err := r.db.BeginTx(context.Background(), nil)
 	if err != nil {
 		return nil, err
 	}
+	defer tx.Rollback()
 
-	ret, err := r.processQuery(all, mp)
+	ids, err := getMatchingIds(tx, idSql, vals)
 	if err != nil {
 		return nil, err
 	}
-	return ret, nil
+
+	before, err := r.getSnapshots(tx, ids)
+	if err != nil {
+		return nil, err
+	}
+	op, err := r.newOperation(tx, client)
+	if err != nil {
+		return nil, err
+	}
+	if err = r.recordHistory(tx, op, godoo.Deleted, ids, before, nil); err != nil {
+		return nil, err
+	}
+
+	for _, id := range ids {
+		if _, err = tx.Exec(getSql(godoo.Delete, r.kind, tags), id); err != nil {
+			return nil, err
+		}
+		if _, err = tx.Exec(getSql(godoo.Delete, r.kind, items), id); err != nil {
+			return nil, err
+		}
+	}
+
+	if err = tx.Commit(); err != nil {
+		return nil, err
+	}
+
+	return ids, nil
 }
 
-func (r *Repo) GetAll() ([]godoo.TodoItem, error) {
-	sql := getSql(godoo.Get, r.kind, all)
-	mp := make(map[int]*godoo.TodoItem)
+// Reads the ids matched by the search query so that the
+// same set of items can be worked on across both tables
+func getMatchingIds(tx *sql.Tx, idSql string, vals []any) ([]int, error) {
+	var ids []int
 
-	all, err := r.db.Query(sql)
+	rows, err := tx.Query(idSql, vals...)
 	if err != nil {
 		return nil, err
 	}
+	defer rows.Close()
 
-	ret, err := r.processQuery(all, mp)
+	for rows.Next() {
+		var id int
+		if err := rows.Scan(&id); err != nil {
+			return nil, err
+		}
+		ids = append(ids, id)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return ids, nil
+}
+
+func (r *Repo) GetWhere(qry godoo.FullUserQuery) ([]godoo.TodoItem, error) {
+
+	mp := make(map[int]*godoo.TodoItem)
+	var sql string
+	var vals []any
+
+	if qry.Expr != nil {
+		if err := qry.Expr.Validate(); err != nil {
+			return nil, err
+		}
+	}
+
+	ranked := isFullTextSearch(qry)
+	if len(qry.QueryOptions) == 0 && qry.Expr == nil {
+		sql = getSql(godoo.Get, r.kind, all)
+	} else if len(qry.QueryOptions) > 0 && qry.QueryOptions[0].Elem == godoo.BySubtree {
+		// no further search params allowed, other than who can see the items
+		scopeSql, scopeVals := buildAndWhere(getScopeList(qry), "")
+		sql, vals = getSubtreeSelectSql(r.kind, scopeSql), append(append([]any{qry.QueryData.Id}, scopeVals...), scopeVals...)
+	} else if ranked {
+		if !r.fts {
+			return nil, &godoo.FullTextUnavailableError{}
+		}
+		sql, vals = r.getFullTextQuery(qry)
+	} else {
+		sql, vals = r.getWhereQuery(qry)
+	}
+
+	sql, vals, err := r.orderAndPage(sql, vals, qry, ranked)
 	if err != nil {
 		return nil, err
 	}
+
+	r.Mtx.Lock()
+	defer r.Mtx.Unlock()
+
+	all, err := r.db.Query(sql, vals...)
+	if err != nil {
+		return nil, checkSearchError(err, qry)
+	}
+
+	ret, err := r.processQuery(all, mp, ranked, getScopeList(qry))
+	if err != nil {
+		return nil, checkSearchError(err, qry)
+	}
 	return ret, nil
+}
+
+// Wraps a select so that its rows come back in the order asked for, with
+// only those on the requested page. Full-text matches are ordered by
+// relevance unless given sort keys; everything else by id. A cursor's
+// page starts after the item it was made from, wherever that now is.
+func (r *Repo) orderAndPage(sql string, vals []any, qry godoo.FullUserQuery, ranked bool) (string, []any, error) {
+	if err := godoo.ValidateSortKeys(qry.Sort); err != nil {
+		return "", nil, err
+	}
+	start, err := qry.PageStart()
+	if err != nil {
+		return "", nil, err
+	}
+	after, err := qry.PageAfter()
+	if err != nil {
+		return "", nil, err
+	}
+
+	orderBy := getOrderBySql(r.kind, qry.Sort, qry.Descending, ranked)
+	if !qry.IsPaged() {
+		return "select * from (" + sql + ") q " + orderBy, vals, nil
+	}
+
+	limit := qry.Limit
+	if limit == 0 {
+		limit = -1 // sqlite needs a limit to go with an offset
+	}
+	where := ""
+	vals = append([]any{}, vals...)
+	if after != nil {
+		keyset, keysetVals := getKeysetSql(r.kind, qry.Sort, qry.Descending, ranked, *after)
+		where, vals = "where "+keyset+" ", append(vals, keysetVals...)
+	}
+	// each item has a row per tag, so page over the ids. Grouping
+	// by id instead stops bm25() from running in full-text searches.
+	ret := "with q as (" + sql + ") " +
+		"select * from q where id in (select distinct id from q " + where + orderBy + " limit ? offset ?) " + orderBy
+	return ret, append(vals, limit, start), nil
+}
+
+func isFullTextSearch(qry godoo.FullUserQuery) bool {
+	for _, o := range qry.QueryOptions {
+		if o.Elem == godoo.ByFullText {
+			return true
+		}
+	}
+	return false
+}
 
+// sqlite only complains about a bad match expression once it
+// runs the query, so it can show up when querying or reading rows
+func checkSearchError(err error, qry godoo.FullUserQuery) error {
+	if isFullTextSearch(qry) && strings.HasPrefix(err.Error(), "fts5:") {
+		return &godoo.SearchSyntaxError{Expr: qry.SearchText}
+	}
+	return err
+}
+
+// Full-text match, narrowed down by any other search params
+func (r *Repo) getFullTextQuery(qry godoo.FullUserQuery) (string, []any) {
+	sql := getFullTextSelectSql(r.kind)
+	vals := []any{godoo.HighlightStart, godoo.HighlightEnd, qry.SearchText}
+
+	whereLst := getWhereList(qry)
+	if len(whereLst) > 0 {
+		var whereVals []any
+		sql, whereVals = buildAndWhere(whereLst, sql+" and ")
+		vals = append(vals, whereVals...)
+	}
+	return addExprWhere(sql, vals, qry.Expr, " and ")
+}
+
+// Plain search params, along with any boolean query
+func (r *Repo) getWhereQuery(qry godoo.FullUserQuery) (string, []any) {
+	sql := getSql(godoo.Get, r.kind, all) + " where "
+
+	whereLst := getWhereList(qry)
+	if len(whereLst) == 0 {
+		return addExprWhere(sql, nil, qry.Expr, "")
+	}
+
+	sql, vals := buildAndWhere(whereLst, sql)
+	return addExprWhere(sql, vals, qry.Expr, " and ")
+}
+
+// and-s the boolean query, if there is one, onto the end of sql
+func addExprWhere(sql string, vals []any, e *godoo.QueryExpr, join string) (string, []any) {
+	if e == nil {
+		return sql, vals
+	}
+	exprSql, exprVals := buildExprWhere(*e)
+	return sql + join + exprSql, append(vals, exprVals...)
+}
+
+func (r *Repo) GetAll() ([]godoo.TodoItem, error) {
+	return r.GetWhere(godoo.FullUserQuery{})
 }
 
 func getWhereList(qry godoo.FullUserQuery) []where_map_entry {
 	var lst []where_map_entry
 
+	anyTag := false
 	for _, opt := range qry.QueryOptions {
-		if opt.Elem == godoo.ByAppending || opt.Elem == godoo.ByReplacement {
+		if opt.Elem == godoo.ByAnyTag {
+			anyTag = true
+		}
+	}
+
+	for _, opt := range qry.QueryOptions {
+		if opt.Elem == godoo.ByAppending || opt.Elem == godoo.ByReplacement || opt.Elem == godoo.ByRemoval || opt.Elem == godoo.ByToggle || opt.Elem == godoo.ByAnyTag {
 			// query modifiers; not query types/options
 			continue
 		}
 		col, val := getColAndVal(opt, qry.QueryData)
+		if col == "tag" && anyTag {
+			col = "anyTag"
+		}
 		if col != "" {
 			lst = append(lst, where_map_entry{col, val})
 		}
@@ -167,11 +926,11 @@ func getColAndVal(q godoo.UserQueryOption, input godoo.TodoItem) (string, any) {
 	case godoo.ById:
 		return "i.id", input.Id
 	case godoo.ByChildId:
-		return "", input.ChildItems
+		return "childId", getChildIdFromMap(input.ChildItems)
 	case godoo.ByParentId:
 		return "parentId", input.ParentId
 	case godoo.ByTag:
-		return "tag", getTagFromMap(input.Tags)
+		return "tag", getTagsFromMap(input.Tags)
 	case godoo.ByBody:
 		return "body", input.Body
 	case godoo.ByNextPriority:
@@ -184,10 +943,49 @@ func getColAndVal(q godoo.UserQueryOption, input godoo.TodoItem) (string, any) {
 		return "creationDate", getDateRange(q, input)
 	case godoo.ByCompletion:
 		return "isComplete", input.IsComplete
+	case godoo.ByCompletionDate:
+		return "completedAt", getDateRange(q, input)
+	case godoo.ByVisibility:
+		return "visibility", string(getVisibility(input.Visibility))
+	case godoo.ByOwner:
+		return "i.owner", input.Owner
+	case godoo.ByVisibleTo:
+		return "visibleTo", input.Owner
 	}
 	return "", nil
 }
 
+// Items are shared unless they've been made private
+func getVisibility(v godoo.Visibility) godoo.Visibility {
+	if v == godoo.Private {
+		return godoo.Private
+	}
+	return godoo.Shared
+}
+
+// The entries in qry's where list that limit whose items it finds
+func getScopeList(qry godoo.FullUserQuery) []where_map_entry {
+	var ret []where_map_entry
+	for _, w := range getWhereList(qry) {
+		if w.columnName == "i.owner" || w.columnName == "visibleTo" {
+			ret = append(ret, w)
+		}
+	}
+	return ret
+}
+
+// Whether qry narrows down which items to change, other than
+// by who can see them. Stops a search that only limits a user to
+// their own items from editing or deleting all of them.
+func hasSearchCriteria(qry godoo.FullUserQuery) bool {
+	for _, w := range getWhereList(qry) {
+		if w.columnName != "i.owner" && w.columnName != "visibleTo" {
+			return true
+		}
+	}
+	return false
+}
+
 func getDateRange(q godoo.UserQueryOption, itm godoo.TodoItem) []string {
 	var ret []string
 	var d time.Time
@@ -197,6 +995,9 @@ func getDateRange(q godoo.UserQueryOption, itm godoo.TodoItem) []string {
 	if q.Elem == godoo.ByCreationDate {
 		d = itm.CreationDate
 	}
+	if q.Elem == godoo.ByCompletionDate {
+		d = itm.CompletedAt
+	}
 
 	if q.UpperBoundDate.IsZero() {
 		ret = append(ret, util.StringFromDate(d))
@@ -207,11 +1008,52 @@ func getDateRange(q godoo.UserQueryOption, itm godoo.TodoItem) []string {
 	return ret
 }
 
-func getTagFromMap(mp map[string]struct{}) string {
-	var ret string
+func getChildIdFromMap(mp map[int]struct{}) int {
+	var ret int
 	for v := range mp {
 		ret = v
-		break // this is from terminal input so will only be one item
+		break // from terminal input so only ever one child id
+	}
+	return ret
+}
+
+// Sorted, so the same tags always give the same sql & values
+func getTagsFromMap(mp map[string]struct{}) []string {
+	var ret []string
+	for v := range mp {
+		ret = append(ret, v)
 	}
+	if len(ret) == 0 {
+		return []string{""} // matches nothing, rather than everything
+	}
+	sort.Strings(ret)
 	return ret
 }
+
+// Returned when the db file can't be created or opened, e.g.
+// because the directory in the connection string doesn't exist
+type ConnectionError struct {
+	Path string
+	Err  error
+}
+
+func (c *ConnectionError) Error() string {
+	return fmt.Sprintf("couldn't open database at '%v': %v", c.Path, c.Err)
+}
+
+func (c *ConnectionError) Unwrap() error {
+	return c.Err
+}
+
+// Returned when the db is missing a table or column the app relies on
+type SchemaError struct {
+	Table  string
+	Column string
+}
+
+func (s *SchemaError) Error() string {
+	if s.Column == "" {
+		return fmt.Sprintf("invalid schema: table '%v' doesn't exist", s.Table)
+	}
+	return fmt.Sprintf("invalid schema: table '%v' has no column '%v'", s.Table, s.Column)
+}
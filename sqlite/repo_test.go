@@ -0,0 +1,1160 @@
+package sqlite
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	godoo "github.com/mundacity/go-doo"
+)
+
+type delete_test_case struct {
+	srchOpts []godoo.UserQueryOption
+	slctr    godoo.TodoItem
+	expIds   []int
+	expLeft  int
+	expErr   error
+	name     string
+}
+
+func getDeleteTestCases() []delete_test_case {
+	return []delete_test_case{{
+		srchOpts: []godoo.UserQueryOption{{Elem: godoo.ById}},
+		slctr:    godoo.TodoItem{Id: 2},
+		expIds:   []int{2},
+		expLeft:  2,
+		name:     "delete by id",
+	}, {
+		srchOpts: []godoo.UserQueryOption{{Elem: godoo.ByTag}},
+		slctr:    godoo.TodoItem{Tags: map[string]struct{}{"work": {}}},
+		expIds:   []int{1, 3},
+		expLeft:  1,
+		name:     "delete by tag; multi-tag item deleted once",
+	}, {
+		srchOpts: []godoo.UserQueryOption{{Elem: godoo.ByBody}},
+		slctr:    godoo.TodoItem{Body: "nothing matches this"},
+		expIds:   nil,
+		expLeft:  3,
+		name:     "delete with no matches",
+	}, {
+		srchOpts: nil,
+		expIds:   nil,
+		expLeft:  3,
+		expErr:   &godoo.NoQueryOptionsError{},
+		name:     "no query options",
+	}}
+}
+
+func seedRepo(t *testing.T) *Repo {
+	r := getInMemDb()
+	seed := []godoo.TodoItem{
+		{CreationDate: parseDate("2022-06-01"), Body: "first", Tags: map[string]struct{}{"work": {}, "dev": {}}},
+		{CreationDate: parseDate("2022-06-02"), Body: "second", Tags: map[string]struct{}{"home": {}}},
+		{CreationDate: parseDate("2022-06-03"), Body: "third", Tags: map[string]struct{}{"work": {}}},
+	}
+	for i := range seed {
+		if _, err := r.Add(&seed[i]); err != nil {
+			t.Fatalf("seeding failed: %v", err)
+		}
+	}
+	return r
+}
+
+func TestDeleteWhere(t *testing.T) {
+	tcs := getDeleteTestCases()
+	for _, tc := range tcs {
+		t.Run(tc.name, func(t *testing.T) {
+			runDeleteTest(t, tc)
+		})
+	}
+}
+
+func runDeleteTest(t *testing.T, tc delete_test_case) {
+	r := seedRepo(t)
+	defer r.db.Close()
+
+	ids, err := r.DeleteWhere(godoo.FullUserQuery{QueryOptions: tc.srchOpts, QueryData: tc.slctr})
+	if (err == nil) != (tc.expErr == nil) {
+		t.Fatalf(">>>>FAILED: expected error '%v', got '%v'", tc.expErr, err)
+	}
+
+	if len(ids) != len(tc.expIds) {
+		t.Errorf(">>>>FAILED: expected ids %v, got %v", tc.expIds, ids)
+	} else {
+		for i, id := range ids {
+			if id != tc.expIds[i] {
+				t.Errorf(">>>>FAILED: expected ids %v, got %v", tc.expIds, ids)
+				break
+			}
+		}
+	}
+
+	left, err := r.GetAll()
+	if err != nil {
+		t.Fatalf(">>>>FAILED: %v", err)
+	}
+	if len(left) != tc.expLeft {
+		t.Errorf(">>>>FAILED: expected %v items remaining, got %v", tc.expLeft, len(left))
+	} else {
+		t.Logf(">>>>PASSED: %v items remaining", len(left))
+	}
+}
+
+type tag_edit_test_case struct {
+	srchOpts []godoo.UserQueryOption
+	slctr    godoo.TodoItem
+	edtOpts  []godoo.UserQueryOption
+	newData  godoo.TodoItem
+	expN     int
+	expTags  map[int][]string
+	name     string
+}
+
+func getTagEditTestCases() []tag_edit_test_case {
+	return []tag_edit_test_case{{
+		srchOpts: []godoo.UserQueryOption{{Elem: godoo.ById}},
+		slctr:    godoo.TodoItem{Id: 2},
+		edtOpts:  []godoo.UserQueryOption{{Elem: godoo.ByTag}, {Elem: godoo.ByAppending}},
+		newData:  godoo.TodoItem{Tags: map[string]struct{}{"work": {}, "home": {}}},
+		expN:     1,
+		expTags:  map[int][]string{2: {"home", "work"}},
+		name:     "append tags; existing tag not duplicated",
+	}, {
+		srchOpts: []godoo.UserQueryOption{{Elem: godoo.ByBody}},
+		slctr:    godoo.TodoItem{Body: "i"},
+		edtOpts:  []godoo.UserQueryOption{{Elem: godoo.ByTag}, {Elem: godoo.ByReplacement}},
+		newData:  godoo.TodoItem{Tags: map[string]struct{}{"done": {}}},
+		expN:     2,
+		expTags:  map[int][]string{1: {"done"}, 2: {"home"}, 3: {"done"}},
+		name:     "replace tags on every matched item",
+	}, {
+		srchOpts: []godoo.UserQueryOption{{Elem: godoo.ById}},
+		slctr:    godoo.TodoItem{Id: 1},
+		edtOpts:  []godoo.UserQueryOption{{Elem: godoo.ByTag}, {Elem: godoo.ByRemoval}, {Elem: godoo.ByBody}, {Elem: godoo.ByReplacement}},
+		newData:  godoo.TodoItem{Body: "renamed", Tags: map[string]struct{}{"work": {}}},
+		expN:     1,
+		expTags:  map[int][]string{1: {"dev"}},
+		name:     "remove tag alongside body replacement",
+	}}
+}
+
+func TestTagEditing(t *testing.T) {
+	tcs := getTagEditTestCases()
+	for _, tc := range tcs {
+		t.Run(tc.name, func(t *testing.T) {
+			runTagEditTest(t, tc)
+		})
+	}
+}
+
+func runTagEditTest(t *testing.T, tc tag_edit_test_case) {
+	r := seedRepo(t)
+	defer r.db.Close()
+
+	srchFq := godoo.FullUserQuery{QueryOptions: tc.srchOpts, QueryData: tc.slctr}
+	edtFq := godoo.FullUserQuery{QueryOptions: tc.edtOpts, QueryData: tc.newData}
+
+	n, err := r.UpdateWhere(srchFq, edtFq)
+	if err != nil {
+		t.Fatalf(">>>>FAILED: %v", err)
+	}
+	if n != tc.expN {
+		t.Errorf(">>>>FAILED: expected %v items edited, got %v", tc.expN, n)
+	}
+
+	all, err := r.GetAll()
+	if err != nil {
+		t.Fatalf(">>>>FAILED: %v", err)
+	}
+
+	for _, itm := range all {
+		exp, ok := tc.expTags[itm.Id]
+		if !ok {
+			continue
+		}
+		if len(itm.Tags) != len(exp) {
+			t.Errorf(">>>>FAILED: item %v expected tags %v, got %v", itm.Id, exp, itm.Tags)
+			continue
+		}
+		for _, tg := range exp {
+			if _, found := itm.Tags[tg]; !found {
+				t.Errorf(">>>>FAILED: item %v expected tags %v, got %v", itm.Id, exp, itm.Tags)
+			}
+		}
+	}
+}
+
+type hierarchy_test_case struct {
+	opts     []godoo.UserQueryOption
+	slctr    godoo.TodoItem
+	expIds   []int
+	expChild map[int]int // id: number of children
+	name     string
+}
+
+func getHierarchyTestCases() []hierarchy_test_case {
+	return []hierarchy_test_case{{
+		opts:     []godoo.UserQueryOption{{Elem: godoo.ByChildId}},
+		slctr:    godoo.TodoItem{ChildItems: map[int]struct{}{3: {}}},
+		expIds:   []int{2},
+		expChild: map[int]int{2: 1},
+		name:     "parent of child id",
+	}, {
+		opts:     []godoo.UserQueryOption{{Elem: godoo.ByParentId}},
+		slctr:    godoo.TodoItem{ParentId: 1},
+		expIds:   []int{2, 4},
+		expChild: map[int]int{2: 1, 4: 0},
+		name:     "children of parent id",
+	}, {
+		opts:     []godoo.UserQueryOption{{Elem: godoo.BySubtree}},
+		slctr:    godoo.TodoItem{Id: 1},
+		expIds:   []int{1, 2, 3, 4},
+		expChild: map[int]int{1: 2, 2: 1, 3: 0, 4: 0},
+		name:     "whole subtree",
+	}, {
+		opts:     []godoo.UserQueryOption{{Elem: godoo.BySubtree}},
+		slctr:    godoo.TodoItem{Id: 2},
+		expIds:   []int{2, 3},
+		expChild: map[int]int{2: 1, 3: 0},
+		name:     "partial subtree",
+	}}
+}
+
+// 1 -> 2 -> 3, 1 -> 4, 5 unrelated
+func seedHierarchy(t *testing.T) *Repo {
+	r := getInMemDb()
+	seed := []godoo.TodoItem{
+		{CreationDate: parseDate("2022-06-01"), Body: "root"},
+		{CreationDate: parseDate("2022-06-01"), Body: "child", ParentId: 1},
+		{CreationDate: parseDate("2022-06-01"), Body: "grandchild", ParentId: 2},
+		{CreationDate: parseDate("2022-06-01"), Body: "second child", ParentId: 1},
+		{CreationDate: parseDate("2022-06-01"), Body: "unrelated"},
+	}
+	for i := range seed {
+		if _, err := r.Add(&seed[i]); err != nil {
+			t.Fatalf("seeding failed: %v", err)
+		}
+	}
+	return r
+}
+
+func TestHierarchyQueries(t *testing.T) {
+	tcs := getHierarchyTestCases()
+	for _, tc := range tcs {
+		t.Run(tc.name, func(t *testing.T) {
+			runHierarchyTest(t, tc)
+		})
+	}
+}
+
+func runHierarchyTest(t *testing.T, tc hierarchy_test_case) {
+	r := seedHierarchy(t)
+	defer r.db.Close()
+
+	itms, err := r.GetWhere(godoo.FullUserQuery{QueryOptions: tc.opts, QueryData: tc.slctr})
+	if err != nil {
+		t.Fatalf(">>>>FAILED: %v", err)
+	}
+	if len(itms) != len(tc.expIds) {
+		t.Fatalf(">>>>FAILED: expected %v items, got %v", len(tc.expIds), len(itms))
+	}
+
+	got := make(map[int]godoo.TodoItem)
+	for _, itm := range itms {
+		got[itm.Id] = itm
+	}
+	for _, id := range tc.expIds {
+		itm, ok := got[id]
+		if !ok {
+			t.Errorf(">>>>FAILED: item %v missing from results", id)
+			continue
+		}
+		if len(itm.ChildItems) != tc.expChild[id] {
+			t.Errorf(">>>>FAILED: item %v expected %v children, got %v", id, tc.expChild[id], len(itm.ChildItems))
+		}
+	}
+}
+
+type parent_validation_test_case struct {
+	add      *godoo.TodoItem
+	srchOpts []godoo.UserQueryOption
+	slctr    godoo.TodoItem
+	parentId int
+	expErr   error
+	name     string
+}
+
+func getParentValidationTestCases() []parent_validation_test_case {
+	return []parent_validation_test_case{{
+		add:    &godoo.TodoItem{CreationDate: parseDate("2022-06-01"), Body: "orphan", ParentId: 99},
+		expErr: &godoo.ParentNotFoundError{},
+		name:   "add with dangling parent",
+	}, {
+		add:    &godoo.TodoItem{CreationDate: parseDate("2022-06-01"), Body: "negative", ParentId: -1},
+		expErr: &godoo.NegativeParentIdError{},
+		name:   "add with negative parent",
+	}, {
+		add:    &godoo.TodoItem{CreationDate: parseDate("2022-06-01"), Body: "fine", ParentId: 3},
+		expErr: nil,
+		name:   "add with existing parent",
+	}, {
+		srchOpts: []godoo.UserQueryOption{{Elem: godoo.ById}},
+		slctr:    godoo.TodoItem{Id: 5},
+		parentId: 42,
+		expErr:   &godoo.ParentNotFoundError{},
+		name:     "edit to dangling parent",
+	}, {
+		srchOpts: []godoo.UserQueryOption{{Elem: godoo.ById}},
+		slctr:    godoo.TodoItem{Id: 1},
+		parentId: 3,
+		expErr:   &godoo.ParentCycleError{},
+		name:     "edit root to be child of grandchild",
+	}, {
+		srchOpts: []godoo.UserQueryOption{{Elem: godoo.ById}},
+		slctr:    godoo.TodoItem{Id: 4},
+		parentId: 4,
+		expErr:   &godoo.ParentCycleError{},
+		name:     "edit item to be its own parent",
+	}, {
+		srchOpts: []godoo.UserQueryOption{{Elem: godoo.ById}},
+		slctr:    godoo.TodoItem{Id: 5},
+		parentId: 3,
+		expErr:   nil,
+		name:     "edit unrelated item into tree",
+	}}
+}
+
+func TestParentValidation(t *testing.T) {
+	tcs := getParentValidationTestCases()
+	for _, tc := range tcs {
+		t.Run(tc.name, func(t *testing.T) {
+			runParentValidationTest(t, tc)
+		})
+	}
+}
+
+func runParentValidationTest(t *testing.T, tc parent_validation_test_case) {
+	r := seedHierarchy(t)
+	defer r.db.Close()
+
+	var err error
+	if tc.add != nil {
+		_, err = r.Add(tc.add)
+	} else {
+		srchFq := godoo.FullUserQuery{QueryOptions: tc.srchOpts, QueryData: tc.slctr}
+		edtFq := godoo.FullUserQuery{QueryOptions: []godoo.UserQueryOption{{Elem: godoo.ByParentId}}, QueryData: godoo.TodoItem{ParentId: tc.parentId}}
+		_, err = r.UpdateWhere(srchFq, edtFq)
+	}
+
+	if fmt.Sprintf("%T", err) != fmt.Sprintf("%T", tc.expErr) {
+		t.Errorf(">>>>FAILED: expected error of type %T, got %T (%v)", tc.expErr, err, err)
+	} else {
+		t.Logf(">>>>PASSED: got %v", err)
+	}
+}
+
+type full_text_test_case struct {
+	expr     string
+	srchOpts []godoo.UserQueryOption // alongside ByFullText
+	slctr    godoo.TodoItem
+	query    *godoo.QueryExpr
+	expIds   []int // in order of relevance
+	limit    int
+	offset   int
+	expErr   error
+	name     string
+}
+
+func getFullTextTestCases() []full_text_test_case {
+	return []full_text_test_case{{
+		expr:   "deploy AND staging",
+		expIds: []int{2, 1},
+		name:   "boolean and; shorter body ranks higher",
+	}, {
+		expr:   "deploy*",
+		expIds: []int{2, 3, 1},
+		name:   "prefix search matches word forms",
+	}, {
+		expr:   "deploy*",
+		limit:  1,
+		offset: 1,
+		expIds: []int{3},
+		name:   "paged by relevance",
+	}, {
+		expr:   "urgent",
+		expIds: []int{3},
+		name:   "matches tags",
+	}, {
+		expr:     "deploy*",
+		srchOpts: []godoo.UserQueryOption{{Elem: godoo.ByCompletion}},
+		slctr:    godoo.TodoItem{IsComplete: true},
+		expIds:   []int{3},
+		name:     "combined with other search params",
+	}, {
+		expr:   "deploy*",
+		query:  &godoo.QueryExpr{Op: godoo.ExprNot, Children: []godoo.QueryExpr{{Op: godoo.ExprCond, Field: godoo.FieldTag, Value: "urgent"}}},
+		expIds: []int{2, 1},
+		name:   "combined with a boolean query",
+	}, {
+		expr:   "deploy AND (staging",
+		expErr: &godoo.SearchSyntaxError{},
+		name:   "invalid expression",
+	}}
+}
+
+func seedSearchRepo(t *testing.T) *Repo {
+	r := getInMemDb()
+	seed := []godoo.TodoItem{
+		{CreationDate: parseDate("2022-06-01"), Body: "deploy the new build to staging once the release notes and changelog are signed off", Tags: map[string]struct{}{"work": {}}},
+		{CreationDate: parseDate("2022-06-02"), Body: "deploy to staging", Tags: map[string]struct{}{"work": {}}},
+		{CreationDate: parseDate("2022-06-03"), Body: "check deployment logs", Tags: map[string]struct{}{"urgent": {}}},
+		{CreationDate: parseDate("2022-06-04"), Body: "water the plants", Tags: map[string]struct{}{"home": {}}},
+	}
+	for i := range seed {
+		if _, err := r.Add(&seed[i]); err != nil {
+			t.Fatalf("seeding failed: %v", err)
+		}
+	}
+	return r
+}
+
+func TestFullTextSearch(t *testing.T) {
+	tcs := getFullTextTestCases()
+	for _, tc := range tcs {
+		t.Run(tc.name, func(t *testing.T) {
+			runFullTextTest(t, tc)
+		})
+	}
+}
+
+func runFullTextTest(t *testing.T, tc full_text_test_case) {
+	r := seedSearchRepo(t)
+	if _, err := r.UpdateWhere(
+		godoo.FullUserQuery{QueryOptions: []godoo.UserQueryOption{{Elem: godoo.ById}}, QueryData: godoo.TodoItem{Id: 3}},
+		godoo.FullUserQuery{QueryOptions: []godoo.UserQueryOption{{Elem: godoo.ByCompletion}}, QueryData: godoo.TodoItem{IsComplete: true}}); err != nil {
+		t.Fatalf("seeding failed: %v", err)
+	}
+
+	qry := godoo.FullUserQuery{
+		QueryOptions: append([]godoo.UserQueryOption{{Elem: godoo.ByFullText}}, tc.srchOpts...),
+		QueryData:    tc.slctr,
+		SearchText:   tc.expr,
+		Expr:         tc.query,
+		Limit:        tc.limit,
+		Offset:       tc.offset,
+	}
+	itms, err := r.GetWhere(qry)
+
+	if !r.fts {
+		if _, ok := err.(*godoo.FullTextUnavailableError); !ok {
+			t.Errorf(">>>>FAILED: expected FullTextUnavailableError without fts5, got '%v'", err)
+		}
+		t.Skip("sqlite built without fts5; rerun with '-tags sqlite_fts5'")
+	}
+
+	if tc.expErr != nil {
+		if fmt.Sprintf("%T", err) != fmt.Sprintf("%T", tc.expErr) {
+			t.Errorf(">>>>FAILED: expected error of type %T, got '%v'", tc.expErr, err)
+		}
+		return
+	}
+	if err != nil {
+		t.Fatalf(">>>>FAILED: %v", err)
+	}
+
+	var got []int
+	for _, itm := range itms {
+		got = append(got, itm.Id)
+		if itm.Snippet == "" {
+			t.Errorf(">>>>FAILED: item %v has no snippet", itm.Id)
+		}
+	}
+	if fmt.Sprint(got) != fmt.Sprint(tc.expIds) {
+		t.Errorf(">>>>FAILED: expected %v, got %v", tc.expIds, got)
+		return
+	}
+	t.Logf(">>>>PASSED: %v", got)
+}
+
+func TestFullTextCursorPaging(t *testing.T) {
+	r := seedSearchRepo(t)
+	if !r.fts {
+		t.Skip("sqlite built without fts5; rerun with '-tags sqlite_fts5'")
+	}
+	qry := godoo.FullUserQuery{QueryOptions: []godoo.UserQueryOption{{Elem: godoo.ByFullText}}, SearchText: "deploy*"}
+	runCursorPagingTest(t, r, qry, 1)
+}
+
+func TestFullTextIndexSync(t *testing.T) {
+	r := seedSearchRepo(t)
+	if !r.fts {
+		t.Skip("sqlite built without fts5; rerun with '-tags sqlite_fts5'")
+	}
+
+	byId := func(id int) godoo.FullUserQuery {
+		return godoo.FullUserQuery{QueryOptions: []godoo.UserQueryOption{{Elem: godoo.ById}}, QueryData: godoo.TodoItem{Id: id}}
+	}
+	search := func(expr string) int {
+		itms, err := r.GetWhere(godoo.FullUserQuery{QueryOptions: []godoo.UserQueryOption{{Elem: godoo.ByFullText}}, SearchText: expr})
+		if err != nil {
+			t.Fatalf(">>>>FAILED: %v", err)
+		}
+		return len(itms)
+	}
+
+	r.UpdateWhere(byId(4), godoo.FullUserQuery{QueryOptions: []godoo.UserQueryOption{{Elem: godoo.ByBody}, {Elem: godoo.ByReplacement}}, QueryData: godoo.TodoItem{Body: "repot the cactus"}})
+	r.UpdateWhere(byId(4), godoo.FullUserQuery{QueryOptions: []godoo.UserQueryOption{{Elem: godoo.ByTag}, {Elem: godoo.ByAppending}}, QueryData: godoo.TodoItem{Tags: map[string]struct{}{"garden": {}}}})
+	r.DeleteWhere(byId(2))
+
+	if n := search("plants"); n != 0 {
+		t.Errorf(">>>>FAILED: old body still indexed")
+	}
+	if n := search("cactus AND garden"); n != 1 {
+		t.Errorf(">>>>FAILED: edited body/tags not indexed; got %v matches", n)
+	}
+	if n := search("deploy AND staging"); n != 1 {
+		t.Errorf(">>>>FAILED: deleted item still indexed; got %v matches", n)
+	}
+}
+
+// Edit queries for edit --done/--undone & edit -F
+func setComplete(done bool) godoo.FullUserQuery {
+	return godoo.FullUserQuery{QueryOptions: []godoo.UserQueryOption{{Elem: godoo.ByCompletion}}, QueryData: godoo.TodoItem{IsComplete: done}}
+}
+
+func toggleComplete() godoo.FullUserQuery {
+	return godoo.FullUserQuery{QueryOptions: []godoo.UserQueryOption{{Elem: godoo.ByCompletion}, {Elem: godoo.ByToggle}}, QueryData: godoo.TodoItem{IsComplete: true}}
+}
+
+type recurrence_test_case struct {
+	add      godoo.TodoItem
+	edits    []godoo.FullUserQuery // run in order against the item
+	expItems int
+	name     string
+}
+
+func getRecurrenceTestCases() []recurrence_test_case {
+	return []recurrence_test_case{{
+		add:      godoo.TodoItem{Body: "standup", Recurrence: "1d", Priority: godoo.High, Deadline: parseDate("2022-06-01"), Tags: map[string]struct{}{"work": {}}},
+		edits:    []godoo.FullUserQuery{setComplete(true)},
+		expItems: 2,
+		name:     "completing a recurring item spawns the next one",
+	}, {
+		add:      godoo.TodoItem{Body: "one off", Tags: map[string]struct{}{"work": {}}},
+		edits:    []godoo.FullUserQuery{setComplete(true)},
+		expItems: 1,
+		name:     "non-recurring item",
+	}, {
+		add:      godoo.TodoItem{Body: "weekly report", Recurrence: "1w", Tags: map[string]struct{}{"work": {}}},
+		edits:    []godoo.FullUserQuery{toggleComplete(), toggleComplete()},
+		expItems: 2,
+		name:     "un-completing doesn't spawn another",
+	}, {
+		add:      godoo.TodoItem{Body: "weekly report", Recurrence: "1w", Tags: map[string]struct{}{"work": {}}},
+		edits:    []godoo.FullUserQuery{setComplete(true), setComplete(true)},
+		expItems: 2,
+		name:     "marking done twice only spawns once",
+	}}
+}
+
+func TestRecurringItems(t *testing.T) {
+	tcs := getRecurrenceTestCases()
+	for _, tc := range tcs {
+		t.Run(tc.name, func(t *testing.T) {
+			runRecurrenceTest(t, tc)
+		})
+	}
+}
+
+func runRecurrenceTest(t *testing.T, tc recurrence_test_case) {
+	r := getInMemDb()
+	parent := godoo.TodoItem{Body: "parent", CreationDate: parseDate("2022-06-01")}
+	pid, _ := r.Add(&parent)
+
+	tc.add.CreationDate = parseDate("2022-06-01")
+	tc.add.ParentId = int(pid)
+	id, err := r.Add(&tc.add)
+	if err != nil {
+		t.Fatalf("seeding failed: %v", err)
+	}
+
+	srch := godoo.FullUserQuery{QueryOptions: []godoo.UserQueryOption{{Elem: godoo.ById}}, QueryData: godoo.TodoItem{Id: int(id)}}
+	for _, edt := range tc.edits {
+		if _, err = r.UpdateWhere(srch, edt); err != nil {
+			t.Fatalf(">>>>FAILED: %v", err)
+		}
+	}
+
+	children, _ := r.GetWhere(godoo.FullUserQuery{QueryOptions: []godoo.UserQueryOption{{Elem: godoo.ByParentId}}, QueryData: godoo.TodoItem{ParentId: int(pid)}})
+	if len(children) != tc.expItems {
+		t.Fatalf(">>>>FAILED: expected %v items, got %v", tc.expItems, len(children))
+	}
+
+	for _, c := range children {
+		if c.Id == int(id) {
+			continue
+		}
+		_, tagged := c.Tags["work"]
+		if c.IsComplete || c.Body != tc.add.Body || c.Priority != tc.add.Priority || c.Recurrence != tc.add.Recurrence || !tagged {
+			t.Errorf(">>>>FAILED: next occurrence doesn't match original: %+v", c)
+		}
+		if !c.Deadline.After(tc.add.Deadline) {
+			t.Errorf(">>>>FAILED: deadline not advanced: %v", c.Deadline)
+		}
+	}
+	t.Logf(">>>>PASSED: %v", tc.name)
+}
+
+type completion_test_case struct {
+	edits     []godoo.FullUserQuery
+	srchDays  []int // completed-between range, in days relative to today
+	expFound  int
+	expEvents int
+	name      string
+}
+
+func getCompletionTestCases() []completion_test_case {
+	return []completion_test_case{{
+		edits:     []godoo.FullUserQuery{setComplete(true)},
+		srchDays:  []int{-7, 0},
+		expFound:  1,
+		expEvents: 1,
+		name:      "completed this week",
+	}, {
+		edits:     []godoo.FullUserQuery{setComplete(true)},
+		srchDays:  []int{0},
+		expFound:  1,
+		expEvents: 1,
+		name:      "completed today",
+	}, {
+		edits:     []godoo.FullUserQuery{setComplete(true)},
+		srchDays:  []int{-14, -7},
+		expFound:  0,
+		expEvents: 1,
+		name:      "not completed in range",
+	}, {
+		edits:     []godoo.FullUserQuery{toggleComplete(), toggleComplete()},
+		srchDays:  []int{-7, 0},
+		expFound:  0,
+		expEvents: 2,
+		name:      "reopened items aren't counted",
+	}, {
+		edits:     []godoo.FullUserQuery{setComplete(true), setComplete(false)},
+		srchDays:  []int{-7, 0},
+		expFound:  0,
+		expEvents: 2,
+		name:      "done then undone",
+	}, {
+		edits:     []godoo.FullUserQuery{setComplete(true), setComplete(true)},
+		srchDays:  []int{-7, 0},
+		expFound:  1,
+		expEvents: 1,
+		name:      "done twice is recorded once",
+	}}
+}
+
+func TestCompletionHistory(t *testing.T) {
+	tcs := getCompletionTestCases()
+	for _, tc := range tcs {
+		t.Run(tc.name, func(t *testing.T) {
+			runCompletionTest(t, tc)
+		})
+	}
+}
+
+func runCompletionTest(t *testing.T, tc completion_test_case) {
+	r := seedRepo(t)
+
+	srch := godoo.FullUserQuery{QueryOptions: []godoo.UserQueryOption{{Elem: godoo.ById}}, QueryData: godoo.TodoItem{Id: 2}}
+	for _, edt := range tc.edits {
+		if _, err := r.UpdateWhere(srch, edt); err != nil {
+			t.Fatalf(">>>>FAILED: %v", err)
+		}
+	}
+
+	today := time.Now()
+	days := tc.srchDays
+	opt := godoo.UserQueryOption{Elem: godoo.ByCompletionDate}
+	if len(days) > 1 {
+		opt.UpperBoundDate = today.AddDate(0, 0, days[1])
+	}
+	qry := godoo.FullUserQuery{QueryOptions: []godoo.UserQueryOption{opt}, QueryData: godoo.TodoItem{CompletedAt: today.AddDate(0, 0, days[0])}}
+
+	itms, err := r.GetWhere(qry)
+	if err != nil || len(itms) != tc.expFound {
+		t.Errorf(">>>>FAILED: expected %v items, got %v (err: %v)", tc.expFound, len(itms), err)
+	}
+	for _, itm := range itms {
+		if itm.CompletedAt.IsZero() {
+			t.Errorf(">>>>FAILED: item %v has no completion time", itm.Id)
+		}
+	}
+
+	var events int
+	if err = r.db.QueryRow("select count(*) from completion_events where itemId = 2").Scan(&events); err != nil || events != tc.expEvents {
+		t.Errorf(">>>>FAILED: expected %v completion events, got %v (err: %v)", tc.expEvents, events, err)
+	}
+
+	if _, err = r.db.Exec("delete from completion_events"); err == nil {
+		t.Errorf(">>>>FAILED: completion events should be append-only")
+	}
+}
+
+func TestSetCompletionOnMixedItems(t *testing.T) {
+	r := seedRepo(t)
+	byId := godoo.FullUserQuery{QueryOptions: []godoo.UserQueryOption{{Elem: godoo.ById}}, QueryData: godoo.TodoItem{Id: 1}}
+	byTag := godoo.FullUserQuery{QueryOptions: []godoo.UserQueryOption{{Elem: godoo.ByTag}}, QueryData: godoo.TodoItem{Tags: map[string]struct{}{"work": {}}}}
+
+	if _, err := r.UpdateWhere(byId, toggleComplete()); err != nil {
+		t.Fatalf(">>>>FAILED: %v", err)
+	}
+
+	// item 1 is done, item 3 isn't; running twice shouldn't change anything
+	for i := 0; i < 2; i++ {
+		if _, err := r.UpdateWhere(byTag, setComplete(true)); err != nil {
+			t.Fatalf(">>>>FAILED: %v", err)
+		}
+		itms, _ := r.GetWhere(godoo.FullUserQuery{QueryOptions: []godoo.UserQueryOption{{Elem: godoo.ByCompletion}}, QueryData: godoo.TodoItem{IsComplete: true}})
+		if len(itms) != 2 {
+			t.Errorf(">>>>FAILED: run %v - expected 2 complete items, got %v", i+1, len(itms))
+		}
+	}
+}
+
+func TestAddCompletedItem(t *testing.T) {
+	r := seedRepo(t)
+	at, _ := time.Parse(time.RFC3339, "2022-06-05T17:30:00Z")
+	itm := godoo.TodoItem{Body: "imported", CreationDate: parseDate("2022-06-01"), IsComplete: true, CompletedAt: at, Tags: map[string]struct{}{}}
+
+	id, err := r.Add(&itm)
+	if err != nil {
+		t.Fatalf(">>>>FAILED: %v", err)
+	}
+
+	itms, err := r.GetWhere(byId(int(id)))
+	if err != nil || len(itms) != 1 {
+		t.Fatalf(">>>>FAILED: expected the new item, got %v (err: %v)", len(itms), err)
+	}
+	if !itms[0].IsComplete || !itms[0].CompletedAt.Equal(at) {
+		t.Errorf(">>>>FAILED: completion not kept: %v at %v", itms[0].IsComplete, itms[0].CompletedAt)
+	}
+}
+
+type add_all_test_case struct {
+	itms       []godoo.TodoItem
+	parents    []int
+	expParents []int // of the items added, in order; nil if none should be
+	name       string
+}
+
+func getAddAllTestCases() []add_all_test_case {
+	newItm := func(body string, parentId int) godoo.TodoItem {
+		return godoo.TodoItem{CreationDate: parseDate("2022-06-04"), Body: body, ParentId: parentId, Tags: map[string]struct{}{}}
+	}
+	return []add_all_test_case{{
+		itms:       []godoo.TodoItem{newItm("plan sprint", 0), newItm("draft backlog", 0), newItm("ask bob", 1)},
+		parents:    []int{-1, 0, -1},
+		expParents: []int{0, 4, 1},
+		name:       "parents within the batch & already in the repo",
+	}, {
+		itms:    []godoo.TodoItem{newItm("plan sprint", 0), newItm("draft backlog", 99)},
+		parents: []int{-1, -1},
+		name:    "nothing added if any item can't be",
+	}}
+}
+
+func TestAddAll(t *testing.T) {
+	tcs := getAddAllTestCases()
+	for _, tc := range tcs {
+		t.Run(tc.name, func(t *testing.T) {
+			runAddAllTest(t, tc)
+		})
+	}
+}
+
+func runAddAllTest(t *testing.T, tc add_all_test_case) {
+	r := seedRepo(t)
+
+	ids, err := r.AddAll(tc.itms, tc.parents)
+	if (err == nil) != (tc.expParents != nil) {
+		t.Fatalf(">>>>FAILED (err): unexpected error state: %v", err)
+	}
+
+	all, _ := r.GetAll()
+	if tc.expParents == nil {
+		if len(ids) != 0 || len(all) != 3 {
+			t.Errorf(">>>>FAILED: expected nothing added, got ids %v & %v items", ids, len(all))
+		}
+		return
+	}
+
+	var got []int
+	for _, itm := range all[3:] {
+		got = append(got, itm.ParentId)
+	}
+	if fmt.Sprint(got) != fmt.Sprint(tc.expParents) || len(ids) != len(tc.itms) {
+		t.Errorf(">>>>FAILED: expected parents %v, got %v (ids %v)", tc.expParents, got, ids)
+	}
+
+	// added as a single operation, so a single undo removes them all
+	if _, err = r.Undo(); err != nil {
+		t.Fatalf(">>>>FAILED (undo): %v", err)
+	}
+	if all, _ = r.GetAll(); len(all) != 3 {
+		t.Errorf(">>>>FAILED: expected undo to remove the batch, got %v items", len(all))
+	}
+}
+
+type paging_test_case struct {
+	qry    godoo.FullUserQuery
+	expIds []int
+	expErr error
+	name   string
+}
+
+func getPagingTestCases() []paging_test_case {
+	work := byTag("work")
+	return []paging_test_case{{
+		expIds: []int{1, 2, 3, 4, 5},
+		name:   "id order by default",
+	}, {
+		qry:    godoo.FullUserQuery{Descending: true},
+		expIds: []int{5, 4, 3, 2, 1},
+		name:   "descending",
+	}, {
+		qry:    godoo.FullUserQuery{Sort: []godoo.SortKey{godoo.SortByDeadline}},
+		expIds: []int{3, 5, 1, 2, 4},
+		name:   "by deadline, items without one last",
+	}, {
+		qry:    godoo.FullUserQuery{Sort: []godoo.SortKey{godoo.SortByDeadline}, Descending: true},
+		expIds: []int{2, 1, 5, 3, 4},
+		name:   "by deadline descending, items without one still last",
+	}, {
+		qry:    godoo.FullUserQuery{Sort: []godoo.SortKey{godoo.SortByPriority, godoo.SortByBody}, Descending: true},
+		expIds: []int{4, 1, 5, 2, 3},
+		name:   "by priority then body",
+	}, {
+		qry:    godoo.FullUserQuery{Sort: []godoo.SortKey{godoo.SortByBody}},
+		expIds: []int{2, 5, 1, 4, 3},
+		name:   "by body, case insensitive",
+	}, {
+		qry:    godoo.FullUserQuery{Sort: []godoo.SortKey{godoo.SortByCreation}, Descending: true, Limit: 2},
+		expIds: []int{5, 4},
+		name:   "limit counts items, not tags",
+	}, {
+		qry:    godoo.FullUserQuery{Limit: 2, Offset: 2},
+		expIds: []int{3, 4},
+		name:   "offset",
+	}, {
+		qry:    godoo.FullUserQuery{Offset: 4},
+		expIds: []int{5},
+		name:   "offset without a limit",
+	}, {
+		qry:    godoo.FullUserQuery{Limit: 2, Cursor: godoo.NewCursor(godoo.TodoItem{Id: 4})},
+		expIds: []int{5},
+		name:   "cursor",
+	}, {
+		qry:    godoo.FullUserQuery{Limit: 2, Offset: 3, Cursor: godoo.NewCursor(godoo.TodoItem{Id: 1})},
+		expIds: []int{2, 3},
+		name:   "cursor rather than offset",
+	}, {
+		qry:    godoo.FullUserQuery{Sort: []godoo.SortKey{godoo.SortByDeadline}, Limit: 2, Cursor: godoo.NewCursor(godoo.TodoItem{Id: 5, Deadline: parseDate("2022-06-20")})},
+		expIds: []int{1, 2},
+		name:   "cursor by deadline",
+	}, {
+		qry:    godoo.FullUserQuery{Sort: []godoo.SortKey{godoo.SortByDeadline}, Descending: true, Cursor: godoo.NewCursor(godoo.TodoItem{Id: 3, Deadline: parseDate("2022-06-10")})},
+		expIds: []int{4},
+		name:   "cursor by deadline descending, on to items without one",
+	}, {
+		qry:    godoo.FullUserQuery{Sort: []godoo.SortKey{godoo.SortByPriority, godoo.SortByBody}, Descending: true, Limit: 5, Cursor: godoo.NewCursor(godoo.TodoItem{Id: 5, Priority: godoo.Low, Body: "pay rent"})},
+		expIds: []int{2, 3},
+		name:   "cursor by priority then body",
+	}, {
+		qry:    godoo.FullUserQuery{Limit: 2, Cursor: godoo.NewCursor(godoo.TodoItem{Id: 9})},
+		expIds: nil,
+		name:   "cursor past the end",
+	}, {
+		qry:    godoo.FullUserQuery{QueryOptions: work.QueryOptions, QueryData: work.QueryData, Sort: []godoo.SortKey{godoo.SortByDeadline}, Limit: 2},
+		expIds: []int{3, 1},
+		name:   "search results are paged too",
+	}, {
+		qry:    godoo.FullUserQuery{Sort: []godoo.SortKey{"colour"}},
+		expErr: &godoo.InvalidSortKeyError{},
+		name:   "unknown sort key",
+	}, {
+		qry:    godoo.FullUserQuery{Cursor: "nonsense"},
+		expErr: &godoo.InvalidCursorError{},
+		name:   "bad cursor",
+	}}
+}
+
+func seedPagingRepo(t *testing.T) *Repo {
+	r := getInMemDb()
+	seed := []godoo.TodoItem{
+		{CreationDate: parseDate("2022-06-01"), Deadline: parseDate("2022-07-01"), Priority: godoo.Medium, Body: "Plan sprint", Tags: map[string]struct{}{"work": {}, "dev": {}, "planning": {}}},
+		{CreationDate: parseDate("2022-06-02"), Deadline: parseDate("2022-08-01"), Priority: godoo.Low, Body: "buy milk", Tags: map[string]struct{}{"home": {}}},
+		{CreationDate: parseDate("2022-06-03"), Deadline: parseDate("2022-06-10"), Body: "write report", Tags: map[string]struct{}{"work": {}}},
+		{CreationDate: parseDate("2022-06-04"), Priority: godoo.High, Body: "Water plants", Tags: map[string]struct{}{"home": {}, "garden": {}}},
+		{CreationDate: parseDate("2022-06-05"), Deadline: parseDate("2022-06-20"), Priority: godoo.Low, Body: "pay rent"},
+	}
+	for i := range seed {
+		if _, err := r.Add(&seed[i]); err != nil {
+			t.Fatalf("seeding failed: %v", err)
+		}
+	}
+	return r
+}
+
+func TestSortingAndPaging(t *testing.T) {
+	tcs := getPagingTestCases()
+	for _, tc := range tcs {
+		t.Run(tc.name, func(t *testing.T) {
+			runPagingTest(t, tc)
+		})
+	}
+}
+
+func runPagingTest(t *testing.T, tc paging_test_case) {
+	r := seedPagingRepo(t)
+
+	itms, err := r.GetWhere(tc.qry)
+	if (err == nil) != (tc.expErr == nil) {
+		t.Fatalf(">>>>FAILED (err): expected '%v', got '%v'", tc.expErr, err)
+	}
+
+	var got []int
+	for _, itm := range itms {
+		got = append(got, itm.Id)
+	}
+	if fmt.Sprint(got) != fmt.Sprint(tc.expIds) {
+		t.Errorf(">>>>FAILED: expected %v, got %v", tc.expIds, got)
+	}
+	if len(itms) > 0 && itms[0].Id == 1 && len(itms[0].Tags) != 3 {
+		t.Errorf(">>>>FAILED: expected every tag of item 1, got %v", itms[0].Tags)
+	}
+}
+
+// Walks every page with the cursor handed back by GetPage, which
+// should give the same items in the same order as a single query
+func TestCursorPaging(t *testing.T) {
+	sorts := map[string]godoo.FullUserQuery{
+		"by id":                  {},
+		"descending":             {Descending: true},
+		"by deadline":            {Sort: []godoo.SortKey{godoo.SortByDeadline}},
+		"by deadline descending": {Sort: []godoo.SortKey{godoo.SortByDeadline}, Descending: true},
+		"by priority then body":  {Sort: []godoo.SortKey{godoo.SortByPriority, godoo.SortByBody}, Descending: true},
+		"by creation":            {Sort: []godoo.SortKey{godoo.SortByCreation}},
+	}
+	for name, qry := range sorts {
+		t.Run(name, func(t *testing.T) {
+			runCursorPagingTest(t, seedPagingRepo(t), qry, 2)
+		})
+	}
+}
+
+func runCursorPagingTest(t *testing.T, r *Repo, qry godoo.FullUserQuery, limit int) {
+	all, err := r.GetWhere(qry)
+	if err != nil {
+		t.Fatalf(">>>>FAILED: %v", err)
+	}
+
+	var got []godoo.TodoItem
+	qry.Limit = limit
+	for pages := 0; pages <= len(all); pages++ {
+		itms, next, err := godoo.GetPage(r, qry)
+		if err != nil {
+			t.Fatalf(">>>>FAILED: %v", err)
+		}
+		got = append(got, itms...)
+		if next == "" {
+			break
+		}
+		qry.Cursor = next
+	}
+
+	if fmt.Sprint(getIds(got)) != fmt.Sprint(getIds(all)) {
+		t.Errorf(">>>>FAILED: expected %v, got %v", getIds(all), getIds(got))
+	}
+}
+
+func getIds(itms []godoo.TodoItem) []int {
+	var ret []int
+	for _, itm := range itms {
+		ret = append(ret, itm.Id)
+	}
+	return ret
+}
+
+type query_expr_test_case struct {
+	query  string              // parsed into the query's expression
+	qry    godoo.FullUserQuery // expression added to this
+	expIds []int
+	expErr error
+	name   string
+}
+
+func getQueryExprTestCases() []query_expr_test_case {
+	work := byTag("work")
+	return []query_expr_test_case{{
+		query:  "tag:work or tag:home",
+		expIds: []int{1, 2, 3, 4},
+		name:   "or",
+	}, {
+		query:  "done or tag:home and priority:high",
+		expIds: []int{3, 4},
+		name:   "and binds tighter than or",
+	}, {
+		query:  "(done or tag:home) and priority:high",
+		expIds: []int{4},
+		name:   "grouping",
+	}, {
+		query:  "not tag:work",
+		expIds: []int{2, 4, 5},
+		name:   "not keeps untagged items",
+	}, {
+		query:  "not (tag:home or tag:work)",
+		expIds: []int{5},
+		name:   "negated group",
+	}, {
+		query:  "priority:l",
+		expIds: []int{2, 5},
+		name:   "priority by initial",
+	}, {
+		query:  "deadline:2022-06-01:2022-06-30 and not rent",
+		expIds: []int{3},
+		name:   "date range & body",
+	}, {
+		query:  "not done",
+		qry:    godoo.FullUserQuery{QueryOptions: work.QueryOptions, QueryData: work.QueryData},
+		expIds: []int{1},
+		name:   "and-ed with query options",
+	}, {
+		query:  "not done",
+		qry:    godoo.FullUserQuery{Sort: []godoo.SortKey{godoo.SortByPriority}, Descending: true, Limit: 2},
+		expIds: []int{4, 1},
+		name:   "sorted & paged",
+	}, {
+		qry:    godoo.FullUserQuery{Expr: &godoo.QueryExpr{Op: godoo.ExprCond, Field: "colour", Value: "red"}},
+		expErr: &godoo.QuerySyntaxError{},
+		name:   "unknown field",
+	}, {
+		qry:    godoo.FullUserQuery{Expr: &godoo.QueryExpr{Op: godoo.ExprNot}},
+		expErr: &godoo.QuerySyntaxError{},
+		name:   "not without a condition",
+	}}
+}
+
+func TestQueryExpressions(t *testing.T) {
+	tcs := getQueryExprTestCases()
+	for _, tc := range tcs {
+		t.Run(tc.name, func(t *testing.T) {
+			runQueryExprTest(t, tc)
+		})
+	}
+}
+
+func runQueryExprTest(t *testing.T, tc query_expr_test_case) {
+	r := seedPagingRepo(t)
+	if _, err := r.UpdateWhere(byId(3), setComplete(true)); err != nil {
+		t.Fatalf(">>>>FAILED: %v", err)
+	}
+
+	if tc.query != "" {
+		e, err := godoo.ParseQueryExpr(tc.query, "2006-01-02")
+		if err != nil {
+			t.Fatalf(">>>>FAILED: %v", err)
+		}
+		tc.qry.Expr = &e
+	}
+
+	itms, err := r.GetWhere(tc.qry)
+	if (err == nil) != (tc.expErr == nil) {
+		t.Fatalf(">>>>FAILED (err): expected '%v', got '%v'", tc.expErr, err)
+	}
+	if _, ok := err.(*godoo.QuerySyntaxError); err != nil && !ok {
+		t.Errorf(">>>>FAILED: expected a syntax error, got '%v'", err)
+	}
+
+	var got []int
+	for _, itm := range itms {
+		got = append(got, itm.Id)
+	}
+	if fmt.Sprint(got) != fmt.Sprint(tc.expIds) {
+		t.Errorf(">>>>FAILED: expected %v, got %v", tc.expIds, got)
+	}
+}
+
+type tag_filter_test_case struct {
+	tags    []string
+	anyTag  bool
+	limit   int
+	expIds  []int
+	expTags map[int]int // number of tags each item should come back with
+	name    string
+}
+
+func getTagFilterTestCases() []tag_filter_test_case {
+	return []tag_filter_test_case{{
+		tags:    []string{"home"},
+		expIds:  []int{2, 4},
+		expTags: map[int]int{2: 1, 4: 2},
+		name:    "single tag; items keep their other tags",
+	}, {
+		tags:    []string{"work", "dev"},
+		expIds:  []int{1},
+		expTags: map[int]int{1: 3},
+		name:    "all tags",
+	}, {
+		tags: []string{"work", "home"},
+		name: "all tags; none match",
+	}, {
+		tags:    []string{"work", "home"},
+		anyTag:  true,
+		expIds:  []int{1, 2, 3, 4},
+		expTags: map[int]int{1: 3, 2: 1, 3: 1, 4: 2},
+		name:    "any tag",
+	}, {
+		tags:   []string{"planning", "dev", "garden"},
+		anyTag: true,
+		limit:  2,
+		expIds: []int{1, 4},
+		name:   "any tag; items with several matches count once",
+	}}
+}
+
+func TestTagFilters(t *testing.T) {
+	tcs := getTagFilterTestCases()
+	for _, tc := range tcs {
+		t.Run(tc.name, func(t *testing.T) {
+			runTagFilterTest(t, tc)
+		})
+	}
+}
+
+func runTagFilterTest(t *testing.T, tc tag_filter_test_case) {
+	r := seedPagingRepo(t)
+
+	qry := godoo.FullUserQuery{QueryOptions: []godoo.UserQueryOption{{Elem: godoo.ByTag}}, QueryData: godoo.TodoItem{Tags: map[string]struct{}{}}, Limit: tc.limit}
+	for _, tg := range tc.tags {
+		qry.QueryData.Tags[tg] = struct{}{}
+	}
+	if tc.anyTag {
+		qry.QueryOptions = append(qry.QueryOptions, godoo.UserQueryOption{Elem: godoo.ByAnyTag})
+	}
+
+	itms, err := r.GetWhere(qry)
+	if err != nil {
+		t.Fatalf(">>>>FAILED: %v", err)
+	}
+
+	var got []int
+	for _, itm := range itms {
+		got = append(got, itm.Id)
+		if n, ok := tc.expTags[itm.Id]; ok && len(itm.Tags) != n {
+			t.Errorf(">>>>FAILED: expected item %v to have %v tags, got %v", itm.Id, n, itm.Tags)
+		}
+	}
+	if fmt.Sprint(got) != fmt.Sprint(tc.expIds) {
+		t.Errorf(">>>>FAILED: expected %v, got %v", tc.expIds, got)
+	}
+}
@@ -1,29 +1,23 @@
 package sqlite
 
 import (
-	"context"
 	"database/sql"
 	"fmt"
 )
 
-func returnSqliteDb(path string, isNewDb bool) *sql.DB {
-
-	ret, _ := sql.Open("sqlite3", path)
-	if isNewDb {
-		tx, _ := ret.BeginTx(context.Background(), nil)
-		tx.Exec("CREATE TABLE items (id integer primary key autoincrement, " +
-			"parentId integer, " +
-			"creationDate text not null, " +
-			"deadline text not null, " +
-			"body text not null, " +
-			"isComplete boolean default false not null, " +
-			"priority integer default 0 not null);")
-		tx.Exec("CREATE TABLE tags (id integer primary key autoincrement, " +
-			"itemId integer, " +
-			"tag text not null);")
-		tx.Commit()
+// Opens the db & pings it, as sql.Open alone doesn't
+// check whether the db can actually be reached
+func returnSqliteDb(path string) (*sql.DB, error) {
+	ret, err := sql.Open("sqlite3", path)
+	if err != nil {
+		return nil, err
 	}
-	return ret
+
+	if err = ret.Ping(); err != nil {
+		ret.Close()
+		return nil, err
+	}
+	return ret, nil
 }
 
 func GetInsert(tbl int) string {
@@ -0,0 +1,103 @@
+package sqlite
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"regexp"
+	"time"
+
+	godoo "github.com/mundacity/go-doo"
+)
+
+var validOwner = regexp.MustCompile(`^[A-Za-z0-9._@-]{1,64}$`)
+
+// Creates a random token for owner. Only a hash of it is kept, so
+// it can't be shown again.
+func (r *Repo) CreateToken(owner string) (godoo.Token, string, error) {
+	ret := godoo.Token{Owner: owner, CreatedAt: time.Now().UTC().Truncate(time.Second)}
+	if !validOwner.MatchString(owner) {
+		return ret, "", &godoo.InvalidOwnerError{Owner: owner}
+	}
+
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return ret, "", err
+	}
+	token := "gd_" + hex.EncodeToString(b)
+
+	r.Mtx.Lock()
+	defer r.Mtx.Unlock()
+
+	res, err := r.db.Exec(getTokenInsertSql(r.kind), owner, hashToken(token), ret.CreatedAt.Format(time.RFC3339))
+	if err != nil {
+		return ret, "", err
+	}
+	id, err := res.LastInsertId()
+	ret.Id = int(id)
+	return ret, token, err
+}
+
+// Stops the token with the id passed from being used again. Revoking
+// a token that's already been revoked does nothing.
+func (r *Repo) RevokeToken(id int) error {
+	r.Mtx.Lock()
+	defer r.Mtx.Unlock()
+
+	res, err := r.db.Exec(getTokenRevokeSql(r.kind), time.Now().UTC().Format(time.RFC3339), id)
+	if err != nil {
+		return err
+	}
+	if n, err := res.RowsAffected(); err != nil {
+		return err
+	} else if n == 0 {
+		return &godoo.TokenNotFoundError{Id: id}
+	}
+	return nil
+}
+
+// Returns every token, revoked or not, oldest first
+func (r *Repo) Tokens() ([]godoo.Token, error) {
+	r.Mtx.Lock()
+	defer r.Mtx.Unlock()
+
+	rows, err := r.db.Query(getTokenSelectSql(r.kind))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var ret []godoo.Token
+	for rows.Next() {
+		var t godoo.Token
+		var created, revoked string
+		if err = rows.Scan(&t.Id, &t.Owner, &created, &revoked); err != nil {
+			return nil, err
+		}
+		t.CreatedAt, _ = time.Parse(time.RFC3339, created)
+		t.RevokedAt, _ = time.Parse(time.RFC3339, revoked)
+		ret = append(ret, t)
+	}
+	return ret, rows.Err()
+}
+
+func (r *Repo) TokenOwner(token string) (string, error) {
+	if token == "" {
+		return "", &godoo.InvalidTokenError{}
+	}
+
+	r.Mtx.Lock()
+	defer r.Mtx.Unlock()
+
+	var owner string
+	err := r.db.QueryRow(getTokenOwnerSql(r.kind), hashToken(token)).Scan(&owner)
+	if err != nil {
+		return "", &godoo.InvalidTokenError{}
+	}
+	return owner, nil
+}
+
+func hashToken(token string) string {
+	h := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(h[:])
+}
@@ -0,0 +1,184 @@
+package sqlite
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+
+	godoo "github.com/mundacity/go-doo"
+)
+
+func TestTokens(t *testing.T) {
+	r := getInMemDb()
+
+	var ownErr *godoo.InvalidOwnerError
+	if _, _, err := r.CreateToken("alice smith"); !errors.As(err, &ownErr) {
+		t.Errorf(">>>>FAILED: expected an invalid owner error, got %v", err)
+	}
+
+	alice, aTok, err := r.CreateToken("alice")
+	if err != nil {
+		t.Fatalf(">>>>FAILED: %v", err)
+	}
+	_, bTok, _ := r.CreateToken("bob@example.com")
+
+	if owner, err := r.TokenOwner(aTok); err != nil || owner != "alice" {
+		t.Errorf(">>>>FAILED: expected alice, got '%v' (err: %v)", owner, err)
+	}
+	if owner, err := r.TokenOwner(bTok); err != nil || owner != "bob@example.com" {
+		t.Errorf(">>>>FAILED: expected bob, got '%v' (err: %v)", owner, err)
+	}
+
+	var tknErr *godoo.InvalidTokenError
+	if _, err := r.TokenOwner(hashToken(aTok)); !errors.As(err, &tknErr) {
+		t.Errorf(">>>>FAILED: the stored hash shouldn't work as a token; got %v", err)
+	}
+
+	if err := r.RevokeToken(alice.Id); err != nil {
+		t.Fatalf(">>>>FAILED: %v", err)
+	}
+	if _, err := r.TokenOwner(aTok); !errors.As(err, &tknErr) {
+		t.Errorf(">>>>FAILED: revoked token still accepted; got %v", err)
+	}
+	var nfErr *godoo.TokenNotFoundError
+	if err := r.RevokeToken(99); !errors.As(err, &nfErr) {
+		t.Errorf(">>>>FAILED: expected a not found error, got %v", err)
+	}
+
+	tkns, err := r.Tokens()
+	if err != nil || len(tkns) != 2 {
+		t.Fatalf(">>>>FAILED: expected 2 tokens, got %v (err: %v)", tkns, err)
+	}
+	if tkns[0].RevokedAt.IsZero() || !tkns[1].RevokedAt.IsZero() {
+		t.Errorf(">>>>FAILED: only alice's token should be revoked: %+v", tkns)
+	}
+}
+
+type visibility_test_case struct {
+	elem   godoo.UserQueryElement
+	owner  string
+	expIds []int
+	name   string
+}
+
+func getVisibilityTestCases() []visibility_test_case {
+	return []visibility_test_case{{
+		elem:   godoo.ByVisibleTo,
+		owner:  "alice",
+		expIds: []int{1, 2, 4},
+		name:   "own items & shared ones",
+	}, {
+		elem:   godoo.ByVisibleTo,
+		owner:  "bob",
+		expIds: []int{2, 3, 4},
+		name:   "someone else's private items hidden",
+	}, {
+		elem:   godoo.ByOwner,
+		owner:  "alice",
+		expIds: []int{1, 2},
+		name:   "own items only",
+	}, {
+		elem:   godoo.ByVisibleTo,
+		owner:  "carol",
+		expIds: []int{2, 4},
+		name:   "no items of their own",
+	}}
+}
+
+// Items 1 & 2 are alice's, 3 is bob's; 1 & 3 are private
+func seedOwnedRepo(t *testing.T) *Repo {
+	r := getInMemDb()
+	seed := []godoo.TodoItem{
+		{Body: "alice private", Owner: "alice", Visibility: godoo.Private},
+		{Body: "alice shared", Owner: "alice", Visibility: godoo.Shared},
+		{Body: "bob private", Owner: "bob", Visibility: godoo.Private},
+		{Body: "from before auth"},
+	}
+	for i := range seed {
+		seed[i].CreationDate = parseDate("2022-06-01")
+		if _, err := r.Add(&seed[i]); err != nil {
+			t.Fatalf("seeding failed: %v", err)
+		}
+	}
+	return r
+}
+
+func TestVisibility(t *testing.T) {
+	tcs := getVisibilityTestCases()
+	for _, tc := range tcs {
+		t.Run(tc.name, func(t *testing.T) {
+			runVisibilityTest(t, tc)
+		})
+	}
+}
+
+func runVisibilityTest(t *testing.T, tc visibility_test_case) {
+	r := seedOwnedRepo(t)
+
+	qry := godoo.FullUserQuery{QueryOptions: []godoo.UserQueryOption{{Elem: tc.elem}}, QueryData: godoo.TodoItem{Owner: tc.owner}}
+	itms, err := r.GetWhere(qry)
+	if err != nil {
+		t.Fatalf(">>>>FAILED: %v", err)
+	}
+
+	var got []int
+	for _, itm := range itms {
+		got = append(got, itm.Id)
+	}
+	if fmt.Sprint(got) != fmt.Sprint(tc.expIds) {
+		t.Errorf(">>>>FAILED: expected %v, got %v", tc.expIds, got)
+	}
+	t.Logf(">>>>PASSED: %v", tc.name)
+}
+
+func TestVisibilityEdits(t *testing.T) {
+	r := seedOwnedRepo(t)
+	alice := godoo.UserQueryOption{Elem: godoo.ByVisibleTo}
+
+	// limiting the search to what alice can see isn't enough on its own
+	srch := godoo.FullUserQuery{QueryOptions: []godoo.UserQueryOption{alice}, QueryData: godoo.TodoItem{Owner: "alice"}}
+	var nqErr *godoo.NoQueryOptionsError
+	if _, err := r.UpdateWhere(srch, replaceBody("everything")); !errors.As(err, &nqErr) {
+		t.Errorf(">>>>FAILED (edit): expected a no query options error, got %v", err)
+	}
+	if _, err := r.DeleteWhere(srch); !errors.As(err, &nqErr) {
+		t.Errorf(">>>>FAILED (delete): expected a no query options error, got %v", err)
+	}
+
+	share := godoo.FullUserQuery{QueryOptions: []godoo.UserQueryOption{{Elem: godoo.ByVisibility}}, QueryData: godoo.TodoItem{Visibility: godoo.Shared}}
+	srch.QueryOptions = append(srch.QueryOptions, godoo.UserQueryOption{Elem: godoo.ById})
+	srch.QueryData.Id = 1
+	if n, err := r.UpdateWhere(srch, share); err != nil || n != 1 {
+		t.Fatalf(">>>>FAILED: expected 1 item shared, got %v (err: %v)", n, err)
+	}
+
+	itms, _ := r.GetWhere(byId(1))
+	if len(itms) != 1 || itms[0].Visibility != godoo.Shared || itms[0].Owner != "alice" {
+		t.Errorf(">>>>FAILED: expected alice's item to be shared, got %+v", itms)
+	}
+}
+
+func TestPrivateRecurringItems(t *testing.T) {
+	r := getInMemDb()
+	itm := godoo.TodoItem{Body: "pay rent", Recurrence: "1m", Owner: "alice", Visibility: godoo.Private, CreationDate: parseDate("2022-06-01")}
+	if _, err := r.Add(&itm); err != nil {
+		t.Fatalf("seeding failed: %v", err)
+	}
+
+	visibleTo := func(owner string) godoo.FullUserQuery {
+		return godoo.FullUserQuery{QueryOptions: []godoo.UserQueryOption{{Elem: godoo.ByVisibleTo}}, QueryData: godoo.TodoItem{Owner: owner}}
+	}
+	srch := visibleTo("alice")
+	srch.QueryOptions = append(srch.QueryOptions, godoo.UserQueryOption{Elem: godoo.ById})
+	srch.QueryData.Id = 1
+	if _, err := r.UpdateWhere(srch, setComplete(true)); err != nil {
+		t.Fatalf(">>>>FAILED: %v", err)
+	}
+
+	if itms, _ := r.GetWhere(visibleTo("alice")); len(itms) != 2 || itms[1].Owner != "alice" || itms[1].Visibility != godoo.Private {
+		t.Errorf(">>>>FAILED: expected alice to get a private next occurrence, got %+v", itms)
+	}
+	if itms, _ := r.GetWhere(visibleTo("bob")); len(itms) != 0 {
+		t.Errorf(">>>>FAILED: expected bob to see nothing, got %+v", itms)
+	}
+}
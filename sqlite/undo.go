@@ -0,0 +1,208 @@
+package sqlite
+
+import (
+	"context"
+	"database/sql"
+	"time"
+
+	godoo "github.com/mundacity/go-doo"
+	"github.com/mundacity/go-doo/util"
+)
+
+// A single item_history row, as stored
+type history_row struct {
+	id     int
+	itemId int
+	action godoo.HistoryAction
+	before string
+	after  string
+}
+
+func (h history_row) toEntry(client string, op int) (godoo.HistoryEntry, error) {
+	var err error
+	e := godoo.HistoryEntry{Id: h.id, ItemId: h.itemId, Action: h.action, Client: client, Operation: op}
+	if e.Before, err = unmarshalSnapshot(h.before); err != nil {
+		return e, err
+	}
+	e.After, err = unmarshalSnapshot(h.after)
+	return e, err
+}
+
+// Reverts the most recent add, edit or delete made by this repo's client
+func (r *Repo) Undo() ([]godoo.HistoryEntry, error) {
+	return r.undo(r.client)
+}
+
+// Restores every item touched by client's most recent operation to the state
+// it was in beforehand. Nothing is changed if any of them has been changed
+// since. The undo is itself recorded, & the next undo goes back one further.
+func (r *Repo) undo(client string) ([]godoo.HistoryEntry, error) {
+	r.Mtx.Lock()
+	defer r.Mtx.Unlock()
+
+	tx, err := r.db.BeginTx(context.Background(), nil)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	var last int
+	if err = tx.QueryRow(getLastOperationSql(r.kind), client).Scan(&last); err != nil {
+		return nil, err
+	}
+	if last == 0 {
+		return nil, &godoo.NothingToUndoError{}
+	}
+
+	rows, err := getOperationRows(tx, getOperationSelectSql(r.kind), last)
+	if err != nil {
+		return nil, err
+	}
+
+	op, err := r.newOperation(tx, client)
+	if err != nil {
+		return nil, err
+	}
+	op.undoes = last
+
+	var ret []godoo.HistoryEntry
+	for _, row := range rows {
+		if err = r.revert(tx, row, op); err != nil {
+			return nil, err
+		}
+
+		e, err := row.toEntry(client, last)
+		if err != nil {
+			return nil, err
+		}
+		ret = append(ret, e)
+	}
+
+	if err = tx.Commit(); err != nil {
+		return nil, err
+	}
+	return ret, nil
+}
+
+// Puts a single item back the way it was before the change in row
+func (r *Repo) revert(tx *sql.Tx, row history_row, op operation) error {
+	ids := []int{row.itemId}
+
+	current, err := r.getSnapshots(tx, ids)
+	if err != nil {
+		return err
+	}
+	cur, err := marshalSnapshot(current, row.itemId)
+	if err != nil {
+		return err
+	}
+	if cur != row.after {
+		return &godoo.UndoConflictError{ItemId: row.itemId}
+	}
+
+	before, err := unmarshalSnapshot(row.before)
+	if err != nil {
+		return err
+	}
+
+	switch row.action {
+	case godoo.Added:
+		// removing it would leave its children pointing at nothing
+		var n int
+		if err = tx.QueryRow(getChildCountSql(r.kind), row.itemId).Scan(&n); err != nil {
+			return err
+		}
+		if n > 0 {
+			return &godoo.UndoConflictError{ItemId: row.itemId}
+		}
+
+		if _, err = tx.Exec(getSql(godoo.Delete, r.kind, tags), row.itemId); err != nil {
+			return err
+		}
+		if _, err = tx.Exec(getSql(godoo.Delete, r.kind, items), row.itemId); err != nil {
+			return err
+		}
+		return r.recordHistory(tx, op, godoo.Deleted, ids, current, nil)
+
+	case godoo.Updated:
+		if _, err = tx.Exec(getRestoreSql(r.kind), append(getRestoreVals(*before), row.itemId)...); err != nil {
+			return err
+		}
+		if err = r.restoreTags(tx, *before); err != nil {
+			return err
+		}
+		if before.IsComplete != current[row.itemId].IsComplete {
+			if _, err = tx.Exec(getCompletionEventSql(r.kind), row.itemId, before.IsComplete, time.Now().Format(time.RFC3339)); err != nil {
+				return err
+			}
+		}
+
+		restored, err := r.getSnapshots(tx, ids)
+		if err != nil {
+			return err
+		}
+		return r.recordHistory(tx, op, godoo.Updated, ids, current, restored)
+
+	case godoo.Deleted:
+		if err = r.checkParent(tx, before.ParentId, nil); err != nil {
+			return err
+		}
+		if _, err = tx.Exec(getReinsertSql(r.kind), append([]any{row.itemId}, getRestoreVals(*before)...)...); err != nil {
+			return err
+		}
+		if err = r.restoreTags(tx, *before); err != nil {
+			return err
+		}
+
+		restored, err := r.getSnapshots(tx, ids)
+		if err != nil {
+			return err
+		}
+		return r.recordHistory(tx, op, godoo.Added, ids, nil, restored)
+	}
+	return nil
+}
+
+// Replaces the item's tags with those in itm
+func (r *Repo) restoreTags(tx *sql.Tx, itm godoo.TodoItem) error {
+	if _, err := tx.Exec(getSql(godoo.Delete, r.kind, tags), itm.Id); err != nil {
+		return err
+	}
+	for t := range itm.Tags {
+		if _, err := tx.Exec(getSql(godoo.Add, r.kind, tags), itm.Id, t); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Column values for getRestoreSql & getReinsertSql, in the same order
+func getRestoreVals(itm godoo.TodoItem) []any {
+	d := ""
+	if !itm.Deadline.IsZero() {
+		d = util.StringFromDate(itm.Deadline)
+	}
+	c := ""
+	if !itm.CompletedAt.IsZero() {
+		c = itm.CompletedAt.Format(time.RFC3339)
+	}
+	return []any{itm.ParentId, util.StringFromDate(itm.CreationDate), d, itm.Body, itm.IsComplete, int(itm.Priority), itm.Recurrence, c, itm.Owner, string(getVisibility(itm.Visibility))}
+}
+
+func getOperationRows(tx *sql.Tx, opSql string, op int) ([]history_row, error) {
+	rows, err := tx.Query(opSql, op)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var ret []history_row
+	for rows.Next() {
+		var h history_row
+		if err = rows.Scan(&h.id, &h.itemId, &h.action, &h.before, &h.after); err != nil {
+			return nil, err
+		}
+		ret = append(ret, h)
+	}
+	return ret, rows.Err()
+}
@@ -0,0 +1,182 @@
+package sqlite
+
+import (
+	"sort"
+	"strings"
+	"testing"
+
+	godoo "github.com/mundacity/go-doo"
+)
+
+type undo_test_case struct {
+	ops     func(t *testing.T, alice, bob godoo.IRepository) // changes made before alice undoes
+	undos   int
+	expErr  error
+	expItms []godoo.TodoItem // bodies & tags checked, by id
+	name    string
+}
+
+func byTag(tag string) godoo.FullUserQuery {
+	return godoo.FullUserQuery{QueryOptions: []godoo.UserQueryOption{{Elem: godoo.ByTag}}, QueryData: godoo.TodoItem{Tags: map[string]struct{}{tag: {}}}}
+}
+
+func replaceBody(body string) godoo.FullUserQuery {
+	return godoo.FullUserQuery{QueryOptions: []godoo.UserQueryOption{{Elem: godoo.ByBody}, {Elem: godoo.ByReplacement}}, QueryData: godoo.TodoItem{Body: body}}
+}
+
+func mustRun(t *testing.T, err error) {
+	if err != nil {
+		t.Fatalf(">>>>FAILED (setup): %v", err)
+	}
+}
+
+var seededItms = []godoo.TodoItem{
+	{Id: 1, Body: "first", Tags: map[string]struct{}{"work": {}, "dev": {}}},
+	{Id: 2, Body: "second", Tags: map[string]struct{}{"home": {}}},
+	{Id: 3, Body: "third", Tags: map[string]struct{}{"work": {}}},
+}
+
+func getSortedTags(mp map[string]struct{}) string {
+	var tgs []string
+	for t := range mp {
+		if t != "" {
+			tgs = append(tgs, t)
+		}
+	}
+	sort.Strings(tgs)
+	return strings.Join(tgs, ",")
+}
+
+func getUndoTestCases() []undo_test_case {
+	return []undo_test_case{{
+		ops: func(t *testing.T, alice, bob godoo.IRepository) {
+			_, err := alice.Add(&godoo.TodoItem{Body: "typo", CreationDate: parseDate("2022-06-04")})
+			mustRun(t, err)
+		},
+		undos:   1,
+		expItms: seededItms,
+		name:    "undo add",
+	}, {
+		ops: func(t *testing.T, alice, bob godoo.IRepository) {
+			_, err := alice.UpdateWhere(byTag("work"), replaceBody("notes"))
+			mustRun(t, err)
+		},
+		undos:   1,
+		expItms: seededItms,
+		name:    "undo edit of several items",
+	}, {
+		ops: func(t *testing.T, alice, bob godoo.IRepository) {
+			_, err := alice.DeleteWhere(byTag("work"))
+			mustRun(t, err)
+		},
+		undos:   1,
+		expItms: seededItms,
+		name:    "undo delete keeps ids & tags",
+	}, {
+		ops: func(t *testing.T, alice, bob godoo.IRepository) {
+			_, err := alice.UpdateWhere(byId(2), replaceBody("2nd"))
+			mustRun(t, err)
+			_, err = alice.DeleteWhere(byId(2))
+			mustRun(t, err)
+		},
+		undos:   2,
+		expItms: seededItms,
+		name:    "repeated undo goes further back",
+	}, {
+		ops: func(t *testing.T, alice, bob godoo.IRepository) {
+			_, err := alice.UpdateWhere(byId(2), replaceBody("2nd"))
+			mustRun(t, err)
+			_, err = bob.UpdateWhere(byId(3), replaceBody("3rd"))
+			mustRun(t, err)
+		},
+		undos:   1,
+		expItms: []godoo.TodoItem{seededItms[0], seededItms[1], {Id: 3, Body: "3rd", Tags: seededItms[2].Tags}},
+		name:    "only the client's own changes are undone",
+	}, {
+		ops: func(t *testing.T, alice, bob godoo.IRepository) {
+			_, err := alice.UpdateWhere(byId(2), replaceBody("2nd"))
+			mustRun(t, err)
+			_, err = bob.UpdateWhere(byId(2), replaceBody("second item"))
+			mustRun(t, err)
+		},
+		undos:   1,
+		expErr:  &godoo.UndoConflictError{ItemId: 2},
+		expItms: []godoo.TodoItem{seededItms[0], {Id: 2, Body: "second item", Tags: seededItms[1].Tags}, seededItms[2]},
+		name:    "item changed by someone else since",
+	}, {
+		ops:     func(t *testing.T, alice, bob godoo.IRepository) {},
+		undos:   1,
+		expErr:  &godoo.NothingToUndoError{},
+		expItms: seededItms,
+		name:    "nothing to undo",
+	}}
+}
+
+func TestUndo(t *testing.T) {
+	tcs := getUndoTestCases()
+	for _, tc := range tcs {
+		t.Run(tc.name, func(t *testing.T) {
+			runUndoTest(t, tc)
+		})
+	}
+}
+
+func runUndoTest(t *testing.T, tc undo_test_case) {
+	r := seedRepo(t)
+	alice, bob := r.ForClient("alice@laptop"), r.ForClient("bob@desktop")
+	tc.ops(t, alice, bob)
+
+	var err error
+	for i := 0; i < tc.undos; i++ {
+		if _, err = alice.(godoo.IUndoer).Undo(); err != nil {
+			break
+		}
+	}
+	if (err == nil) != (tc.expErr == nil) || (err != nil && err.Error() != tc.expErr.Error()) {
+		t.Errorf(">>>>FAILED: expected error '%v', got '%v'", tc.expErr, err)
+	}
+
+	itms, err := r.GetAll()
+	if err != nil {
+		t.Fatalf(">>>>FAILED: %v", err)
+	}
+	if len(itms) != len(tc.expItms) {
+		t.Fatalf(">>>>FAILED: expected %v items, got %v", len(tc.expItms), len(itms))
+	}
+
+	got := make(map[int]godoo.TodoItem)
+	for _, itm := range itms {
+		got[itm.Id] = itm
+	}
+	for _, exp := range tc.expItms {
+		itm, exists := got[exp.Id]
+		if !exists || itm.Body != exp.Body || getSortedTags(itm.Tags) != getSortedTags(exp.Tags) {
+			t.Errorf(">>>>FAILED: expected item %v to be '%v' %v, got '%v' %v", exp.Id, exp.Body, getSortedTags(exp.Tags), itm.Body, getSortedTags(itm.Tags))
+		}
+	}
+}
+
+func TestUndoCompletionOfRecurringItem(t *testing.T) {
+	r := getInMemDb()
+	itm := godoo.TodoItem{Body: "standup", Recurrence: "1d", CreationDate: parseDate("2022-06-01")}
+	id, _ := r.Add(&itm)
+
+	if _, err := r.UpdateWhere(byId(int(id)), setComplete(true)); err != nil {
+		t.Fatalf(">>>>FAILED: %v", err)
+	}
+	entries, err := r.Undo()
+	if err != nil || len(entries) != 2 {
+		t.Fatalf(">>>>FAILED: expected completion & spawn to be undone, got %v (err: %v)", entries, err)
+	}
+
+	itms, _ := r.GetAll()
+	if len(itms) != 1 || itms[0].IsComplete || !itms[0].CompletedAt.IsZero() {
+		t.Errorf(">>>>FAILED: expected just the original, incomplete item, got %v", itms)
+	}
+
+	var events int
+	r.db.QueryRow("select count(*) from completion_events where itemId = ?", id).Scan(&events)
+	if events != 2 {
+		t.Errorf(">>>>FAILED: expected the undo to add a completion event, got %v events", events)
+	}
+}
@@ -0,0 +1,183 @@
+package srv
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"runtime"
+
+	godoo "github.com/mundacity/go-doo"
+	lg "github.com/mundacity/quick-logger"
+)
+
+type ownerKey struct{}
+
+// Returns the owner of the token the request was sent with, or an
+// empty string if the server doesn't require tokens
+func getOwner(r *http.Request) string {
+	owner, _ := r.Context().Value(ownerKey{}).(string)
+	return owner
+}
+
+// Refuses requests without a valid token, if the server requires them.
+// The token's owner is passed on in the request's context.
+func (h *Handler) requireToken(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if !h.authRequired {
+			next(w, r)
+			return
+		}
+
+		ts, ok := h.Repo.(godoo.ITokenStore)
+		if !ok {
+			lg.Logger.LogWithCallerInfo(lg.Error, "auth required but repo doesn't keep tokens", runtime.Caller)
+			http.Error(w, "auth not available", http.StatusNotImplemented)
+			return
+		}
+
+		owner, err := ts.TokenOwner(godoo.ParseBearerToken(r.Header.Get(godoo.AuthHeader)))
+		if err != nil {
+			code := getErrorStatus(err)
+			lg.Logger.LogWithCallerInfo(lg.Error, fmt.Sprintf("request from %v refused (%v): %v", r.RemoteAddr, code, err), runtime.Caller)
+			http.Error(w, err.Error(), code)
+			return
+		}
+		next(w, r.WithContext(context.WithValue(r.Context(), ownerKey{}, owner)))
+	}
+}
+
+// Limits what a token's owner can see & change to their own
+// items and shared ones. Sharing an item hands it to everyone:
+// anyone can edit or delete it, not just its owner. Only the
+// owner can change who can see it, & new items are private
+// unless sent as shared.
+type scopedRepo struct {
+	godoo.IRepository
+	owner string
+}
+
+// Drops anything the client sent about owners, so they
+// can't widen the search to other people's items
+func (s *scopedRepo) scope(qry godoo.FullUserQuery, ownOnly bool) godoo.FullUserQuery {
+	var opts []godoo.UserQueryOption
+	for _, o := range qry.QueryOptions {
+		if o.Elem != godoo.ByOwner && o.Elem != godoo.ByVisibleTo {
+			opts = append(opts, o)
+		}
+	}
+
+	elem := godoo.ByVisibleTo
+	if ownOnly {
+		elem = godoo.ByOwner
+	}
+	qry.QueryOptions = append(opts, godoo.UserQueryOption{Elem: elem})
+	qry.QueryData.Owner = s.owner
+	return qry
+}
+
+// Strips owner options from an edit; an item's owner never changes
+func unscoped(qry godoo.FullUserQuery) godoo.FullUserQuery {
+	var opts []godoo.UserQueryOption
+	for _, o := range qry.QueryOptions {
+		if o.Elem != godoo.ByOwner && o.Elem != godoo.ByVisibleTo {
+			opts = append(opts, o)
+		}
+	}
+	qry.QueryOptions = opts
+	return qry
+}
+
+func changesVisibility(edtQry godoo.FullUserQuery) bool {
+	for _, o := range edtQry.QueryOptions {
+		if o.Elem == godoo.ByVisibility {
+			return true
+		}
+	}
+	return false
+}
+
+func (s *scopedRepo) canSee(itm *godoo.TodoItem) bool {
+	return itm != nil && (itm.Owner == s.owner || itm.Visibility != godoo.Private)
+}
+
+func (s *scopedRepo) GetAll() ([]godoo.TodoItem, error) {
+	return s.GetWhere(godoo.FullUserQuery{})
+}
+
+// Subtree searches & the child ids of the items found are
+// scoped too, so neither gives away other people's private items
+func (s *scopedRepo) GetWhere(qry godoo.FullUserQuery) ([]godoo.TodoItem, error) {
+	return s.IRepository.GetWhere(s.scope(qry, false))
+}
+
+func (s *scopedRepo) Add(itm *godoo.TodoItem) (int64, error) {
+	itm.Owner = s.owner
+	if itm.Visibility != godoo.Shared {
+		itm.Visibility = godoo.Private
+	}
+	return s.IRepository.Add(itm)
+}
+
+func (s *scopedRepo) UpdateWhere(srchQry, edtQry godoo.FullUserQuery) (int, error) {
+	return s.IRepository.UpdateWhere(s.scope(srchQry, changesVisibility(edtQry)), unscoped(edtQry))
+}
+
+func (s *scopedRepo) UpdateIfUnchanged(srchQry, edtQry godoo.FullUserQuery, versions map[int]int) (int, error) {
+	c, ok := s.IRepository.(godoo.IConditionalUpdater)
+	if !ok {
+		return 0, &godoo.VersionsUnavailableError{}
+	}
+	return c.UpdateIfUnchanged(s.scope(srchQry, changesVisibility(edtQry)), unscoped(edtQry), versions)
+}
+
+func (s *scopedRepo) DeleteWhere(srchQry godoo.FullUserQuery) ([]int, error) {
+	return s.IRepository.DeleteWhere(s.scope(srchQry, false))
+}
+
+// Returns nothing for items the owner can't see, judged by
+// the item as it is now or, if deleted, as it was
+func (s *scopedRepo) History(itemId int) ([]godoo.HistoryEntry, error) {
+	hs, ok := s.IRepository.(godoo.IHistorian)
+	if !ok {
+		return nil, &unavailableError{op: "history"}
+	}
+	entries, err := hs.History(itemId)
+	if err != nil || len(entries) == 0 {
+		return entries, err
+	}
+
+	last := entries[len(entries)-1]
+	itm := last.After
+	if itm == nil {
+		itm = last.Before
+	}
+	if !s.canSee(itm) {
+		return []godoo.HistoryEntry{}, nil
+	}
+	return entries, nil
+}
+
+func (s *scopedRepo) Undo() ([]godoo.HistoryEntry, error) {
+	u, ok := s.IRepository.(godoo.IUndoer)
+	if !ok {
+		return nil, &unavailableError{op: "undo"}
+	}
+	return u.Undo()
+}
+
+func (s *scopedRepo) PreviewUpdate(srchQry, edtQry godoo.FullUserQuery) (godoo.EditPreview, error) {
+	p, ok := s.IRepository.(godoo.IPreviewer)
+	if !ok {
+		return godoo.EditPreview{}, &unavailableError{op: "preview"}
+	}
+	return p.PreviewUpdate(s.scope(srchQry, changesVisibility(edtQry)), unscoped(edtQry))
+}
+
+// Returned when the repo behind a scoped one can't do what was asked
+type unavailableError struct {
+	op string
+}
+
+func (e *unavailableError) Error() string {
+	return fmt.Sprintf("%v not available", e.op)
+}
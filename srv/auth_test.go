@@ -0,0 +1,298 @@
+package srv
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+
+	godoo "github.com/mundacity/go-doo"
+	"github.com/mundacity/go-doo/sqlite"
+	lg "github.com/mundacity/quick-logger"
+)
+
+type auth_request struct {
+	user    string // whose token to send; 'revoked' & 'bogus' send ones that don't work
+	method  string
+	path    string
+	body    any
+	code    int
+	expIds  []int  // for gets
+	expBody string // for anything else
+	name    string
+}
+
+func ownedBy(owner string, opts ...godoo.UserQueryElement) godoo.FullUserQuery {
+	qry := godoo.FullUserQuery{QueryData: godoo.TodoItem{Owner: owner}}
+	for _, o := range opts {
+		qry.QueryOptions = append(qry.QueryOptions, godoo.UserQueryOption{Elem: o})
+	}
+	return qry
+}
+
+func getAuthRequests() []auth_request {
+	byId := func(id int) godoo.FullUserQuery {
+		return godoo.FullUserQuery{QueryOptions: []godoo.UserQueryOption{{Elem: godoo.ById}}, QueryData: godoo.TodoItem{Id: id}}
+	}
+	makePrivate := godoo.FullUserQuery{QueryOptions: []godoo.UserQueryOption{{Elem: godoo.ByVisibility}}, QueryData: godoo.TodoItem{Visibility: godoo.Private}}
+	next := godoo.FullUserQuery{QueryOptions: []godoo.UserQueryOption{{Elem: godoo.ByNextPriority}}}
+
+	return []auth_request{{
+		method: http.MethodGet, path: "/get", body: godoo.FullUserQuery{},
+		code: http.StatusUnauthorized, name: "no token",
+	}, {
+		user: "bogus", method: http.MethodGet, path: "/get", body: godoo.FullUserQuery{},
+		code: http.StatusUnauthorized, name: "unknown token",
+	}, {
+		user: "revoked", method: http.MethodGet, path: "/get", body: godoo.FullUserQuery{},
+		code: http.StatusUnauthorized, name: "revoked token",
+	}, {
+		method: http.MethodGet, path: "/test",
+		code: http.StatusOK, expBody: "ok", name: "test endpoint stays open",
+	}, {
+		user: "alice", method: http.MethodGet, path: "/get", body: godoo.FullUserQuery{},
+		code: http.StatusOK, expIds: []int{1, 2}, name: "own items & shared ones",
+	}, {
+		user: "bob", method: http.MethodGet, path: "/get", body: godoo.FullUserQuery{},
+		code: http.StatusOK, expIds: []int{2, 3}, name: "others' private items hidden",
+	}, {
+		user: "bob", method: http.MethodGet, path: "/get", body: ownedBy("alice", godoo.ByOwner),
+		code: http.StatusOK, expIds: []int{2, 3}, name: "owner options from the client are ignored",
+	}, {
+		user: "alice", method: http.MethodGet, path: "/get", body: next,
+		code: http.StatusOK, expIds: []int{1}, name: "next by priority from own items",
+	}, {
+		user: "bob", method: http.MethodGet, path: "/get", body: next,
+		code: http.StatusOK, expIds: []int{3}, name: "next by priority from visible items",
+	}, {
+		user: "bob", method: http.MethodPut, path: "/edit", body: []godoo.FullUserQuery{byId(1), replace("mine now")},
+		code: http.StatusOK, expBody: "0", name: "can't edit others' private items",
+	}, {
+		user: "bob", method: http.MethodPut, path: "/edit", body: []godoo.FullUserQuery{byId(2), replace("reworded")},
+		code: http.StatusOK, expBody: "1", name: "can edit shared items",
+	}, {
+		user: "bob", method: http.MethodPut, path: "/edit", body: []godoo.FullUserQuery{byId(2), makePrivate},
+		code: http.StatusOK, expBody: "0", name: "only the owner can change visibility",
+	}, {
+		user: "alice", method: http.MethodPut, path: "/edit", body: []godoo.FullUserQuery{byId(2), makePrivate},
+		code: http.StatusOK, expBody: "1", name: "owner changes visibility",
+	}, {
+		user: "bob", method: http.MethodPut, path: "/edit", body: []godoo.FullUserQuery{ownedBy("bob", godoo.ByVisibleTo), replace("everything")},
+		code: http.StatusForbidden, name: "edit needs more than the owner",
+	}, {
+		user: "bob", method: http.MethodDelete, path: "/delete", body: byId(1),
+		code: http.StatusOK, expBody: "null", name: "can't delete others' private items",
+	}, {
+		user: "bob", method: http.MethodDelete, path: "/delete", body: byId(2),
+		code: http.StatusOK, expBody: "[2]", name: "can delete others' shared items",
+	}, {
+		user: "bob", method: http.MethodGet, path: "/history?id=1",
+		code: http.StatusOK, expBody: "[]", name: "no history of others' private items",
+	}}
+}
+
+func replace(body string) godoo.FullUserQuery {
+	return godoo.FullUserQuery{QueryOptions: []godoo.UserQueryOption{{Elem: godoo.ByBody}, {Elem: godoo.ByReplacement}}, QueryData: godoo.TodoItem{Body: body}}
+}
+
+// Items 1 & 2 are alice's, 3 is bob's; only 2 is shared
+func setupAuthServer(t *testing.T) (*FakeSrvContext, *sqlite.Repo, map[string]string) {
+	r, err := sqlite.SetupRepo("", godoo.Sqlite, "2006-01-02", 0)
+	if err != nil {
+		t.Fatalf("couldn't set up repo: %v", err)
+	}
+
+	seed := []godoo.TodoItem{
+		{Body: "alice private", Owner: "alice", Visibility: godoo.Private, Priority: godoo.High},
+		{Body: "alice shared", Owner: "alice", Visibility: godoo.Shared, Priority: godoo.Low},
+		{Body: "bob private", Owner: "bob", Visibility: godoo.Private, Priority: godoo.High},
+	}
+	for i := range seed {
+		seed[i].CreationDate = time.Now()
+		if _, err = r.Add(&seed[i]); err != nil {
+			t.Fatalf("seeding failed: %v", err)
+		}
+	}
+
+	tokens := map[string]string{"bogus": "gd_nothing"}
+	for _, u := range []string{"alice", "bob", "revoked"} {
+		tkn, raw, err := r.CreateToken(u)
+		if err != nil {
+			t.Fatalf("couldn't create token: %v", err)
+		}
+		tokens[u] = raw
+		if u == "revoked" {
+			r.RevokeToken(tkn.Id)
+		}
+	}
+
+	cf := getSrvConfig()
+	cf.Repo, cf.RunPriorityList, cf.AuthRequired = r, false, true
+	f := &FakeSrvContext{}
+	f.SetupServerContext(cf)
+	return f, r, tokens
+}
+
+func TestAuth(t *testing.T) {
+	lg.Logger = lg.NewDummyLogger()
+	tcs := getAuthRequests()
+	for _, tc := range tcs {
+		t.Run(tc.name, func(t *testing.T) {
+			runAuthTest(t, tc)
+		})
+	}
+}
+
+func runAuthTest(t *testing.T, tc auth_request) {
+	f, _, tokens := setupAuthServer(t)
+
+	var b []byte
+	if tc.body != nil {
+		b, _ = json.Marshal(tc.body)
+	}
+	req, _ := http.NewRequest(tc.method, tc.path, bytes.NewReader(b))
+	if tc.user != "" {
+		req.Header.Set(godoo.AuthHeader, godoo.BearerToken(tokens[tc.user]))
+	}
+
+	w := httptest.NewRecorder()
+	f.Server.Handler.ServeHTTP(w, req)
+
+	if w.Code != tc.code {
+		t.Fatalf(">>>>FAIL: http status code mismatch: got %v, expecting %v (%v)", w.Code, tc.code, w.Body.String())
+	}
+	if tc.expIds != nil {
+		var itms []godoo.TodoItem
+		json.NewDecoder(w.Body).Decode(&itms)
+		var ids []int
+		for _, itm := range itms {
+			ids = append(ids, itm.Id)
+		}
+		if fmt.Sprint(ids) != fmt.Sprint(tc.expIds) {
+			t.Errorf(">>>>FAIL: expected items %v, got %v", tc.expIds, ids)
+		}
+	}
+	if tc.expBody != "" && strings.TrimSpace(w.Body.String()) != tc.expBody {
+		t.Errorf(">>>>FAIL: expected '%v', got '%v'", tc.expBody, strings.TrimSpace(w.Body.String()))
+	}
+}
+
+func TestScopedAdd(t *testing.T) {
+	lg.Logger = lg.NewDummyLogger()
+	f, r, tokens := setupAuthServer(t)
+
+	for _, v := range []godoo.Visibility{"", godoo.Shared} {
+		itm := godoo.TodoItem{Body: "bob's new item", CreationDate: time.Now(), Owner: "alice", Visibility: v}
+		b, _ := json.Marshal(itm)
+		req, _ := http.NewRequest(http.MethodPost, "/add", bytes.NewReader(b))
+		req.Header.Set(godoo.AuthHeader, godoo.BearerToken(tokens["bob"]))
+
+		w := httptest.NewRecorder()
+		f.Server.Handler.ServeHTTP(w, req)
+		if w.Code != http.StatusOK {
+			t.Fatalf(">>>>FAIL: add failed (%v): %v", w.Code, w.Body.String())
+		}
+	}
+
+	itms, _ := r.GetWhere(ownedBy("bob", godoo.ByOwner))
+	if len(itms) != 3 || itms[1].Visibility != godoo.Private || itms[2].Visibility != godoo.Shared {
+		t.Errorf(">>>>FAIL: expected bob to own a new private & a new shared item, got %+v", itms)
+	}
+}
+
+type children_request struct {
+	user        string
+	qry         godoo.FullUserQuery
+	expIds      []int
+	expChildren map[int][]int // item id -> child ids
+	name        string
+}
+
+func getChildrenRequests() []children_request {
+	opt := func(elem godoo.UserQueryElement, id int) godoo.FullUserQuery {
+		return godoo.FullUserQuery{QueryOptions: []godoo.UserQueryOption{{Elem: elem}}, QueryData: godoo.TodoItem{Id: id}}
+	}
+
+	return []children_request{{
+		user: "alice", qry: opt(godoo.ById, 2),
+		expIds: []int{2}, expChildren: map[int][]int{2: {4, 5}}, name: "owner sees all children",
+	}, {
+		user: "bob", qry: opt(godoo.ById, 2),
+		expIds: []int{2}, expChildren: map[int][]int{2: {5}}, name: "others' private children hidden",
+	}, {
+		user: "alice", qry: opt(godoo.BySubtree, 2),
+		expIds: []int{2, 4, 5, 6}, expChildren: map[int][]int{2: {4, 5}, 4: {6}}, name: "owner's subtree",
+	}, {
+		user: "bob", qry: opt(godoo.BySubtree, 2),
+		expIds: []int{2, 5}, expChildren: map[int][]int{2: {5}}, name: "subtree stops at others' private items",
+	}, {
+		user: "bob", qry: opt(godoo.BySubtree, 1),
+		expIds: []int{}, name: "no subtree of others' private items",
+	}}
+}
+
+// On top of setupAuthServer: 4 is alice's private child of 2, 5 is
+// bob's shared child of 2, & 6 is alice's shared child of 4
+func TestScopedChildren(t *testing.T) {
+	lg.Logger = lg.NewDummyLogger()
+	tcs := getChildrenRequests()
+	for _, tc := range tcs {
+		t.Run(tc.name, func(t *testing.T) {
+			runScopedChildrenTest(t, tc)
+		})
+	}
+}
+
+func runScopedChildrenTest(t *testing.T, tc children_request) {
+	f, r, tokens := setupAuthServer(t)
+
+	seed := []godoo.TodoItem{
+		{Body: "alice private child", Owner: "alice", Visibility: godoo.Private, ParentId: 2},
+		{Body: "bob shared child", Owner: "bob", Visibility: godoo.Shared, ParentId: 2},
+		{Body: "alice shared grandchild", Owner: "alice", Visibility: godoo.Shared, ParentId: 4},
+	}
+	for i := range seed {
+		seed[i].CreationDate = time.Now()
+		if _, err := r.Add(&seed[i]); err != nil {
+			t.Fatalf("seeding failed: %v", err)
+		}
+	}
+
+	b, _ := json.Marshal(tc.qry)
+	req, _ := http.NewRequest(http.MethodGet, "/get", bytes.NewReader(b))
+	req.Header.Set(godoo.AuthHeader, godoo.BearerToken(tokens[tc.user]))
+	w := httptest.NewRecorder()
+	f.Server.Handler.ServeHTTP(w, req)
+
+	if w.Code != http.StatusOK {
+		t.Fatalf(">>>>FAIL: http status code mismatch: got %v (%v)", w.Code, w.Body.String())
+	}
+
+	var itms []godoo.TodoItem
+	json.NewDecoder(w.Body).Decode(&itms)
+	ids := []int{}
+	children := make(map[int][]int)
+	for _, itm := range itms {
+		ids = append(ids, itm.Id)
+		for id := range itm.ChildItems {
+			children[itm.Id] = append(children[itm.Id], id)
+		}
+		sort.Ints(children[itm.Id])
+	}
+	sort.Ints(ids)
+
+	if fmt.Sprint(ids) != fmt.Sprint(tc.expIds) {
+		t.Errorf(">>>>FAIL: expected items %v, got %v", tc.expIds, ids)
+	}
+	if tc.expChildren == nil {
+		tc.expChildren = map[int][]int{}
+	}
+	if fmt.Sprint(children) != fmt.Sprint(tc.expChildren) {
+		t.Errorf(">>>>FAIL: expected children %v, got %v", tc.expChildren, children)
+	}
+}
@@ -0,0 +1,44 @@
+package srv
+
+import (
+	"fmt"
+	"runtime"
+	"time"
+
+	godoo "github.com/mundacity/go-doo"
+	lg "github.com/mundacity/quick-logger"
+)
+
+// Adds a snapshot of the db to cf.BackupDir every cf.BackupInterval, keeping
+// the newest cf.BackupKeep, until stop is closed. Does nothing if backups
+// aren't configured or the repo can't make them.
+func scheduleBackups(cf godoo.ServerConfigVals, stop <-chan struct{}) {
+	if cf.BackupDir == "" || cf.BackupInterval <= 0 {
+		return
+	}
+
+	b, ok := cf.Repo.(godoo.IBackuper)
+	if !ok {
+		lg.Logger.Log(lg.Warning, "scheduled backups configured but the repo doesn't support them")
+		return
+	}
+
+	lg.Logger.Logf(lg.Info, "backing up to '%v' every %v", cf.BackupDir, cf.BackupInterval)
+	tk := time.NewTicker(cf.BackupInterval)
+	defer tk.Stop()
+
+	for {
+		select {
+		case <-stop:
+			return
+		case t := <-tk.C:
+			// a failed backup is logged & tried again next time round
+			path, removed, err := godoo.TakeSnapshot(b, cf.BackupDir, cf.BackupKeep, t)
+			if err != nil {
+				lg.Logger.LogWithCallerInfo(lg.Error, fmt.Sprintf("scheduled backup failed: %v", err), runtime.Caller)
+				continue
+			}
+			lg.Logger.Logf(lg.Info, "backed up to %v; removed %v old snapshot/s", path, len(removed))
+		}
+	}
+}
@@ -3,8 +3,11 @@ package srv
 import (
 	"encoding/json"
 	"fmt"
+	"net"
 	"net/http"
 	"runtime"
+	"strconv"
+	"strings"
 
 	godoo "github.com/mundacity/go-doo"
 	lg "github.com/mundacity/quick-logger"
@@ -14,13 +17,14 @@ type Handler struct {
 	Repo         godoo.IRepository
 	PriorityList *godoo.PriorityList
 	priorityMode bool
+	authRequired bool
 }
 
 // Returns a new http handler. If runPl is true, then the handler will
 // maintain a priority queue as well.
 func NewHandler(ct godoo.ServerConfigVals) *Handler {
 
-	h := &Handler{Repo: ct.Repo}
+	h := &Handler{Repo: ct.Repo, authRequired: ct.AuthRequired}
 
 	if ct.RunPriorityList {
 		h.priorityMode = true
@@ -67,12 +71,69 @@ func (h *Handler) HandleRequests(w http.ResponseWriter, r *http.Request) {
 		h.EditHandler(w, r)
 	case http.MethodPost:
 		h.AddHandler(w, r)
+	case http.MethodDelete:
+		h.DeleteHandler(w, r)
 	default:
 		lg.Logger.LogWithCallerInfo(lg.Error, "method not allowed", runtime.Caller)
 		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
 	}
 }
 
+// Maps errors caused by invalid user input to 4xx status
+// codes; anything else is treated as a server error
+func getErrorStatus(err error) int {
+	switch err.(type) {
+	case *godoo.NegativeParentIdError, *godoo.ParentNotFoundError, *godoo.SearchSyntaxError,
+		*godoo.InvalidSortKeyError, *godoo.InvalidCursorError, *godoo.QuerySyntaxError, *godoo.VersionTagError,
+		*godoo.InvalidOwnerError:
+		return http.StatusBadRequest
+	case *godoo.FullTextUnavailableError, *godoo.VersionsUnavailableError, *unavailableError:
+		return http.StatusNotImplemented
+	case *godoo.ParentCycleError, *godoo.UndoConflictError, *godoo.VersionConflictError:
+		return http.StatusConflict
+	case *godoo.NothingToUndoError, *godoo.TokenNotFoundError:
+		return http.StatusNotFound
+	case *godoo.InvalidTokenError:
+		return http.StatusUnauthorized
+	case *godoo.NoQueryOptionsError:
+		return http.StatusForbidden
+	}
+	return http.StatusInternalServerError
+}
+
+// Returns a repo that records changes against whoever sent r,
+// if the repo keeps track of that sort of thing. If r was sent
+// with a token, only its owner's items & shared ones are used.
+func (h *Handler) getRepo(r *http.Request) godoo.IRepository {
+	repo := h.Repo
+	if a, ok := h.Repo.(godoo.IAttributer); ok {
+		repo = a.ForClient(getClientName(r))
+	}
+	if owner := getOwner(r); owner != "" {
+		return &scopedRepo{IRepository: repo, owner: owner}
+	}
+	return repo
+}
+
+// Combines the name the client gave, if any, with the address the
+// request came from, e.g. 'alice@laptop (192.168.0.5)'. The owner
+// of the token sent, if any, is used instead of the name given.
+func getClientName(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		host = r.RemoteAddr
+	}
+
+	name := getOwner(r)
+	if name == "" {
+		name = strings.TrimSpace(r.Header.Get(godoo.ClientHeader))
+	}
+	if name == "" {
+		return host
+	}
+	return fmt.Sprintf("%v (%v)", name, host)
+}
+
 func (h *Handler) AddHandler(w http.ResponseWriter, r *http.Request) {
 
 	w.Header().Set("content-type", "application/json")
@@ -95,14 +156,15 @@ func (h *Handler) AddHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	i, err := h.Repo.Add(&td)
+	i, err := h.getRepo(r).Add(&td)
 	if err != nil {
-		lg.Logger.LogWithCallerInfo(lg.Error, fmt.Sprintf("server error: %v", err), runtime.Caller)
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		code := getErrorStatus(err)
+		lg.Logger.LogWithCallerInfo(lg.Error, fmt.Sprintf("add failed (%v): %v", code, err), runtime.Caller)
+		http.Error(w, err.Error(), code)
 		return
 	}
 
-	if h.priorityMode {
+	if h.priorityMode && !td.IsComplete { // e.g. imported; the pl only holds unfinished items
 		if err = h.PriorityList.Add(td); err != nil {
 			// db fine but pl out of sync --> reset pl
 			h.setupPriorityList()
@@ -133,8 +195,9 @@ func (h *Handler) GetHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	// handle get by priority mode/date
-	if h.priorityMode && len(fq.QueryOptions) == 1 {
+	// handle get by priority mode/date; the queue holds
+	// everyone's items, so token owners get theirs from the db
+	if h.priorityMode && len(fq.QueryOptions) == 1 && getOwner(r) == "" {
 
 		itm, done, msg, err := h.handleQueueMode(fq)
 		if err != nil {
@@ -143,6 +206,7 @@ func (h *Handler) GetHandler(w http.ResponseWriter, r *http.Request) {
 		}
 		if done {
 			itms = append(itms, itm)
+			w.Header().Set("ETag", godoo.VersionTag(itms))
 			w.WriteHeader(http.StatusOK)
 			json.NewEncoder(w).Encode(itms)
 			lg.Logger.Logf(lg.Info, "get handler (%v) completed execution", msg)
@@ -150,14 +214,24 @@ func (h *Handler) GetHandler(w http.ResponseWriter, r *http.Request) {
 		}
 	}
 
+	if getOwner(r) != "" {
+		fq = getNextItemQuery(fq)
+	}
+
 	// standard get query
-	itms, err = h.Repo.GetWhere(fq)
+	itms, next, err := godoo.GetPage(h.getRepo(r), fq)
 	if err != nil {
 		lg.Logger.LogWithCallerInfo(lg.Error, fmt.Sprintf("server error: %v", err), runtime.Caller)
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		http.Error(w, err.Error(), getErrorStatus(err))
 		return
 	}
 
+	if next != "" {
+		w.Header().Set(godoo.NextCursorHeader, next)
+	}
+
+	// sent back in If-Match, the edit is refused if any of these items has changed since
+	w.Header().Set("ETag", godoo.VersionTag(itms))
 	w.WriteHeader(http.StatusOK)
 	json.NewEncoder(w).Encode(itms)
 	lg.Logger.Log(lg.Info, "get handler completed execution")
@@ -179,6 +253,29 @@ func (h *Handler) handleQueueMode(fq godoo.FullUserQuery) (itm godoo.TodoItem, d
 	return itm, done, logMsg, err
 }
 
+// Turns a request for the next item by priority or date into a search
+// for it, for when the queue can't be used. Other queries are returned as is.
+func getNextItemQuery(fq godoo.FullUserQuery) godoo.FullUserQuery {
+	if len(fq.QueryOptions) != 1 {
+		return fq
+	}
+
+	next := godoo.FullUserQuery{
+		QueryOptions: []godoo.UserQueryOption{{Elem: godoo.ByCompletion}},
+		QueryData:    godoo.TodoItem{IsComplete: false},
+		Limit:        1,
+	}
+	switch fq.QueryOptions[0].Elem {
+	case godoo.ByNextPriority:
+		next.Sort, next.Descending = []godoo.SortKey{godoo.SortByPriority}, true
+	case godoo.ByNextDate:
+		next.Sort = []godoo.SortKey{godoo.SortByDeadline}
+	default:
+		return fq
+	}
+	return next
+}
+
 // Pops the next item off the queue by priority. If rePush is true, the item is
 // returned to the queue. Can't fully pop until the user marks
 // the item as complete - i.e. via the edit command rather
@@ -251,10 +348,18 @@ func (h *Handler) EditHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	i, err := h.Repo.UpdateWhere(fq[0], fq[1])
+	i, err := h.update(r, fq[0], fq[1])
+	if ce, ok := err.(*godoo.VersionConflictError); ok {
+		// the body lists the conflicting items so the client can say which
+		lg.Logger.LogWithCallerInfo(lg.Error, fmt.Sprintf("edit refused (%v): %v", http.StatusConflict, err), runtime.Caller)
+		w.WriteHeader(http.StatusConflict)
+		json.NewEncoder(w).Encode(ce)
+		return
+	}
 	if err != nil {
-		lg.Logger.LogWithCallerInfo(lg.Error, fmt.Sprintf("server error: %v", err), runtime.Caller)
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		code := getErrorStatus(err)
+		lg.Logger.LogWithCallerInfo(lg.Error, fmt.Sprintf("edit failed (%v): %v", code, err), runtime.Caller)
+		http.Error(w, err.Error(), code)
 		return
 	}
 
@@ -266,3 +371,200 @@ func (h *Handler) EditHandler(w http.ResponseWriter, r *http.Request) {
 	json.NewEncoder(w).Encode(i)
 	lg.Logger.Log(lg.Info, "edit handler completed execution")
 }
+
+// Applies the edit, but only if none of the items it matches has changed
+// since the ETag sent in the If-Match header, if there is one. 'If-Match: *'
+// is the same as leaving the header out.
+func (h *Handler) update(r *http.Request, srchQry, edtQry godoo.FullUserQuery) (int, error) {
+	tag := r.Header.Get("If-Match")
+	if tag == "" || tag == "*" {
+		return h.getRepo(r).UpdateWhere(srchQry, edtQry)
+	}
+
+	versions, err := godoo.ParseVersionTag(tag)
+	if err != nil {
+		return 0, err
+	}
+	c, ok := h.getRepo(r).(godoo.IConditionalUpdater)
+	if !ok {
+		return 0, &godoo.VersionsUnavailableError{}
+	}
+	return c.UpdateIfUnchanged(srchQry, edtQry, versions)
+}
+
+func (h *Handler) DeleteHandler(w http.ResponseWriter, r *http.Request) {
+
+	w.Header().Set("content-type", "application/json")
+
+	var fq godoo.FullUserQuery
+	d := json.NewDecoder(r.Body)
+
+	d.DisallowUnknownFields()
+	err := d.Decode(&fq)
+
+	if err != nil {
+		lg.Logger.LogWithCallerInfo(lg.Error, fmt.Sprintf("bad request: %v", err), runtime.Caller)
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	if len(fq.QueryOptions) == 0 {
+		msg := "operation forbidden; search criteria required"
+		lg.Logger.LogWithCallerInfo(lg.Error, msg, runtime.Caller)
+		http.Error(w, "operation forbidden", http.StatusForbidden)
+		return
+	}
+
+	ids, err := h.getRepo(r).DeleteWhere(fq)
+	if err != nil {
+		code := getErrorStatus(err)
+		lg.Logger.LogWithCallerInfo(lg.Error, fmt.Sprintf("delete failed (%v): %v", code, err), runtime.Caller)
+		http.Error(w, err.Error(), code)
+		return
+	}
+
+	if h.priorityMode {
+		for _, id := range ids {
+			if err = h.PriorityList.Delete(id); err != nil {
+				// completed items aren't in the pl so not found is expected
+				if _, notFound := err.(*godoo.ItemIdNotFoundError); !notFound {
+					h.setupPriorityList()
+					break
+				}
+			}
+		}
+	}
+
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(ids)
+	lg.Logger.Logf(lg.Info, "delete handler completed execution; ids: %v", ids)
+}
+
+// Returns the change history of the item whose id is passed
+// in the query string, e.g. /history?id=3
+func (h *Handler) HistoryHandler(w http.ResponseWriter, r *http.Request) {
+
+	lg.Logger.Logf(lg.Info, "%v request received from %v", r.Method, r.RemoteAddr)
+
+	if r.Method != http.MethodGet {
+		lg.Logger.LogWithCallerInfo(lg.Error, "method not allowed", runtime.Caller)
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	w.Header().Set("content-type", "application/json")
+
+	hs, ok := h.getRepo(r).(godoo.IHistorian)
+	if !ok {
+		lg.Logger.LogWithCallerInfo(lg.Error, "repo doesn't keep history", runtime.Caller)
+		http.Error(w, "history not available", http.StatusNotImplemented)
+		return
+	}
+
+	id, err := strconv.Atoi(r.URL.Query().Get("id"))
+	if err != nil || id < 1 {
+		lg.Logger.LogWithCallerInfo(lg.Error, fmt.Sprintf("bad request: invalid id '%v'", r.URL.Query().Get("id")), runtime.Caller)
+		http.Error(w, "bad request; positive item id required", http.StatusBadRequest)
+		return
+	}
+
+	entries, err := hs.History(id)
+	if err != nil {
+		code := getErrorStatus(err)
+		lg.Logger.LogWithCallerInfo(lg.Error, fmt.Sprintf("history failed (%v): %v", code, err), runtime.Caller)
+		http.Error(w, err.Error(), code)
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(entries)
+	lg.Logger.Logf(lg.Info, "history handler completed execution; id: %v", id)
+}
+
+// Reverts the most recent add, edit or delete made by whoever sent the request
+func (h *Handler) UndoHandler(w http.ResponseWriter, r *http.Request) {
+
+	lg.Logger.Logf(lg.Info, "%v request received from %v", r.Method, r.RemoteAddr)
+
+	if r.Method != http.MethodPost {
+		lg.Logger.LogWithCallerInfo(lg.Error, "method not allowed", runtime.Caller)
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	w.Header().Set("content-type", "application/json")
+
+	u, ok := h.getRepo(r).(godoo.IUndoer)
+	if !ok {
+		lg.Logger.LogWithCallerInfo(lg.Error, "repo doesn't support undo", runtime.Caller)
+		http.Error(w, "undo not available", http.StatusNotImplemented)
+		return
+	}
+
+	entries, err := u.Undo()
+	if err != nil {
+		code := getErrorStatus(err)
+		lg.Logger.LogWithCallerInfo(lg.Error, fmt.Sprintf("undo failed (%v): %v", code, err), runtime.Caller)
+		http.Error(w, err.Error(), code)
+		return
+	}
+
+	if h.priorityMode {
+		h.setupPriorityList()
+	}
+
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(entries)
+	lg.Logger.Logf(lg.Info, "undo handler completed execution; %v changes reverted", len(entries))
+}
+
+// Reports what an edit would change without changing anything. Takes
+// the same search & edit queries as the edit endpoint.
+func (h *Handler) PreviewHandler(w http.ResponseWriter, r *http.Request) {
+
+	lg.Logger.Logf(lg.Info, "%v request received from %v", r.Method, r.RemoteAddr)
+
+	if r.Method != http.MethodPut {
+		lg.Logger.LogWithCallerInfo(lg.Error, "method not allowed", runtime.Caller)
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	w.Header().Set("content-type", "application/json")
+
+	var fq []godoo.FullUserQuery
+	d := json.NewDecoder(r.Body)
+
+	d.DisallowUnknownFields()
+	if err := d.Decode(&fq); err != nil {
+		lg.Logger.LogWithCallerInfo(lg.Error, fmt.Sprintf("bad request: %v", err), runtime.Caller)
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	if len(fq) != 2 {
+		msg := "operation forbidden; two FullUserQuery structs required"
+		lg.Logger.LogWithCallerInfo(lg.Error, msg, runtime.Caller)
+		http.Error(w, "operation forbidden", http.StatusForbidden)
+		return
+	}
+
+	p, ok := h.getRepo(r).(godoo.IPreviewer)
+	if !ok {
+		lg.Logger.LogWithCallerInfo(lg.Error, "repo doesn't support previews", runtime.Caller)
+		http.Error(w, "preview not available", http.StatusNotImplemented)
+		return
+	}
+
+	preview, err := p.PreviewUpdate(fq[0], fq[1])
+	if err != nil {
+		code := getErrorStatus(err)
+		lg.Logger.LogWithCallerInfo(lg.Error, fmt.Sprintf("preview failed (%v): %v", code, err), runtime.Caller)
+		http.Error(w, err.Error(), code)
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(preview)
+	lg.Logger.Logf(lg.Info, "preview handler completed execution; %v items matched", preview.Matched)
+}
@@ -3,12 +3,17 @@ package srv
 import (
 	"bytes"
 	"encoding/json"
+	"errors"
 	"net/http"
 	"net/http/httptest"
+	"path/filepath"
+	"reflect"
 	"testing"
+	"time"
 
 	godoo "github.com/mundacity/go-doo"
 	"github.com/mundacity/go-doo/fake"
+	"github.com/mundacity/go-doo/sqlite"
 	lg "github.com/mundacity/quick-logger"
 )
 
@@ -61,6 +66,12 @@ func getBadJsonTests() []bad_json_request {
 		path:   "/edit",
 		code:   http.StatusBadRequest,
 		name:   "editing with bad json",
+	}, {
+		json:   badJson{Name: "dud", Val: 4},
+		method: http.MethodDelete,
+		path:   "/delete",
+		code:   http.StatusBadRequest,
+		name:   "deleting with bad json",
 	},
 	}
 }
@@ -143,3 +154,475 @@ func runBadJsonTest(t *testing.T, tc bad_json_request) {
 // 		t.Logf(">>>>PASS: http status code match: got %v, expecting %v", w.Code, tc.expectedCode)
 // 	}
 // }
+
+func TestErrorStatusMapping(t *testing.T) {
+	tcs := []struct {
+		err  error
+		code int
+		name string
+	}{
+		{&godoo.NegativeParentIdError{}, http.StatusBadRequest, "negative parent"},
+		{&godoo.ParentNotFoundError{ParentId: 8}, http.StatusBadRequest, "dangling parent"},
+		{&godoo.ParentCycleError{ItemId: 1, ParentId: 3}, http.StatusConflict, "parent cycle"},
+		{&godoo.SearchSyntaxError{Expr: "a AND ("}, http.StatusBadRequest, "bad search expression"},
+		{&godoo.FullTextUnavailableError{}, http.StatusNotImplemented, "no full-text support"},
+		{&godoo.NoQueryOptionsError{}, http.StatusForbidden, "no search criteria"},
+		{&godoo.NothingToUndoError{}, http.StatusNotFound, "nothing to undo"},
+		{&godoo.UndoConflictError{ItemId: 2}, http.StatusConflict, "changed since"},
+		{&godoo.InvalidSortKeyError{Key: "colour"}, http.StatusBadRequest, "bad sort key"},
+		{&godoo.InvalidCursorError{Cursor: "x"}, http.StatusBadRequest, "bad cursor"},
+		{&godoo.QuerySyntaxError{Expr: "tag:work and", Reason: "expected a condition at the end"}, http.StatusBadRequest, "bad query expression"},
+		{&godoo.VersionConflictError{}, http.StatusConflict, "changed since read"},
+		{&godoo.VersionTagError{Tag: "x"}, http.StatusBadRequest, "bad If-Match"},
+		{&godoo.VersionsUnavailableError{}, http.StatusNotImplemented, "no versions"},
+		{&godoo.InvalidTokenError{}, http.StatusUnauthorized, "bad token"},
+		{&godoo.InvalidOwnerError{Owner: "a b"}, http.StatusBadRequest, "bad owner"},
+		{&godoo.TokenNotFoundError{Id: 4}, http.StatusNotFound, "no such token"},
+		{errors.New("disk full"), http.StatusInternalServerError, "anything else"},
+	}
+
+	for _, tc := range tcs {
+		t.Run(tc.name, func(t *testing.T) {
+			if got := getErrorStatus(tc.err); got != tc.code {
+				t.Errorf(">>>>FAIL: got %v, expecting %v", got, tc.code)
+			}
+		})
+	}
+}
+
+type history_request struct {
+	method string
+	path   string
+	code   int
+	name   string
+}
+
+func getHistoryRequests() []history_request {
+	return []history_request{{
+		method: http.MethodGet,
+		path:   "/history?id=3",
+		code:   http.StatusOK,
+		name:   "history of existing item",
+	}, {
+		method: http.MethodGet,
+		path:   "/history",
+		code:   http.StatusBadRequest,
+		name:   "no id",
+	}, {
+		method: http.MethodGet,
+		path:   "/history?id=-3",
+		code:   http.StatusBadRequest,
+		name:   "negative id",
+	}, {
+		method: http.MethodDelete,
+		path:   "/history?id=3",
+		code:   http.StatusMethodNotAllowed,
+		name:   "wrong method",
+	}}
+}
+
+func TestHistoryHandler(t *testing.T) {
+
+	lg.Logger = lg.NewDummyLogger()
+	tcs := getHistoryRequests()
+	for _, tc := range tcs {
+		t.Run(tc.name, func(t *testing.T) {
+			runHistoryTest(t, tc)
+		})
+	}
+}
+
+func runHistoryTest(t *testing.T, tc history_request) {
+
+	w := httptest.NewRecorder()
+
+	f := FakeSrvContext{}
+	f.SetupServerContext(getSrvConfig())
+
+	req, _ := http.NewRequest(tc.method, tc.path, nil)
+	f.handler.HistoryHandler(w, req)
+
+	if w.Code != tc.code {
+		t.Errorf(">>>>FAIL: http status code mismatch: got %v, expecting %v", w.Code, tc.code)
+		return
+	}
+	if w.Code != http.StatusOK {
+		return
+	}
+
+	var entries []godoo.HistoryEntry
+	if err := json.NewDecoder(w.Body).Decode(&entries); err != nil || len(entries) != 1 || entries[0].ItemId != 3 {
+		t.Errorf(">>>>FAIL: unexpected history: %v (err: %v)", entries, err)
+	}
+}
+
+func TestClientName(t *testing.T) {
+	tcs := []struct {
+		header string
+		addr   string
+		exp    string
+		name   string
+	}{
+		{"alice@laptop", "192.168.0.5:53422", "alice@laptop (192.168.0.5)", "named client"},
+		{"", "192.168.0.5:53422", "192.168.0.5", "anonymous client"},
+	}
+
+	for _, tc := range tcs {
+		t.Run(tc.name, func(t *testing.T) {
+			req, _ := http.NewRequest(http.MethodPut, "/edit", nil)
+			req.RemoteAddr = tc.addr
+			req.Header.Set(godoo.ClientHeader, tc.header)
+
+			if got := getClientName(req); got != tc.exp {
+				t.Errorf(">>>>FAIL: got '%v', expecting '%v'", got, tc.exp)
+			}
+		})
+	}
+}
+
+func TestUndoHandler(t *testing.T) {
+	lg.Logger = lg.NewDummyLogger()
+	tcs := []history_request{{
+		method: http.MethodPost,
+		path:   "/undo",
+		code:   http.StatusOK,
+		name:   "undo",
+	}, {
+		method: http.MethodGet,
+		path:   "/undo",
+		code:   http.StatusMethodNotAllowed,
+		name:   "wrong method",
+	}}
+
+	for _, tc := range tcs {
+		t.Run(tc.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			f := FakeSrvContext{}
+			f.SetupServerContext(getSrvConfig())
+
+			req, _ := http.NewRequest(tc.method, tc.path, nil)
+			f.handler.UndoHandler(w, req)
+
+			if w.Code != tc.code {
+				t.Errorf(">>>>FAIL: http status code mismatch: got %v, expecting %v", w.Code, tc.code)
+			}
+		})
+	}
+}
+
+type preview_request struct {
+	method string
+	body   []byte
+	code   int
+	name   string
+}
+
+func TestPreviewHandler(t *testing.T) {
+	lg.Logger = lg.NewDummyLogger()
+	two, _ := json.Marshal([]godoo.FullUserQuery{{}, {}})
+	one, _ := json.Marshal([]godoo.FullUserQuery{{}})
+
+	tcs := []preview_request{{
+		method: http.MethodPut,
+		body:   two,
+		code:   http.StatusOK,
+		name:   "preview",
+	}, {
+		method: http.MethodPut,
+		body:   one,
+		code:   http.StatusForbidden,
+		name:   "missing edit query",
+	}, {
+		method: http.MethodPut,
+		body:   []byte("{"),
+		code:   http.StatusBadRequest,
+		name:   "bad json",
+	}, {
+		method: http.MethodPost,
+		body:   two,
+		code:   http.StatusMethodNotAllowed,
+		name:   "wrong method",
+	}}
+
+	for _, tc := range tcs {
+		t.Run(tc.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			f := FakeSrvContext{}
+			f.SetupServerContext(getSrvConfig())
+
+			req, _ := http.NewRequest(tc.method, "/preview", bytes.NewReader(tc.body))
+			f.handler.PreviewHandler(w, req)
+
+			if w.Code != tc.code {
+				t.Errorf(">>>>FAIL: http status code mismatch: got %v, expecting %v", w.Code, tc.code)
+			}
+		})
+	}
+}
+
+type cursor_request struct {
+	qry     func(all []godoo.TodoItem) godoo.FullUserQuery
+	expNext func(all []godoo.TodoItem) string
+	name    string
+}
+
+func getCursorRequests() []cursor_request {
+	none := func(all []godoo.TodoItem) string { return "" }
+	return []cursor_request{{
+		qry:     func(all []godoo.TodoItem) godoo.FullUserQuery { return godoo.FullUserQuery{Limit: 1} },
+		expNext: func(all []godoo.TodoItem) string { return godoo.NewCursor(all[0]) },
+		name:    "full page",
+	}, {
+		qry: func(all []godoo.TodoItem) godoo.FullUserQuery {
+			return godoo.FullUserQuery{Limit: 1, Cursor: godoo.NewCursor(all[0])}
+		},
+		expNext: func(all []godoo.TodoItem) string { return godoo.NewCursor(all[1]) },
+		name:    "following page",
+	}, {
+		qry: func(all []godoo.TodoItem) godoo.FullUserQuery {
+			return godoo.FullUserQuery{Limit: 2, Cursor: godoo.NewCursor(all[0])}
+		},
+		expNext: none,
+		name:    "last page exactly full",
+	}, {
+		qry:     func(all []godoo.TodoItem) godoo.FullUserQuery { return godoo.FullUserQuery{Limit: 5} },
+		expNext: none,
+		name:    "last page",
+	}, {
+		qry:     func(all []godoo.TodoItem) godoo.FullUserQuery { return godoo.FullUserQuery{} },
+		expNext: none,
+		name:    "not paged",
+	}}
+}
+
+func TestNextCursor(t *testing.T) {
+	lg.Logger = lg.NewDummyLogger()
+	tcs := getCursorRequests()
+	for _, tc := range tcs {
+		t.Run(tc.name, func(t *testing.T) {
+			runNextCursorTest(t, tc)
+		})
+	}
+}
+
+func runNextCursorTest(t *testing.T, tc cursor_request) {
+	r, err := sqlite.SetupRepo("", godoo.Sqlite, "2006-01-02", 0)
+	if err != nil {
+		t.Fatalf("couldn't set up repo: %v", err)
+	}
+	for _, body := range []string{"plan sprint", "draft backlog", "water plants"} {
+		itm := godoo.NewTodoItem(godoo.WithPriorityLevel(godoo.None))
+		itm.CreationDate, itm.Body = time.Now(), body
+		r.Add(itm)
+	}
+	all, _ := r.GetAll()
+
+	cf := getSrvConfig()
+	cf.Repo, cf.RunPriorityList = r, false
+	f := FakeSrvContext{}
+	f.SetupServerContext(cf)
+
+	w := httptest.NewRecorder()
+	b, _ := json.Marshal(tc.qry(all))
+	req, _ := http.NewRequest(http.MethodGet, "/get", bytes.NewReader(b))
+	f.handler.GetHandler(w, req)
+
+	if got, exp := w.Header().Get(godoo.NextCursorHeader), tc.expNext(all); got != exp {
+		t.Errorf(">>>>FAIL: expected next cursor '%v', got '%v'", exp, got)
+	}
+}
+
+type conditional_edit_request struct {
+	ifMatch      func(etag string) string
+	changedSince bool // item edited by someone else after the get
+	code         int
+	expConflicts []int
+	name         string
+}
+
+func getConditionalEditRequests() []conditional_edit_request {
+	return []conditional_edit_request{{
+		ifMatch: func(etag string) string { return etag },
+		code:    http.StatusOK,
+		name:    "unchanged since get",
+	}, {
+		ifMatch:      func(etag string) string { return etag },
+		changedSince: true,
+		code:         http.StatusConflict,
+		expConflicts: []int{1},
+		name:         "changed since get",
+	}, {
+		ifMatch:      func(etag string) string { return "" },
+		changedSince: true,
+		code:         http.StatusOK,
+		name:         "no If-Match",
+	}, {
+		ifMatch:      func(etag string) string { return "*" },
+		changedSince: true,
+		code:         http.StatusOK,
+		name:         "any version",
+	}, {
+		ifMatch: func(etag string) string { return "1:1" },
+		code:    http.StatusBadRequest,
+		name:    "malformed tag",
+	}}
+}
+
+func TestConditionalEdit(t *testing.T) {
+	lg.Logger = lg.NewDummyLogger()
+	tcs := getConditionalEditRequests()
+	for _, tc := range tcs {
+		t.Run(tc.name, func(t *testing.T) {
+			runConditionalEditTest(t, tc)
+		})
+	}
+}
+
+func runConditionalEditTest(t *testing.T, tc conditional_edit_request) {
+	r, err := sqlite.SetupRepo("", godoo.Sqlite, "2006-01-02", 0)
+	if err != nil {
+		t.Fatalf("couldn't set up repo: %v", err)
+	}
+	itm := godoo.NewTodoItem(godoo.WithPriorityLevel(godoo.None))
+	itm.CreationDate, itm.Body = time.Now(), "plan sprint"
+	r.Add(itm)
+
+	cf := getSrvConfig()
+	cf.Repo, cf.RunPriorityList = r, false
+	f := FakeSrvContext{}
+	f.SetupServerContext(cf)
+
+	byId := godoo.FullUserQuery{QueryOptions: []godoo.UserQueryOption{{Elem: godoo.ById}}, QueryData: godoo.TodoItem{Id: 1}}
+	newBody := func(body string) godoo.FullUserQuery {
+		return godoo.FullUserQuery{QueryOptions: []godoo.UserQueryOption{{Elem: godoo.ByBody}, {Elem: godoo.ByReplacement}}, QueryData: godoo.TodoItem{Body: body}}
+	}
+
+	w := httptest.NewRecorder()
+	b, _ := json.Marshal(byId)
+	req, _ := http.NewRequest(http.MethodGet, "/get", bytes.NewReader(b))
+	f.handler.GetHandler(w, req)
+	etag := w.Header().Get("ETag")
+	if etag != `"1:1"` {
+		t.Errorf(">>>>FAIL: expected ETag '\"1:1\"', got '%v'", etag)
+	}
+
+	if tc.changedSince {
+		r.UpdateWhere(byId, newBody("plan sprint with the team"))
+	}
+
+	w = httptest.NewRecorder()
+	b, _ = json.Marshal([]godoo.FullUserQuery{byId, newBody("plan the sprint")})
+	req, _ = http.NewRequest(http.MethodPut, "/edit", bytes.NewReader(b))
+	if h := tc.ifMatch(etag); h != "" {
+		req.Header.Set("If-Match", h)
+	}
+	f.handler.EditHandler(w, req)
+
+	if w.Code != tc.code {
+		t.Errorf(">>>>FAIL: http status code mismatch: got %v, expecting %v", w.Code, tc.code)
+	}
+	if tc.expConflicts != nil {
+		var ce godoo.VersionConflictError
+		json.NewDecoder(w.Body).Decode(&ce)
+		var ids []int
+		for _, c := range ce.Conflicts {
+			ids = append(ids, c.ItemId)
+		}
+		if !reflect.DeepEqual(ids, tc.expConflicts) {
+			t.Errorf(">>>>FAIL: expected conflicts for %v, got %v", tc.expConflicts, ids)
+		}
+	}
+}
+
+// counts backups rather than making them
+type backupRepo struct {
+	godoo.IRepository
+	made chan string
+}
+
+func (b backupRepo) Backup(path string) error {
+	b.made <- path
+	return nil
+}
+
+func (b backupRepo) Restore(path string) error { return nil }
+
+func TestScheduledBackups(t *testing.T) {
+	lg.Logger = lg.NewDummyLogger()
+	rp := backupRepo{made: make(chan string, 10)}
+	cf := godoo.ServerConfigVals{Repo: rp, BackupDir: t.TempDir(), BackupInterval: 5 * time.Millisecond}
+
+	stop := make(chan struct{})
+	done := make(chan struct{})
+	go func() {
+		scheduleBackups(cf, stop)
+		close(done)
+	}()
+
+	for i := 0; i < 2; i++ {
+		select {
+		case p := <-rp.made:
+			if filepath.Dir(p) != cf.BackupDir {
+				t.Errorf(">>>>FAIL: backup made outside the backup dir: %v", p)
+			}
+		case <-time.After(time.Second):
+			t.Fatalf(">>>>FAIL: backup %v wasn't made", i+1)
+		}
+	}
+
+	close(stop)
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Errorf(">>>>FAIL: backups didn't stop")
+	}
+
+	// not configured, so returns straight away
+	cf.BackupInterval = 0
+	scheduleBackups(cf, nil)
+}
+
+// fails every delete with err
+type failingDeleteRepo struct {
+	fake.RepoDud
+	err error
+}
+
+func (f failingDeleteRepo) DeleteWhere(srchQry godoo.FullUserQuery) ([]int, error) {
+	if f.err != nil {
+		return nil, f.err
+	}
+	return f.RepoDud.DeleteWhere(srchQry)
+}
+
+func TestDeleteErrorStatus(t *testing.T) {
+	lg.Logger = lg.NewDummyLogger()
+	tcs := []struct {
+		err  error
+		code int
+		name string
+	}{
+		{nil, http.StatusOK, "deleted"},
+		{&godoo.QuerySyntaxError{Expr: "tag:", Reason: "expected a value"}, http.StatusBadRequest, "bad query"},
+		{&godoo.NoQueryOptionsError{}, http.StatusForbidden, "no search criteria"},
+		{errors.New("disk full"), http.StatusInternalServerError, "anything else"},
+	}
+
+	for _, tc := range tcs {
+		t.Run(tc.name, func(t *testing.T) {
+			cf := getSrvConfig()
+			cf.Repo, cf.RunPriorityList = failingDeleteRepo{err: tc.err}, false
+			f := FakeSrvContext{}
+			f.SetupServerContext(cf)
+
+			b, _ := json.Marshal(godoo.FullUserQuery{QueryOptions: []godoo.UserQueryOption{{Elem: godoo.ById}}, QueryData: godoo.TodoItem{Id: 3}})
+			req, _ := http.NewRequest(http.MethodDelete, "/delete", bytes.NewReader(b))
+			w := httptest.NewRecorder()
+			f.handler.DeleteHandler(w, req)
+
+			if w.Code != tc.code {
+				t.Errorf(">>>>FAIL: http status code mismatch: got %v, expecting %v", w.Code, tc.code)
+			}
+		})
+	}
+}
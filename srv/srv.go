@@ -26,9 +26,13 @@ func (s *SrvContext) SetupServerContext(cf godoo.ServerConfigVals) {
 
 	mux := http.NewServeMux()
 	mux.HandleFunc("/test", s.handler.TestHandler)
-	mux.HandleFunc("/add", s.handler.HandleRequests)
-	mux.HandleFunc("/get", s.handler.HandleRequests)
-	mux.HandleFunc("/edit", s.handler.HandleRequests)
+	mux.HandleFunc("/add", s.handler.requireToken(s.handler.HandleRequests))
+	mux.HandleFunc("/get", s.handler.requireToken(s.handler.HandleRequests))
+	mux.HandleFunc("/edit", s.handler.requireToken(s.handler.HandleRequests))
+	mux.HandleFunc("/delete", s.handler.requireToken(s.handler.HandleRequests))
+	mux.HandleFunc("/history", s.handler.requireToken(s.handler.HistoryHandler))
+	mux.HandleFunc("/undo", s.handler.requireToken(s.handler.UndoHandler))
+	mux.HandleFunc("/preview", s.handler.requireToken(s.handler.PreviewHandler))
 
 	add := fmt.Sprintf(":%v", s.config.Port)
 	s.Server = http.Server{
@@ -38,5 +42,6 @@ func (s *SrvContext) SetupServerContext(cf godoo.ServerConfigVals) {
 }
 
 func (s *SrvContext) Serve() {
+	go scheduleBackups(s.config, nil)
 	log.Fatal(s.Server.ListenAndServe())
 }
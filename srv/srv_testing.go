@@ -20,9 +20,13 @@ func (s *FakeSrvContext) SetupServerContext(cf godoo.ServerConfigVals) {
 
 	mux := http.NewServeMux()
 	mux.HandleFunc("/test", s.handler.TestHandler)
-	mux.HandleFunc("/add", s.handler.HandleRequests)
-	mux.HandleFunc("/get", s.handler.HandleRequests)
-	mux.HandleFunc("/edit", s.handler.HandleRequests)
+	mux.HandleFunc("/add", s.handler.requireToken(s.handler.HandleRequests))
+	mux.HandleFunc("/get", s.handler.requireToken(s.handler.HandleRequests))
+	mux.HandleFunc("/edit", s.handler.requireToken(s.handler.HandleRequests))
+	mux.HandleFunc("/delete", s.handler.requireToken(s.handler.HandleRequests))
+	mux.HandleFunc("/history", s.handler.requireToken(s.handler.HistoryHandler))
+	mux.HandleFunc("/undo", s.handler.requireToken(s.handler.UndoHandler))
+	mux.HandleFunc("/preview", s.handler.requireToken(s.handler.PreviewHandler))
 
 	add := fmt.Sprintf(":%v", s.config.Port)
 	s.Server = http.Server{
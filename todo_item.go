@@ -2,9 +2,18 @@ package godoo
 
 import (
 	"errors"
+	"fmt"
+	"strconv"
 	"time"
 )
 
+// Wrap the matched terms in TodoItem.Snippet so that
+// clients can highlight them however they like
+const (
+	HighlightStart = "\x02"
+	HighlightEnd   = "\x03"
+)
+
 // Function used in TodoItem initialisation to set PriorityLevel
 type PriorityOption func(itm *TodoItem)
 
@@ -18,6 +27,15 @@ const (
 	DateBased
 )
 
+// Who can see an item on a server that requires auth tokens. Items are
+// always visible to their owner.
+type Visibility string
+
+const (
+	Private Visibility = "private"
+	Shared  Visibility = "shared" // visible to everyone using the server
+)
+
 type TodoItem struct {
 	Id           int                 `json:"itemId"`
 	ParentId     int                 `json:"parentId"`
@@ -27,8 +45,16 @@ type TodoItem struct {
 	Priority     PriorityLevel       `json:"priority"`
 	Body         string              `json:"itemText"`
 	IsComplete   bool                `json:"isComplete"`
-	ChildItems   map[int]struct{}    `json:"children"` // map of TodoItem.id with empty struct
+	CompletedAt  time.Time           `json:"completedAt"` // zero unless complete
+	ChildItems   map[int]struct{}    `json:"children"`    // map of TodoItem.id with empty struct
 	Tags         map[string]struct{} `json:"tags"`
+	Recurrence   string              `json:"recurrence,omitempty"` // repeat rule, e.g. '1w'; see SetRecurrence
+	Version      int                 `json:"version,omitempty"`    // goes up by one with every change; 0 if not known
+	Owner        string              `json:"owner,omitempty"`      // whoever added it to a server requiring auth tokens
+	Visibility   Visibility          `json:"visibility,omitempty"` // Shared if not set
+	Source       string              `json:"source,omitempty"`     // set when reading from multiple storage options
+	Rank         float64             `json:"rank,omitempty"`       // full-text relevance; lower is better
+	Snippet      string              `json:"snippet,omitempty"`    // matching text, wrapped in HighlightStart/End
 	Index        int                 // for the implementation of a priority list
 }
 
@@ -104,8 +130,114 @@ func (e *TagAlreadyExistsError) Error() string {
 	return "supplied tag already present"
 }
 
+// Sets how often the item repeats. Rules use the same shorthand as
+// relative dates, plus 'w' for weeks: e.g. '1d', '2w', '1m', '1y', '1m15d'.
+// An empty rule means the item doesn't repeat.
+func (itm *TodoItem) SetRecurrence(rule string) error {
+	if rule != "" {
+		if _, _, _, err := parseRecurrence(rule); err != nil {
+			return err
+		}
+	}
+	itm.Recurrence = rule
+	return nil
+}
+
+// Returns the item that replaces a completed recurring item. Body, tags,
+// priority & parent are copied; the deadline moves on by the recurrence
+// rule until it falls after now, so completing late doesn't leave the
+// next occurrence already overdue. Items without a deadline repeat from now.
+func (itm *TodoItem) NextOccurrence(now time.Time) (TodoItem, error) {
+	y, m, d, err := parseRecurrence(itm.Recurrence)
+	if err != nil {
+		return TodoItem{}, err
+	}
+
+	next := *NewTodoItem(WithPriorityLevel(itm.Priority))
+	next.ParentId = itm.ParentId
+	next.IsChild = itm.IsChild
+	next.Body = itm.Body
+	next.Recurrence = itm.Recurrence
+	next.Owner = itm.Owner
+	next.Visibility = itm.Visibility
+	next.CreationDate = now
+	for t := range itm.Tags {
+		next.Tags[t] = struct{}{}
+	}
+
+	next.Deadline = itm.Deadline
+	if next.Deadline.IsZero() {
+		next.Deadline = now
+	}
+	next.Deadline = next.Deadline.AddDate(y, m, d)
+	for !next.Deadline.After(now) {
+		next.Deadline = next.Deadline.AddDate(y, m, d)
+	}
+	return next, nil
+}
+
+// Splits a rule like '1m2w' into years, months & days
+func parseRecurrence(rule string) (y, m, d int, err error) {
+	n := ""
+	for _, r := range rule {
+		if r >= '0' && r <= '9' {
+			n += string(r)
+			continue
+		}
+
+		v, e := strconv.Atoi(n)
+		if e != nil {
+			return 0, 0, 0, &InvalidRecurrenceError{Rule: rule}
+		}
+		switch r {
+		case 'y':
+			y += v
+		case 'm':
+			m += v
+		case 'w':
+			d += v * 7
+		case 'd':
+			d += v
+		default:
+			return 0, 0, 0, &InvalidRecurrenceError{Rule: rule}
+		}
+		n = ""
+	}
+
+	if n != "" || y+m+d == 0 {
+		return 0, 0, 0, &InvalidRecurrenceError{Rule: rule}
+	}
+	return y, m, d, nil
+}
+
+type InvalidRecurrenceError struct {
+	Rule string
+}
+
+func (e *InvalidRecurrenceError) Error() string {
+	return fmt.Sprintf("invalid recurrence rule '%v'; expected e.g. '1d', '2w', '1m' or '1y'", e.Rule)
+}
+
 type NegativeParentIdError struct{}
 
 func (e *NegativeParentIdError) Error() string {
 	return "supplied ParentId less than zero"
 }
+
+type ParentNotFoundError struct {
+	ParentId int
+}
+
+func (e *ParentNotFoundError) Error() string {
+	return fmt.Sprintf("supplied parent item (id: %v) does not exist", e.ParentId)
+}
+
+// Returned when a parent change would make an item its own ancestor
+type ParentCycleError struct {
+	ItemId   int
+	ParentId int
+}
+
+func (e *ParentCycleError) Error() string {
+	return fmt.Sprintf("item %v can't be a child of item %v; it would become its own ancestor", e.ItemId, e.ParentId)
+}
@@ -0,0 +1,20 @@
+package util
+
+import (
+	"os"
+	"os/user"
+)
+
+// Identifies the user & machine making changes, e.g. 'alice@laptop'
+func ClientName() string {
+	host, err := os.Hostname()
+	if err != nil {
+		host = "unknown"
+	}
+
+	u, err := user.Current()
+	if err != nil || u.Username == "" {
+		return host
+	}
+	return u.Username + "@" + host
+}
@@ -0,0 +1,118 @@
+package godoo
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Implemented by repositories that can refuse an edit when any of the items
+// it matches has changed since it was read. versions maps the id of every
+// item the search matched when read to the version it was at.
+type IConditionalUpdater interface {
+	UpdateIfUnchanged(srchQry, edtQry FullUserQuery, versions map[int]int) (int, error)
+}
+
+// Returns the versions of itms keyed by id, as expected by UpdateIfUnchanged
+func GetVersions(itms []TodoItem) map[int]int {
+	ret := make(map[int]int)
+	for _, itm := range itms {
+		ret[itm.Id] = itm.Version
+	}
+	return ret
+}
+
+// Returns the versions of itms as an ETag, e.g. "1:3,4:1", which the
+// server sends with the results of a get. Sent back in an If-Match
+// header, it makes the edit conditional on none of them changing.
+func VersionTag(itms []TodoItem) string {
+	versions := GetVersions(itms)
+
+	var ids []int
+	for id := range versions {
+		ids = append(ids, id)
+	}
+	sort.Ints(ids)
+
+	var pairs []string
+	for _, id := range ids {
+		pairs = append(pairs, fmt.Sprintf("%v:%v", id, versions[id]))
+	}
+	return `"` + strings.Join(pairs, ",") + `"`
+}
+
+// Reads the item versions back out of a tag made by VersionTag
+func ParseVersionTag(tag string) (map[int]int, error) {
+	ret := make(map[int]int)
+
+	s := strings.TrimSpace(tag)
+	if len(s) < 2 || s[0] != '"' || s[len(s)-1] != '"' {
+		return nil, &VersionTagError{Tag: tag}
+	}
+	s = s[1 : len(s)-1]
+	if s == "" {
+		return ret, nil // nothing matched when read
+	}
+
+	for _, pair := range strings.Split(s, ",") {
+		idStr, vStr, found := strings.Cut(pair, ":")
+		id, err := strconv.Atoi(idStr)
+		if !found || err != nil || id < 1 {
+			return nil, &VersionTagError{Tag: tag}
+		}
+		v, err := strconv.Atoi(vStr)
+		if err != nil || v < 1 {
+			return nil, &VersionTagError{Tag: tag}
+		}
+		ret[id] = v
+	}
+	return ret, nil
+}
+
+// An item that's changed since it was read
+type VersionConflict struct {
+	ItemId   int `json:"itemId"`
+	Expected int `json:"expected"` // version when read; 0 if the search didn't match it then
+	Current  int `json:"current"`  // 0 if it's since been deleted
+}
+
+func (v VersionConflict) Reason() string {
+	if v.Current == 0 {
+		return "deleted since it was read"
+	}
+	if v.Expected == 0 {
+		return "matched the search since it was read"
+	}
+	return fmt.Sprintf("changed since it was read (now version %v; read at version %v)", v.Current, v.Expected)
+}
+
+// Returned when an edit is refused because items it matches have
+// changed since they were read. Nothing is edited.
+type VersionConflictError struct {
+	Conflicts []VersionConflict `json:"conflicts"`
+}
+
+func (e *VersionConflictError) Error() string {
+	var ids []string
+	for _, c := range e.Conflicts {
+		ids = append(ids, strconv.Itoa(c.ItemId))
+	}
+	return fmt.Sprintf("nothing edited; items changed since they were read: %v", strings.Join(ids, ", "))
+}
+
+// Returned when an If-Match header isn't a tag made by VersionTag
+type VersionTagError struct {
+	Tag string
+}
+
+func (e *VersionTagError) Error() string {
+	return fmt.Sprintf("'%v' isn't a valid version tag", e.Tag)
+}
+
+// Returned when an edit is conditional on item versions the repo doesn't keep
+type VersionsUnavailableError struct{}
+
+func (e *VersionsUnavailableError) Error() string {
+	return "item versions aren't kept by this storage option"
+}